@@ -0,0 +1,127 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IngressPolicy controls whether an ingress VIP is allocated for matching Clusters.
+// +kubebuilder:validation:Enum=Enabled;Disabled
+type IngressPolicy string
+
+const (
+	// IngressPolicyEnabled allocates an ingress VIP (the default).
+	IngressPolicyEnabled IngressPolicy = "Enabled"
+	// IngressPolicyDisabled skips ingress VIP allocation.
+	IngressPolicyDisabled IngressPolicy = "Disabled"
+
+	// DefaultPoolKind is the pool kind used when a PoolReference does not set one.
+	DefaultPoolKind = "GlobalInClusterIPPool"
+
+	// DefaultControlPlaneVariable is the ClusterClass variable that receives the control-plane VIP.
+	DefaultControlPlaneVariable = "clusterVip"
+)
+
+// PoolReference points to an IPAM pool.
+type PoolReference struct {
+	// Name of the pool.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Kind of the pool. Only GlobalInClusterIPPool is supported.
+	// +kubebuilder:validation:Enum=GlobalInClusterIPPool
+	// +kubebuilder:default=GlobalInClusterIPPool
+	// +optional
+	Kind string `json:"kind,omitempty"`
+}
+
+// VariableNames lists the ClusterClass variables that receive allocated addresses.
+type VariableNames struct {
+	// ControlPlane is the variable set to the control-plane VIP when the ClusterClass defines it.
+	// Defaults to clusterVip.
+	// +optional
+	ControlPlane string `json:"controlPlane,omitempty"`
+}
+
+// VIPAllocationPolicySpec maps ClusterClasses, namespaces and roles to pools.
+type VIPAllocationPolicySpec struct {
+	// Priority orders policies. Higher values are evaluated first; ties are broken by name.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// ClusterClasses lists the ClusterClass names this policy applies to.
+	// When both ClusterClasses and ClusterClassSelector are empty the policy applies to every class.
+	// +optional
+	ClusterClasses []string `json:"clusterClasses,omitempty"`
+
+	// ClusterClassSelector selects ClusterClasses by label.
+	// +optional
+	ClusterClassSelector *metav1.LabelSelector `json:"clusterClassSelector,omitempty"`
+
+	// NamespaceSelector restricts the policy to Clusters in namespaces with matching labels.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// Roles lists the VIP roles served by this policy.
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:items:Enum=control-plane;ingress
+	Roles []string `json:"roles"`
+
+	// Pools are tried in order; the first pool that exists is used.
+	// +kubebuilder:validation:MinItems=1
+	Pools []PoolReference `json:"pools"`
+
+	// Port is the control-plane port set when the Cluster does not specify one.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// IngressPolicy controls ingress VIP allocation for Clusters matched for the control-plane role.
+	// +optional
+	IngressPolicy IngressPolicy `json:"ingressPolicy,omitempty"`
+
+	// Variables names the ClusterClass variables that receive the allocated addresses.
+	// +optional
+	Variables VariableNames `json:"variables,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=vipallocationpolicies,scope=Cluster,shortName=vap
+// +kubebuilder:printcolumn:name="Priority",type="integer",JSONPath=".spec.priority"
+// +kubebuilder:printcolumn:name="Roles",type="string",JSONPath=".spec.roles"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// VIPAllocationPolicy selects the IP pools used for Clusters.
+type VIPAllocationPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec VIPAllocationPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VIPAllocationPolicyList contains a list of VIPAllocationPolicy.
+type VIPAllocationPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VIPAllocationPolicy `json:"items"`
+}
+
+// AppliesToRole reports whether the policy serves the given role.
+func (p *VIPAllocationPolicy) AppliesToRole(role string) bool {
+	for _, r := range p.Spec.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// ControlPlaneVariable returns the variable that receives the control-plane VIP.
+func (p *VIPAllocationPolicy) ControlPlaneVariable() string {
+	if p.Spec.Variables.ControlPlane != "" {
+		return p.Spec.Variables.ControlPlane
+	}
+	return DefaultControlPlaneVariable
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gorizond/capi-vip-allocator/pkg/config"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// configSource returns the source selected by --config or --config-configmap, or nil when
+// neither is set.
+func configSource(restConfig *rest.Config, file, configMapRef, configMapKey string) (config.Source, error) {
+	switch {
+	case file != "" && configMapRef != "":
+		return nil, fmt.Errorf("--config and --config-configmap are mutually exclusive")
+	case file != "":
+		return config.FileSource(file), nil
+	case configMapRef != "":
+		namespace, name, ok := strings.Cut(configMapRef, "/")
+		if !ok || namespace == "" || name == "" {
+			return nil, fmt.Errorf("--config-configmap must be namespace/name, got %q", configMapRef)
+		}
+		reader, err := client.New(restConfig, client.Options{Scheme: scheme})
+		if err != nil {
+			return nil, fmt.Errorf("create client: %w", err)
+		}
+		return config.ConfigMapSource(reader, types.NamespacedName{Namespace: namespace, Name: name}, configMapKey), nil
+	}
+	return nil, nil
+}
+
+// loadConfig reads and validates the configuration from source. It also returns the raw
+// data so that a watcher can detect changes.
+func loadConfig(ctx context.Context, source config.Source) (*config.Config, []byte, error) {
+	data, err := source(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg, err := config.Load(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, data, nil
+}
@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
+	vipv1alpha1 "github.com/gorizond/capi-vip-allocator/api/v1alpha1"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	"github.com/gorizond/capi-vip-allocator/pkg/config"
 	"github.com/gorizond/capi-vip-allocator/pkg/controller"
+	"github.com/gorizond/capi-vip-allocator/pkg/health"
 	_ "github.com/gorizond/capi-vip-allocator/pkg/metrics" // Import for metrics registration
 	runtimeext "github.com/gorizond/capi-vip-allocator/pkg/runtime"
+	vipwebhook "github.com/gorizond/capi-vip-allocator/pkg/webhook"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -15,9 +25,14 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
+// configWatchInterval is how often --watch-config polls the configuration source.
+const configWatchInterval = 30 * time.Second
+
 var (
 	scheme   = runtime.NewScheme()
 	setupLog logr.Logger
@@ -26,6 +41,7 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(clusterv1.AddToScheme(scheme))
+	utilruntime.Must(vipv1alpha1.AddToScheme(scheme))
 }
 
 func main() {
@@ -38,6 +54,27 @@ func main() {
 		enableRuntimeExt     bool
 		runtimeExtName       string
 		enableReconciler     bool
+		enableClusterWebhook bool
+		webhookPort          int
+		webhookCertDir       string
+		manualVIPCIDRs       string
+		enablePoolWebhook    bool
+		poolWebhookWarnOnly  bool
+		enableMutatingHook   bool
+		mutatingHookTimeout  time.Duration
+		runtimeExtPending    string
+		runtimeExtProfiles   string
+		runtimeExtHooks      string
+		runtimeExtTimeouts   string
+		runtimeExtPolicies   string
+		runtimeExtNSSelector string
+		runtimeExtCertDir    string
+		runtimeExtClientCA   string
+		shadowMode           bool
+		configFile           string
+		configMapRef         string
+		configMapKey         string
+		watchConfig          bool
 	)
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
@@ -47,7 +84,29 @@ func main() {
 	flag.IntVar(&runtimeExtPort, "runtime-extension-port", 9443, "The port for the runtime extension server.")
 	flag.BoolVar(&enableRuntimeExt, "enable-runtime-extension", true, "Enable CAPI Runtime Extension server for BeforeClusterCreate hook.")
 	flag.StringVar(&runtimeExtName, "runtime-extension-name", "vip-allocator", "The name of the runtime extension handler (must not contain dots).")
+	flag.StringVar(&runtimeExtPending, "runtime-extension-pending-policy", "retry", "How GeneratePatches answers while a VIP is pending: retry (fail so the topology controller retries) or skip (succeed without VIP patches).")
+	flag.StringVar(&runtimeExtProfiles, "runtime-extension-patch-profiles", "", "Comma-separated built-in ControlPlane patch profiles for GeneratePatches: rke2, kubeadm (empty disables them).")
+	flag.StringVar(&runtimeExtHooks, "runtime-extension-hooks", "", "Comma-separated hooks advertised by discovery: GeneratePatches, ValidateTopology, BeforeClusterDelete, AfterClusterUpgrade (empty advertises all).")
+	flag.StringVar(&runtimeExtTimeouts, "runtime-extension-hook-timeouts", "", "Comma-separated Hook=seconds discovery timeouts, e.g. GeneratePatches=10.")
+	flag.StringVar(&runtimeExtPolicies, "runtime-extension-hook-failure-policies", "", "Comma-separated Hook=Fail|Ignore discovery failure policies, e.g. GeneratePatches=Ignore.")
+	flag.StringVar(&runtimeExtNSSelector, "runtime-extension-namespace-selector", "", "Label selector for Cluster namespaces served by the runtime extension; keep in sync with the ExtensionConfig namespaceSelector (empty serves all).")
+	flag.StringVar(&runtimeExtCertDir, "runtime-extension-cert-dir", "/tmp/runtime-extension/serving-certs", "Directory containing tls.crt and tls.key for the runtime extension server; reloaded on change.")
+	flag.StringVar(&runtimeExtClientCA, "runtime-extension-client-ca-file", "", "CA bundle used to verify client certificates on the runtime extension server (empty accepts any client).")
 	flag.BoolVar(&enableReconciler, "enable-reconciler", false, "Enable reconciler controller (fallback mode, not recommended with runtime extension).")
+	flag.BoolVar(&enableClusterWebhook, "enable-cluster-webhook", false, "Enable the validating admission webhook for Cluster control plane endpoints.")
+	flag.IntVar(&webhookPort, "webhook-port", 9444, "The port for the admission webhook server.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs", "Directory containing tls.crt and tls.key for the admission webhook server.")
+	flag.StringVar(&manualVIPCIDRs, "manual-vip-allowed-cidrs", "", "Comma-separated CIDRs manual control plane hosts must fall into (empty allows any address).")
+	flag.BoolVar(&enablePoolWebhook, "enable-pool-webhook", false, "Enable the validating admission webhook for VIP-labelled GlobalInClusterIPPools.")
+	flag.BoolVar(&poolWebhookWarnOnly, "pool-webhook-warn-only", false, "Report pool validation problems as admission warnings instead of rejecting.")
+	flag.BoolVar(&enableMutatingHook, "enable-mutating-webhook", false, "Enable the mutating admission webhook that injects the control plane VIP on Cluster create (implies --enable-reconciler).")
+	flag.BoolVar(&shadowMode, "shadow-mode", false, "Only report the pool and address each allocation would use (events, logs, metrics) without creating IPAddressClaims or patching Clusters; the vip.capi.gorizond.io/shadow annotation overrides it per Cluster.")
+	flag.DurationVar(&mutatingHookTimeout, "mutating-webhook-timeout", 5*time.Second, "How long the mutating webhook waits for an IP before admitting the Cluster unchanged.")
+
+	flag.StringVar(&configFile, "config", "", "Path to an AllocatorConfig file; flags given on the command line override its values.")
+	flag.StringVar(&configMapRef, "config-configmap", "", "namespace/name of a ConfigMap holding the AllocatorConfig, read instead of --config.")
+	flag.StringVar(&configMapKey, "config-configmap-key", config.DefaultConfigMapKey, "Key of the AllocatorConfig in the --config-configmap ConfigMap.")
+	flag.BoolVar(&watchConfig, "watch-config", false, "Restart the manager when the configuration file or ConfigMap changes to a valid new configuration.")
 
 	opts := zap.Options{Development: true}
 	opts.BindFlags(flag.CommandLine)
@@ -56,32 +115,94 @@ func main() {
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 	setupLog = ctrl.Log.WithName("setup")
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	restConfig := ctrl.GetConfigOrDie()
+	source, err := configSource(restConfig, configFile, configMapRef, configMapKey)
+	if err != nil {
+		setupLog.Error(err, "invalid configuration source")
+		os.Exit(1)
+	}
+	if watchConfig && source == nil {
+		setupLog.Error(errors.New("--watch-config requires --config or --config-configmap"), "invalid configuration source")
+		os.Exit(1)
+	}
+
+	cfg := &config.Config{}
+	var rawConfig []byte
+	if source != nil {
+		if cfg, rawConfig, err = loadConfig(context.Background(), source); err != nil {
+			setupLog.Error(err, "unable to load configuration")
+			os.Exit(1)
+		}
+		if err := cfg.ApplyFlags(flag.CommandLine); err != nil {
+			setupLog.Error(err, "unable to apply configuration")
+			os.Exit(1)
+		}
+		if err := allocator.Configure(cfg.AllocatorSettings()); err != nil {
+			setupLog.Error(err, "unable to apply allocation settings")
+			os.Exit(1)
+		}
+		setupLog.Info("configuration loaded", "file", configFile, "configMap", configMapRef, "labelDomain", allocator.Domain())
+		setupLog.V(1).Info("effective configuration", "config", cfg.Dump())
+	}
+
+	// Allocators with different label domains must not share a leader election lease
+	leaderElectionID := "capi-vip-allocator.gorizond.io"
+	if allocator.Domain() != allocator.DefaultDomain {
+		leaderElectionID = "capi-vip-allocator." + allocator.Domain()
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme: scheme,
 		Metrics: metricsserver.Options{
 			BindAddress: metricsAddr,
 		},
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port:    webhookPort,
+			CertDir: webhookCertDir,
+		}),
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "capi-vip-allocator.gorizond.io",
+		LeaderElectionID:       leaderElectionID,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	reconciler := &controller.ClusterReconciler{
+		Client:      mgr.GetClient(),
+		APIReader:   mgr.GetAPIReader(),
+		Scheme:      mgr.GetScheme(),
+		Logger:      ctrl.Log.WithName("controllers").WithName("Cluster"),
+		Recorder:    mgr.GetEventRecorderFor("capi-vip-allocator"),
+		DefaultPort: int32(defaultPort),
+		Shadow:      shadowMode,
+		// Zero keeps the reconciler defaults
+		RequeueDelay:       cfg.RequeueDelay(),
+		ShadowResyncPeriod: cfg.ShadowResyncPeriod(),
+	}
+
+	// The quota gauges are read from the cache at scrape time
+	ctrlmetrics.Registry.MustRegister(&allocator.QuotaCollector{
+		Client: mgr.GetClient(),
+		Logger: ctrl.Log.WithName("metrics").WithName("quota"),
+	})
+
+	if shadowMode {
+		setupLog.Info("shadow mode enabled - allocations are only reported, no IPAddressClaims are created and no Clusters are patched")
+	}
+
+	// The mutating webhook creates claims without ownerReferences; the reconciler adopts them
+	if enableMutatingHook && !enableReconciler {
+		setupLog.Info("mutating webhook enabled - enabling reconciler to adopt claims and finish slow allocations")
+		enableReconciler = true
+	}
+
 	// Start Reconciler controller only if explicitly enabled
 	// WARNING: Reconciler creates race condition with BeforeClusterCreate hook
 	// Only use reconciler for clusters created without runtime extension
 	if enableReconciler {
 		setupLog.Info("reconciler enabled - this may cause race conditions with runtime extension!")
-		reconciler := &controller.ClusterReconciler{
-			Client:      mgr.GetClient(),
-			Scheme:      mgr.GetScheme(),
-			Logger:      ctrl.Log.WithName("controllers").WithName("Cluster"),
-			DefaultPort: int32(defaultPort),
-		}
-
 		if err := reconciler.SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "Cluster")
 			os.Exit(1)
@@ -90,6 +211,47 @@ func main() {
 		setupLog.Info("reconciler disabled - VIP allocation via BeforeClusterCreate hook only")
 	}
 
+	if enableClusterWebhook {
+		allowedCIDRs, err := vipwebhook.ParseCIDRs(strings.Split(manualVIPCIDRs, ","))
+		if err != nil {
+			setupLog.Error(err, "invalid --manual-vip-allowed-cidrs")
+			os.Exit(1)
+		}
+
+		setupLog.Info("cluster validating webhook enabled", "port", webhookPort, "allowedCIDRs", manualVIPCIDRs)
+		validator := &vipwebhook.ClusterValidator{
+			Client:       mgr.GetClient(),
+			Logger:       ctrl.Log.WithName("webhooks").WithName("Cluster"),
+			AllowedCIDRs: allowedCIDRs,
+		}
+		if err := validator.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Cluster")
+			os.Exit(1)
+		}
+	}
+
+	if enablePoolWebhook {
+		setupLog.Info("pool validating webhook enabled", "port", webhookPort, "warnOnly", poolWebhookWarnOnly)
+		poolValidator := &vipwebhook.PoolValidator{
+			Client:   mgr.GetClient(),
+			Logger:   ctrl.Log.WithName("webhooks").WithName("GlobalInClusterIPPool"),
+			WarnOnly: poolWebhookWarnOnly,
+		}
+		poolValidator.SetupWithManager(mgr)
+	}
+
+	if enableMutatingHook {
+		setupLog.Info("cluster mutating webhook enabled", "port", webhookPort, "timeout", mutatingHookTimeout.String())
+		defaulter := &controller.ClusterDefaulter{
+			Reconciler: reconciler,
+			Timeout:    mutatingHookTimeout,
+		}
+		if err := defaulter.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterDefaulter")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -98,23 +260,87 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if err := mgr.AddReadyzCheck("ipam-resources", health.IPAMResources(mgr.GetRESTMapper())); err != nil {
+		setupLog.Error(err, "unable to set up ready check", "check", "ipam-resources")
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("informer-cache", health.CacheSynced(mgr.GetCache())); err != nil {
+		setupLog.Error(err, "unable to set up ready check", "check", "informer-cache")
+		os.Exit(1)
+	}
 
 	// Start Runtime Extension server (required for VIP allocation)
 	if enableRuntimeExt {
-		setupLog.Info("runtime extension enabled", "port", runtimeExtPort, "name", runtimeExtName)
-		certDir := "/tmp/runtime-extension/serving-certs"
-		extServer := runtimeext.NewServer(mgr.GetClient(), ctrl.Log.WithName("runtime-extension"), runtimeExtPort, certDir, runtimeExtName)
+		pendingPolicy, err := runtimeext.ParsePendingPolicy(runtimeExtPending)
+		if err != nil {
+			setupLog.Error(err, "invalid --runtime-extension-pending-policy")
+			os.Exit(1)
+		}
+
+		patchProfiles, err := runtimeext.ParsePatchProfiles(strings.Split(runtimeExtProfiles, ","))
+		if err != nil {
+			setupLog.Error(err, "invalid --runtime-extension-patch-profiles")
+			os.Exit(1)
+		}
+
+		hookSettings, err := runtimeext.ParseHookSettings(strings.Split(runtimeExtHooks, ","), strings.Split(runtimeExtTimeouts, ","), strings.Split(runtimeExtPolicies, ","))
+		if err != nil {
+			setupLog.Error(err, "invalid runtime extension hook settings")
+			os.Exit(1)
+		}
+
+		namespaceSelector, err := labels.Parse(runtimeExtNSSelector)
+		if err != nil {
+			setupLog.Error(err, "invalid --runtime-extension-namespace-selector")
+			os.Exit(1)
+		}
+
+		setupLog.Info("runtime extension enabled", "port", runtimeExtPort, "name", runtimeExtName, "pendingPolicy", pendingPolicy, "patchProfiles", patchProfiles, "hooks", hookSettings, "namespaceSelector", namespaceSelector.String())
+		extServer := runtimeext.NewServer(mgr.GetClient(), ctrl.Log.WithName("runtime-extension"), runtimeExtPort, runtimeExtCertDir, runtimeext.Options{
+			ExtensionName:     runtimeExtName,
+			PendingPolicy:     pendingPolicy,
+			PatchProfiles:     patchProfiles,
+			DefaultPort:       int32(defaultPort),
+			Hooks:             hookSettings,
+			NamespaceSelector: namespaceSelector,
+			ClientCAFile:      runtimeExtClientCA,
+			Shadow:            shadowMode,
+			Recorder:          mgr.GetEventRecorderFor("capi-vip-allocator"),
+			APIReader:         mgr.GetAPIReader(),
+		})
 
 		if err := mgr.Add(extServer); err != nil {
 			setupLog.Error(err, "unable to add runtime extension server to manager")
 			os.Exit(1)
 		}
+		if err := mgr.AddReadyzCheck("runtime-extension", extServer.ReadyzCheck); err != nil {
+			setupLog.Error(err, "unable to set up ready check", "check", "runtime-extension")
+			os.Exit(1)
+		}
 	} else {
 		setupLog.Info("runtime extension disabled - no VIP allocation will occur!")
 	}
 
+	if watchConfig {
+		setupLog.Info("watching configuration for changes", "interval", configWatchInterval.String())
+		watcher := &config.Watcher{
+			Source:   source,
+			Interval: configWatchInterval,
+			Logger:   ctrl.Log.WithName("config"),
+			Current:  rawConfig,
+		}
+		if err := mgr.Add(watcher); err != nil {
+			setupLog.Error(err, "unable to add configuration watcher to manager")
+			os.Exit(1)
+		}
+	}
+
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		if errors.Is(err, config.ErrChanged) {
+			// Exit cleanly so the pod restarts with the new configuration
+			os.Exit(0)
+		}
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
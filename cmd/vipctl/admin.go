@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+
+	"github.com/gorizond/capi-vip-allocator/pkg/admin"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// adminFlags are shared by the subcommands that change VIP allocations.
+type adminFlags struct {
+	clusterFlags
+	role   string
+	yes    bool
+	dryRun bool
+}
+
+func (f *adminFlags) register(flags *flag.FlagSet) {
+	f.clusterFlags.register(flags)
+	flags.StringVar(&f.role, "role", allocator.ControlPlaneRole, "VIP role: control-plane or ingress.")
+	flags.BoolVar(&f.yes, "yes", false, "Apply the changes; without it the planned changes are only printed.")
+	flags.BoolVar(&f.dryRun, "dry-run", false, "Print the planned changes without applying them, even with --yes.")
+}
+
+// parse validates the flags and the <namespace>/<cluster> argument.
+func (f *adminFlags) parse(name string, flags *flag.FlagSet, args []string, stderr io.Writer) (types.NamespacedName, int) {
+	if err := flags.Parse(args); err != nil {
+		return types.NamespacedName{}, 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return types.NamespacedName{}, 2
+	}
+	namespace, cluster, ok := strings.Cut(flags.Arg(0), "/")
+	if !ok || namespace == "" || cluster == "" {
+		fmt.Fprintf(stderr, "vipctl %s: expected <namespace>/<cluster>, got %q\n", name, flags.Arg(0))
+		return types.NamespacedName{}, 2
+	}
+	if f.role != allocator.ControlPlaneRole && f.role != allocator.IngressRole {
+		fmt.Fprintf(stderr, "vipctl %s: unknown role %q\n", name, f.role)
+		return types.NamespacedName{}, 2
+	}
+	return types.NamespacedName{Namespace: namespace, Name: cluster}, 0
+}
+
+// run plans the operation and applies it when confirmed.
+func (f *adminFlags) run(name string, stdout, stderr io.Writer, plan func(ctx context.Context, a *admin.Admin) (*admin.Operation, error)) int {
+	c, err := f.client()
+	if err != nil {
+		fmt.Fprintf(stderr, "vipctl %s: %v\n", name, err)
+		return 1
+	}
+	ctx := context.Background()
+	op, err := plan(ctx, admin.New(c))
+	if err != nil {
+		fmt.Fprintf(stderr, "vipctl %s: %v\n", name, err)
+		return 1
+	}
+
+	if f.dryRun || !f.yes {
+		fmt.Fprintln(stdout, "Planned changes:")
+		if err := op.WritePlan(stdout); err != nil {
+			fmt.Fprintf(stderr, "vipctl %s: %v\n", name, err)
+			return 1
+		}
+		if f.dryRun {
+			return 0
+		}
+		fmt.Fprintf(stderr, "vipctl %s: nothing changed, re-run with --yes to apply\n", name)
+		return 1
+	}
+
+	if err := op.Apply(ctx, stdout); err != nil {
+		fmt.Fprintf(stderr, "vipctl %s: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+func adminUsage(flags *flag.FlagSet, stderr io.Writer, usage string, description ...string) func() {
+	return func() {
+		fmt.Fprintln(stderr, "Usage: vipctl "+usage)
+		fmt.Fprintln(stderr)
+		for _, line := range description {
+			fmt.Fprintln(stderr, line)
+		}
+		fmt.Fprintln(stderr)
+		flags.PrintDefaults()
+	}
+}
+
+// runRelease implements "vipctl release".
+func runRelease(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("release", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var f adminFlags
+	f.register(flags)
+	flags.Usage = adminUsage(flags, stderr, "release [--role ROLE] [--dry-run] [--yes] <namespace>/<cluster>",
+		"Deletes the role's IPAddressClaim, returning the address to its pool, and removes the address",
+		"from the Cluster. The reconciler allocates a new VIP unless the role is disabled, the Cluster",
+		"is in shadow mode or it is being deleted.")
+	key, code := f.parse("release", flags, args, stderr)
+	if code != 0 {
+		return code
+	}
+	return f.run("release", stdout, stderr, func(ctx context.Context, a *admin.Admin) (*admin.Operation, error) {
+		return a.PlanRelease(ctx, key, f.role)
+	})
+}
+
+// runReassign implements "vipctl reassign".
+func runReassign(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("reassign", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var f adminFlags
+	f.register(flags)
+	address := flags.String("address", "", "The address to assign (required).")
+	pool := flags.String("pool", "", "The pool holding the address (defaults to the pool of the current claim, then the matching pool).")
+	defaultPort := flags.Int("default-port", 6443, "Control plane port to set when the Cluster has none.")
+	flags.Usage = adminUsage(flags, stderr, "reassign --address IP [--pool NAME] [--role ROLE] [--dry-run] [--yes] <namespace>/<cluster>",
+		"Moves the role's VIP to a specific address: deletes the current claim and IPAddress, creates an",
+		"IPAddress holding the address for the claim, recreates the claim and patches the Cluster.")
+	key, code := f.parse("reassign", flags, args, stderr)
+	if code != 0 {
+		return code
+	}
+	if _, err := netip.ParseAddr(*address); err != nil {
+		fmt.Fprintf(stderr, "vipctl reassign: --address must be an IP address, got %q\n", *address)
+		return 2
+	}
+	return f.run("reassign", stdout, stderr, func(ctx context.Context, a *admin.Admin) (*admin.Operation, error) {
+		a.DefaultPort = int32(*defaultPort)
+		return a.PlanReassign(ctx, key, f.role, *address, *pool)
+	})
+}
+
+// runAdopt implements "vipctl adopt".
+func runAdopt(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("adopt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var f adminFlags
+	f.register(flags)
+	flags.Usage = adminUsage(flags, stderr, "adopt [--role ROLE] [--dry-run] [--yes] <namespace>/<cluster>",
+		"Makes the Cluster the owner of the role's orphan IPAddressClaim, e.g. after the Cluster was",
+		"recreated or restored from a backup.")
+	key, code := f.parse("adopt", flags, args, stderr)
+	if code != 0 {
+		return code
+	}
+	return f.run("adopt", stdout, stderr, func(ctx context.Context, a *admin.Admin) (*admin.Operation, error) {
+		return a.PlanAdopt(ctx, key, f.role)
+	})
+}
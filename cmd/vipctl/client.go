@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	vipv1alpha1 "github.com/gorizond/capi-vip-allocator/api/v1alpha1"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	"github.com/gorizond/capi-vip-allocator/pkg/config"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// clusterFlags select the management cluster of subcommands that talk to the API server.
+type clusterFlags struct {
+	kubeconfig string
+	context    string
+	config     string
+}
+
+func (f *clusterFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.kubeconfig, "kubeconfig", "", "Path to the kubeconfig of the management cluster (defaults to $KUBECONFIG, ~/.kube/config or the in-cluster config).")
+	flags.StringVar(&f.context, "context", "", "The kubeconfig context to use.")
+	registerConfigFlag(flags, &f.config)
+}
+
+// registerConfigFlag adds the --config flag naming the manager's configuration file.
+func registerConfigFlag(flags *flag.FlagSet, path *string) {
+	flags.StringVar(path, "config", "", "Path to the manager's AllocatorConfig, to use its label domain, claim names and IPAM versions.")
+}
+
+// applyConfig configures the allocator like the manager running with the configuration file.
+func applyConfig(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := config.FileSource(path)(context.Background())
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return allocator.Configure(cfg.AllocatorSettings())
+}
+
+// client builds a client that knows Clusters, VIPAllocationPolicies and core types; IPAM
+// objects are read as unstructured. It applies --config first.
+func (f *clusterFlags) client() (client.Client, error) {
+	if err := applyConfig(f.config); err != nil {
+		return nil, err
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = f.kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: f.context}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load kubeconfig: %w", err)
+	}
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(clusterv1.AddToScheme(scheme))
+	utilruntime.Must(vipv1alpha1.AddToScheme(scheme))
+
+	c, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("create client: %w", err)
+	}
+	return c, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gorizond/capi-vip-allocator/pkg/doctor"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// runDoctor implements "vipctl doctor". It exits 1 when a step fails.
+func runDoctor(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var cluster clusterFlags
+	cluster.register(flags)
+	output := flags.String("o", "text", "Output format: text or json.")
+	shadow := flags.Bool("shadow-mode", false, "Whether the manager runs with --shadow-mode.")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: vipctl doctor [-o text|json] [--kubeconfig PATH] [--context NAME] <namespace>/<cluster>")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Walks the VIP allocation decision path for the Cluster and reports the first failing")
+		fmt.Fprintln(stderr, "step of each role with remediation hints.")
+		fmt.Fprintln(stderr)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	namespace, name, ok := strings.Cut(flags.Arg(0), "/")
+	if !ok || namespace == "" || name == "" {
+		fmt.Fprintf(stderr, "vipctl doctor: expected <namespace>/<cluster>, got %q\n", flags.Arg(0))
+		return 2
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(stderr, "vipctl doctor: unsupported output format %q\n", *output)
+		return 2
+	}
+
+	c, err := cluster.client()
+	if err != nil {
+		fmt.Fprintf(stderr, "vipctl doctor: %v\n", err)
+		return 1
+	}
+	report, err := doctor.Diagnose(context.Background(), c, types.NamespacedName{Namespace: namespace, Name: name}, doctor.Options{Shadow: *shadow})
+	if err != nil {
+		fmt.Fprintf(stderr, "vipctl doctor: %v\n", err)
+		return 1
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = report.WriteText(stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "vipctl doctor: %v\n", err)
+		return 1
+	}
+
+	if len(report.Failures()) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorizond/capi-vip-allocator/pkg/inventory"
+)
+
+// runInventory implements "vipctl inventory".
+func runInventory(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("inventory", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var cluster clusterFlags
+	cluster.register(flags)
+	output := flags.String("o", "table", "Output format: "+strings.Join(inventory.Formats, ", ")+".")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: vipctl inventory [-o table|json|yaml|csv] [--kubeconfig PATH] [--context NAME]")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Lists every VIP allocated by the capi-vip-allocator with its cluster, role, pool and")
+		fmt.Fprintln(stderr, "whether the Cluster endpoint matches the claim.")
+		fmt.Fprintln(stderr)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+	if !slices.Contains(inventory.Formats, *output) {
+		fmt.Fprintf(stderr, "vipctl inventory: unsupported output format %q\n", *output)
+		return 2
+	}
+
+	c, err := cluster.client()
+	if err != nil {
+		fmt.Fprintf(stderr, "vipctl inventory: %v\n", err)
+		return 1
+	}
+	entries, err := inventory.Collect(context.Background(), c, time.Now())
+	if err != nil {
+		fmt.Fprintf(stderr, "vipctl inventory: %v\n", err)
+		return 1
+	}
+	if err := inventory.Write(stdout, entries, *output); err != nil {
+		fmt.Fprintf(stderr, "vipctl inventory: %v\n", err)
+		return 1
+	}
+	return 0
+}
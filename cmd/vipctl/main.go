@@ -0,0 +1,52 @@
+// Command vipctl is the operator CLI of the capi-vip-allocator.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// command is a vipctl subcommand. run returns the process exit code.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands = []command{
+	{name: "plan", summary: "Predict VIP allocations from Cluster, ClusterClass and pool manifests", run: runPlan},
+	{name: "inventory", summary: "List allocated VIPs with their cluster, role and pool", run: runInventory},
+	{name: "doctor", summary: "Explain why a Cluster has no VIP", run: runDoctor},
+	{name: "release", summary: "Release a Cluster's VIP for a role", run: runRelease},
+	{name: "reassign", summary: "Force a Cluster's VIP for a role to a specific address", run: runReassign},
+	{name: "adopt", summary: "Re-adopt an orphan IPAddressClaim to its Cluster", run: runAdopt},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		usage(stderr)
+		return 2
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "vipctl: unknown command %q\n\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: vipctl <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/go-logr/logr"
+	"github.com/gorizond/capi-vip-allocator/pkg/planner"
+)
+
+// runPlan implements "vipctl plan". It exits 1 when a cluster role would not get a VIP.
+func runPlan(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("plan", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("o", "text", "Output format: text or json.")
+	var configPath string
+	registerConfigFlag(flags, &configPath)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: vipctl plan [-o text|json] [--config FILE] PATH...")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Reads Cluster, ClusterClass, Namespace, VIPAllocationPolicy, GlobalInClusterIPPool,")
+		fmt.Fprintln(stderr, "IPAddressClaim and IPAddress manifests from files, directories or - (stdin) and")
+		fmt.Fprintln(stderr, "prints the pool and address each cluster role would get.")
+		fmt.Fprintln(stderr)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(stderr, "vipctl plan: unsupported output format %q\n", *output)
+		return 2
+	}
+
+	if err := applyConfig(configPath); err != nil {
+		fmt.Fprintf(stderr, "vipctl plan: %v\n", err)
+		return 1
+	}
+	objects, err := planner.LoadManifests(flags.Args())
+	if err != nil {
+		fmt.Fprintf(stderr, "vipctl plan: %v\n", err)
+		return 1
+	}
+	result, err := planner.Plan(context.Background(), objects, logr.Discard())
+	if err != nil {
+		fmt.Fprintf(stderr, "vipctl plan: %v\n", err)
+		return 1
+	}
+
+	if *output == "json" {
+		err = result.WriteJSON(stdout)
+	} else {
+		err = result.WriteText(stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "vipctl plan: %v\n", err)
+		return 1
+	}
+
+	problems := result.Problems()
+	for _, problem := range problems {
+		fmt.Fprintf(stderr, "vipctl plan: %s\n", problem)
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,110 @@
+// Package fixtures holds the fixtures shared by the package tests: a scheme with every type the
+// allocator reads and builders for Clusters and Cluster API IPAM objects. It does not import
+// pkg/allocator, so the allocator's own tests can use it too.
+package fixtures
+
+import (
+	"testing"
+
+	vipv1alpha1 "github.com/gorizond/capi-vip-allocator/api/v1alpha1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ipamv1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// PoolVersion is the default GlobalInClusterIPPool API version of the allocator.
+	PoolVersion = "v1alpha2"
+	// GlobalPoolKind is the kind of the in-cluster IPAM provider's global pools.
+	GlobalPoolKind = "GlobalInClusterIPPool"
+)
+
+func poolGVK() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: ipamv1.GroupVersion.Group, Version: PoolVersion, Kind: GlobalPoolKind}
+}
+
+// NewScheme returns a scheme with the Cluster API, core and VIP types and the IPAM kinds.
+func NewScheme(t testing.TB) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clusterv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add cluster api scheme: %v", err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add core scheme: %v", err)
+	}
+	if err := vipv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add vip scheme: %v", err)
+	}
+	RegisterIPAMGVKs(scheme)
+	return scheme
+}
+
+// RegisterIPAMGVKs registers pools, claims and addresses as unstructured types, the way the
+// allocator reads them.
+func RegisterIPAMGVKs(scheme *runtime.Scheme) {
+	for _, gvk := range []schema.GroupVersionKind{
+		poolGVK(),
+		ipamv1.GroupVersion.WithKind("IPAddressClaim"),
+		ipamv1.GroupVersion.WithKind("IPAddress"),
+	} {
+		scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind(gvk.Kind+"List"), &unstructured.UnstructuredList{})
+	}
+}
+
+// NewGlobalPool returns a GlobalInClusterIPPool with the given labels and no spec.
+func NewGlobalPool(name string, labels map[string]string) *unstructured.Unstructured {
+	pool := &unstructured.Unstructured{}
+	pool.SetGroupVersionKind(poolGVK())
+	pool.SetName(name)
+	pool.SetLabels(labels)
+	return pool
+}
+
+// NewTopologyCluster returns a Cluster of the given ClusterClass.
+func NewTopologyCluster(namespace, name, className string) *clusterv1.Cluster {
+	return &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: clusterv1.ClusterSpec{
+			Topology: &clusterv1.Topology{Class: className},
+		},
+	}
+}
+
+// NewIPAddressClaim returns a claim controlled by the cluster, with the given labels,
+// referencing the pool "pool-cp".
+func NewIPAddressClaim(cluster *clusterv1.Cluster, name string, labels map[string]string) *unstructured.Unstructured {
+	claim := &unstructured.Unstructured{}
+	claim.SetGroupVersionKind(ipamv1.GroupVersion.WithKind("IPAddressClaim"))
+	claim.SetName(name)
+	claim.SetNamespace(cluster.Namespace)
+	claim.SetLabels(labels)
+	ownerRef := metav1.NewControllerRef(cluster, clusterv1.GroupVersion.WithKind("Cluster"))
+	claim.SetOwnerReferences([]metav1.OwnerReference{*ownerRef})
+	if err := unstructured.SetNestedField(claim.Object, map[string]interface{}{
+		"apiVersion": ipamv1.GroupVersion.String(),
+		"kind":       GlobalPoolKind,
+		"name":       "pool-cp",
+	}, "spec", "poolRef"); err != nil {
+		panic(err)
+	}
+	return claim
+}
+
+// NewIPAddress returns an IPAddress holding address.
+func NewIPAddress(name, namespace, address string) *unstructured.Unstructured {
+	ip := &unstructured.Unstructured{}
+	ip.SetGroupVersionKind(ipamv1.GroupVersion.WithKind("IPAddress"))
+	ip.SetName(name)
+	ip.SetNamespace(namespace)
+	if err := unstructured.SetNestedField(ip.Object, address, "spec", "address"); err != nil {
+		panic(err)
+	}
+	return ip
+}
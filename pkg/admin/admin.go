@@ -0,0 +1,430 @@
+// Package admin implements manual VIP operations: releasing a cluster's VIP, reassigning a
+// specific address and re-adopting an orphan claim. Each operation is planned first, as an
+// ordered list of steps that can be printed for a dry run, and applied afterwards.
+//
+// The operations create and adopt claims exactly like the allocator, so the reconciler accepts
+// the result as its own.
+package admin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultWaitTimeout bounds how long an operation waits for deleted objects to disappear.
+	DefaultWaitTimeout = 2 * time.Minute
+	waitInterval       = time.Second
+)
+
+// Step is one change of an Operation.
+type Step struct {
+	Description string
+	apply       func(ctx context.Context) error
+}
+
+// Operation is an ordered list of changes to the management cluster.
+type Operation struct {
+	Steps []Step
+}
+
+func (o *Operation) add(description string, apply func(ctx context.Context) error) {
+	o.Steps = append(o.Steps, Step{Description: description, apply: apply})
+}
+
+// WritePlan prints the steps without applying them.
+func (o *Operation) WritePlan(w io.Writer) error {
+	for i, step := range o.Steps {
+		if _, err := fmt.Fprintf(w, "%d. %s\n", i+1, step.Description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply runs the steps in order and stops at the first failure.
+func (o *Operation) Apply(ctx context.Context, w io.Writer) error {
+	for i, step := range o.Steps {
+		if err := step.apply(ctx); err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, step.Description, err)
+		}
+		if _, err := fmt.Fprintf(w, "%d. %s: done\n", i+1, step.Description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Admin plans VIP operations against the management cluster.
+type Admin struct {
+	Client client.Client
+	// DefaultPort is the control plane port set when a reassigned Cluster has none
+	DefaultPort int32
+	// WaitTimeout bounds the wait for deleted claims and addresses
+	WaitTimeout time.Duration
+
+	vips *allocator.PoolAllocator
+}
+
+// New returns an Admin using the manager's default control plane port.
+func New(c client.Client) *Admin {
+	return &Admin{
+		Client:      c,
+		DefaultPort: 6443,
+		WaitTimeout: DefaultWaitTimeout,
+		vips:        allocator.New(c, logr.Discard(), nil),
+	}
+}
+
+// PlanRelease deletes the role's claim, returning its address to the pool, and then removes the
+// address from the Cluster. The reconciler allocates a new VIP on its next run unless the role
+// is disabled, the Cluster is in shadow mode or it is being deleted.
+func (a *Admin) PlanRelease(ctx context.Context, key types.NamespacedName, role string) (*Operation, error) {
+	cluster, err := a.getCluster(ctx, key)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	claim, err := a.getClaim(ctx, key, role)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	op := &Operation{}
+	if claim != nil {
+		a.planDeleteClaim(op, claim)
+	}
+	if cluster != nil && endpoint(cluster, role) != "" {
+		a.planEndpointChange(op, cluster, role, fmt.Sprintf("remove %s %s from Cluster %s", endpointField(role), endpoint(cluster, role), key), func(ctx context.Context, cluster *clusterv1.Cluster) error {
+			if role == allocator.IngressRole {
+				allocator.ClearIngressVIP(cluster)
+				return nil
+			}
+			return a.vips.ClearControlPlaneEndpoint(ctx, cluster)
+		})
+	}
+	if len(op.Steps) == 0 {
+		return nil, fmt.Errorf("Cluster %s holds no %s VIP", key, role)
+	}
+	return op, nil
+}
+
+// PlanReassign moves the role's VIP to the given address. The current claim and its IPAddress
+// are deleted, an IPAddress holding the address is created under the claim's name, which the
+// in-cluster IPAM provider binds to the claim, and the claim is recreated. Finally the Cluster
+// is patched to the new address. poolName defaults to the pool of the current claim, then to the
+// pool the allocator selects.
+func (a *Admin) PlanReassign(ctx context.Context, key types.NamespacedName, role, address, poolName string) (*Operation, error) {
+	cluster, err := a.getCluster(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	claim, err := a.getClaim(ctx, key, role)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	if poolName == "" && claim != nil {
+		poolName, _, _ = unstructured.NestedString(claim.Object, "spec", "poolRef", "name")
+	}
+	if poolName == "" {
+		if poolName, err = a.vips.FindPool(ctx, cluster, role); err != nil {
+			return nil, err
+		}
+		if poolName == "" {
+			return nil, fmt.Errorf("no pool matches Cluster %s for the %s role, pass the pool explicitly", key, role)
+		}
+	}
+
+	pool := &unstructured.Unstructured{}
+	pool.SetGroupVersionKind(allocator.PoolGVK())
+	if err := a.Client.Get(ctx, types.NamespacedName{Name: poolName}, pool); err != nil {
+		return nil, fmt.Errorf("get %s %q: %w", allocator.GlobalPoolKind, poolName, err)
+	}
+	allocatable, err := a.vips.AddressAllocatable(ctx, poolName, address)
+	if err != nil {
+		return nil, err
+	}
+	if !allocatable {
+		return nil, fmt.Errorf("address %s is not allocatable from pool %s (outside spec.addresses, gateway, excluded or reserved)", address, poolName)
+	}
+	if holder, err := a.addressHolder(ctx, poolName, address); err != nil {
+		return nil, err
+	} else if holder != "" && holder != allocator.ClusterKey(key.Namespace, allocator.ClaimName(key.Name, role)) {
+		return nil, fmt.Errorf("address %s of pool %s is held by IPAddress %s", address, poolName, holder)
+	}
+
+	op := &Operation{}
+	if claim != nil {
+		a.planDeleteClaim(op, claim)
+	}
+
+	ipAddress := newIPAddress(cluster, role, pool, address)
+	op.add(fmt.Sprintf("create IPAddress %s/%s with address %s from pool %s", ipAddress.GetNamespace(), ipAddress.GetName(), address, poolName), func(ctx context.Context) error {
+		return a.Client.Create(ctx, ipAddress.DeepCopy())
+	})
+
+	newClaim := allocator.NewClaim(cluster, role, poolName)
+	annotations := newClaim.GetAnnotations()
+	annotations[allocator.AddressAnnotation()] = address
+	newClaim.SetAnnotations(annotations)
+	op.add(fmt.Sprintf("create IPAddressClaim %s/%s owned by Cluster %s", newClaim.GetNamespace(), newClaim.GetName(), key.Name), func(ctx context.Context) error {
+		return a.Client.Create(ctx, newClaim.DeepCopy())
+	})
+
+	a.planEndpointChange(op, cluster, role, fmt.Sprintf("set %s of Cluster %s to %s", endpointField(role), key, address), func(ctx context.Context, cluster *clusterv1.Cluster) error {
+		if role == allocator.IngressRole {
+			allocator.SetIngressVIP(cluster, address)
+			return nil
+		}
+		return a.vips.SetControlPlaneEndpoint(ctx, cluster, address, a.DefaultPort)
+	})
+	return op, nil
+}
+
+// PlanAdopt makes the Cluster the controller owner of the role's claim and restores its labels,
+// replacing references to a deleted Cluster of the same name.
+func (a *Admin) PlanAdopt(ctx context.Context, key types.NamespacedName, role string) (*Operation, error) {
+	cluster, err := a.getCluster(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	claim, err := a.getClaim(ctx, key, role)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("IPAddressClaim %s/%s not found; the reconciler only adopts claims with this name, use reassign to move an address",
+				key.Namespace, allocator.ClaimName(key.Name, role))
+		}
+		return nil, err
+	}
+
+	adopted := claim.DeepCopy()
+	allocator.AdoptClaim(adopted, cluster, role)
+	if equalOwnership(claim, adopted) {
+		return nil, fmt.Errorf("IPAddressClaim %s/%s is already owned by Cluster %s", claim.GetNamespace(), claim.GetName(), key)
+	}
+
+	op := &Operation{}
+	op.add(fmt.Sprintf("set Cluster %s (uid %s) as owner of IPAddressClaim %s/%s", key, cluster.UID, claim.GetNamespace(), claim.GetName()), func(ctx context.Context) error {
+		current, err := a.getClaim(ctx, key, role)
+		if err != nil {
+			return err
+		}
+		allocator.AdoptClaim(current, cluster, role)
+		return a.Client.Update(ctx, current)
+	})
+	return op, nil
+}
+
+// planDeleteClaim deletes the claim and its IPAddress and waits until both are gone, so an
+// object with the same name can be created afterwards.
+func (a *Admin) planDeleteClaim(op *Operation, claim *unstructured.Unstructured) {
+	key := types.NamespacedName{Namespace: claim.GetNamespace(), Name: claim.GetName()}
+	description := fmt.Sprintf("delete IPAddressClaim %s", key)
+
+	var address *unstructured.Unstructured
+	if addressName, _, _ := unstructured.NestedString(claim.Object, "status", "addressRef", "name"); addressName != "" {
+		address = &unstructured.Unstructured{}
+		address.SetGroupVersionKind(allocator.AddressGVK())
+		address.SetNamespace(claim.GetNamespace())
+		address.SetName(addressName)
+		description += fmt.Sprintf(" and IPAddress %s/%s", address.GetNamespace(), address.GetName())
+	}
+
+	op.add(description, func(ctx context.Context) error {
+		objects := []*unstructured.Unstructured{claim.DeepCopy()}
+		if address != nil {
+			objects = append(objects, address.DeepCopy())
+		}
+		for _, object := range objects {
+			if err := a.Client.Delete(ctx, object); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+		for _, object := range objects {
+			if err := a.waitDeleted(ctx, object); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// planEndpointChange patches the role's endpoint on the Cluster. The Cluster validating webhook
+// refuses to change a set control plane host without the override annotation, so the annotation
+// is set in the same patch and removed by a separate step, unless the Cluster already carried it.
+func (a *Admin) planEndpointChange(op *Operation, cluster *clusterv1.Cluster, role, description string, mutate func(context.Context, *clusterv1.Cluster) error) {
+	key := client.ObjectKeyFromObject(cluster)
+	override := role == allocator.ControlPlaneRole &&
+		cluster.Spec.ControlPlaneEndpoint.Host != "" &&
+		cluster.Annotations[allocator.AllowVIPChangeAnnotation()] != "true"
+	if !override {
+		op.add(description, func(ctx context.Context) error {
+			return a.patchCluster(ctx, key, func(cluster *clusterv1.Cluster) error {
+				return mutate(ctx, cluster)
+			})
+		})
+		return
+	}
+
+	op.add(fmt.Sprintf("%s, annotated %s=\"true\"", description, allocator.AllowVIPChangeAnnotation()), func(ctx context.Context) error {
+		return a.patchCluster(ctx, key, func(cluster *clusterv1.Cluster) error {
+			if cluster.Annotations == nil {
+				cluster.Annotations = map[string]string{}
+			}
+			cluster.Annotations[allocator.AllowVIPChangeAnnotation()] = "true"
+			return mutate(ctx, cluster)
+		})
+	})
+	op.add(fmt.Sprintf("remove annotation %s from Cluster %s", allocator.AllowVIPChangeAnnotation(), key), func(ctx context.Context) error {
+		return a.patchCluster(ctx, key, func(cluster *clusterv1.Cluster) error {
+			delete(cluster.Annotations, allocator.AllowVIPChangeAnnotation())
+			return nil
+		})
+	})
+}
+
+// waitDeleted polls until the object is gone, e.g. once the IPAM provider removed its finalizer.
+func (a *Admin) waitDeleted(ctx context.Context, object *unstructured.Unstructured) error {
+	key := client.ObjectKeyFromObject(object)
+	err := wait.PollUntilContextTimeout(ctx, waitInterval, a.WaitTimeout, true, func(ctx context.Context) (bool, error) {
+		current := &unstructured.Unstructured{}
+		current.SetGroupVersionKind(object.GroupVersionKind())
+		err := a.Client.Get(ctx, key, current)
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return fmt.Errorf("wait for %s %s to be deleted: %w", object.GetKind(), key, err)
+	}
+	return nil
+}
+
+// patchCluster re-reads the Cluster, applies mutate and merge-patches the result.
+func (a *Admin) patchCluster(ctx context.Context, key types.NamespacedName, mutate func(*clusterv1.Cluster) error) error {
+	cluster, err := a.getCluster(ctx, key)
+	if err != nil {
+		return err
+	}
+	base := client.MergeFrom(cluster.DeepCopy())
+	if err := mutate(cluster); err != nil {
+		return err
+	}
+	return a.Client.Patch(ctx, cluster, base)
+}
+
+// addressHolder returns "namespace/name" of the IPAddress holding the address in the pool, or "".
+func (a *Admin) addressHolder(ctx context.Context, poolName, address string) (string, error) {
+	addresses := &unstructured.UnstructuredList{}
+	addresses.SetGroupVersionKind(allocator.AddressGVK().GroupVersion().WithKind(allocator.IPAddressKind + "List"))
+	if err := a.Client.List(ctx, addresses); err != nil {
+		return "", fmt.Errorf("list IPAddresses: %w", err)
+	}
+	for _, item := range addresses.Items {
+		ref, _, _ := unstructured.NestedStringMap(item.Object, "spec", "poolRef")
+		value, _, _ := unstructured.NestedString(item.Object, "spec", "address")
+		if ref["name"] == poolName && ref["kind"] == allocator.GlobalPoolKind && value == address {
+			return allocator.ClusterKey(item.GetNamespace(), item.GetName()), nil
+		}
+	}
+	return "", nil
+}
+
+func (a *Admin) getCluster(ctx context.Context, key types.NamespacedName) (*clusterv1.Cluster, error) {
+	cluster := &clusterv1.Cluster{}
+	if err := a.Client.Get(ctx, key, cluster); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("get Cluster %s: %w", key, err)
+	}
+	return cluster, nil
+}
+
+func (a *Admin) getClaim(ctx context.Context, key types.NamespacedName, role string) (*unstructured.Unstructured, error) {
+	claim := &unstructured.Unstructured{}
+	claim.SetGroupVersionKind(allocator.ClaimGVK())
+	if err := a.Client.Get(ctx, types.NamespacedName{Namespace: key.Namespace, Name: allocator.ClaimName(key.Name, role)}, claim); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("get IPAddressClaim: %w", err)
+	}
+	return claim, nil
+}
+
+// newIPAddress returns the IPAddress binding the address to the role's claim. The in-cluster
+// IPAM provider reuses an existing IPAddress named after the claim instead of allocating one.
+func newIPAddress(cluster *clusterv1.Cluster, role string, pool *unstructured.Unstructured, address string) *unstructured.Unstructured {
+	claimName := allocator.ClaimName(cluster.Name, role)
+	spec := map[string]interface{}{
+		"address":  address,
+		"claimRef": map[string]interface{}{"name": claimName},
+		"poolRef": map[string]interface{}{
+			"apiGroup": allocator.IPAMGroup,
+			"kind":     allocator.GlobalPoolKind,
+			"name":     pool.GetName(),
+		},
+	}
+	if prefix, found, _ := unstructured.NestedInt64(pool.Object, "spec", "prefix"); found {
+		spec["prefix"] = prefix
+	}
+	if gateway, _, _ := unstructured.NestedString(pool.Object, "spec", "gateway"); gateway != "" {
+		spec["gateway"] = gateway
+	}
+
+	ip := &unstructured.Unstructured{}
+	ip.SetGroupVersionKind(allocator.AddressGVK())
+	ip.SetNamespace(cluster.Namespace)
+	ip.SetName(claimName)
+	ip.SetLabels(map[string]string{allocator.ClusterNameLabel: cluster.Name})
+	ip.Object["spec"] = spec
+	return ip
+}
+
+// equalOwnership reports whether adoption would not change the claim.
+func equalOwnership(current, adopted *unstructured.Unstructured) bool {
+	currentRefs, adoptedRefs := current.GetOwnerReferences(), adopted.GetOwnerReferences()
+	if len(currentRefs) != len(adoptedRefs) {
+		return false
+	}
+	for i := range currentRefs {
+		if currentRefs[i].UID != adoptedRefs[i].UID || currentRefs[i].Name != adoptedRefs[i].Name {
+			return false
+		}
+	}
+	for key, value := range adopted.GetLabels() {
+		if current.GetLabels()[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// endpoint returns the address the Cluster publishes for the role.
+func endpoint(cluster *clusterv1.Cluster, role string) string {
+	if role == allocator.IngressRole {
+		return cluster.Annotations[allocator.IngressVIPAnnotation()]
+	}
+	return cluster.Spec.ControlPlaneEndpoint.Host
+}
+
+func endpointField(role string) string {
+	if role == allocator.IngressRole {
+		return "the " + allocator.IngressVIPAnnotation() + " annotation"
+	}
+	return "spec.controlPlaneEndpoint.host"
+}
@@ -0,0 +1,276 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	vipv1alpha1 "github.com/gorizond/capi-vip-allocator/api/v1alpha1"
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	"github.com/gorizond/capi-vip-allocator/pkg/webhook"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var clusterKey = types.NamespacedName{Namespace: "team-a", Name: "alpha"}
+
+func newCluster() *clusterv1.Cluster {
+	return &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: clusterKey.Name, Namespace: clusterKey.Namespace, UID: "alpha-uid"},
+		Spec: clusterv1.ClusterSpec{
+			ControlPlaneEndpoint: clusterv1.APIEndpoint{Host: "10.0.0.10", Port: 6443},
+			Topology: &clusterv1.Topology{Class: "prod", Version: "v1.30.0", Variables: []clusterv1.ClusterVariable{
+				{Name: vipv1alpha1.DefaultControlPlaneVariable, Value: apiextensionsv1.JSON{Raw: []byte(`"10.0.0.10"`)}},
+			}},
+		},
+	}
+}
+
+func newClusterClass() *clusterv1.ClusterClass {
+	return &clusterv1.ClusterClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: clusterKey.Namespace},
+		Spec: clusterv1.ClusterClassSpec{Variables: []clusterv1.ClusterClassVariable{
+			{Name: vipv1alpha1.DefaultControlPlaneVariable},
+		}},
+	}
+}
+
+func newPool() *unstructured.Unstructured {
+	pool := &unstructured.Unstructured{}
+	pool.SetGroupVersionKind(allocator.PoolGVK())
+	pool.SetName("cp")
+	pool.SetLabels(map[string]string{allocator.ClusterClassLabel(): "prod", allocator.RoleLabel(): allocator.ControlPlaneRole})
+	pool.Object["spec"] = map[string]interface{}{
+		"addresses": []interface{}{"10.0.0.0/24"},
+		"prefix":    int64(24),
+		"gateway":   "10.0.0.1",
+	}
+	return pool
+}
+
+// newBoundClaim returns the control-plane claim of the test cluster bound to an IPAddress.
+func newBoundClaim(address string) (*unstructured.Unstructured, *unstructured.Unstructured) {
+	claim := allocator.NewClaim(newCluster(), allocator.ControlPlaneRole, "cp")
+	claim.Object["status"] = map[string]interface{}{"addressRef": map[string]interface{}{"name": claim.GetName()}}
+
+	ip := &unstructured.Unstructured{}
+	ip.SetGroupVersionKind(allocator.AddressGVK())
+	ip.SetNamespace(claim.GetNamespace())
+	ip.SetName(claim.GetName())
+	ip.Object["spec"] = map[string]interface{}{
+		"address": address,
+		"poolRef": map[string]interface{}{"apiGroup": allocator.IPAMGroup, "kind": allocator.GlobalPoolKind, "name": "cp"},
+	}
+	return claim, ip
+}
+
+func newAdmin(t *testing.T, objects ...runtime.Object) (*Admin, client.Client) {
+	t.Helper()
+	c := fake.NewClientBuilder().WithScheme(fixtures.NewScheme(t)).WithRuntimeObjects(objects...).Build()
+	a := New(c)
+	a.WaitTimeout = time.Second
+	return a, c
+}
+
+func apply(t *testing.T, op *Operation, err error) string {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("planning failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := op.Apply(context.Background(), &out); err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	return out.String()
+}
+
+func getClaim(t *testing.T, c client.Client) *unstructured.Unstructured {
+	t.Helper()
+	claim := &unstructured.Unstructured{}
+	claim.SetGroupVersionKind(allocator.ClaimGVK())
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: clusterKey.Namespace, Name: "vip-cp-alpha"}, claim); err != nil {
+		t.Fatalf("get claim: %v", err)
+	}
+	return claim
+}
+
+func TestReleaseDeletesClaimBeforeClearingTheCluster(t *testing.T) {
+	claim, ip := newBoundClaim("10.0.0.10")
+	a, c := newAdmin(t, newCluster(), newClusterClass(), newPool(), claim, ip)
+	ctx := context.Background()
+
+	op, err := a.PlanRelease(ctx, clusterKey, allocator.ControlPlaneRole)
+	var plan bytes.Buffer
+	if err == nil {
+		_ = op.WritePlan(&plan)
+	}
+	want := "1. delete IPAddressClaim team-a/vip-cp-alpha and IPAddress team-a/vip-cp-alpha\n2. remove spec.controlPlaneEndpoint.host 10.0.0.10 from Cluster team-a/alpha, annotated vip.capi.gorizond.io/allow-vip-change=\"true\"\n" +
+		"3. remove annotation vip.capi.gorizond.io/allow-vip-change from Cluster team-a/alpha\n"
+	if plan.String() != want {
+		t.Fatalf("expected plan:\n%s\ngot:\n%s", want, plan.String())
+	}
+	apply(t, op, err)
+
+	if err := c.Get(ctx, client.ObjectKeyFromObject(claim), claim.DeepCopy()); !errors.IsNotFound(err) {
+		t.Fatalf("expected the claim to be deleted, got %v", err)
+	}
+	cluster := &clusterv1.Cluster{}
+	if err := c.Get(ctx, clusterKey, cluster); err != nil {
+		t.Fatalf("get cluster: %v", err)
+	}
+	if cluster.Spec.ControlPlaneEndpoint.Host != "" || len(cluster.Spec.Topology.Variables) != 0 {
+		t.Fatalf("expected the endpoint and VIP variable to be cleared, got %+v", cluster.Spec)
+	}
+
+	if _, err := a.PlanRelease(ctx, clusterKey, allocator.ControlPlaneRole); err == nil {
+		t.Fatalf("expected releasing twice to fail")
+	}
+}
+
+func TestReassignBindsTheAddressToARecreatedClaim(t *testing.T) {
+	claim, ip := newBoundClaim("10.0.0.10")
+	a, c := newAdmin(t, newCluster(), newClusterClass(), newPool(), claim, ip)
+	ctx := context.Background()
+
+	op, err := a.PlanReassign(ctx, clusterKey, allocator.ControlPlaneRole, "10.0.0.50", "")
+	out := apply(t, op, err)
+	if !strings.Contains(out, "create IPAddress team-a/vip-cp-alpha with address 10.0.0.50 from pool cp: done") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+
+	address := &unstructured.Unstructured{}
+	address.SetGroupVersionKind(allocator.AddressGVK())
+	if err := c.Get(ctx, types.NamespacedName{Namespace: clusterKey.Namespace, Name: "vip-cp-alpha"}, address); err != nil {
+		t.Fatalf("get IPAddress: %v", err)
+	}
+	value, _, _ := unstructured.NestedString(address.Object, "spec", "address")
+	gateway, _, _ := unstructured.NestedString(address.Object, "spec", "gateway")
+	claimRef, _, _ := unstructured.NestedString(address.Object, "spec", "claimRef", "name")
+	if value != "10.0.0.50" || gateway != "10.0.0.1" || claimRef != "vip-cp-alpha" {
+		t.Fatalf("unexpected IPAddress spec %v", address.Object["spec"])
+	}
+
+	newClaim := getClaim(t, c)
+	if newClaim.GetAnnotations()[allocator.AddressAnnotation()] != "10.0.0.50" || newClaim.GetLabels()[allocator.RoleLabel()] != allocator.ControlPlaneRole {
+		t.Fatalf("expected the claim to carry the address and role, got %v %v", newClaim.GetAnnotations(), newClaim.GetLabels())
+	}
+	if owners := newClaim.GetOwnerReferences(); len(owners) != 1 || owners[0].UID != "alpha-uid" {
+		t.Fatalf("expected the Cluster to own the claim, got %+v", owners)
+	}
+
+	cluster := &clusterv1.Cluster{}
+	if err := c.Get(ctx, clusterKey, cluster); err != nil {
+		t.Fatalf("get cluster: %v", err)
+	}
+	if cluster.Spec.ControlPlaneEndpoint.Host != "10.0.0.50" || string(cluster.Spec.Topology.Variables[0].Value.Raw) != `"10.0.0.50"` {
+		t.Fatalf("expected the Cluster to use the new address, got %+v", cluster.Spec)
+	}
+}
+
+func TestEndpointChangesPassTheClusterValidator(t *testing.T) {
+	tests := map[string]func(*Admin) (*Operation, error){
+		"release": func(a *Admin) (*Operation, error) {
+			return a.PlanRelease(context.Background(), clusterKey, allocator.ControlPlaneRole)
+		},
+		"reassign": func(a *Admin) (*Operation, error) {
+			return a.PlanReassign(context.Background(), clusterKey, allocator.ControlPlaneRole, "10.0.0.50", "")
+		},
+	}
+	for name, plan := range tests {
+		t.Run(name, func(t *testing.T) {
+			claim, ip := newBoundClaim("10.0.0.10")
+			c := fake.NewClientBuilder().WithScheme(fixtures.NewScheme(t)).
+				WithRuntimeObjects(newCluster(), newClusterClass(), newPool(), claim, ip).
+				Build()
+			validator := &webhook.ClusterValidator{Client: c, Logger: testr.New(t)}
+
+			var validated int
+			a := New(interceptor.NewClient(c.(client.WithWatch), interceptor.Funcs{
+				Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+					if cluster, ok := obj.(*clusterv1.Cluster); ok {
+						old := &clusterv1.Cluster{}
+						if err := c.Get(ctx, client.ObjectKeyFromObject(cluster), old); err != nil {
+							return err
+						}
+						if _, err := validator.ValidateUpdate(ctx, old, cluster); err != nil {
+							return err
+						}
+						validated++
+					}
+					return c.Patch(ctx, obj, patch, opts...)
+				},
+			}))
+			a.WaitTimeout = time.Second
+
+			op, err := plan(a)
+			apply(t, op, err)
+			if validated != 2 {
+				t.Fatalf("expected the endpoint and annotation patches to be validated, got %d", validated)
+			}
+
+			cluster := &clusterv1.Cluster{}
+			if err := c.Get(context.Background(), clusterKey, cluster); err != nil {
+				t.Fatalf("get cluster: %v", err)
+			}
+			if _, ok := cluster.Annotations[allocator.AllowVIPChangeAnnotation()]; ok {
+				t.Fatalf("expected the override annotation to be removed, got %v", cluster.Annotations)
+			}
+		})
+	}
+}
+
+func TestReassignRejectsUnavailableAddresses(t *testing.T) {
+	claim, ip := newBoundClaim("10.0.0.10")
+	other := ip.DeepCopy()
+	other.SetNamespace("team-b")
+	other.SetName("vip-cp-beta")
+	_ = unstructured.SetNestedField(other.Object, "10.0.0.20", "spec", "address")
+	a, _ := newAdmin(t, newCluster(), newClusterClass(), newPool(), claim, ip, other)
+
+	for address, want := range map[string]string{
+		"10.0.0.20": "held by IPAddress team-b/vip-cp-beta",
+		"10.0.0.1":  "not allocatable from pool cp",
+		"10.0.1.5":  "not allocatable from pool cp",
+	} {
+		_, err := a.PlanReassign(context.Background(), clusterKey, allocator.ControlPlaneRole, address, "")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", address, want, err)
+		}
+	}
+}
+
+func TestAdoptReplacesStaleOwner(t *testing.T) {
+	claim, ip := newBoundClaim("10.0.0.10")
+	claim.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: clusterv1.GroupVersion.String(), Kind: "Cluster", Name: "alpha", UID: "deleted-uid"}})
+	claim.SetLabels(nil)
+	a, c := newAdmin(t, newCluster(), claim, ip)
+	ctx := context.Background()
+
+	op, err := a.PlanAdopt(ctx, clusterKey, allocator.ControlPlaneRole)
+	apply(t, op, err)
+
+	adopted := getClaim(t, c)
+	if owners := adopted.GetOwnerReferences(); len(owners) != 1 || owners[0].UID != "alpha-uid" || owners[0].Controller == nil || !*owners[0].Controller {
+		t.Fatalf("expected the Cluster to control the claim, got %+v", owners)
+	}
+	if adopted.GetLabels()[allocator.RoleLabel()] != allocator.ControlPlaneRole || adopted.GetLabels()[allocator.ClusterNameLabel] != "alpha" {
+		t.Fatalf("expected the role and cluster-name labels, got %v", adopted.GetLabels())
+	}
+
+	if _, err := a.PlanAdopt(ctx, clusterKey, allocator.ControlPlaneRole); err == nil || !strings.Contains(err.Error(), "already owned") {
+		t.Fatalf("expected adopting twice to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package allocator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AllocatedAddresses maps every address held by a role-labelled IPAddressClaim to the
+// "namespace/cluster" it is allocated to.
+func AllocatedAddresses(ctx context.Context, c client.Reader) (map[string]string, error) {
+	claims := &unstructured.UnstructuredList{}
+	claims.SetGroupVersionKind(ClaimGVK().GroupVersion().WithKind(IPAddressClaimKind + "List"))
+	if err := c.List(ctx, claims, client.HasLabels{RoleLabel()}); err != nil {
+		return nil, fmt.Errorf("list IPAddressClaims: %w", err)
+	}
+
+	addresses := &unstructured.UnstructuredList{}
+	addresses.SetGroupVersionKind(AddressGVK().GroupVersion().WithKind(IPAddressKind + "List"))
+	if err := c.List(ctx, addresses); err != nil {
+		return nil, fmt.Errorf("list IPAddresses: %w", err)
+	}
+
+	addressByName := make(map[string]string, len(addresses.Items))
+	for _, address := range addresses.Items {
+		value, _, _ := unstructured.NestedString(address.Object, "spec", "address")
+		if value != "" {
+			addressByName[ClusterKey(address.GetNamespace(), address.GetName())] = value
+		}
+	}
+
+	owners := make(map[string]string)
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		addressName, _, _ := unstructured.NestedString(claim.Object, "status", "addressRef", "name")
+		if addressName == "" {
+			continue
+		}
+		address, ok := addressByName[ClusterKey(claim.GetNamespace(), addressName)]
+		if !ok {
+			continue
+		}
+		owners[address] = ClusterKey(claim.GetNamespace(), ClaimClusterName(claim))
+	}
+
+	return owners, nil
+}
+
+// ClaimClusterName returns the name of the Cluster a VIP claim belongs to: the owning Cluster,
+// the cluster-name label, or the name encoded in the claim name.
+func ClaimClusterName(claim *unstructured.Unstructured) string {
+	for _, ref := range claim.GetOwnerReferences() {
+		if ref.Kind == "Cluster" && strings.HasPrefix(ref.APIVersion, clusterv1.GroupVersion.Group+"/") {
+			return ref.Name
+		}
+	}
+	if name := claim.GetLabels()[ClusterNameLabel]; name != "" {
+		return name
+	}
+	name := claim.GetName()
+	for _, role := range []string{ControlPlaneRole, IngressRole} {
+		prefix, suffix, ok := claimNameAffixes(role)
+		if ok && len(name) > len(prefix)+len(suffix) && strings.HasPrefix(name, prefix) && strings.HasSuffix(name, suffix) {
+			return name[len(prefix) : len(name)-len(suffix)]
+		}
+	}
+	return name
+}
+
+// ClusterKey formats a namespaced name as "namespace/name".
+func ClusterKey(namespace, name string) string {
+	return namespace + "/" + name
+}
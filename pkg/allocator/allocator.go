@@ -0,0 +1,443 @@
+// Package allocator implements VIP allocation from Cluster API IPAM pools.
+// It is shared by the reconciler, the mutating webhook and the runtime extension
+// so that every allocation mode selects pools and creates claims the same way.
+package allocator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	IPAMGroup            = "ipam.cluster.x-k8s.io"
+	IPAMVersion          = "v1beta1"  // for IPAddressClaim and IPAddress
+	GlobalPoolAPIVersion = "v1alpha2" // for GlobalInClusterIPPool
+	GlobalPoolKind       = "GlobalInClusterIPPool"
+	IPAddressClaimKind   = "IPAddressClaim"
+	IPAddressKind        = "IPAddress"
+
+	ClusterClassLabelTrueFlag = "true"
+	ClusterNameLabel          = "cluster.x-k8s.io/cluster-name"
+
+	ControlPlaneRole = "control-plane"
+	IngressRole      = "ingress"
+)
+
+// ClaimGVK returns the GroupVersionKind of IPAddressClaims in the configured IPAM version.
+func ClaimGVK() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: IPAMGroup, Version: currentSettings().IPAMVersion, Kind: IPAddressClaimKind}
+}
+
+// AddressGVK returns the GroupVersionKind of IPAddresses in the configured IPAM version.
+func AddressGVK() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: IPAMGroup, Version: currentSettings().IPAMVersion, Kind: IPAddressKind}
+}
+
+// PoolGVK returns the GroupVersionKind of GlobalInClusterIPPools in the configured pool version.
+func PoolGVK() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: IPAMGroup, Version: currentSettings().PoolVersion, Kind: GlobalPoolKind}
+}
+
+// Allocator allocates VIPs for Clusters.
+type Allocator interface {
+	// FindPool returns the name of the pool to allocate the role's VIP from, or "" if none matches.
+	FindPool(ctx context.Context, cluster *clusterv1.Cluster, role string) (string, error)
+	// EnsureClaim returns the role's IPAddressClaim for the cluster, creating it if needed.
+	EnsureClaim(ctx context.Context, cluster *clusterv1.Cluster, role string) (*unstructured.Unstructured, error)
+	// ResolveAddress returns the address allocated to the claim; ready is false while it is pending.
+	ResolveAddress(ctx context.Context, claim *unstructured.Unstructured) (address string, ready bool, err error)
+	// Release deletes the role's IPAddressClaim for the cluster, if any.
+	Release(ctx context.Context, cluster *clusterv1.Cluster, role string) error
+	// Shadow reports the pool and address the role's VIP would get, without creating anything.
+	Shadow(ctx context.Context, cluster *clusterv1.Cluster, role string) (ShadowResult, error)
+}
+
+// PoolAllocator is the Allocator backed by GlobalInClusterIPPools and VIPAllocationPolicies.
+type PoolAllocator struct {
+	Client   client.Client
+	Logger   logr.Logger
+	Recorder record.EventRecorder
+	// APIReader reads the namespace claims uncached for the quota re-count after a claim is
+	// created; nil uses Client
+	APIReader client.Reader
+}
+
+var _ Allocator = &PoolAllocator{}
+
+// New returns a PoolAllocator. The recorder may be nil.
+func New(c client.Client, logger logr.Logger, recorder record.EventRecorder) *PoolAllocator {
+	return &PoolAllocator{Client: c, Logger: logger, Recorder: recorder}
+}
+
+// apiReader returns the reader for uncached reads.
+func (a *PoolAllocator) apiReader() client.Reader {
+	if a.APIReader != nil {
+		return a.APIReader
+	}
+	return a.Client
+}
+
+// ClaimName returns the name of the IPAddressClaim holding the role's VIP for the cluster.
+// The name comes from the claim name template; names longer than 253 characters are cut and
+// end in a hash of the full name.
+func ClaimName(clusterName, role string) string {
+	data := claimNameData(clusterName, role)
+	name, err := renderClaimName(currentClaimNameTemplate(), data)
+	if err != nil {
+		// Configure rejects templates that fail to render; fall back to the default naming
+		name = data.Prefix + data.Cluster
+	}
+	return shortenName(name)
+}
+
+// claimNameData returns the claim name template data; roles other than ingress name
+// control plane claims.
+func claimNameData(clusterName, role string) ClaimNameData {
+	if role != IngressRole {
+		role = ControlPlaneRole
+	}
+	return ClaimNameData{Cluster: clusterName, Role: role, Prefix: currentSettings().ClaimPrefixes[role]}
+}
+
+// FindPool returns the pool to allocate from for the cluster and role.
+// A matching VIPAllocationPolicy takes precedence over label-based matching on the pools.
+func (a *PoolAllocator) FindPool(ctx context.Context, cluster *clusterv1.Cluster, role string) (string, error) {
+	if cluster.Spec.Topology == nil {
+		return "", nil
+	}
+
+	policy, err := a.MatchPolicy(ctx, cluster, role)
+	if err != nil {
+		return "", err
+	}
+	if policy != nil {
+		a.Logger.V(1).Info("using VIPAllocationPolicy for pool selection", "cluster", cluster.Name, "policy", policy.Name, "role", role)
+		return a.poolFromPolicy(ctx, cluster, policy, role)
+	}
+
+	className := cluster.Spec.Topology.Class
+
+	pools := &unstructured.UnstructuredList{}
+	pools.SetGroupVersionKind(PoolGVK().GroupVersion().WithKind(GlobalPoolKind + "List"))
+
+	// List all GlobalInClusterIPPool resources without label filtering
+	// We'll filter them manually to support comma-separated values and annotation-based class names
+	if err := a.Client.List(ctx, pools); err != nil {
+		return "", fmt.Errorf("list %s: %w", GlobalPoolKind, err)
+	}
+
+	for i := range pools.Items {
+		pool := &pools.Items[i]
+		if !PoolMatches(pool, className, role) {
+			continue
+		}
+
+		// Skip pools reserved for other tenants
+		allowed, err := a.PoolAllowsNamespace(ctx, pool, cluster.Namespace)
+		if err != nil {
+			return "", err
+		}
+		if !allowed {
+			a.recordPoolDenied(cluster, pool.GetName(), role)
+			continue
+		}
+
+		return pool.GetName(), nil
+	}
+
+	return "", nil
+}
+
+// PoolMatches reports whether the pool's cluster-class and role labels select the class and role.
+// The cluster-class label holds class names directly, or "true" to read them from the
+// cluster-class annotation; both labels and the annotation accept comma-separated lists.
+func PoolMatches(pool *unstructured.Unstructured, className, role string) bool {
+	labels := pool.GetLabels()
+
+	classLabel, ok := labels[ClusterClassLabel()]
+	if !ok {
+		return false
+	}
+	if classLabel == ClusterClassLabelTrueFlag {
+		classAnnotation, ok := pool.GetAnnotations()[ClusterClassAnnotation()]
+		if !ok || !LabelContainsValue(classAnnotation, className) {
+			return false
+		}
+	} else if !LabelContainsValue(classLabel, className) {
+		return false
+	}
+
+	roleValue, ok := labels[RoleLabel()]
+	return ok && LabelContainsValue(roleValue, role)
+}
+
+// LabelContainsValue checks if a label value contains the target value.
+// Supports both exact match and comma-separated lists.
+// Examples:
+//   - LabelContainsValue("rke2-proxmox-class", "rke2-proxmox-class") -> true
+//   - LabelContainsValue("class1,class2,class3", "class2") -> true
+//   - LabelContainsValue("class1, class2, class3", "class2") -> true (with spaces)
+func LabelContainsValue(labelValue, targetValue string) bool {
+	targetValue = strings.TrimSpace(targetValue)
+
+	if strings.TrimSpace(labelValue) == targetValue {
+		return true
+	}
+
+	for _, val := range strings.Split(labelValue, ",") {
+		if strings.TrimSpace(val) == targetValue {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EnsureClaim gets or creates the role's IPAddressClaim for the cluster.
+//
+// Claims of persisted Clusters are owned by the Cluster; an existing claim
+// without owner, created by the runtime extension or the mutating webhook, is adopted. Claims
+// for Clusters that are not persisted yet are created without ownerReference and carry the
+// cluster-name label so they can be adopted later.
+func (a *PoolAllocator) EnsureClaim(ctx context.Context, cluster *clusterv1.Cluster, role string) (*unstructured.Unstructured, error) {
+	claimName := ClaimName(cluster.Name, role)
+	log := a.Logger.WithValues("cluster", cluster.Name, "claim", claimName, "role", role)
+
+	claim := &unstructured.Unstructured{}
+	claim.SetGroupVersionKind(ClaimGVK())
+
+	namespacedName := types.NamespacedName{Name: claimName, Namespace: cluster.Namespace}
+	if err := a.Client.Get(ctx, namespacedName, claim); err == nil {
+		if len(claim.GetOwnerReferences()) == 0 && isPersisted(cluster) {
+			log.Info("Adopting IPAddressClaim created without owner")
+			AdoptClaim(claim, cluster, role)
+
+			if err := a.Client.Update(ctx, claim); err != nil {
+				return nil, fmt.Errorf("adopt IPAddressClaim: %w", err)
+			}
+			log.Info("IPAddressClaim adopted successfully")
+		}
+		return claim, nil
+	} else if !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("get IPAddressClaim: %w", err)
+	}
+
+	poolName, err := a.FindPool(ctx, cluster, role)
+	if err != nil {
+		return nil, err
+	}
+	if poolName == "" {
+		className := ""
+		if cluster.Spec.Topology != nil {
+			className = cluster.Spec.Topology.Class
+		}
+		return nil, fmt.Errorf("no matching ip pool for class %q role %q", className, role)
+	}
+
+	if err := a.checkQuota(ctx, cluster, role); err != nil {
+		return nil, err
+	}
+
+	claim = NewClaim(cluster, role, poolName)
+	if err := a.Client.Create(ctx, claim); err != nil {
+		if !errors.IsAlreadyExists(err) {
+			return nil, fmt.Errorf("create IPAddressClaim: %w", err)
+		}
+		// Another allocation mode created it concurrently
+		log.Info("IPAddressClaim was created by another process, fetching it")
+		if err := a.Client.Get(ctx, namespacedName, claim); err != nil {
+			return nil, fmt.Errorf("fetch existing IPAddressClaim: %w", err)
+		}
+		return claim, nil
+	}
+	if err := a.confirmQuota(ctx, cluster, claim, role); err != nil {
+		return nil, err
+	}
+
+	if err := a.clearQuotaCondition(ctx, cluster); err != nil {
+		log.Error(err, "clear VIPAllocated condition")
+	}
+
+	return claim, nil
+}
+
+// NewClaim returns the role's IPAddressClaim for the cluster, requesting an address from the pool.
+// Claims of persisted Clusters are owned by the Cluster; all claims carry the role and
+// cluster-name labels.
+func NewClaim(cluster *clusterv1.Cluster, role, poolName string) *unstructured.Unstructured {
+	claim := &unstructured.Unstructured{}
+	claim.SetGroupVersionKind(ClaimGVK())
+	claim.SetName(ClaimName(cluster.Name, role))
+	claim.SetNamespace(cluster.Namespace)
+	annotations := map[string]string{
+		RequestedAtAnnotation(): time.Now().UTC().Format(time.RFC3339),
+	}
+	if !isPersisted(cluster) {
+		annotations[PendingAdoptionAnnotation()] = "true"
+	}
+	claim.SetAnnotations(annotations)
+	AdoptClaim(claim, cluster, role)
+	claim.Object["spec"] = map[string]interface{}{
+		"poolRef": map[string]interface{}{
+			"apiGroup": IPAMGroup,
+			"kind":     GlobalPoolKind,
+			"name":     poolName,
+		},
+	}
+	return claim
+}
+
+// AdoptClaim labels the claim for the cluster and role and, once the Cluster is persisted, makes
+// the Cluster its only controller owner and drops the pending adoption mark.
+func AdoptClaim(claim *unstructured.Unstructured, cluster *clusterv1.Cluster, role string) {
+	labels := claim.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[RoleLabel()] = role
+	labels[ClusterNameLabel] = cluster.Name
+	claim.SetLabels(labels)
+
+	if !isPersisted(cluster) {
+		return
+	}
+	owners := []metav1.OwnerReference{*metav1.NewControllerRef(cluster, clusterv1.GroupVersion.WithKind("Cluster"))}
+	for _, ref := range claim.GetOwnerReferences() {
+		// Drop references to Clusters, including stale ones left by a deleted Cluster of the same name
+		if ref.Kind != "Cluster" || !strings.HasPrefix(ref.APIVersion, clusterv1.GroupVersion.Group+"/") {
+			owners = append(owners, ref)
+		}
+	}
+	claim.SetOwnerReferences(owners)
+
+	if annotations := claim.GetAnnotations(); annotations[PendingAdoptionAnnotation()] != "" {
+		delete(annotations, PendingAdoptionAnnotation())
+		claim.SetAnnotations(annotations)
+	}
+}
+
+// isPersisted reports whether the Cluster has been stored by the API server.
+// Clusters seen by mutating admission on create have neither UID nor resourceVersion yet.
+func isPersisted(cluster *clusterv1.Cluster) bool {
+	return cluster.ResourceVersion != ""
+}
+
+// ResolveAddress returns the IP address bound to the claim.
+// ready is false while the IPAM provider has not allocated an address yet.
+// The first successful resolution is cached in the claim's address annotation,
+// so repeated calls for an allocated claim do not read the IPAddress again.
+func (a *PoolAllocator) ResolveAddress(ctx context.Context, claim *unstructured.Unstructured) (string, bool, error) {
+	if address := claim.GetAnnotations()[AddressAnnotation()]; address != "" {
+		return address, true, nil
+	}
+
+	address, ready, err := a.lookupAddress(ctx, claim)
+	if err != nil || !ready {
+		return "", false, err
+	}
+
+	if err := a.recordAddress(ctx, claim, address); err != nil {
+		// The annotation is only a shortcut, resolution succeeded regardless
+		a.Logger.V(1).Info("could not record address on IPAddressClaim", "claim", claim.GetName(), "error", err.Error())
+	}
+
+	return address, true, nil
+}
+
+// lookupAddress reads the address bound to the claim from its IPAddress without modifying anything.
+func (a *PoolAllocator) lookupAddress(ctx context.Context, claim *unstructured.Unstructured) (string, bool, error) {
+	if address := claim.GetAnnotations()[AddressAnnotation()]; address != "" {
+		return address, true, nil
+	}
+
+	addressName, found, err := unstructured.NestedString(claim.Object, "status", "addressRef", "name")
+	if err != nil {
+		return "", false, fmt.Errorf("read claim status: %w", err)
+	}
+	if !found || addressName == "" {
+		return "", false, nil
+	}
+
+	ip := &unstructured.Unstructured{}
+	ip.SetGroupVersionKind(AddressGVK())
+
+	nn := types.NamespacedName{Name: addressName, Namespace: claim.GetNamespace()}
+	if err := a.Client.Get(ctx, nn, ip); err != nil {
+		if errors.IsNotFound(err) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("get IPAddress: %w", err)
+	}
+
+	address, found, err := unstructured.NestedString(ip.Object, "spec", "address")
+	if err != nil {
+		return "", false, fmt.Errorf("read IPAddress: %w", err)
+	}
+	if !found || address == "" {
+		return "", false, nil
+	}
+
+	return address, true, nil
+}
+
+// recordAddress stores the resolved address in the claim's address annotation.
+func (a *PoolAllocator) recordAddress(ctx context.Context, claim *unstructured.Unstructured, address string) error {
+	patchBase := client.MergeFrom(claim.DeepCopy())
+	annotations := claim.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[AddressAnnotation()] = address
+	claim.SetAnnotations(annotations)
+
+	return a.Client.Patch(ctx, claim, patchBase)
+}
+
+// Release deletes the role's IPAddressClaim for the cluster, returning its address to the pool.
+// A missing claim is not an error.
+func (a *PoolAllocator) Release(ctx context.Context, cluster *clusterv1.Cluster, role string) error {
+	claim := &unstructured.Unstructured{}
+	claim.SetGroupVersionKind(ClaimGVK())
+	claim.SetName(ClaimName(cluster.Name, role))
+	claim.SetNamespace(cluster.Namespace)
+
+	if err := a.Client.Delete(ctx, claim); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("delete IPAddressClaim: %w", err)
+	}
+	return nil
+}
+
+// GetClusterClass fetches the ClusterClass for the given class name.
+// First tries to get it as cluster-scoped, then falls back to namespace-scoped.
+func (a *PoolAllocator) GetClusterClass(ctx context.Context, className string, clusterNamespace string) (*clusterv1.ClusterClass, error) {
+	clusterClass := &clusterv1.ClusterClass{}
+
+	// First try cluster-scoped (without namespace)
+	err := a.Client.Get(ctx, types.NamespacedName{Name: className}, clusterClass)
+	if err == nil {
+		return clusterClass, nil
+	}
+
+	// If not found, try namespace-scoped (with cluster's namespace)
+	if errors.IsNotFound(err) {
+		if err := a.Client.Get(ctx, types.NamespacedName{Name: className, Namespace: clusterNamespace}, clusterClass); err != nil {
+			return nil, fmt.Errorf("get ClusterClass %q (tried both cluster-scoped and namespace %q): %w", className, clusterNamespace, err)
+		}
+		return clusterClass, nil
+	}
+
+	return nil, fmt.Errorf("get ClusterClass %q: %w", className, err)
+}
@@ -0,0 +1,451 @@
+package allocator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestEnsureClaimErrorsWhenPoolMissing(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clusterv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add cluster api scheme: %v", err)
+	}
+	fixtures.RegisterIPAMGVKs(scheme)
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "no-pool",
+			Namespace: "default",
+		},
+		Spec: clusterv1.ClusterSpec{
+			Topology: &clusterv1.Topology{Class: "missing"},
+		},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(cluster).Build()
+	vips := New(client, testr.New(t), nil)
+
+	_, err := vips.EnsureClaim(context.Background(), cluster, ControlPlaneRole)
+	if err == nil {
+		t.Fatalf("expected error when pool is missing")
+	}
+	if !strings.Contains(err.Error(), "no matching ip pool") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFindPoolMatchesClusterClassAndRole(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clusterv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add cluster api scheme: %v", err)
+	}
+	fixtures.RegisterIPAMGVKs(scheme)
+
+	matching := fixtures.NewGlobalPool("control-plane-pool", map[string]string{
+		ClusterClassLabel(): "prod",
+		RoleLabel():         ControlPlaneRole,
+	})
+	wrongClass := fixtures.NewGlobalPool("wrong-class", map[string]string{
+		ClusterClassLabel(): "dev",
+		RoleLabel():         ControlPlaneRole,
+	})
+	wrongRole := fixtures.NewGlobalPool("wrong-role", map[string]string{
+		ClusterClassLabel(): "prod",
+		RoleLabel():         "ingress",
+	})
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(matching, wrongClass, wrongRole).
+		Build()
+
+	vips := New(client, testr.New(t), nil)
+
+	got, err := vips.FindPool(context.Background(), fixtures.NewTopologyCluster("default", "prod-cluster", "prod"), ControlPlaneRole)
+	if err != nil {
+		t.Fatalf("FindPool returned error: %v", err)
+	}
+	if got != matching.GetName() {
+		t.Fatalf("expected pool %q, got %q", matching.GetName(), got)
+	}
+}
+
+func TestResolveIPAddressPendingWithoutIPAddressResource(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clusterv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add cluster api scheme: %v", err)
+	}
+	fixtures.RegisterIPAMGVKs(scheme)
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "wait-for-ip",
+			Namespace: "default",
+		},
+	}
+
+	claim := fixtures.NewIPAddressClaim(cluster, "vip-cp-"+cluster.Name, map[string]string{RoleLabel(): ControlPlaneRole})
+	if err := unstructured.SetNestedField(claim.Object, map[string]interface{}{
+		"name": "pending-ip",
+	}, "status", "addressRef"); err != nil {
+		t.Fatalf("set claim status: %v", err)
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(claim).Build()
+	vips := New(client, testr.New(t), nil)
+
+	ip, ready, err := vips.ResolveAddress(context.Background(), claim)
+	if err != nil {
+		t.Fatalf("ResolveAddress returned error: %v", err)
+	}
+	if ready {
+		t.Fatalf("expected claim to be pending, got ready with ip %q", ip)
+	}
+	if ip != "" {
+		t.Fatalf("expected ip to be empty while pending, got %q", ip)
+	}
+}
+
+func TestGetClusterClass_NamespaceScoped(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clusterv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add cluster api scheme: %v", err)
+	}
+
+	// ClusterClass in namespace
+	clusterClass := &clusterv1.ClusterClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "rke2-proxmox-class",
+			Namespace: "clusters-proxmox",
+		},
+		Spec: clusterv1.ClusterClassSpec{
+			Variables: []clusterv1.ClusterClassVariable{
+				{Name: "clusterVip"},
+			},
+		},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(clusterClass).Build()
+	vips := New(client, testr.New(t), nil)
+
+	ctx := context.Background()
+
+	// Test: should find ClusterClass in namespace
+	got, err := vips.GetClusterClass(ctx, "rke2-proxmox-class", "clusters-proxmox")
+	if err != nil {
+		t.Fatalf("GetClusterClass returned error: %v", err)
+	}
+	if got.Name != "rke2-proxmox-class" {
+		t.Fatalf("expected ClusterClass name %q, got %q", "rke2-proxmox-class", got.Name)
+	}
+	if got.Namespace != "clusters-proxmox" {
+		t.Fatalf("expected ClusterClass namespace %q, got %q", "clusters-proxmox", got.Namespace)
+	}
+}
+
+func TestGetClusterClass_ClusterScoped(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clusterv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add cluster api scheme: %v", err)
+	}
+
+	// ClusterClass without namespace (cluster-scoped)
+	clusterClass := &clusterv1.ClusterClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "global-class",
+		},
+		Spec: clusterv1.ClusterClassSpec{
+			Variables: []clusterv1.ClusterClassVariable{
+				{Name: "someVariable"},
+			},
+		},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(clusterClass).Build()
+	vips := New(client, testr.New(t), nil)
+
+	ctx := context.Background()
+
+	// Test: should find cluster-scoped ClusterClass
+	got, err := vips.GetClusterClass(ctx, "global-class", "any-namespace")
+	if err != nil {
+		t.Fatalf("GetClusterClass returned error: %v", err)
+	}
+	if got.Name != "global-class" {
+		t.Fatalf("expected ClusterClass name %q, got %q", "global-class", got.Name)
+	}
+}
+
+func TestLabelContainsValue(t *testing.T) {
+	tests := []struct {
+		name        string
+		labelValue  string
+		targetValue string
+		expected    bool
+	}{
+		{
+			name:        "exact match",
+			labelValue:  "rke2-proxmox-class",
+			targetValue: "rke2-proxmox-class",
+			expected:    true,
+		},
+		{
+			name:        "exact match with spaces",
+			labelValue:  " rke2-proxmox-class ",
+			targetValue: "rke2-proxmox-class",
+			expected:    true,
+		},
+		{
+			name:        "comma-separated first value",
+			labelValue:  "class1,class2,class3",
+			targetValue: "class1",
+			expected:    true,
+		},
+		{
+			name:        "comma-separated middle value",
+			labelValue:  "class1,class2,class3",
+			targetValue: "class2",
+			expected:    true,
+		},
+		{
+			name:        "comma-separated last value",
+			labelValue:  "class1,class2,class3",
+			targetValue: "class3",
+			expected:    true,
+		},
+		{
+			name:        "comma-separated with spaces",
+			labelValue:  "class1, class2, class3",
+			targetValue: "class2",
+			expected:    true,
+		},
+		{
+			name:        "comma-separated with mixed spaces",
+			labelValue:  "class1,class2 ,  class3",
+			targetValue: "class3",
+			expected:    true,
+		},
+		{
+			name:        "no match single value",
+			labelValue:  "rke2-proxmox-class",
+			targetValue: "other-class",
+			expected:    false,
+		},
+		{
+			name:        "no match comma-separated",
+			labelValue:  "class1,class2,class3",
+			targetValue: "class4",
+			expected:    false,
+		},
+		{
+			name:        "partial substring no match",
+			labelValue:  "rke2-proxmox-class",
+			targetValue: "rke2",
+			expected:    false,
+		},
+		{
+			name:        "empty label value",
+			labelValue:  "",
+			targetValue: "class1",
+			expected:    false,
+		},
+		{
+			name:        "empty target value",
+			labelValue:  "class1",
+			targetValue: "",
+			expected:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := LabelContainsValue(tt.labelValue, tt.targetValue)
+			if got != tt.expected {
+				t.Errorf("LabelContainsValue(%q, %q) = %v, expected %v", tt.labelValue, tt.targetValue, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFindPoolWithCommaSeparatedLabels(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clusterv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add cluster api scheme: %v", err)
+	}
+	fixtures.RegisterIPAMGVKs(scheme)
+
+	// Pool with comma-separated cluster-class
+	poolMultiClass := fixtures.NewGlobalPool("multi-class-pool", map[string]string{
+		ClusterClassLabel(): "class1,class2,class3",
+		RoleLabel():         ControlPlaneRole,
+	})
+
+	// Pool with comma-separated role
+	poolMultiRole := fixtures.NewGlobalPool("multi-role-pool", map[string]string{
+		ClusterClassLabel(): "prod",
+		RoleLabel():         "control-plane,ingress",
+	})
+
+	// Pool with both comma-separated
+	poolBothMulti := fixtures.NewGlobalPool("both-multi-pool", map[string]string{
+		ClusterClassLabel(): "dev,staging,prod",
+		RoleLabel():         "control-plane,ingress",
+	})
+
+	// Single value pools for comparison
+	poolSingle := fixtures.NewGlobalPool("single-pool", map[string]string{
+		ClusterClassLabel(): "prod",
+		RoleLabel():         ControlPlaneRole,
+	})
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(poolMultiClass, poolMultiRole, poolBothMulti, poolSingle).
+		Build()
+
+	vips := New(client, testr.New(t), nil)
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		className     string
+		role          string
+		expectedPools []string // can match multiple pools, we check if result is one of these
+	}{
+		{
+			name:          "match second value in cluster-class",
+			className:     "class2",
+			role:          ControlPlaneRole,
+			expectedPools: []string{"multi-class-pool"},
+		},
+		{
+			name:          "match ingress role in multi-role pool",
+			className:     "prod",
+			role:          IngressRole,
+			expectedPools: []string{"multi-role-pool", "both-multi-pool"},
+		},
+		{
+			name:          "match control-plane role in multi-role pool",
+			className:     "prod",
+			role:          ControlPlaneRole,
+			expectedPools: []string{"single-pool", "both-multi-pool"},
+		},
+		{
+			name:          "match staging in both-multi pool",
+			className:     "staging",
+			role:          IngressRole,
+			expectedPools: []string{"both-multi-pool"},
+		},
+		{
+			name:          "no match",
+			className:     "nonexistent",
+			role:          ControlPlaneRole,
+			expectedPools: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := vips.FindPool(ctx, fixtures.NewTopologyCluster("default", "test-cluster", tt.className), tt.role)
+			if err != nil {
+				t.Fatalf("FindPool returned error: %v", err)
+			}
+
+			if len(tt.expectedPools) == 0 {
+				if got != "" {
+					t.Fatalf("expected no pool, got %q", got)
+				}
+				return
+			}
+
+			// Check if result is one of expected pools
+			found := false
+			for _, expected := range tt.expectedPools {
+				if got == expected {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Fatalf("expected one of %v, got %q", tt.expectedPools, got)
+			}
+		})
+	}
+}
+
+func TestEnsureClaimOwnershipFollowsClusterPersistence(t *testing.T) {
+	scheme := fixtures.NewScheme(t)
+
+	pool := fixtures.NewGlobalPool("pool-cp", map[string]string{
+		ClusterClassLabel(): "prod",
+		RoleLabel():         ControlPlaneRole,
+	})
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(pool).Build()
+	vips := New(client, testr.New(t), nil)
+	ctx := context.Background()
+
+	// Admission and runtime hooks see the Cluster before it is stored
+	pending := fixtures.NewTopologyCluster("default", "owned-later", "prod")
+	claim, err := vips.EnsureClaim(ctx, pending, ControlPlaneRole)
+	if err != nil {
+		t.Fatalf("EnsureClaim returned error: %v", err)
+	}
+	if len(claim.GetOwnerReferences()) != 0 {
+		t.Fatalf("expected no ownerReference for unpersisted cluster, got %#v", claim.GetOwnerReferences())
+	}
+	if claim.GetLabels()[ClusterNameLabel] != pending.Name || claim.GetLabels()[RoleLabel()] != ControlPlaneRole {
+		t.Fatalf("unexpected claim labels %#v", claim.GetLabels())
+	}
+	if claim.GetName() != ClaimName(pending.Name, ControlPlaneRole) {
+		t.Fatalf("unexpected claim name %q", claim.GetName())
+	}
+
+	// Once persisted, the same call adopts the claim
+	persisted := pending.DeepCopy()
+	persisted.UID = "cluster-uid"
+	persisted.ResourceVersion = "1"
+	claim, err = vips.EnsureClaim(ctx, persisted, ControlPlaneRole)
+	if err != nil {
+		t.Fatalf("EnsureClaim returned error: %v", err)
+	}
+	owners := claim.GetOwnerReferences()
+	if len(owners) != 1 || owners[0].UID != persisted.UID {
+		t.Fatalf("expected claim to be adopted by cluster, got %#v", owners)
+	}
+}
+
+func TestReleaseDeletesClaim(t *testing.T) {
+	scheme := fixtures.NewScheme(t)
+
+	cluster := fixtures.NewTopologyCluster("default", "released", "prod")
+	claim := fixtures.NewIPAddressClaim(cluster, ClaimName(cluster.Name, ControlPlaneRole), map[string]string{RoleLabel(): ControlPlaneRole})
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(claim).Build()
+	vips := New(client, testr.New(t), nil)
+	ctx := context.Background()
+
+	if err := vips.Release(ctx, cluster, ControlPlaneRole); err != nil {
+		t.Fatalf("Release returned error: %v", err)
+	}
+	if err := client.Get(ctx, types.NamespacedName{Name: claim.GetName(), Namespace: cluster.Namespace}, claim); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected claim to be deleted, got %v", err)
+	}
+
+	// Releasing again is a no-op
+	if err := vips.Release(ctx, cluster, IngressRole); err != nil {
+		t.Fatalf("Release of missing claim returned error: %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package allocator
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// PredictAddress returns the address the in-cluster IPAM provider would hand out next from the
+// pool: the lowest address of spec.addresses that is not the gateway, not excluded, not reserved
+// and not allocated yet. It returns "" when the pool is exhausted.
+func (a *PoolAllocator) PredictAddress(ctx context.Context, poolName string) (string, error) {
+	space, err := a.poolAddressSpace(ctx, poolName)
+	if err != nil {
+		return "", err
+	}
+	used, err := a.poolAddresses(ctx, poolName)
+	if err != nil {
+		return "", err
+	}
+
+	var next string
+	space.each(func(addr netip.Addr) bool {
+		if used[addr] {
+			return true
+		}
+		next = addr.String()
+		return false
+	})
+	return next, nil
+}
+
+// maxCountedAddresses caps PoolUsage for huge (IPv6) pools.
+const maxCountedAddresses = 1 << 20
+
+// PoolUsage is the capacity of a pool as the in-cluster IPAM provider sees it.
+type PoolUsage struct {
+	// Total is the number of allocatable addresses, capped at maxCountedAddresses
+	Total int
+	// Used is the number of allocatable addresses held by IPAddresses
+	Used int
+}
+
+// Free returns the number of addresses still available.
+func (u PoolUsage) Free() int {
+	return u.Total - u.Used
+}
+
+// PoolUsage counts the allocatable and allocated addresses of the pool.
+func (a *PoolAllocator) PoolUsage(ctx context.Context, poolName string) (PoolUsage, error) {
+	space, err := a.poolAddressSpace(ctx, poolName)
+	if err != nil {
+		return PoolUsage{}, err
+	}
+	used, err := a.poolAddresses(ctx, poolName)
+	if err != nil {
+		return PoolUsage{}, err
+	}
+
+	var usage PoolUsage
+	space.each(func(addr netip.Addr) bool {
+		usage.Total++
+		if used[addr] {
+			usage.Used++
+		}
+		return usage.Total < maxCountedAddresses
+	})
+	return usage, nil
+}
+
+// AddressAllocatable reports whether the pool may hand out the address: it lies within
+// spec.addresses and is not the gateway, excluded or reserved. It does not check whether the
+// address is in use.
+func (a *PoolAllocator) AddressAllocatable(ctx context.Context, poolName, address string) (bool, error) {
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return false, fmt.Errorf("invalid address %q: %w", address, err)
+	}
+	space, err := a.poolAddressSpace(ctx, poolName)
+	if err != nil {
+		return false, err
+	}
+	return space.contains(addr), nil
+}
+
+// poolAddressSpace describes the addresses a pool may hand out.
+type poolAddressSpace struct {
+	ranges   []AddressRange
+	excluded []AddressRange
+	// prefix is the subnet size used to find reserved addresses, 0 if unknown or not applicable
+	prefix int
+}
+
+// poolAddressSpace reads spec.addresses, the gateway, spec.excludedAddresses and the reserved
+// address settings of the pool.
+func (a *PoolAllocator) poolAddressSpace(ctx context.Context, poolName string) (poolAddressSpace, error) {
+	pool := &unstructured.Unstructured{}
+	pool.SetGroupVersionKind(PoolGVK())
+	if err := a.Client.Get(ctx, types.NamespacedName{Name: poolName}, pool); err != nil {
+		return poolAddressSpace{}, fmt.Errorf("get %s %q: %w", GlobalPoolKind, poolName, err)
+	}
+
+	entries, _, _ := unstructured.NestedStringSlice(pool.Object, "spec", "addresses")
+	ranges, err := ParseAddressRanges(entries)
+	if err != nil {
+		return poolAddressSpace{}, fmt.Errorf("pool %q: spec.addresses: %w", poolName, err)
+	}
+
+	excludedEntries, _, _ := unstructured.NestedStringSlice(pool.Object, "spec", "excludedAddresses")
+	if gateway, _, _ := unstructured.NestedString(pool.Object, "spec", "gateway"); gateway != "" {
+		excludedEntries = append(excludedEntries, gateway)
+	}
+	excluded, err := ParseAddressRanges(excludedEntries)
+	if err != nil {
+		return poolAddressSpace{}, fmt.Errorf("pool %q: excluded addresses: %w", poolName, err)
+	}
+
+	space := poolAddressSpace{ranges: ranges, excluded: excluded}
+	prefix, hasPrefix, _ := unstructured.NestedInt64(pool.Object, "spec", "prefix")
+	allocateReserved, _, _ := unstructured.NestedBool(pool.Object, "spec", "allocateReservedIPAddresses")
+	if hasPrefix && !allocateReserved {
+		space.prefix = int(prefix)
+	}
+	return space, nil
+}
+
+// each calls fn for every allocatable address in ascending order of the pool entries until fn
+// returns false.
+func (s poolAddressSpace) each(fn func(netip.Addr) bool) {
+	for _, r := range s.ranges {
+		for addr := r.Start; addr.IsValid() && addr.Compare(r.End) <= 0; addr = addr.Next() {
+			if skipTo, ok := excludedEnd(s.excluded, addr); ok {
+				addr = skipTo
+				continue
+			}
+			if s.prefix > 0 && isReservedAddress(addr, s.prefix) {
+				continue
+			}
+			if !fn(addr) {
+				return
+			}
+		}
+	}
+}
+
+// contains reports whether addr is allocatable.
+func (s poolAddressSpace) contains(addr netip.Addr) bool {
+	inRange := false
+	for _, r := range s.ranges {
+		if r.Contains(addr) {
+			inRange = true
+			break
+		}
+	}
+	if !inRange {
+		return false
+	}
+	if _, excluded := excludedEnd(s.excluded, addr); excluded {
+		return false
+	}
+	return s.prefix == 0 || !isReservedAddress(addr, s.prefix)
+}
+
+// excludedEnd returns the end of the excluded range containing addr, so iteration can skip it.
+func excludedEnd(excluded []AddressRange, addr netip.Addr) (netip.Addr, bool) {
+	for _, r := range excluded {
+		if r.Contains(addr) {
+			return r.End, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// isReservedAddress reports whether addr is the network or IPv4 broadcast address of its subnet,
+// which the in-cluster provider does not allocate unless allocateReservedIPAddresses is set.
+func isReservedAddress(addr netip.Addr, bits int) bool {
+	if addr.Is4() && bits >= 31 {
+		return false
+	}
+	subnet, err := addr.Prefix(bits)
+	if err != nil {
+		return false
+	}
+	return addr == subnet.Addr() || (addr.Is4() && addr == lastAddress(subnet))
+}
+
+// poolAddresses returns the addresses already allocated from the pool.
+func (a *PoolAllocator) poolAddresses(ctx context.Context, poolName string) (map[netip.Addr]bool, error) {
+	addresses := &unstructured.UnstructuredList{}
+	addresses.SetGroupVersionKind(AddressGVK().GroupVersion().WithKind(IPAddressKind + "List"))
+	if err := a.Client.List(ctx, addresses); err != nil {
+		return nil, fmt.Errorf("list IPAddresses: %w", err)
+	}
+
+	used := make(map[netip.Addr]bool)
+	for _, address := range addresses.Items {
+		ref, _, _ := unstructured.NestedStringMap(address.Object, "spec", "poolRef")
+		if ref["name"] != poolName || ref["kind"] != GlobalPoolKind {
+			continue
+		}
+		value, _, _ := unstructured.NestedString(address.Object, "spec", "address")
+		if addr, err := netip.ParseAddr(value); err == nil {
+			used[addr] = true
+		}
+	}
+	return used, nil
+}
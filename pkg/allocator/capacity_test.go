@@ -0,0 +1,109 @@
+package allocator
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPredictAddressSkipsUnavailableAddresses(t *testing.T) {
+	pool := newCapacityPool()
+
+	tests := []struct {
+		name string
+		used []string
+		want string
+	}{
+		{name: "skips network, gateway, excluded and used addresses", used: []string{"10.0.0.4"}, want: "10.0.0.5"},
+		{name: "never predicts the broadcast address", used: []string{"10.0.0.4", "10.0.0.5", "10.0.0.6"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := []runtime.Object{pool.DeepCopy()}
+			for i, address := range tt.used {
+				objects = append(objects, newPoolAddress(fmt.Sprintf("ip-%d", i), address, "pool"))
+			}
+			// An address of another pool must not count
+			objects = append(objects, newPoolAddress("other", "10.0.0.5", "other-pool"))
+
+			client := fake.NewClientBuilder().WithScheme(fixtures.NewScheme(t)).WithRuntimeObjects(objects...).Build()
+			got, err := New(client, testr.New(t), nil).PredictAddress(context.Background(), "pool")
+			if err != nil {
+				t.Fatalf("PredictAddress returned error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPoolUsageCountsAllocatableAddresses(t *testing.T) {
+	pool := newCapacityPool()
+	objects := []runtime.Object{
+		pool,
+		newPoolAddress("used", "10.0.0.4", "pool"),
+		// The gateway is not allocatable, so an address on it does not count as used
+		newPoolAddress("gateway", "10.0.0.1", "pool"),
+	}
+
+	client := fake.NewClientBuilder().WithScheme(fixtures.NewScheme(t)).WithRuntimeObjects(objects...).Build()
+	usage, err := New(client, testr.New(t), nil).PoolUsage(context.Background(), "pool")
+	if err != nil {
+		t.Fatalf("PoolUsage returned error: %v", err)
+	}
+	// 10.0.0.0/29 without network, broadcast, gateway and the two excluded addresses
+	if usage != (PoolUsage{Total: 3, Used: 1}) || usage.Free() != 2 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+}
+
+// newCapacityPool returns a /29 pool with a gateway and an excluded range.
+func newCapacityPool() *unstructured.Unstructured {
+	pool := fixtures.NewGlobalPool("pool", nil)
+	pool.Object["spec"] = map[string]interface{}{
+		"addresses":         []interface{}{"10.0.0.0/29"},
+		"prefix":            int64(29),
+		"gateway":           "10.0.0.1",
+		"excludedAddresses": []interface{}{"10.0.0.2-10.0.0.3"},
+	}
+	return pool
+}
+
+func newPoolAddress(name, address, poolName string) *unstructured.Unstructured {
+	ip := fixtures.NewIPAddress(name, "default", address)
+	if err := unstructured.SetNestedStringMap(ip.Object, map[string]string{"apiGroup": IPAMGroup, "kind": GlobalPoolKind, "name": poolName}, "spec", "poolRef"); err != nil {
+		panic(err)
+	}
+	return ip
+}
+
+func TestAddressAllocatable(t *testing.T) {
+	client := fake.NewClientBuilder().WithScheme(fixtures.NewScheme(t)).WithRuntimeObjects(newCapacityPool()).Build()
+	vips := New(client, testr.New(t), nil)
+
+	tests := map[string]bool{
+		"10.0.0.4": true,
+		"10.0.0.0": false, // network
+		"10.0.0.1": false, // gateway
+		"10.0.0.3": false, // excluded
+		"10.0.0.7": false, // broadcast
+		"10.0.1.4": false, // outside spec.addresses
+	}
+	for address, want := range tests {
+		got, err := vips.AddressAllocatable(context.Background(), "pool", address)
+		if err != nil {
+			t.Fatalf("%s: AddressAllocatable returned error: %v", address, err)
+		}
+		if got != want {
+			t.Errorf("%s: expected %v, got %v", address, want, got)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package allocator
+
+import (
+	"context"
+	"fmt"
+
+	vipv1alpha1 "github.com/gorizond/capi-vip-allocator/api/v1alpha1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// SetControlPlaneEndpoint sets the control plane endpoint and, if the ClusterClass defines it,
+// the VIP variable on the in-memory Cluster object. A missing port is set to the port of the
+// matching VIPAllocationPolicy, the ClusterClass default port, or defaultPort.
+func (a *PoolAllocator) SetControlPlaneEndpoint(ctx context.Context, cluster *clusterv1.Cluster, ip string, defaultPort int32) error {
+	policy, err := a.MatchPolicy(ctx, cluster, ControlPlaneRole)
+	if err != nil {
+		return err
+	}
+
+	// Set the controlPlaneEndpoint directly
+	cluster.Spec.ControlPlaneEndpoint.Host = ip
+	if cluster.Spec.ControlPlaneEndpoint.Port == 0 {
+		cluster.Spec.ControlPlaneEndpoint.Port = defaultPort
+		if port := ClassPort(cluster); port != 0 {
+			cluster.Spec.ControlPlaneEndpoint.Port = port
+		}
+		if policy != nil && policy.Spec.Port != 0 {
+			cluster.Spec.ControlPlaneEndpoint.Port = policy.Spec.Port
+		}
+	}
+
+	variableName := vipv1alpha1.DefaultControlPlaneVariable
+	if policy != nil {
+		variableName = policy.ControlPlaneVariable()
+	}
+
+	// Check if ClusterClass defines clusterVip variable (legacy mode)
+	// Only patch topology.variables if the variable is defined in ClusterClass
+	if cluster.Spec.Topology != nil {
+		clusterClass, err := a.GetClusterClass(ctx, cluster.Spec.Topology.Class, cluster.Namespace)
+		if err != nil {
+			return fmt.Errorf("get ClusterClass: %w", err)
+		}
+
+		// Check if ClusterClass defines clusterVip variable
+		if hasVariable(clusterClass, variableName) {
+			// Legacy mode: update or add clusterVip variable
+			found := false
+			for i := range cluster.Spec.Topology.Variables {
+				if cluster.Spec.Topology.Variables[i].Name == variableName {
+					cluster.Spec.Topology.Variables[i].Value.Raw = []byte(fmt.Sprintf("%q", ip))
+					found = true
+					break
+				}
+			}
+
+			// If not found, append new variable
+			if !found {
+				cluster.Spec.Topology.Variables = append(cluster.Spec.Topology.Variables, clusterv1.ClusterVariable{
+					Name:  variableName,
+					Value: apiextensionsv1.JSON{Raw: []byte(fmt.Sprintf("%q", ip))},
+				})
+			}
+		}
+		// If ClusterClass doesn't define clusterVip, we're in direct mode
+		// Only controlPlaneEndpoint.Host is set
+	}
+
+	return nil
+}
+
+// ClearControlPlaneEndpoint removes the control plane endpoint host and the VIP variable from
+// the in-memory Cluster object, so the reconciler allocates the VIP again.
+func (a *PoolAllocator) ClearControlPlaneEndpoint(ctx context.Context, cluster *clusterv1.Cluster) error {
+	policy, err := a.MatchPolicy(ctx, cluster, ControlPlaneRole)
+	if err != nil {
+		return err
+	}
+	variableName := vipv1alpha1.DefaultControlPlaneVariable
+	if policy != nil {
+		variableName = policy.ControlPlaneVariable()
+	}
+
+	cluster.Spec.ControlPlaneEndpoint.Host = ""
+	if cluster.Spec.Topology == nil {
+		return nil
+	}
+	variables := cluster.Spec.Topology.Variables[:0]
+	for _, variable := range cluster.Spec.Topology.Variables {
+		if variable.Name != variableName {
+			variables = append(variables, variable)
+		}
+	}
+	cluster.Spec.Topology.Variables = variables
+	return nil
+}
+
+// SetIngressVIP records the ingress VIP in the Cluster's ingress-vip annotation and label.
+func SetIngressVIP(cluster *clusterv1.Cluster, ip string) {
+	if cluster.Annotations == nil {
+		cluster.Annotations = make(map[string]string)
+	}
+	cluster.Annotations[IngressVIPAnnotation()] = ip
+
+	if cluster.Labels == nil {
+		cluster.Labels = make(map[string]string)
+	}
+	cluster.Labels[IngressVIPAnnotation()] = ip
+}
+
+// ClearIngressVIP removes the ingress-vip annotation and label from the Cluster.
+func ClearIngressVIP(cluster *clusterv1.Cluster) {
+	delete(cluster.Annotations, IngressVIPAnnotation())
+	delete(cluster.Labels, IngressVIPAnnotation())
+}
+
+// hasVariable checks if the ClusterClass defines the named variable (clusterVip by default).
+func hasVariable(clusterClass *clusterv1.ClusterClass, name string) bool {
+	for _, variable := range clusterClass.Spec.Variables {
+		if variable.Name == name {
+			return true
+		}
+	}
+	return false
+}
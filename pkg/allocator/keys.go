@@ -0,0 +1,63 @@
+package allocator
+
+// DefaultDomain is the domain of every label and annotation key unless Settings.Domain
+// changes it.
+const DefaultDomain = "vip.capi.gorizond.io"
+
+// Label and annotation keys. They live in the configured domain so that two allocators with
+// different domains can run side by side, each only seeing the pools, claims and Cluster
+// annotations of its own domain. Configure moves them, so they are read through these
+// functions on every use instead of being copied.
+
+// Domain returns the domain of the label and annotation keys.
+func Domain() string {
+	return currentSettings().Domain
+}
+
+// domainKey returns name in the configured domain.
+func domainKey(name string) string {
+	return Domain() + "/" + name
+}
+
+// ClusterClassLabel on a pool lists the ClusterClasses it serves, or is "true" to read them
+// from ClusterClassAnnotation.
+func ClusterClassLabel() string { return domainKey("cluster-class") }
+
+// ClusterClassAnnotation on a pool lists the ClusterClasses it serves when ClusterClassLabel is "true".
+func ClusterClassAnnotation() string { return domainKey("cluster-class") }
+
+// RoleLabel on pools and claims names the VIP roles.
+func RoleLabel() string { return domainKey("role") }
+
+// RequestedAtAnnotation records when the claim was created (RFC 3339).
+func RequestedAtAnnotation() string { return domainKey("requested-at") }
+
+// AddressAnnotation caches the allocated address on the claim once it is resolved.
+func AddressAnnotation() string { return domainKey("address") }
+
+// IngressVIPAnnotation carries the ingress VIP on the Cluster once it is allocated.
+func IngressVIPAnnotation() string { return domainKey("ingress-vip") }
+
+// IngressEnabledAnnotation set to "false" on a Cluster disables its ingress VIP.
+func IngressEnabledAnnotation() string { return domainKey("ingress-enabled") }
+
+// ShadowAnnotation on a Cluster overrides the manager-wide shadow mode: "true" only reports
+// the allocation the Cluster would get, "false" allocates for real.
+func ShadowAnnotation() string { return domainKey("shadow") }
+
+// AllowedNamespacesAnnotation on a pool lists the namespaces allowed to allocate from it.
+func AllowedNamespacesAnnotation() string { return domainKey("allowed-namespaces") }
+
+// NamespaceSelectorAnnotation on a pool holds a label selector namespaces must match.
+func NamespaceSelectorAnnotation() string { return domainKey("namespace-selector") }
+
+// VIPQuotaAnnotation on a Namespace caps the number of VIP claims its Clusters may hold.
+func VIPQuotaAnnotation() string { return domainKey("vip-quota") }
+
+// AllowVIPChangeAnnotation must be set to "true" on a Cluster to change an already set VIP.
+func AllowVIPChangeAnnotation() string { return domainKey("allow-vip-change") }
+
+// PendingAdoptionAnnotation marks a claim created during admission, before its Cluster existed.
+// The first adoption removes it; claims still carrying it after their Cluster failed to appear
+// are deleted by DeleteUnadoptedClaims.
+func PendingAdoptionAnnotation() string { return domainKey("pending-adoption") }
@@ -0,0 +1,97 @@
+package allocator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// DefaultClaimNameTemplate names claims after the role's claim prefix and the cluster,
+	// e.g. vip-cp-alpha.
+	DefaultClaimNameTemplate = "{{ .Prefix }}{{ .Cluster }}"
+
+	// claimNameHashLength is the number of hex digits of the hash that replaces the tail of
+	// names longer than validation.DNS1123SubdomainMaxLength.
+	claimNameHashLength = 10
+)
+
+// ClaimNameData is passed to the claim name template.
+type ClaimNameData struct {
+	// Cluster is the name of the Cluster
+	Cluster string
+	// Role is the VIP role, control-plane or ingress
+	Role string
+	// Prefix is the claim prefix configured for the role (vip-cp- or vip-ingress- by default)
+	Prefix string
+}
+
+// ParseClaimNameTemplate parses a claim name template and checks that it names the claims of
+// different clusters and roles differently and produces valid object names. Roles without a
+// prefix in prefixes use the default prefix.
+func ParseClaimNameTemplate(text string, prefixes map[string]string) (*template.Template, error) {
+	tmpl, err := template.New("claimName").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse claim name template: %w", err)
+	}
+
+	seen := map[string]string{}
+	for _, cluster := range []string{"alpha", "beta"} {
+		for _, role := range []string{ControlPlaneRole, IngressRole} {
+			prefix := prefixes[role]
+			if prefix == "" {
+				prefix = defaultClaimPrefixes()[role]
+			}
+			name, err := renderClaimName(tmpl, ClaimNameData{Cluster: cluster, Role: role, Prefix: prefix})
+			if err != nil {
+				return nil, err
+			}
+			if msgs := validation.IsDNS1123Subdomain(name); len(msgs) > 0 {
+				return nil, fmt.Errorf("claim name template renders invalid name %q: %s", name, strings.Join(msgs, "; "))
+			}
+			what := fmt.Sprintf("cluster %s role %s", cluster, role)
+			if other, ok := seen[name]; ok {
+				return nil, fmt.Errorf("claim name template renders %q for both %s and %s; use .Cluster and .Prefix or .Role", name, other, what)
+			}
+			seen[name] = what
+		}
+	}
+	return tmpl, nil
+}
+
+// renderClaimName executes the template without shortening the result.
+func renderClaimName(tmpl *template.Template, data ClaimNameData) (string, error) {
+	var name strings.Builder
+	if err := tmpl.Execute(&name, data); err != nil {
+		return "", fmt.Errorf("render claim name: %w", err)
+	}
+	return name.String(), nil
+}
+
+// shortenName keeps names within the object name length limit. Longer names are cut and end in
+// a hash of the full name, so distinct long names stay distinct.
+func shortenName(name string) string {
+	if len(name) <= validation.DNS1123SubdomainMaxLength {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:])[:claimNameHashLength]
+	head := strings.TrimRight(name[:validation.DNS1123SubdomainMaxLength-claimNameHashLength-1], "-.")
+	return head + "-" + hash
+}
+
+// claimNameAffixes returns the text the template puts before and after the cluster name for
+// the role. ok is false when the cluster name does not appear exactly once.
+func claimNameAffixes(role string) (prefix, suffix string, ok bool) {
+	const marker = "\x00"
+	name, err := renderClaimName(currentClaimNameTemplate(), claimNameData(marker, role))
+	if err != nil || strings.Count(name, marker) != 1 {
+		return "", "", false
+	}
+	prefix, suffix, _ = strings.Cut(name, marker)
+	return prefix, suffix, true
+}
@@ -0,0 +1,123 @@
+package allocator
+
+import (
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestClaimNameShortensLongNames(t *testing.T) {
+	long := strings.Repeat("a", 250)
+	cp := ClaimName(long, ControlPlaneRole)
+	ingress := ClaimName(long, IngressRole)
+	other := ClaimName(long+"b", ControlPlaneRole)
+
+	for _, name := range []string{cp, ingress, other} {
+		if msgs := validation.IsDNS1123Subdomain(name); len(msgs) > 0 {
+			t.Fatalf("claim name %q is invalid: %v", name, msgs)
+		}
+	}
+	if cp == ingress || cp == other {
+		t.Fatalf("shortened claim names collide: %q, %q, %q", cp, ingress, other)
+	}
+	if cp != ClaimName(long, ControlPlaneRole) {
+		t.Fatalf("shortened claim names must be stable")
+	}
+	if name := ClaimName("alpha", ControlPlaneRole); name != "vip-cp-alpha" {
+		t.Fatalf("short names must be kept, got %q", name)
+	}
+}
+
+func TestConfigureClaimNameTemplate(t *testing.T) {
+	if err := Configure(Settings{ClaimNameTemplate: "{{ .Cluster }}-{{ .Role }}-vip"}); err != nil {
+		t.Fatalf("Configure returned error: %v", err)
+	}
+	t.Cleanup(func() { _ = Configure(Settings{}) })
+
+	if name := ClaimName("alpha", IngressRole); name != "alpha-ingress-vip" {
+		t.Fatalf("unexpected claim name %q", name)
+	}
+
+	claim := &unstructured.Unstructured{}
+	claim.SetName("alpha-control-plane-vip")
+	if cluster := ClaimClusterName(claim); cluster != "alpha" {
+		t.Fatalf("expected cluster alpha from the claim name, got %q", cluster)
+	}
+}
+
+func TestConfigureRejectsInvalidNaming(t *testing.T) {
+	tests := map[string]Settings{
+		"cluster missing":     {ClaimNameTemplate: "{{ .Prefix }}vip"},
+		"roles collide":       {ClaimNameTemplate: "vip-{{ .Cluster }}"},
+		"invalid characters":  {ClaimNameTemplate: "VIP_{{ .Cluster }}"},
+		"unknown field":       {ClaimNameTemplate: "{{ .Namespace }}-{{ .Cluster }}"},
+		"invalid domain":      {Domain: "Not A Domain"},
+		"same prefix as role": {ClaimPrefixes: map[string]string{IngressRole: "vip-cp-"}},
+	}
+	for name, settings := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := Configure(settings); err == nil {
+				_ = Configure(Settings{})
+				t.Fatalf("expected error")
+			}
+			if ClaimName("alpha", ControlPlaneRole) != "vip-cp-alpha" {
+				t.Fatalf("a rejected configuration must keep the previous settings")
+			}
+		})
+	}
+}
+
+func TestConfigureLabelDomain(t *testing.T) {
+	if err := Configure(Settings{Domain: "vip.example.com"}); err != nil {
+		t.Fatalf("Configure returned error: %v", err)
+	}
+	t.Cleanup(func() { _ = Configure(Settings{}) })
+
+	if RoleLabel() != "vip.example.com/role" || ShadowAnnotation() != "vip.example.com/shadow" || AllowVIPChangeAnnotation() != "vip.example.com/allow-vip-change" {
+		t.Fatalf("keys not moved to the domain: %s, %s, %s", RoleLabel(), ShadowAnnotation(), AllowVIPChangeAnnotation())
+	}
+
+	pool := fixtures.NewGlobalPool("pool", map[string]string{
+		DefaultDomain + "/cluster-class": "prod",
+		DefaultDomain + "/role":          ControlPlaneRole,
+	})
+	if PoolMatches(pool, "prod", ControlPlaneRole) {
+		t.Fatalf("pools labelled in the default domain must be ignored")
+	}
+	pool.SetLabels(map[string]string{ClusterClassLabel(): "prod", RoleLabel(): ControlPlaneRole})
+	if !PoolMatches(pool, "prod", ControlPlaneRole) {
+		t.Fatalf("pools labelled in the configured domain must match")
+	}
+
+	cluster := fixtures.NewTopologyCluster("default", "c", "prod")
+	cluster.ObjectMeta = metav1.ObjectMeta{Name: "c", Annotations: map[string]string{DefaultDomain + "/shadow": "true"}}
+	if ShadowEnabled(cluster, false) {
+		t.Fatalf("annotations in the default domain must be ignored")
+	}
+}
+
+func TestConfigureWhileReadingKeys(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(Settings{}) })
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = Configure(Settings{Domain: "vip.example.com", PoolVersion: "v1alpha3"})
+			_ = Configure(Settings{})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if key := RoleLabel(); !strings.HasSuffix(key, "/role") {
+			t.Fatalf("unexpected role label %q", key)
+		}
+		if gvk := PoolGVK(); gvk.Kind != GlobalPoolKind {
+			t.Fatalf("unexpected pool GVK %v", gvk)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,176 @@
+package allocator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	vipv1alpha1 "github.com/gorizond/capi-vip-allocator/api/v1alpha1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// MatchPolicy returns the first VIPAllocationPolicy (by priority, then name) that applies
+// to the cluster and role. It returns nil when no policy matches or the CRD is not installed,
+// in which case callers fall back to label-based pool matching.
+func (a *PoolAllocator) MatchPolicy(ctx context.Context, cluster *clusterv1.Cluster, role string) (*vipv1alpha1.VIPAllocationPolicy, error) {
+	if cluster.Spec.Topology == nil {
+		return nil, nil
+	}
+
+	policies := &vipv1alpha1.VIPAllocationPolicyList{}
+	if err := a.Client.List(ctx, policies); err != nil {
+		if meta.IsNoMatchError(err) || runtime.IsNotRegisteredError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("list VIPAllocationPolicy: %w", err)
+	}
+
+	sort.SliceStable(policies.Items, func(i, j int) bool {
+		if policies.Items[i].Spec.Priority != policies.Items[j].Spec.Priority {
+			return policies.Items[i].Spec.Priority > policies.Items[j].Spec.Priority
+		}
+		return policies.Items[i].Name < policies.Items[j].Name
+	})
+
+	// ClusterClass and Namespace are fetched lazily, only when a selector needs them
+	var classLabels, namespaceLabels labels.Set
+
+	for i := range policies.Items {
+		policy := &policies.Items[i]
+		if !policy.AppliesToRole(role) {
+			continue
+		}
+
+		classMatches, err := a.policyMatchesClass(ctx, policy, cluster, &classLabels)
+		if err != nil {
+			return nil, err
+		}
+		if !classMatches {
+			continue
+		}
+
+		if policy.Spec.NamespaceSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(policy.Spec.NamespaceSelector)
+			if err != nil {
+				return nil, fmt.Errorf("VIPAllocationPolicy %q: invalid namespaceSelector: %w", policy.Name, err)
+			}
+			if namespaceLabels == nil {
+				if namespaceLabels, err = a.getNamespaceLabels(ctx, cluster.Namespace); err != nil {
+					return nil, err
+				}
+			}
+			if !selector.Matches(namespaceLabels) {
+				continue
+			}
+		}
+
+		return policy, nil
+	}
+
+	return nil, nil
+}
+
+// policyMatchesClass checks the policy's ClusterClass names and selector against the cluster's class.
+func (a *PoolAllocator) policyMatchesClass(ctx context.Context, policy *vipv1alpha1.VIPAllocationPolicy, cluster *clusterv1.Cluster, classLabels *labels.Set) (bool, error) {
+	className := cluster.Spec.Topology.Class
+
+	if len(policy.Spec.ClusterClasses) == 0 && policy.Spec.ClusterClassSelector == nil {
+		return true, nil
+	}
+
+	for _, name := range policy.Spec.ClusterClasses {
+		if name == className {
+			return true, nil
+		}
+	}
+
+	if policy.Spec.ClusterClassSelector == nil {
+		return false, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(policy.Spec.ClusterClassSelector)
+	if err != nil {
+		return false, fmt.Errorf("VIPAllocationPolicy %q: invalid clusterClassSelector: %w", policy.Name, err)
+	}
+	if *classLabels == nil {
+		clusterClass, err := a.GetClusterClass(ctx, className, cluster.Namespace)
+		if err != nil {
+			// A class that cannot be fetched cannot match a label selector
+			a.Logger.V(1).Info("could not fetch ClusterClass for policy selector", "policy", policy.Name, "class", className, "error", err.Error())
+			*classLabels = labels.Set{}
+		} else {
+			*classLabels = labels.Set(clusterClass.Labels)
+		}
+	}
+
+	return selector.Matches(*classLabels), nil
+}
+
+// poolFromPolicy returns the first pool referenced by the policy that exists and
+// allows the cluster's namespace.
+func (a *PoolAllocator) poolFromPolicy(ctx context.Context, cluster *clusterv1.Cluster, policy *vipv1alpha1.VIPAllocationPolicy, role string) (string, error) {
+	for _, ref := range policy.Spec.Pools {
+		kind := ref.Kind
+		if kind == "" {
+			kind = vipv1alpha1.DefaultPoolKind
+		}
+
+		pool := &unstructured.Unstructured{}
+		pool.SetGroupVersionKind(schema.GroupVersionKind{Group: IPAMGroup, Version: PoolGVK().Version, Kind: kind})
+		if err := a.Client.Get(ctx, types.NamespacedName{Name: ref.Name}, pool); err != nil {
+			if errors.IsNotFound(err) {
+				a.Logger.V(1).Info("pool referenced by VIPAllocationPolicy not found, trying next", "policy", policy.Name, "pool", ref.Name)
+				continue
+			}
+			return "", fmt.Errorf("get %s %q: %w", kind, ref.Name, err)
+		}
+
+		allowed, err := a.PoolAllowsNamespace(ctx, pool, cluster.Namespace)
+		if err != nil {
+			return "", err
+		}
+		if !allowed {
+			a.recordPoolDenied(cluster, pool.GetName(), role)
+			continue
+		}
+
+		return pool.GetName(), nil
+	}
+
+	return "", fmt.Errorf("VIPAllocationPolicy %q references no existing pool usable from namespace %q", policy.Name, cluster.Namespace)
+}
+
+// IngressEnabled reports whether an ingress VIP should be allocated for the cluster.
+// The ingress-enabled annotation set to "false" wins; otherwise the control-plane
+// VIPAllocationPolicy can disable it. Without either, the annotation set to "true", the
+// ClusterClass defaults and finally the manager default decide.
+func (a *PoolAllocator) IngressEnabled(ctx context.Context, cluster *clusterv1.Cluster) (bool, error) {
+	if cluster.Annotations[IngressEnabledAnnotation()] == "false" {
+		return false, nil
+	}
+
+	policy, err := a.MatchPolicy(ctx, cluster, ControlPlaneRole)
+	if err != nil {
+		return false, err
+	}
+	if policy != nil && policy.Spec.IngressPolicy == vipv1alpha1.IngressPolicyDisabled {
+		return false, nil
+	}
+
+	if cluster.Annotations[IngressEnabledAnnotation()] == "true" {
+		return true, nil
+	}
+	if defaults, ok := classDefaults(cluster); ok && defaults.IngressEnabled != nil {
+		return *defaults.IngressEnabled, nil
+	}
+	return !currentSettings().IngressDisabled, nil
+}
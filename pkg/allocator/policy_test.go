@@ -0,0 +1,81 @@
+package allocator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	vipv1alpha1 "github.com/gorizond/capi-vip-allocator/api/v1alpha1"
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestFindPoolPrefersPolicyOverLabels(t *testing.T) {
+	scheme := fixtures.NewScheme(t)
+
+	labelled := fixtures.NewGlobalPool("labelled-pool", map[string]string{
+		ClusterClassLabel(): "prod",
+		RoleLabel():         ControlPlaneRole,
+	})
+	policyPool := fixtures.NewGlobalPool("policy-pool", nil)
+
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-a", Labels: map[string]string{"tier": "gold"}}}
+
+	lowPriority := &vipv1alpha1.VIPAllocationPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "a-low"},
+		Spec: vipv1alpha1.VIPAllocationPolicySpec{
+			ClusterClasses: []string{"prod"},
+			Roles:          []string{ControlPlaneRole},
+			Pools:          []vipv1alpha1.PoolReference{{Name: "labelled-pool"}},
+		},
+	}
+	highPriority := &vipv1alpha1.VIPAllocationPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "b-high"},
+		Spec: vipv1alpha1.VIPAllocationPolicySpec{
+			Priority:          10,
+			ClusterClasses:    []string{"prod"},
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "gold"}},
+			Roles:             []string{ControlPlaneRole},
+			Pools:             []vipv1alpha1.PoolReference{{Name: "missing-pool"}, {Name: "policy-pool"}},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(labelled, policyPool, namespace, lowPriority, highPriority).
+		Build()
+	vips := New(client, testr.New(t), nil)
+	ctx := context.Background()
+
+	got, err := vips.FindPool(ctx, fixtures.NewTopologyCluster("tenant-a", "c1", "prod"), ControlPlaneRole)
+	if err != nil {
+		t.Fatalf("FindPool returned error: %v", err)
+	}
+	if got != "policy-pool" {
+		t.Fatalf("expected first existing pool of highest priority policy, got %q", got)
+	}
+
+	// Namespace without the label falls through to the lower priority policy
+	other := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-b"}}
+	if err := client.Create(ctx, other); err != nil {
+		t.Fatalf("create namespace: %v", err)
+	}
+	got, err = vips.FindPool(ctx, fixtures.NewTopologyCluster("tenant-b", "c2", "prod"), ControlPlaneRole)
+	if err != nil {
+		t.Fatalf("FindPool returned error: %v", err)
+	}
+	if got != "labelled-pool" {
+		t.Fatalf("expected pool from lower priority policy, got %q", got)
+	}
+
+	// No policy serves the ingress role and no pool is labelled for it
+	got, err = vips.FindPool(ctx, fixtures.NewTopologyCluster("tenant-a", "c1", "prod"), IngressRole)
+	if err != nil {
+		t.Fatalf("FindPool returned error: %v", err)
+	}
+	if got != "" {
+		t.Fatalf("expected no pool for ingress role, got %q", got)
+	}
+}
@@ -0,0 +1,210 @@
+package allocator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gorizond/capi-vip-allocator/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// VIPAllocatedCondition reports whether VIP allocation for the Cluster can proceed.
+	VIPAllocatedCondition clusterv1.ConditionType = "VIPAllocated"
+
+	// VIPQuotaExceededReason is used when the namespace VIP quota is exhausted.
+	VIPQuotaExceededReason = "VIPQuotaExceeded"
+)
+
+// ErrQuotaExceeded is returned when creating a claim would exceed the namespace VIP quota.
+var ErrQuotaExceeded = errors.New("namespace VIP quota exceeded")
+
+// checkQuota verifies that the cluster's namespace can hold one more VIP claim.
+// Namespaces without the vip-quota annotation are unlimited.
+func (a *PoolAllocator) checkQuota(ctx context.Context, cluster *clusterv1.Cluster, role string) error {
+	used, limit, limited, err := a.QuotaUsage(ctx, cluster.Namespace)
+	if err != nil {
+		return err
+	}
+	if !limited || used < limit {
+		return nil
+	}
+	return a.refuseQuota(ctx, cluster, role, used, limit)
+}
+
+// confirmQuota re-counts the namespace's claims after the claim was created and deletes it again
+// when concurrent allocations, from other reconciles, the mutating webhook or other replicas,
+// pushed the namespace over its quota. The count is read from the API server, so of two claims
+// racing for the last VIP at most one is kept.
+func (a *PoolAllocator) confirmQuota(ctx context.Context, cluster *clusterv1.Cluster, claim *unstructured.Unstructured, role string) error {
+	limit, limited, err := a.namespaceQuota(ctx, cluster.Namespace)
+	if err != nil || !limited {
+		return err
+	}
+	used, err := countClaims(ctx, a.apiReader(), cluster.Namespace)
+	if err != nil {
+		return err
+	}
+	if used <= limit {
+		return nil
+	}
+
+	uid := claim.GetUID()
+	if err := a.Client.Delete(ctx, claim, client.Preconditions{UID: &uid}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("delete IPAddressClaim over quota: %w", err)
+	}
+	return a.refuseQuota(ctx, cluster, role, used-1, limit)
+}
+
+// refuseQuota reports on the Cluster that the namespace quota is exhausted.
+func (a *PoolAllocator) refuseQuota(ctx context.Context, cluster *clusterv1.Cluster, role string, used, limit int) error {
+	message := fmt.Sprintf("namespace %s holds %d of %d allowed VIPs, refusing to allocate %s VIP", cluster.Namespace, used, limit, role)
+	a.Logger.Info("VIP quota exceeded", "cluster", cluster.Name, "namespace", cluster.Namespace, "role", role, "used", used, "limit", limit)
+	if a.Recorder != nil {
+		a.Recorder.Event(cluster, corev1.EventTypeWarning, VIPQuotaExceededReason, message)
+	}
+	if err := a.setVIPAllocatedCondition(ctx, cluster, false, message); err != nil {
+		a.Logger.Error(err, "set VIPAllocated condition", "cluster", cluster.Name)
+	}
+
+	return fmt.Errorf("%w: %s", ErrQuotaExceeded, message)
+}
+
+// QuotaUsage returns the number of VIP claims held in the namespace and its vip-quota limit.
+// limited is false, and used is not counted, when the namespace has no quota.
+func (a *PoolAllocator) QuotaUsage(ctx context.Context, namespace string) (used, limit int, limited bool, err error) {
+	limit, limited, err = a.namespaceQuota(ctx, namespace)
+	if err != nil || !limited {
+		return 0, limit, limited, err
+	}
+
+	used, err = countClaims(ctx, a.Client, namespace)
+	if err != nil {
+		return 0, limit, limited, err
+	}
+	return used, limit, true, nil
+}
+
+// countClaims returns the number of VIP claims in the namespace.
+func countClaims(ctx context.Context, reader client.Reader, namespace string) (int, error) {
+	claims := &unstructured.UnstructuredList{}
+	claims.SetGroupVersionKind(ClaimGVK().GroupVersion().WithKind(IPAddressClaimKind + "List"))
+	if err := reader.List(ctx, claims, client.InNamespace(namespace), client.HasLabels{RoleLabel()}); err != nil {
+		return 0, fmt.Errorf("list IPAddressClaims for quota: %w", err)
+	}
+	return len(claims.Items), nil
+}
+
+// namespaceQuota reads the vip-quota annotation from the namespace.
+func (a *PoolAllocator) namespaceQuota(ctx context.Context, namespace string) (int, bool, error) {
+	ns := &corev1.Namespace{}
+	if err := a.Client.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		if apierrors.IsNotFound(err) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("get namespace %q: %w", namespace, err)
+	}
+	return quotaLimit(ns)
+}
+
+// quotaLimit parses the vip-quota annotation of the namespace.
+func quotaLimit(ns *corev1.Namespace) (int, bool, error) {
+	raw, ok := ns.Annotations[VIPQuotaAnnotation()]
+	if !ok {
+		return 0, false, nil
+	}
+
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 0 {
+		return 0, false, fmt.Errorf("namespace %q: invalid %s annotation %q: must be a non-negative integer", ns.Name, VIPQuotaAnnotation(), raw)
+	}
+
+	return limit, true, nil
+}
+
+// setVIPAllocatedCondition records the VIPAllocated condition on the Cluster status.
+// Clusters that are not persisted yet (admission, runtime hooks) have no status to patch.
+func (a *PoolAllocator) setVIPAllocatedCondition(ctx context.Context, cluster *clusterv1.Cluster, allocated bool, message string) error {
+	if !isPersisted(cluster) {
+		return nil
+	}
+
+	patchHelper, err := patch.NewHelper(cluster, a.Client)
+	if err != nil {
+		return fmt.Errorf("create patch helper: %w", err)
+	}
+
+	if allocated {
+		conditions.MarkTrue(cluster, VIPAllocatedCondition)
+	} else {
+		conditions.MarkFalse(cluster, VIPAllocatedCondition, VIPQuotaExceededReason, clusterv1.ConditionSeverityWarning, "%s", message)
+	}
+
+	return patchHelper.Patch(ctx, cluster, patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{VIPAllocatedCondition}})
+}
+
+// clearQuotaCondition flips a previously failed VIPAllocated condition back to true.
+func (a *PoolAllocator) clearQuotaCondition(ctx context.Context, cluster *clusterv1.Cluster) error {
+	if !conditions.IsFalse(cluster, VIPAllocatedCondition) {
+		return nil
+	}
+	return a.setVIPAllocatedCondition(ctx, cluster, true, "")
+}
+
+// quotaCollectTimeout bounds the reads of one QuotaCollector scrape.
+const quotaCollectTimeout = 10 * time.Second
+
+// QuotaCollector reports the VIP quota and usage of every namespace with a vip-quota annotation
+// when the metrics are scraped, so the values follow claim deletions and cover idle namespaces.
+type QuotaCollector struct {
+	Client client.Reader
+	Logger logr.Logger
+}
+
+var _ prometheus.Collector = &QuotaCollector{}
+
+// Describe implements prometheus.Collector.
+func (c *QuotaCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metrics.VipNamespaceQuotaLimit
+	ch <- metrics.VipNamespaceQuotaUsed
+}
+
+// Collect implements prometheus.Collector.
+func (c *QuotaCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), quotaCollectTimeout)
+	defer cancel()
+
+	namespaces := &corev1.NamespaceList{}
+	if err := c.Client.List(ctx, namespaces); err != nil {
+		c.Logger.Error(err, "list namespaces for VIP quota metrics")
+		return
+	}
+	for i := range namespaces.Items {
+		ns := &namespaces.Items[i]
+		limit, limited, err := quotaLimit(ns)
+		if err != nil || !limited {
+			// Allocation reports an invalid annotation on the Clusters of the namespace
+			continue
+		}
+		used, err := countClaims(ctx, c.Client, ns.Name)
+		if err != nil {
+			c.Logger.Error(err, "count VIP claims for quota metrics", "namespace", ns.Name)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(metrics.VipNamespaceQuotaLimit, prometheus.GaugeValue, float64(limit), ns.Name)
+		ch <- prometheus.MustNewConstMetric(metrics.VipNamespaceQuotaUsed, prometheus.GaugeValue, float64(used), ns.Name)
+	}
+}
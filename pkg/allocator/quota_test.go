@@ -0,0 +1,188 @@
+package allocator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestEnsureClaimRefusesWhenQuotaExceeded(t *testing.T) {
+	scheme := fixtures.NewScheme(t)
+
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "tenant-a",
+		Annotations: map[string]string{VIPQuotaAnnotation(): "2"},
+	}}
+	existing := fixtures.NewTopologyCluster("tenant-a", "existing", "prod")
+	cluster := fixtures.NewTopologyCluster("tenant-a", "new", "prod")
+
+	pool := fixtures.NewGlobalPool("pool", map[string]string{
+		ClusterClassLabel(): "prod",
+		RoleLabel():         "control-plane,ingress",
+	})
+
+	// Two claims held by another cluster use up the quota
+	cpClaim := fixtures.NewIPAddressClaim(existing, "vip-cp-existing", map[string]string{RoleLabel(): ControlPlaneRole})
+	ingressClaim := fixtures.NewIPAddressClaim(existing, "vip-ingress-existing", map[string]string{RoleLabel(): ControlPlaneRole})
+	ingressClaim.SetLabels(map[string]string{RoleLabel(): IngressRole})
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(namespace, existing, cluster, pool, cpClaim, ingressClaim).
+		WithStatusSubresource(&clusterv1.Cluster{}).
+		Build()
+	recorder := record.NewFakeRecorder(10)
+	vips := New(client, testr.New(t), recorder)
+	ctx := context.Background()
+
+	_, err := vips.EnsureClaim(ctx, cluster, IngressRole)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected quota exceeded error, got %v", err)
+	}
+
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "Warning "+VIPQuotaExceededReason) || !strings.Contains(event, "2 of 2") {
+			t.Fatalf("unexpected event: %s", event)
+		}
+	default:
+		t.Fatalf("expected quota Warning event")
+	}
+
+	updated := &clusterv1.Cluster{}
+	if err := client.Get(ctx, types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace}, updated); err != nil {
+		t.Fatalf("fetch cluster: %v", err)
+	}
+	if !conditions.IsFalse(updated, VIPAllocatedCondition) {
+		t.Fatalf("expected %s condition to be false, got %#v", VIPAllocatedCondition, updated.Status.Conditions)
+	}
+	if reason := conditions.GetReason(updated, VIPAllocatedCondition); reason != VIPQuotaExceededReason {
+		t.Fatalf("expected reason %q, got %q", VIPQuotaExceededReason, reason)
+	}
+
+	// Raising the quota lets the claim through and clears the condition
+	namespace.Annotations[VIPQuotaAnnotation()] = "3"
+	if err := client.Update(ctx, namespace); err != nil {
+		t.Fatalf("update namespace: %v", err)
+	}
+	if _, err := vips.EnsureClaim(ctx, updated, IngressRole); err != nil {
+		t.Fatalf("expected claim to be created, got %v", err)
+	}
+	if !conditions.IsTrue(updated, VIPAllocatedCondition) {
+		t.Fatalf("expected %s condition to be true after allocation", VIPAllocatedCondition)
+	}
+}
+
+func TestEnsureClaimRollsBackRacingClaimOverQuota(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "tenant-a",
+		Annotations: map[string]string{VIPQuotaAnnotation(): "1"},
+	}}
+	other := fixtures.NewTopologyCluster("tenant-a", "other", "prod")
+	cluster := fixtures.NewTopologyCluster("tenant-a", "new", "prod")
+	pool := fixtures.NewGlobalPool("pool", map[string]string{
+		ClusterClassLabel(): "prod",
+		RoleLabel():         ControlPlaneRole,
+	})
+	// The claim of a concurrent allocation that the cache has not seen yet
+	racing := fixtures.NewIPAddressClaim(other, "vip-cp-other", map[string]string{RoleLabel(): ControlPlaneRole})
+
+	live := fake.NewClientBuilder().
+		WithScheme(fixtures.NewScheme(t)).
+		WithRuntimeObjects(namespace, other, cluster, pool, racing).
+		WithStatusSubresource(&clusterv1.Cluster{}).
+		Build()
+	cached := interceptor.NewClient(live.(client.WithWatch), interceptor.Funcs{
+		List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if err := c.List(ctx, list, opts...); err != nil {
+				return err
+			}
+			if claims, ok := list.(*unstructured.UnstructuredList); ok && claims.GetKind() == IPAddressClaimKind+"List" {
+				kept := claims.Items[:0]
+				for _, claim := range claims.Items {
+					if claim.GetName() != racing.GetName() {
+						kept = append(kept, claim)
+					}
+				}
+				claims.Items = kept
+			}
+			return nil
+		},
+	})
+	vips := New(cached, testr.New(t), nil)
+	vips.APIReader = live
+	ctx := context.Background()
+
+	if _, err := vips.EnsureClaim(ctx, cluster, ControlPlaneRole); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected quota exceeded error, got %v", err)
+	}
+	if used, err := countClaims(ctx, live, namespace.Name); err != nil || used != 1 {
+		t.Fatalf("expected the claim over quota to be deleted, %d claims left (%v)", used, err)
+	}
+	if used, _, _, _ := vips.QuotaUsage(ctx, namespace.Name); used != 0 {
+		t.Fatalf("the cached client must hide the racing claim, counted %d", used)
+	}
+}
+
+func TestQuotaCollector(t *testing.T) {
+	limited := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "tenant-a",
+		Annotations: map[string]string{VIPQuotaAnnotation(): "3"},
+	}}
+	idle := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "tenant-b",
+		Annotations: map[string]string{VIPQuotaAnnotation(): "2"},
+	}}
+	invalid := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "tenant-c",
+		Annotations: map[string]string{VIPQuotaAnnotation(): "many"},
+	}}
+	unlimited := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+	cluster := fixtures.NewTopologyCluster("tenant-a", "c1", "prod")
+	free := fixtures.NewTopologyCluster("default", "c2", "prod")
+
+	c := fake.NewClientBuilder().
+		WithScheme(fixtures.NewScheme(t)).
+		WithRuntimeObjects(limited, idle, invalid, unlimited,
+			fixtures.NewIPAddressClaim(cluster, "vip-cp-c1", map[string]string{RoleLabel(): ControlPlaneRole}),
+			fixtures.NewIPAddressClaim(free, "vip-cp-c2", map[string]string{RoleLabel(): ControlPlaneRole})).
+		Build()
+	collector := &QuotaCollector{Client: c, Logger: testr.New(t)}
+
+	expected := `
+# HELP capi_vip_allocator_namespace_quota_limit Maximum number of VIP claims allowed in the namespace
+# TYPE capi_vip_allocator_namespace_quota_limit gauge
+capi_vip_allocator_namespace_quota_limit{namespace="tenant-a"} 3
+capi_vip_allocator_namespace_quota_limit{namespace="tenant-b"} 2
+# HELP capi_vip_allocator_namespace_quota_used Number of VIP claims counted against the namespace quota
+# TYPE capi_vip_allocator_namespace_quota_used gauge
+capi_vip_allocator_namespace_quota_used{namespace="tenant-a"} 1
+capi_vip_allocator_namespace_quota_used{namespace="tenant-b"} 0
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Fatalf("unexpected quota metrics: %v", err)
+	}
+
+	// Deleting a claim is reflected by the next scrape
+	if err := c.DeleteAllOf(context.Background(), fixtures.NewIPAddressClaim(cluster, "", nil), client.InNamespace("tenant-a")); err != nil {
+		t.Fatalf("delete claims: %v", err)
+	}
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(strings.Replace(expected, `{namespace="tenant-a"} 1`, `{namespace="tenant-a"} 0`, 1)), "capi_vip_allocator_namespace_quota_used"); err != nil {
+		t.Fatalf("unexpected quota usage after delete: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package allocator
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// AddressRange is an inclusive range of IP addresses of a single family.
+type AddressRange struct {
+	// Source is the pool entry the range was parsed from
+	Source string
+	Start  netip.Addr
+	End    netip.Addr
+}
+
+// Overlaps reports whether both ranges share at least one address.
+func (r AddressRange) Overlaps(other AddressRange) bool {
+	if r.Start.Is4() != other.Start.Is4() {
+		return false
+	}
+	return r.Start.Compare(other.End) <= 0 && other.Start.Compare(r.End) <= 0
+}
+
+// Contains reports whether the address falls into the range.
+func (r AddressRange) Contains(addr netip.Addr) bool {
+	return r.Start.Is4() == addr.Is4() && r.Start.Compare(addr) <= 0 && addr.Compare(r.End) <= 0
+}
+
+// ParseAddressRanges parses pool spec.addresses entries as accepted by the in-cluster IPAM
+// provider: single addresses ("10.0.0.1"), CIDRs ("10.0.0.0/28") and ranges ("10.0.0.1-10.0.0.9").
+func ParseAddressRanges(entries []string) ([]AddressRange, error) {
+	ranges := make([]AddressRange, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+
+		switch {
+		case strings.Contains(entry, "/"):
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("parse CIDR %q: %w", entry, err)
+			}
+			prefix = prefix.Masked()
+			ranges = append(ranges, AddressRange{Source: entry, Start: prefix.Addr(), End: lastAddress(prefix)})
+
+		case strings.Contains(entry, "-"):
+			parts := strings.SplitN(entry, "-", 2)
+			start, err := netip.ParseAddr(strings.TrimSpace(parts[0]))
+			if err != nil {
+				return nil, fmt.Errorf("parse range start %q: %w", entry, err)
+			}
+			end, err := netip.ParseAddr(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return nil, fmt.Errorf("parse range end %q: %w", entry, err)
+			}
+			if start.Is4() != end.Is4() || start.Compare(end) > 0 {
+				return nil, fmt.Errorf("invalid range %q", entry)
+			}
+			ranges = append(ranges, AddressRange{Source: entry, Start: start, End: end})
+
+		default:
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("parse address %q: %w", entry, err)
+			}
+			ranges = append(ranges, AddressRange{Source: entry, Start: addr, End: addr})
+		}
+	}
+	return ranges, nil
+}
+
+// lastAddress returns the highest address within the (masked) prefix.
+func lastAddress(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(bytes)*8; bit++ {
+		bytes[bit/8] |= 1 << (7 - bit%8)
+	}
+	addr, _ := netip.AddrFromSlice(bytes)
+	return addr
+}
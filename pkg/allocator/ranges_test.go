@@ -0,0 +1,20 @@
+package allocator
+
+import "testing"
+
+func TestParseAddressRanges(t *testing.T) {
+	ranges, err := ParseAddressRanges([]string{"10.0.0.0/30", "10.0.0.8-10.0.0.9", "fd00::1"})
+	if err != nil {
+		t.Fatalf("ParseAddressRanges returned error: %v", err)
+	}
+	if got := ranges[0].End.String(); got != "10.0.0.3" {
+		t.Fatalf("expected CIDR to end at 10.0.0.3, got %s", got)
+	}
+	if ranges[0].Overlaps(ranges[1]) || ranges[1].Overlaps(ranges[2]) {
+		t.Fatalf("expected disjoint ranges")
+	}
+
+	if _, err := ParseAddressRanges([]string{"10.0.0.9-10.0.0.1"}); err == nil {
+		t.Fatalf("expected error for reversed range")
+	}
+}
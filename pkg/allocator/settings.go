@@ -0,0 +1,132 @@
+package allocator
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Settings holds the allocation behaviour that the manager configuration file can change.
+// The zero value of every field keeps the built-in default.
+type Settings struct {
+	// Domain is the domain of every label and annotation key (default vip.capi.gorizond.io)
+	Domain string
+	// ClaimPrefixes maps a role to the prefix of its IPAddressClaim names
+	ClaimPrefixes map[string]string
+	// ClaimNameTemplate is a text/template rendering ClaimNameData into a claim name
+	ClaimNameTemplate string
+	// IPAMVersion is the API version of IPAddressClaims and IPAddresses
+	IPAMVersion string
+	// PoolVersion is the API version of GlobalInClusterIPPools
+	PoolVersion string
+	// IngressDisabled turns the ingress VIP off unless a class or annotation enables it
+	IngressDisabled bool
+	// Classes holds per-ClusterClass defaults, keyed by ClusterClass name
+	Classes map[string]ClassDefaults
+}
+
+// ClassDefaults are the defaults applied to Clusters of one ClusterClass. They sit between
+// the manager-wide defaults and the Cluster annotations and VIPAllocationPolicies.
+type ClassDefaults struct {
+	// Port is the control plane port used when neither the Cluster nor a policy sets one
+	Port int32
+	// IngressEnabled enables or disables the ingress VIP, nil keeps the manager default
+	IngressEnabled *bool
+	// Shadow enables or disables shadow mode, nil keeps the manager default
+	Shadow *bool
+}
+
+var (
+	settingsMu        sync.RWMutex
+	settings          = defaultSettings()
+	claimNameTemplate = template.Must(ParseClaimNameTemplate(DefaultClaimNameTemplate, settings.ClaimPrefixes))
+)
+
+func defaultClaimPrefixes() map[string]string {
+	return map[string]string{
+		ControlPlaneRole: "vip-cp-",
+		IngressRole:      "vip-ingress-",
+	}
+}
+
+func defaultSettings() Settings {
+	return Settings{
+		Domain:            DefaultDomain,
+		ClaimPrefixes:     defaultClaimPrefixes(),
+		ClaimNameTemplate: DefaultClaimNameTemplate,
+		IPAMVersion:       IPAMVersion,
+		PoolVersion:       GlobalPoolAPIVersion,
+	}
+}
+
+// Configure replaces the allocation settings. It is meant to be called once at startup,
+// before any allocation runs; unset fields fall back to the built-in defaults.
+func Configure(s Settings) error {
+	merged := defaultSettings()
+	if s.Domain != "" {
+		if msgs := validation.IsDNS1123Subdomain(s.Domain); len(msgs) > 0 {
+			return fmt.Errorf("invalid label domain %q: %s", s.Domain, strings.Join(msgs, "; "))
+		}
+		merged.Domain = s.Domain
+	}
+	for role, prefix := range s.ClaimPrefixes {
+		if prefix != "" {
+			merged.ClaimPrefixes[role] = prefix
+		}
+	}
+	if s.ClaimNameTemplate != "" {
+		merged.ClaimNameTemplate = s.ClaimNameTemplate
+	}
+	tmpl, err := ParseClaimNameTemplate(merged.ClaimNameTemplate, merged.ClaimPrefixes)
+	if err != nil {
+		return err
+	}
+	if s.IPAMVersion != "" {
+		merged.IPAMVersion = s.IPAMVersion
+	}
+	if s.PoolVersion != "" {
+		merged.PoolVersion = s.PoolVersion
+	}
+	merged.IngressDisabled = s.IngressDisabled
+	merged.Classes = s.Classes
+
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	settings = merged
+	claimNameTemplate = tmpl
+	return nil
+}
+
+// currentSettings returns the active settings.
+func currentSettings() Settings {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return settings
+}
+
+// currentClaimNameTemplate returns the active claim name template.
+func currentClaimNameTemplate() *template.Template {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return claimNameTemplate
+}
+
+// classDefaults returns the defaults configured for the cluster's ClusterClass.
+func classDefaults(cluster *clusterv1.Cluster) (ClassDefaults, bool) {
+	if cluster.Spec.Topology == nil {
+		return ClassDefaults{}, false
+	}
+	defaults, ok := currentSettings().Classes[cluster.Spec.Topology.Class]
+	return defaults, ok
+}
+
+// ClassPort returns the control plane port configured for the cluster's ClusterClass, or 0.
+func ClassPort(cluster *clusterv1.Cluster) int32 {
+	defaults, _ := classDefaults(cluster)
+	return defaults.Port
+}
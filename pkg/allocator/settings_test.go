@@ -0,0 +1,75 @@
+package allocator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestConfigureClassDefaults(t *testing.T) {
+	disabled, enabled := false, true
+	err := Configure(Settings{
+		ClaimPrefixes:   map[string]string{ControlPlaneRole: "api-vip-"},
+		PoolVersion:     "v1alpha3",
+		IngressDisabled: true,
+		Classes: map[string]ClassDefaults{
+			"edge": {Port: 9345, IngressEnabled: &enabled, Shadow: &enabled},
+			"prod": {Shadow: &disabled},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Configure returned error: %v", err)
+	}
+	t.Cleanup(func() { _ = Configure(Settings{}) })
+
+	if name := ClaimName("c1", ControlPlaneRole); name != "api-vip-c1" {
+		t.Fatalf("expected configured control plane prefix, got %q", name)
+	}
+	if name := ClaimName("c1", IngressRole); name != "vip-ingress-c1" {
+		t.Fatalf("expected default ingress prefix, got %q", name)
+	}
+	if PoolGVK().Version != "v1alpha3" || ClaimGVK().Version != IPAMVersion {
+		t.Fatalf("unexpected GVK versions: pool %s, claim %s", PoolGVK().Version, ClaimGVK().Version)
+	}
+
+	edge := fixtures.NewTopologyCluster("default", "e", "edge")
+	prod := fixtures.NewTopologyCluster("default", "p", "prod")
+	if ClassPort(edge) != 9345 || ClassPort(prod) != 0 {
+		t.Fatalf("unexpected class ports: edge %d, prod %d", ClassPort(edge), ClassPort(prod))
+	}
+	if !ShadowEnabled(edge, false) || ShadowEnabled(prod, true) {
+		t.Fatalf("class shadow defaults must override the global setting")
+	}
+	prod.Annotations = map[string]string{ShadowAnnotation(): "true"}
+	if !ShadowEnabled(prod, false) {
+		t.Fatalf("shadow annotation must override the class default")
+	}
+
+	vips := New(fake.NewClientBuilder().WithScheme(fixtures.NewScheme(t)).Build(), testr.New(t), nil)
+	ctx := context.Background()
+	for _, tt := range []struct {
+		class      string
+		annotation string
+		want       bool
+	}{
+		{class: "edge", want: true},
+		{class: "prod", want: false},
+		{class: "prod", annotation: "true", want: true},
+		{class: "edge", annotation: "false", want: false},
+	} {
+		cluster := fixtures.NewTopologyCluster("default", "c", tt.class)
+		if tt.annotation != "" {
+			cluster.Annotations = map[string]string{IngressEnabledAnnotation(): tt.annotation}
+		}
+		got, err := vips.IngressEnabled(ctx, cluster)
+		if err != nil {
+			t.Fatalf("IngressEnabled returned error: %v", err)
+		}
+		if got != tt.want {
+			t.Fatalf("class %s, annotation %q: expected ingress %v, got %v", tt.class, tt.annotation, tt.want, got)
+		}
+	}
+}
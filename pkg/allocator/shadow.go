@@ -0,0 +1,131 @@
+package allocator
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	"github.com/gorizond/capi-vip-allocator/pkg/metrics"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// ShadowAllocationReason is the event reason used to report shadow allocations.
+	ShadowAllocationReason = "ShadowAllocation"
+)
+
+// ShadowEnabled reports whether allocation for the cluster only runs in shadow mode.
+// The shadow annotation wins over the ClusterClass defaults, which win over global.
+func ShadowEnabled(cluster *clusterv1.Cluster, global bool) bool {
+	if value, ok := cluster.Annotations[ShadowAnnotation()]; ok {
+		if enabled, err := strconv.ParseBool(value); err == nil {
+			return enabled
+		}
+	}
+	if defaults, ok := classDefaults(cluster); ok && defaults.Shadow != nil {
+		return *defaults.Shadow
+	}
+	return global
+}
+
+// ShadowResult is the allocation a cluster role would get, next to the one it has now.
+type ShadowResult struct {
+	Role string
+	// Pool is the pool selected with the current configuration, "" if none matches
+	Pool string
+	// Address is the address that pool would hand out, "" if the pool has no free address
+	Address string
+	// CurrentPool is the pool of the existing IPAddressClaim, if any
+	CurrentPool string
+	// CurrentAddress is the address of the existing claim, or the address set on the Cluster
+	CurrentAddress string
+}
+
+// Changed reports whether the shadow allocation differs from the current one.
+func (r ShadowResult) Changed() bool {
+	return r.Pool != r.CurrentPool || r.Address != r.CurrentAddress
+}
+
+// Shadow runs pool selection for the cluster role and predicts the address it would receive,
+// without creating claims or modifying the Cluster. An existing claim from the selected pool
+// keeps its address.
+func (a *PoolAllocator) Shadow(ctx context.Context, cluster *clusterv1.Cluster, role string) (ShadowResult, error) {
+	result := ShadowResult{Role: role}
+
+	claim := &unstructured.Unstructured{}
+	claim.SetGroupVersionKind(ClaimGVK())
+	err := a.Client.Get(ctx, types.NamespacedName{Name: ClaimName(cluster.Name, role), Namespace: cluster.Namespace}, claim)
+	switch {
+	case err == nil:
+		result.CurrentPool, _, _ = unstructured.NestedString(claim.Object, "spec", "poolRef", "name")
+		if result.CurrentAddress, _, err = a.lookupAddress(ctx, claim); err != nil {
+			return result, err
+		}
+	case errors.IsNotFound(err):
+		result.CurrentAddress = currentClusterAddress(cluster, role)
+	default:
+		return result, fmt.Errorf("get IPAddressClaim: %w", err)
+	}
+
+	if result.Pool, err = a.FindPool(ctx, cluster, role); err != nil || result.Pool == "" {
+		return result, err
+	}
+
+	if result.Pool == result.CurrentPool && result.CurrentAddress != "" {
+		result.Address = result.CurrentAddress
+		return result, nil
+	}
+
+	result.Address, err = a.PredictAddress(ctx, result.Pool)
+	return result, err
+}
+
+// currentClusterAddress returns the address the Cluster already carries for the role.
+func currentClusterAddress(cluster *clusterv1.Cluster, role string) string {
+	if role == IngressRole {
+		return cluster.Annotations[IngressVIPAnnotation()]
+	}
+	return cluster.Spec.ControlPlaneEndpoint.Host
+}
+
+// ReportShadow publishes a shadow allocation as a log line, a Normal event on the Cluster and the
+// capi_vip_allocator_shadow_allocation gauge. The recorder may be nil.
+func ReportShadow(logger logr.Logger, recorder record.EventRecorder, cluster *clusterv1.Cluster, result ShadowResult) {
+	message := fmt.Sprintf("Shadow mode: no pool matches the %s role", result.Role)
+	switch {
+	case result.Pool != "" && result.Address == "":
+		message = fmt.Sprintf("Shadow mode: would allocate the %s VIP from pool %s, but it has no free address", result.Role, result.Pool)
+	case result.Pool != "":
+		message = fmt.Sprintf("Shadow mode: would allocate %s VIP %s from pool %s", result.Role, result.Address, result.Pool)
+	}
+	if result.CurrentPool != "" || result.CurrentAddress != "" {
+		message += fmt.Sprintf(" (current: %q from pool %q)", result.CurrentAddress, result.CurrentPool)
+	}
+
+	logger.Info("shadow allocation", "cluster", cluster.Name, "namespace", cluster.Namespace, "role", result.Role,
+		"pool", result.Pool, "address", result.Address, "currentPool", result.CurrentPool, "currentAddress", result.CurrentAddress, "changed", result.Changed())
+	if recorder != nil {
+		recorder.Event(cluster, corev1.EventTypeNormal, ShadowAllocationReason, message)
+	}
+
+	metrics.VipShadowAllocation.DeletePartialMatch(prometheus.Labels{"namespace": cluster.Namespace, "cluster": cluster.Name, "role": result.Role})
+	changed := 0.0
+	if result.Changed() {
+		changed = 1
+	}
+	metrics.VipShadowAllocation.WithLabelValues(cluster.Namespace, cluster.Name, result.Role, result.Pool, result.Address, result.CurrentPool, result.CurrentAddress).Set(changed)
+}
+
+// ForgetShadow drops the shadow allocation series of a cluster, e.g. once it is deleted or
+// leaves shadow mode.
+func ForgetShadow(namespace, name string) {
+	metrics.VipShadowAllocation.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "cluster": name})
+}
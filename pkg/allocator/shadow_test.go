@@ -0,0 +1,88 @@
+package allocator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestShadowReportsWithoutCreatingClaims(t *testing.T) {
+	pool := fixtures.NewGlobalPool("pool-new", map[string]string{ClusterClassLabel(): "prod", RoleLabel(): ControlPlaneRole})
+	pool.Object["spec"] = map[string]interface{}{"addresses": []interface{}{"10.1.0.10-10.1.0.20"}}
+
+	cluster := fixtures.NewTopologyCluster("default", "shadowed", "prod")
+	claim := fixtures.NewIPAddressClaim(cluster, ClaimName(cluster.Name, ControlPlaneRole), map[string]string{RoleLabel(): ControlPlaneRole})
+	claim.SetAnnotations(map[string]string{AddressAnnotation(): "10.0.0.7"})
+	if err := unstructured.SetNestedField(claim.Object, "pool-old", "spec", "poolRef", "name"); err != nil {
+		t.Fatalf("set poolRef: %v", err)
+	}
+
+	client := fake.NewClientBuilder().WithScheme(fixtures.NewScheme(t)).WithRuntimeObjects(pool, claim).Build()
+	vips := New(client, testr.New(t), nil)
+	ctx := context.Background()
+
+	result, err := vips.Shadow(ctx, cluster, ControlPlaneRole)
+	if err != nil {
+		t.Fatalf("Shadow returned error: %v", err)
+	}
+	want := ShadowResult{Role: ControlPlaneRole, Pool: "pool-new", Address: "10.1.0.10", CurrentPool: "pool-old", CurrentAddress: "10.0.0.7"}
+	if result != want {
+		t.Fatalf("expected %+v, got %+v", want, result)
+	}
+	if !result.Changed() {
+		t.Fatalf("expected the pool change to be reported")
+	}
+
+	// The ingress role has no claim yet; shadow mode must not create one
+	ingress, err := vips.Shadow(ctx, cluster, IngressRole)
+	if err != nil {
+		t.Fatalf("Shadow returned error: %v", err)
+	}
+	if ingress.Pool != "" || ingress.Changed() {
+		t.Fatalf("expected no ingress pool and no change, got %+v", ingress)
+	}
+
+	claims := &unstructured.UnstructuredList{}
+	claims.SetGroupVersionKind(ClaimGVK().GroupVersion().WithKind(IPAddressClaimKind + "List"))
+	if err := client.List(ctx, claims); err != nil {
+		t.Fatalf("list claims: %v", err)
+	}
+	if len(claims.Items) != 1 {
+		t.Fatalf("expected shadow mode to leave the single existing claim, found %d", len(claims.Items))
+	}
+
+	recorder := record.NewFakeRecorder(1)
+	ReportShadow(testr.New(t), recorder, cluster, result)
+	if event := <-recorder.Events; event != `Normal ShadowAllocation Shadow mode: would allocate control-plane VIP 10.1.0.10 from pool pool-new (current: "10.0.0.7" from pool "pool-old")` {
+		t.Fatalf("unexpected event %q", event)
+	}
+}
+
+func TestShadowEnabled(t *testing.T) {
+	tests := []struct {
+		annotation string
+		global     bool
+		want       bool
+	}{
+		{annotation: "", global: false, want: false},
+		{annotation: "", global: true, want: true},
+		{annotation: "true", global: false, want: true},
+		{annotation: "false", global: true, want: false},
+		{annotation: "maybe", global: true, want: true},
+	}
+
+	for _, tt := range tests {
+		cluster := fixtures.NewTopologyCluster("default", "c", "prod")
+		if tt.annotation != "" {
+			cluster.Annotations = map[string]string{ShadowAnnotation(): tt.annotation}
+		}
+		if got := ShadowEnabled(cluster, tt.global); got != tt.want {
+			t.Fatalf("annotation %q, global %v: expected %v, got %v", tt.annotation, tt.global, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package allocator
+
+import (
+	"context"
+	"fmt"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// PoolNamespaceDeniedReason is the event reason used when a pool rejects the cluster namespace.
+	PoolNamespaceDeniedReason = "PoolNamespaceNotAllowed"
+)
+
+// PoolAllowsNamespace checks the pool's tenant restrictions against the cluster namespace.
+// Pools without allowed-namespaces or namespace-selector annotations are open to every namespace.
+// When both annotations are set the namespace must satisfy both.
+func (a *PoolAllocator) PoolAllowsNamespace(ctx context.Context, pool *unstructured.Unstructured, namespace string) (bool, error) {
+	annotations := pool.GetAnnotations()
+
+	if allowed, ok := annotations[AllowedNamespacesAnnotation()]; ok {
+		if !LabelContainsValue(allowed, namespace) {
+			return false, nil
+		}
+	}
+
+	if rawSelector, ok := annotations[NamespaceSelectorAnnotation()]; ok {
+		selector, err := labels.Parse(rawSelector)
+		if err != nil {
+			return false, fmt.Errorf("pool %q: invalid %s annotation: %w", pool.GetName(), NamespaceSelectorAnnotation(), err)
+		}
+		namespaceLabels, err := a.getNamespaceLabels(ctx, namespace)
+		if err != nil {
+			return false, err
+		}
+		if !selector.Matches(namespaceLabels) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// getNamespaceLabels returns the labels of the given namespace.
+func (a *PoolAllocator) getNamespaceLabels(ctx context.Context, namespace string) (labels.Set, error) {
+	ns := &corev1.Namespace{}
+	if err := a.Client.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return nil, fmt.Errorf("get namespace %q: %w", namespace, err)
+	}
+	return labels.Set(ns.Labels), nil
+}
+
+// recordPoolDenied emits a Warning event on the cluster naming the pool that rejected its namespace.
+func (a *PoolAllocator) recordPoolDenied(cluster *clusterv1.Cluster, poolName, role string) {
+	a.Logger.Info("pool does not allow cluster namespace, skipping", "cluster", cluster.Name, "namespace", cluster.Namespace, "pool", poolName, "role", role)
+	if a.Recorder == nil {
+		return
+	}
+	a.Recorder.Eventf(cluster, corev1.EventTypeWarning, PoolNamespaceDeniedReason,
+		"Pool %s matches %s role but does not allow namespace %s (see %s / %s annotations)",
+		poolName, role, cluster.Namespace, AllowedNamespacesAnnotation(), NamespaceSelectorAnnotation())
+}
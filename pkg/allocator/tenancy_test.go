@@ -0,0 +1,90 @@
+package allocator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestFindPoolSkipsPoolsNotAllowedForNamespace(t *testing.T) {
+	scheme := fixtures.NewScheme(t)
+
+	restricted := fixtures.NewGlobalPool("a-tenant-a-only", map[string]string{
+		ClusterClassLabel(): "prod",
+		RoleLabel():         ControlPlaneRole,
+	})
+	restricted.SetAnnotations(map[string]string{AllowedNamespacesAnnotation(): "tenant-a, tenant-c"})
+
+	selected := fixtures.NewGlobalPool("b-gold-only", map[string]string{
+		ClusterClassLabel(): "prod",
+		RoleLabel():         ControlPlaneRole,
+	})
+	selected.SetAnnotations(map[string]string{NamespaceSelectorAnnotation(): "tier=gold"})
+
+	tenantA := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-a"}}
+	tenantB := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-b", Labels: map[string]string{"tier": "gold"}}}
+	tenantC := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-c"}}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(restricted, selected, tenantA, tenantB, tenantC).
+		Build()
+	recorder := record.NewFakeRecorder(10)
+	vips := New(client, testr.New(t), recorder)
+	ctx := context.Background()
+
+	tests := []struct {
+		namespace    string
+		expectedPool string
+		deniedPools  []string
+	}{
+		{namespace: "tenant-a", expectedPool: "a-tenant-a-only"},
+		{namespace: "tenant-b", expectedPool: "b-gold-only", deniedPools: []string{"a-tenant-a-only"}},
+		{namespace: "tenant-c", expectedPool: "a-tenant-a-only"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			got, err := vips.FindPool(ctx, fixtures.NewTopologyCluster(tt.namespace, "c", "prod"), ControlPlaneRole)
+			if err != nil {
+				t.Fatalf("FindPool returned error: %v", err)
+			}
+			if got != tt.expectedPool {
+				t.Fatalf("expected pool %q, got %q", tt.expectedPool, got)
+			}
+			for _, pool := range tt.deniedPools {
+				select {
+				case event := <-recorder.Events:
+					if !strings.Contains(event, "Warning "+PoolNamespaceDeniedReason) || !strings.Contains(event, pool) {
+						t.Fatalf("unexpected event: %s", event)
+					}
+				default:
+					t.Fatalf("expected Warning event for pool %q", pool)
+				}
+			}
+		})
+	}
+
+	// A namespace allowed by neither pool gets no pool and one event per rejected pool
+	other := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-d"}}
+	if err := client.Create(ctx, other); err != nil {
+		t.Fatalf("create namespace: %v", err)
+	}
+	got, err := vips.FindPool(ctx, fixtures.NewTopologyCluster("tenant-d", "c", "prod"), ControlPlaneRole)
+	if err != nil {
+		t.Fatalf("FindPool returned error: %v", err)
+	}
+	if got != "" {
+		t.Fatalf("expected no pool for tenant-d, got %q", got)
+	}
+	if len(recorder.Events) != 2 {
+		t.Fatalf("expected 2 warning events, got %d", len(recorder.Events))
+	}
+}
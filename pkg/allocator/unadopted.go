@@ -0,0 +1,50 @@
+package allocator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Unadopted reports whether the claim was created during admission and never adopted by its
+// Cluster.
+func Unadopted(claim client.Object) bool {
+	return len(claim.GetOwnerReferences()) == 0 && claim.GetAnnotations()[PendingAdoptionAnnotation()] == "true"
+}
+
+// DeleteUnadoptedClaims deletes the claims created for a Cluster during admission when the
+// Cluster was never persisted, e.g. because a later webhook or a quota rejected it. Only claims
+// older than grace are deleted, so the admission request that created them can still finish;
+// retryAfter is the time until the youngest remaining claim may be deleted, or 0 if none is left.
+// The caller must have checked that the Cluster does not exist.
+func (a *PoolAllocator) DeleteUnadoptedClaims(ctx context.Context, namespace, clusterName string, grace time.Duration) (retryAfter time.Duration, err error) {
+	claims := &unstructured.UnstructuredList{}
+	claims.SetGroupVersionKind(ClaimGVK().GroupVersion().WithKind(IPAddressClaimKind + "List"))
+	if err := a.Client.List(ctx, claims, client.InNamespace(namespace), client.MatchingLabels{ClusterNameLabel: clusterName}, client.HasLabels{RoleLabel()}); err != nil {
+		return 0, fmt.Errorf("list IPAddressClaims of cluster %s: %w", ClusterKey(namespace, clusterName), err)
+	}
+
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		if !Unadopted(claim) {
+			continue
+		}
+		if remaining := grace - time.Since(claim.GetCreationTimestamp().Time); remaining > 0 {
+			if retryAfter == 0 || remaining < retryAfter {
+				retryAfter = remaining
+			}
+			continue
+		}
+
+		uid := claim.GetUID()
+		if err := a.Client.Delete(ctx, claim, client.Preconditions{UID: &uid}); err != nil && !apierrors.IsNotFound(err) {
+			return 0, fmt.Errorf("delete unadopted IPAddressClaim %s/%s: %w", claim.GetNamespace(), claim.GetName(), err)
+		}
+		a.Logger.Info("deleted IPAddressClaim of a Cluster that was never created", "claim", claim.GetName(), "namespace", claim.GetNamespace(), "cluster", clusterName)
+	}
+	return retryAfter, nil
+}
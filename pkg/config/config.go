@@ -0,0 +1,293 @@
+// Package config loads the manager configuration file. The file mirrors the command-line
+// flags of capi-vip-allocator and adds the allocation settings that have no flag: claim
+// name prefixes, IPAM API versions, timings and per-ClusterClass defaults.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	// APIVersion is the only supported apiVersion of the configuration file.
+	APIVersion = "vip.capi.gorizond.io/v1alpha1"
+	// Kind is the kind of the configuration file.
+	Kind = "AllocatorConfig"
+)
+
+// Config is the manager configuration file. Unset fields keep the flag value, so a file only
+// needs the settings it changes.
+type Config struct {
+	APIVersion       string                 `json:"apiVersion"`
+	Kind             string                 `json:"kind"`
+	Manager          ManagerConfig          `json:"manager,omitempty"`
+	RuntimeExtension RuntimeExtensionConfig `json:"runtimeExtension,omitempty"`
+	Webhooks         WebhooksConfig         `json:"webhooks,omitempty"`
+	Allocation       AllocationConfig       `json:"allocation,omitempty"`
+}
+
+// ManagerConfig holds the general manager settings.
+type ManagerConfig struct {
+	MetricsBindAddress     *string `json:"metricsBindAddress,omitempty"`
+	HealthProbeBindAddress *string `json:"healthProbeBindAddress,omitempty"`
+	LeaderElect            *bool   `json:"leaderElect,omitempty"`
+	EnableReconciler       *bool   `json:"enableReconciler,omitempty"`
+	ShadowMode             *bool   `json:"shadowMode,omitempty"`
+	DefaultPort            *int32  `json:"defaultPort,omitempty"`
+}
+
+// RuntimeExtensionConfig holds the runtime extension server settings.
+type RuntimeExtensionConfig struct {
+	Enabled             *bool             `json:"enabled,omitempty"`
+	Port                *int32            `json:"port,omitempty"`
+	Name                *string           `json:"name,omitempty"`
+	PendingPolicy       *string           `json:"pendingPolicy,omitempty"`
+	PatchProfiles       []string          `json:"patchProfiles,omitempty"`
+	Hooks               []string          `json:"hooks,omitempty"`
+	HookTimeouts        map[string]int32  `json:"hookTimeouts,omitempty"`
+	HookFailurePolicies map[string]string `json:"hookFailurePolicies,omitempty"`
+	NamespaceSelector   *string           `json:"namespaceSelector,omitempty"`
+	CertDir             *string           `json:"certDir,omitempty"`
+	ClientCAFile        *string           `json:"clientCAFile,omitempty"`
+}
+
+// WebhooksConfig holds the admission webhook settings.
+type WebhooksConfig struct {
+	Port     *int32                `json:"port,omitempty"`
+	CertDir  *string               `json:"certDir,omitempty"`
+	Cluster  ClusterWebhookConfig  `json:"cluster,omitempty"`
+	Pool     PoolWebhookConfig     `json:"pool,omitempty"`
+	Mutating MutatingWebhookConfig `json:"mutating,omitempty"`
+}
+
+// ClusterWebhookConfig configures the Cluster validating webhook.
+type ClusterWebhookConfig struct {
+	Enabled               *bool    `json:"enabled,omitempty"`
+	ManualVIPAllowedCIDRs []string `json:"manualVIPAllowedCIDRs,omitempty"`
+}
+
+// PoolWebhookConfig configures the pool validating webhook.
+type PoolWebhookConfig struct {
+	Enabled  *bool `json:"enabled,omitempty"`
+	WarnOnly *bool `json:"warnOnly,omitempty"`
+}
+
+// MutatingWebhookConfig configures the Cluster mutating webhook.
+type MutatingWebhookConfig struct {
+	Enabled *bool            `json:"enabled,omitempty"`
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// AllocationConfig holds the allocation settings that have no command-line flag.
+type AllocationConfig struct {
+	// LabelDomain is the domain of every label and annotation key (default vip.capi.gorizond.io)
+	LabelDomain string `json:"labelDomain,omitempty"`
+	// ClaimNameTemplate is a Go template naming the IPAddressClaims from .Cluster, .Role and
+	// .Prefix (default "{{ .Prefix }}{{ .Cluster }}")
+	ClaimNameTemplate string `json:"claimNameTemplate,omitempty"`
+	// RequeueDelay is how long the reconciler waits before checking a pending claim again
+	RequeueDelay *metav1.Duration `json:"requeueDelay,omitempty"`
+	// ShadowResyncPeriod is how often the reconciler refreshes shadow results
+	ShadowResyncPeriod *metav1.Duration `json:"shadowResyncPeriod,omitempty"`
+	IPAM               IPAMConfig       `json:"ipam,omitempty"`
+	Roles              RolesConfig      `json:"roles,omitempty"`
+	// Classes holds per-ClusterClass defaults, keyed by ClusterClass name
+	Classes map[string]ClassConfig `json:"classes,omitempty"`
+}
+
+// IPAMConfig selects the Cluster API IPAM API versions.
+type IPAMConfig struct {
+	// ClaimVersion is the API version of IPAddressClaims and IPAddresses (default v1beta1)
+	ClaimVersion string `json:"claimVersion,omitempty"`
+	// PoolVersion is the API version of GlobalInClusterIPPools (default v1alpha2)
+	PoolVersion string `json:"poolVersion,omitempty"`
+}
+
+// RolesConfig defines the VIP roles.
+type RolesConfig struct {
+	ControlPlane RoleConfig `json:"controlPlane,omitempty"`
+	Ingress      RoleConfig `json:"ingress,omitempty"`
+}
+
+// RoleConfig defines one VIP role.
+type RoleConfig struct {
+	// ClaimPrefix is prepended to the cluster name to form the IPAddressClaim name
+	ClaimPrefix string `json:"claimPrefix,omitempty"`
+	// Enabled turns the role on or off by default; the control plane role cannot be disabled
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// ClassConfig holds the defaults for Clusters of one ClusterClass.
+type ClassConfig struct {
+	// Port is the control plane port used when neither the Cluster nor a policy sets one
+	Port *int32 `json:"port,omitempty"`
+	// Ingress enables or disables the ingress VIP for the class
+	Ingress *bool `json:"ingress,omitempty"`
+	// Shadow enables or disables shadow mode for the class
+	Shadow *bool `json:"shadow,omitempty"`
+}
+
+// Load decodes and validates a YAML or JSON configuration. Unknown fields are rejected so
+// that typos do not silently keep the defaults.
+func Load(data []byte) (*Config, error) {
+	raw, err := utilyaml.ToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+
+	cfg := &Config{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("decode config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Flags returns the flag values set by the configuration, keyed by flag name.
+func (c *Config) Flags() map[string]string {
+	values := map[string]string{}
+	setString := func(name string, value *string) {
+		if value != nil {
+			values[name] = *value
+		}
+	}
+	setBool := func(name string, value *bool) {
+		if value != nil {
+			values[name] = strconv.FormatBool(*value)
+		}
+	}
+	setInt := func(name string, value *int32) {
+		if value != nil {
+			values[name] = strconv.Itoa(int(*value))
+		}
+	}
+	setList := func(name string, value []string) {
+		if value != nil {
+			values[name] = strings.Join(value, ",")
+		}
+	}
+
+	m := c.Manager
+	setString("metrics-bind-address", m.MetricsBindAddress)
+	setString("health-probe-bind-address", m.HealthProbeBindAddress)
+	setBool("leader-elect", m.LeaderElect)
+	setBool("enable-reconciler", m.EnableReconciler)
+	setBool("shadow-mode", m.ShadowMode)
+	setInt("default-port", m.DefaultPort)
+
+	r := c.RuntimeExtension
+	setBool("enable-runtime-extension", r.Enabled)
+	setInt("runtime-extension-port", r.Port)
+	setString("runtime-extension-name", r.Name)
+	setString("runtime-extension-pending-policy", r.PendingPolicy)
+	setList("runtime-extension-patch-profiles", r.PatchProfiles)
+	setList("runtime-extension-hooks", r.Hooks)
+	if r.HookTimeouts != nil {
+		setList("runtime-extension-hook-timeouts", pairs(timeoutStrings(r.HookTimeouts)))
+	}
+	if r.HookFailurePolicies != nil {
+		setList("runtime-extension-hook-failure-policies", pairs(r.HookFailurePolicies))
+	}
+	setString("runtime-extension-namespace-selector", r.NamespaceSelector)
+	setString("runtime-extension-cert-dir", r.CertDir)
+	setString("runtime-extension-client-ca-file", r.ClientCAFile)
+
+	w := c.Webhooks
+	setInt("webhook-port", w.Port)
+	setString("webhook-cert-dir", w.CertDir)
+	setBool("enable-cluster-webhook", w.Cluster.Enabled)
+	setList("manual-vip-allowed-cidrs", w.Cluster.ManualVIPAllowedCIDRs)
+	setBool("enable-pool-webhook", w.Pool.Enabled)
+	setBool("pool-webhook-warn-only", w.Pool.WarnOnly)
+	setBool("enable-mutating-webhook", w.Mutating.Enabled)
+	if w.Mutating.Timeout != nil {
+		values["mutating-webhook-timeout"] = w.Mutating.Timeout.Duration.String()
+	}
+
+	return values
+}
+
+// pairs renders a map as sorted key=value items.
+func pairs(m map[string]string) []string {
+	items := make([]string, 0, len(m))
+	for key, value := range m {
+		items = append(items, key+"="+value)
+	}
+	sort.Strings(items)
+	return items
+}
+
+// timeoutStrings renders hook timeouts in seconds as strings.
+func timeoutStrings(timeouts map[string]int32) map[string]string {
+	values := make(map[string]string, len(timeouts))
+	for hook, seconds := range timeouts {
+		values[hook] = strconv.Itoa(int(seconds))
+	}
+	return values
+}
+
+// AllocatorSettings returns the allocator settings described by the configuration.
+func (c *Config) AllocatorSettings() allocator.Settings {
+	a := c.Allocation
+	s := allocator.Settings{
+		Domain:            a.LabelDomain,
+		ClaimNameTemplate: a.ClaimNameTemplate,
+		ClaimPrefixes: map[string]string{
+			allocator.ControlPlaneRole: a.Roles.ControlPlane.ClaimPrefix,
+			allocator.IngressRole:      a.Roles.Ingress.ClaimPrefix,
+		},
+		IPAMVersion:     a.IPAM.ClaimVersion,
+		PoolVersion:     a.IPAM.PoolVersion,
+		IngressDisabled: a.Roles.Ingress.Enabled != nil && !*a.Roles.Ingress.Enabled,
+	}
+	if len(a.Classes) > 0 {
+		s.Classes = make(map[string]allocator.ClassDefaults, len(a.Classes))
+		for name, class := range a.Classes {
+			defaults := allocator.ClassDefaults{IngressEnabled: class.Ingress, Shadow: class.Shadow}
+			if class.Port != nil {
+				defaults.Port = *class.Port
+			}
+			s.Classes[name] = defaults
+		}
+	}
+	return s
+}
+
+// RequeueDelay returns the configured requeue delay, or 0 for the default.
+func (c *Config) RequeueDelay() time.Duration {
+	if c.Allocation.RequeueDelay == nil {
+		return 0
+	}
+	return c.Allocation.RequeueDelay.Duration
+}
+
+// ShadowResyncPeriod returns the configured shadow resync period, or 0 for the default.
+func (c *Config) ShadowResyncPeriod() time.Duration {
+	if c.Allocation.ShadowResyncPeriod == nil {
+		return 0
+	}
+	return c.Allocation.ShadowResyncPeriod.Duration
+}
+
+// Dump renders the configuration as indented JSON for debug logging.
+func (c *Config) Dump() string {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return string(data)
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+)
+
+const fullConfig = `
+apiVersion: vip.capi.gorizond.io/v1alpha1
+kind: AllocatorConfig
+manager:
+  defaultPort: 9345
+  shadowMode: true
+runtimeExtension:
+  patchProfiles: [rke2]
+  hookTimeouts:
+    GeneratePatches: 20
+  hookFailurePolicies:
+    GeneratePatches: Ignore
+webhooks:
+  cluster:
+    manualVIPAllowedCIDRs: [10.0.0.0/8, 192.168.0.0/16]
+  mutating:
+    timeout: 3s
+allocation:
+  labelDomain: vip.example.com
+  claimNameTemplate: "{{ .Prefix }}{{ .Cluster }}-vip"
+  requeueDelay: 30s
+  ipam:
+    poolVersion: v1alpha2
+  roles:
+    controlPlane:
+      claimPrefix: api-
+    ingress:
+      enabled: false
+  classes:
+    edge:
+      port: 6444
+      ingress: true
+`
+
+func TestLoadAndApplyFlags(t *testing.T) {
+	cfg, err := Load([]byte(fullConfig))
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	defaultPort := fs.Int("default-port", 6443, "")
+	shadow := fs.Bool("shadow-mode", false, "")
+	profiles := fs.String("runtime-extension-patch-profiles", "", "")
+	timeouts := fs.String("runtime-extension-hook-timeouts", "", "")
+	policies := fs.String("runtime-extension-hook-failure-policies", "", "")
+	cidrs := fs.String("manual-vip-allowed-cidrs", "", "")
+	mutatingTimeout := fs.Duration("mutating-webhook-timeout", 5*time.Second, "")
+	if err := fs.Parse([]string{"--shadow-mode=false"}); err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	if err := cfg.ApplyFlags(fs); err != nil {
+		t.Fatalf("ApplyFlags returned error: %v", err)
+	}
+	if *defaultPort != 9345 || *profiles != "rke2" || *timeouts != "GeneratePatches=20" || *policies != "GeneratePatches=Ignore" {
+		t.Fatalf("unexpected flags: port %d, profiles %q, timeouts %q, policies %q", *defaultPort, *profiles, *timeouts, *policies)
+	}
+	if *cidrs != "10.0.0.0/8,192.168.0.0/16" || *mutatingTimeout != 3*time.Second {
+		t.Fatalf("unexpected flags: cidrs %q, timeout %v", *cidrs, *mutatingTimeout)
+	}
+	if *shadow {
+		t.Fatalf("explicit --shadow-mode=false must win over the configuration")
+	}
+
+	if cfg.RequeueDelay() != 30*time.Second || cfg.ShadowResyncPeriod() != 0 {
+		t.Fatalf("unexpected timings: requeue %v, shadow resync %v", cfg.RequeueDelay(), cfg.ShadowResyncPeriod())
+	}
+	settings := cfg.AllocatorSettings()
+	if settings.Domain != "vip.example.com" || settings.ClaimNameTemplate != "{{ .Prefix }}{{ .Cluster }}-vip" {
+		t.Fatalf("unexpected naming settings: %+v", settings)
+	}
+	if settings.ClaimPrefixes[allocator.ControlPlaneRole] != "api-" || !settings.IngressDisabled {
+		t.Fatalf("unexpected allocator settings: %+v", settings)
+	}
+	if edge := settings.Classes["edge"]; edge.Port != 6444 || edge.IngressEnabled == nil || !*edge.IngressEnabled || edge.Shadow != nil {
+		t.Fatalf("unexpected class defaults: %+v", edge)
+	}
+}
+
+func TestApplyFlagsRejectsUnknownFlag(t *testing.T) {
+	cfg, err := Load([]byte("apiVersion: vip.capi.gorizond.io/v1alpha1\nkind: AllocatorConfig\nmanager:\n  leaderElect: true\n"))
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if err := cfg.ApplyFlags(flag.NewFlagSet("test", flag.ContinueOnError)); err == nil || !strings.Contains(err.Error(), "--leader-elect") {
+		t.Fatalf("expected unknown flag error, got %v", err)
+	}
+}
+
+func TestLoadRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{
+			name:   "unknown field",
+			config: "apiVersion: vip.capi.gorizond.io/v1alpha1\nkind: AllocatorConfig\nmanager:\n  defaultPrt: 6443\n",
+			want:   []string{`unknown field "defaultPrt"`},
+		},
+		{
+			name:   "wrong kind and version",
+			config: "apiVersion: v1\nkind: ConfigMap\n",
+			want:   []string{"apiVersion", "kind"},
+		},
+		{
+			name: "invalid values",
+			config: `
+apiVersion: vip.capi.gorizond.io/v1alpha1
+kind: AllocatorConfig
+manager:
+  defaultPort: 70000
+runtimeExtension:
+  pendingPolicy: wait
+  hooks: [BeforeClusterCreate]
+webhooks:
+  cluster:
+    manualVIPAllowedCIDRs: [10.0.0.0]
+allocation:
+  labelDomain: Bad Domain
+  claimNameTemplate: "{{ .Prefix }}"
+  requeueDelay: 0s
+  roles:
+    controlPlane:
+      claimPrefix: VIP_
+      enabled: false
+  classes:
+    edge:
+      port: 0
+`,
+			want: []string{
+				"manager.defaultPort",
+				"runtimeExtension.pendingPolicy",
+				"runtimeExtension.hooks",
+				"webhooks.cluster.manualVIPAllowedCIDRs",
+				"allocation.labelDomain",
+				"allocation.claimNameTemplate",
+				"allocation.requeueDelay",
+				"allocation.roles.controlPlane.claimPrefix",
+				"allocation.roles.controlPlane.enabled",
+				"allocation.classes[edge].port",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load([]byte(tt.config))
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Fatalf("expected error to mention %q, got %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestWatcherIgnoresInvalidChanges(t *testing.T) {
+	valid := "apiVersion: vip.capi.gorizond.io/v1alpha1\nkind: AllocatorConfig\n"
+	reads := []string{valid, "kind: AllocatorConfig\n", valid + "manager:\n  shadowMode: true\n"}
+	source := func(context.Context) ([]byte, error) {
+		data := reads[0]
+		if len(reads) > 1 {
+			reads = reads[1:]
+		}
+		return []byte(data), nil
+	}
+
+	watcher := &Watcher{Source: source, Interval: time.Millisecond, Logger: testr.New(t), Current: []byte(valid)}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := watcher.Start(ctx); !errors.Is(err, ErrChanged) {
+		t.Fatalf("expected ErrChanged, got %v", err)
+	}
+	if len(reads) != 1 {
+		t.Fatalf("expected the watcher to read every configuration, %d left", len(reads))
+	}
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+)
+
+// ApplyFlags sets the flags named by the configuration on fs. Flags given explicitly on the
+// command line win over the file, so it must be called after fs has been parsed.
+func (c *Config) ApplyFlags(fs *flag.FlagSet) error {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	values := c.Flags()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if explicit[name] {
+			continue
+		}
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("config sets unknown flag --%s", name)
+		}
+		if err := fs.Set(name, values[name]); err != nil {
+			return fmt.Errorf("config value for --%s: %w", name, err)
+		}
+	}
+	return nil
+}
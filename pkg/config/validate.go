@@ -0,0 +1,166 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	runtimeext "github.com/gorizond/capi-vip-allocator/pkg/runtime"
+	vipwebhook "github.com/gorizond/capi-vip-allocator/pkg/webhook"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Validate checks the configuration and returns all problems at once.
+func (c *Config) Validate() error {
+	var errs field.ErrorList
+
+	if c.APIVersion != APIVersion {
+		errs = append(errs, field.Invalid(field.NewPath("apiVersion"), c.APIVersion, fmt.Sprintf("must be %s", APIVersion)))
+	}
+	if c.Kind != Kind {
+		errs = append(errs, field.Invalid(field.NewPath("kind"), c.Kind, fmt.Sprintf("must be %s", Kind)))
+	}
+
+	errs = append(errs, c.validateManager(field.NewPath("manager"))...)
+	errs = append(errs, c.validateRuntimeExtension(field.NewPath("runtimeExtension"))...)
+	errs = append(errs, c.validateWebhooks(field.NewPath("webhooks"))...)
+	errs = append(errs, c.validateAllocation(field.NewPath("allocation"))...)
+
+	return errs.ToAggregate()
+}
+
+func (c *Config) validateManager(path *field.Path) field.ErrorList {
+	return validatePort(path.Child("defaultPort"), c.Manager.DefaultPort)
+}
+
+func (c *Config) validateRuntimeExtension(path *field.Path) field.ErrorList {
+	r := c.RuntimeExtension
+	errs := validatePort(path.Child("port"), r.Port)
+
+	if r.Name != nil {
+		for _, msg := range validation.IsDNS1123Label(*r.Name) {
+			errs = append(errs, field.Invalid(path.Child("name"), *r.Name, msg))
+		}
+	}
+	if r.PendingPolicy != nil {
+		if _, err := runtimeext.ParsePendingPolicy(*r.PendingPolicy); err != nil {
+			errs = append(errs, field.Invalid(path.Child("pendingPolicy"), *r.PendingPolicy, err.Error()))
+		}
+	}
+	if _, err := runtimeext.ParsePatchProfiles(r.PatchProfiles); err != nil {
+		errs = append(errs, field.Invalid(path.Child("patchProfiles"), r.PatchProfiles, err.Error()))
+	}
+
+	if _, err := runtimeext.ParseHookSettings(r.Hooks, pairs(timeoutStrings(r.HookTimeouts)), pairs(r.HookFailurePolicies)); err != nil {
+		errs = append(errs, field.Invalid(path.Child("hooks"), r.Hooks, err.Error()))
+	}
+
+	if r.NamespaceSelector != nil {
+		if _, err := labels.Parse(*r.NamespaceSelector); err != nil {
+			errs = append(errs, field.Invalid(path.Child("namespaceSelector"), *r.NamespaceSelector, err.Error()))
+		}
+	}
+	return errs
+}
+
+func (c *Config) validateWebhooks(path *field.Path) field.ErrorList {
+	w := c.Webhooks
+	errs := validatePort(path.Child("port"), w.Port)
+
+	if _, err := vipwebhook.ParseCIDRs(w.Cluster.ManualVIPAllowedCIDRs); err != nil {
+		errs = append(errs, field.Invalid(path.Child("cluster", "manualVIPAllowedCIDRs"), w.Cluster.ManualVIPAllowedCIDRs, err.Error()))
+	}
+	errs = append(errs, validateDuration(path.Child("mutating", "timeout"), w.Mutating.Timeout)...)
+	return errs
+}
+
+func (c *Config) validateAllocation(path *field.Path) field.ErrorList {
+	a := c.Allocation
+	var errs field.ErrorList
+
+	errs = append(errs, validateDuration(path.Child("requeueDelay"), a.RequeueDelay)...)
+	errs = append(errs, validateDuration(path.Child("shadowResyncPeriod"), a.ShadowResyncPeriod)...)
+
+	if a.LabelDomain != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(a.LabelDomain) {
+			errs = append(errs, field.Invalid(path.Child("labelDomain"), a.LabelDomain, msg))
+		}
+	}
+	if a.ClaimNameTemplate != "" {
+		prefixes := map[string]string{
+			allocator.ControlPlaneRole: a.Roles.ControlPlane.ClaimPrefix,
+			allocator.IngressRole:      a.Roles.Ingress.ClaimPrefix,
+		}
+		if _, err := allocator.ParseClaimNameTemplate(a.ClaimNameTemplate, prefixes); err != nil {
+			errs = append(errs, field.Invalid(path.Child("claimNameTemplate"), a.ClaimNameTemplate, err.Error()))
+		}
+	}
+
+	ipamPath := path.Child("ipam")
+	for name, version := range map[string]string{"claimVersion": a.IPAM.ClaimVersion, "poolVersion": a.IPAM.PoolVersion} {
+		if version == "" {
+			continue
+		}
+		for _, msg := range validation.IsDNS1123Label(version) {
+			errs = append(errs, field.Invalid(ipamPath.Child(name), version, msg))
+		}
+	}
+
+	rolesPath := path.Child("roles")
+	errs = append(errs, validateClaimPrefix(rolesPath.Child("controlPlane", "claimPrefix"), a.Roles.ControlPlane.ClaimPrefix)...)
+	errs = append(errs, validateClaimPrefix(rolesPath.Child("ingress", "claimPrefix"), a.Roles.Ingress.ClaimPrefix)...)
+	if enabled := a.Roles.ControlPlane.Enabled; enabled != nil && !*enabled {
+		errs = append(errs, field.Invalid(rolesPath.Child("controlPlane", "enabled"), false, "the control plane role cannot be disabled"))
+	}
+	if cp, ingress := a.Roles.ControlPlane.ClaimPrefix, a.Roles.Ingress.ClaimPrefix; cp != "" && cp == ingress {
+		errs = append(errs, field.Duplicate(rolesPath.Child("ingress", "claimPrefix"), ingress))
+	}
+
+	names := make([]string, 0, len(a.Classes))
+	for name := range a.Classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		classPath := path.Child("classes").Key(name)
+		if name == "" {
+			errs = append(errs, field.Required(classPath, "ClusterClass name must not be empty"))
+		}
+		errs = append(errs, validatePort(classPath.Child("port"), a.Classes[name].Port)...)
+	}
+	return errs
+}
+
+func validatePort(path *field.Path, port *int32) field.ErrorList {
+	if port == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	for _, msg := range validation.IsValidPortNum(int(*port)) {
+		errs = append(errs, field.Invalid(path, *port, msg))
+	}
+	return errs
+}
+
+func validateDuration(path *field.Path, d *metav1.Duration) field.ErrorList {
+	if d == nil || d.Duration > 0 {
+		return nil
+	}
+	return field.ErrorList{field.Invalid(path, d.Duration.String(), "must be positive")}
+}
+
+// validateClaimPrefix checks that prefix followed by a cluster name forms a valid object name.
+func validateClaimPrefix(path *field.Path, prefix string) field.ErrorList {
+	if prefix == "" {
+		return nil
+	}
+	var errs field.ErrorList
+	for _, msg := range validation.IsDNS1123Subdomain(prefix + "a") {
+		errs = append(errs, field.Invalid(path, prefix, msg))
+	}
+	return errs
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// DefaultConfigMapKey is the ConfigMap data key holding the configuration.
+const DefaultConfigMapKey = "config.yaml"
+
+// ErrChanged is returned by Watcher when a valid new configuration was found. The manager
+// exits so that it restarts with the new configuration.
+var ErrChanged = errors.New("configuration changed")
+
+// Source returns the raw configuration.
+type Source func(ctx context.Context) ([]byte, error)
+
+// FileSource reads the configuration from a file. Files mounted from a ConfigMap are updated
+// in place by the kubelet, so watching the file follows the ConfigMap.
+func FileSource(path string) Source {
+	return func(context.Context) ([]byte, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config %s: %w", path, err)
+		}
+		return data, nil
+	}
+}
+
+// ConfigMapSource reads the configuration from the key of a ConfigMap.
+func ConfigMapSource(c client.Reader, key types.NamespacedName, dataKey string) Source {
+	return func(ctx context.Context) ([]byte, error) {
+		configMap := &corev1.ConfigMap{}
+		if err := c.Get(ctx, key, configMap); err != nil {
+			return nil, fmt.Errorf("get ConfigMap %s: %w", key, err)
+		}
+		data, ok := configMap.Data[dataKey]
+		if !ok {
+			return nil, fmt.Errorf("ConfigMap %s has no %q key", key, dataKey)
+		}
+		return []byte(data), nil
+	}
+}
+
+// Watcher polls a Source and stops the manager with ErrChanged once it returns a different,
+// valid configuration. Invalid changes are logged and ignored so that a typo in the
+// ConfigMap never takes the manager down.
+type Watcher struct {
+	Source   Source
+	Interval time.Duration
+	Logger   logr.Logger
+	// Current is the configuration the manager was started with
+	Current []byte
+}
+
+var _ manager.Runnable = &Watcher{}
+var _ manager.LeaderElectionRunnable = &Watcher{}
+
+// Start polls the source until the context is cancelled or the configuration changes.
+func (w *Watcher) Start(ctx context.Context) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	rejected := w.Current
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		data, err := w.Source(ctx)
+		if err != nil {
+			w.Logger.Error(err, "unable to read configuration, keeping the current one")
+			continue
+		}
+		if bytes.Equal(data, w.Current) || bytes.Equal(data, rejected) {
+			continue
+		}
+		if _, err := Load(data); err != nil {
+			w.Logger.Error(err, "ignoring invalid configuration change")
+			rejected = data
+			continue
+		}
+		w.Logger.Info("configuration changed, restarting to apply it")
+		return ErrChanged
+	}
+}
+
+// NeedLeaderElection reports false: every replica follows the configuration.
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
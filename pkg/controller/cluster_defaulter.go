@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	"github.com/gorizond/capi-vip-allocator/pkg/metrics"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// Default bounded wait for the mutating webhook; must stay well below the webhook timeoutSeconds
+	defaultWebhookAllocationTimeout  = 5 * time.Second
+	defaultWebhookAllocationInterval = 250 * time.Millisecond
+)
+
+// ClusterDefaulter allocates the control-plane VIP while a Cluster is being admitted and injects
+// controlPlaneEndpoint and the VIP variable into the object before it is persisted, so the
+// topology controller never sees a Cluster without an endpoint.
+//
+// The claim is created without an ownerReference because the Cluster is not persisted yet; the
+// reconciler adopts it once the Cluster is persisted, or deletes it when the Cluster is still
+// missing after a grace period because a later admission step rejected it. If the address is not
+// allocated within Timeout the Cluster is admitted unchanged and the reconciler finishes the
+// allocation.
+type ClusterDefaulter struct {
+	Reconciler *ClusterReconciler
+	Timeout    time.Duration
+	Interval   time.Duration
+}
+
+var _ admission.CustomDefaulter = &ClusterDefaulter{}
+
+// SetupWithManager registers the mutating webhook for Clusters.
+func (d *ClusterDefaulter) SetupWithManager(mgr ctrl.Manager) error {
+	if d.Timeout == 0 {
+		d.Timeout = defaultWebhookAllocationTimeout
+	}
+	if d.Interval == 0 {
+		d.Interval = defaultWebhookAllocationInterval
+	}
+
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&clusterv1.Cluster{}).
+		WithDefaulter(d).
+		Complete()
+}
+
+// Default allocates a VIP for new topology Clusters without a control plane host.
+func (d *ClusterDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	cluster, ok := obj.(*clusterv1.Cluster)
+	if !ok {
+		return errors.NewBadRequest(fmt.Sprintf("expected a Cluster but got a %T", obj))
+	}
+
+	if req, err := admission.RequestFromContext(ctx); err == nil {
+		if req.Operation != admissionv1.Create {
+			return nil
+		}
+		if req.DryRun != nil && *req.DryRun {
+			// Dry-run requests must not have side effects such as creating claims
+			return nil
+		}
+	}
+
+	if cluster.Spec.Topology == nil || cluster.Spec.Topology.Class == "" || cluster.Spec.ControlPlaneEndpoint.Host != "" {
+		return nil
+	}
+	if allocator.ShadowEnabled(cluster, d.Reconciler.Shadow) {
+		// Shadow mode must not create claims; the reconciler reports the would-be allocation
+		return nil
+	}
+
+	log := d.Reconciler.Logger.WithValues("cluster", types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace}, "mode", "webhook")
+	clusterClass := cluster.Spec.Topology.Class
+	allocationStart := time.Now()
+	vips := d.Reconciler.vipAllocator()
+
+	// The Cluster is not persisted yet, so the claim is created without ownerReference
+	claim, err := vips.EnsureClaim(ctx, cluster, allocator.ControlPlaneRole)
+	if err != nil {
+		// Admission must not fail because of IPAM problems; the reconciler reports them
+		log.Error(err, "could not create IPAddressClaim during admission, leaving allocation to the reconciler")
+		return nil
+	}
+
+	var ip string
+	err = wait.PollUntilContextTimeout(ctx, d.Interval, d.Timeout, true, func(ctx context.Context) (bool, error) {
+		if err := d.Reconciler.Client.Get(ctx, client.ObjectKeyFromObject(claim), claim); err != nil {
+			if errors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+
+		address, ready, err := vips.ResolveAddress(ctx, claim)
+		if err != nil || !ready {
+			return false, err
+		}
+		ip = address
+		return true, nil
+	})
+	if err != nil {
+		log.Info("VIP not allocated within admission deadline, leaving allocation to the reconciler", "timeout", d.Timeout.String(), "reason", err.Error())
+		return nil
+	}
+
+	if err := d.Reconciler.setClusterEndpoint(ctx, cluster, ip); err != nil {
+		log.Error(err, "could not set control plane endpoint during admission, leaving it to the reconciler")
+		return nil
+	}
+
+	allocationDuration := time.Since(allocationStart).Seconds()
+	metrics.VipAllocationDurationSeconds.WithLabelValues(allocator.ControlPlaneRole, clusterClass).Observe(allocationDuration)
+	metrics.VipAllocationsTotal.WithLabelValues(allocator.ControlPlaneRole, clusterClass).Inc()
+	log.Info("control-plane VIP injected during admission", "ip", ip, "duration_seconds", allocationDuration)
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestClusterDefaulterInjectsAllocatedVIP(t *testing.T) {
+	scheme := fixtures.NewScheme(t)
+
+	cluster := fixtures.NewTopologyCluster("default", "hooked", "prod")
+	clusterClass := &clusterv1.ClusterClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: "default"},
+		Spec: clusterv1.ClusterClassSpec{
+			Variables: []clusterv1.ClusterClassVariable{{Name: "clusterVip"}},
+		},
+	}
+	pool := fixtures.NewGlobalPool("pool-cp", map[string]string{
+		allocator.ClusterClassLabel(): "prod",
+		allocator.RoleLabel():         allocator.ControlPlaneRole,
+	})
+
+	// The IPAM provider answered before the webhook started polling
+	claim := &unstructured.Unstructured{}
+	claim.SetGroupVersionKind(schema.GroupVersionKind{Group: allocator.IPAMGroup, Version: allocator.IPAMVersion, Kind: allocator.IPAddressClaimKind})
+	claim.SetName("vip-cp-hooked")
+	claim.SetNamespace("default")
+	claim.SetLabels(map[string]string{allocator.RoleLabel(): allocator.ControlPlaneRole, allocator.ClusterNameLabel: "hooked"})
+	if err := unstructured.SetNestedField(claim.Object, "hooked-ip", "status", "addressRef", "name"); err != nil {
+		t.Fatalf("set addressRef: %v", err)
+	}
+	address := fixtures.NewIPAddress("hooked-ip", "default", "10.4.0.7")
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(clusterClass, pool, claim, address).Build()
+	reconciler := &ClusterReconciler{Client: client, Scheme: scheme, Logger: testr.New(t), DefaultPort: 6443}
+	defaulter := &ClusterDefaulter{Reconciler: reconciler, Timeout: time.Second, Interval: 10 * time.Millisecond}
+
+	ctx := admission.NewContextWithRequest(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Create}})
+	if err := defaulter.Default(ctx, cluster); err != nil {
+		t.Fatalf("Default returned error: %v", err)
+	}
+
+	if cluster.Spec.ControlPlaneEndpoint.Host != "10.4.0.7" || cluster.Spec.ControlPlaneEndpoint.Port != 6443 {
+		t.Fatalf("expected endpoint 10.4.0.7:6443, got %#v", cluster.Spec.ControlPlaneEndpoint)
+	}
+	if len(cluster.Spec.Topology.Variables) != 1 || string(cluster.Spec.Topology.Variables[0].Value.Raw) != `"10.4.0.7"` {
+		t.Fatalf("expected clusterVip variable to be injected, got %#v", cluster.Spec.Topology.Variables)
+	}
+}
+
+func TestClusterDefaulterAdmitsUnchangedWhenAllocationTimesOut(t *testing.T) {
+	scheme := fixtures.NewScheme(t)
+
+	cluster := fixtures.NewTopologyCluster("default", "slow", "prod")
+	pool := fixtures.NewGlobalPool("pool-cp", map[string]string{
+		allocator.ClusterClassLabel(): "prod",
+		allocator.RoleLabel():         allocator.ControlPlaneRole,
+	})
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(pool).Build()
+	reconciler := &ClusterReconciler{Client: client, Scheme: scheme, Logger: testr.New(t), DefaultPort: 6443}
+	defaulter := &ClusterDefaulter{Reconciler: reconciler, Timeout: 50 * time.Millisecond, Interval: 10 * time.Millisecond}
+
+	// Dry-run requests must not create claims
+	dryRun := true
+	dryRunCtx := admission.NewContextWithRequest(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Create, DryRun: &dryRun}})
+	if err := defaulter.Default(dryRunCtx, cluster); err != nil {
+		t.Fatalf("Default returned error: %v", err)
+	}
+
+	claimKey := types.NamespacedName{Name: "vip-cp-slow", Namespace: "default"}
+	claim := &unstructured.Unstructured{}
+	claim.SetGroupVersionKind(schema.GroupVersionKind{Group: allocator.IPAMGroup, Version: allocator.IPAMVersion, Kind: allocator.IPAddressClaimKind})
+	if err := client.Get(context.Background(), claimKey, claim); err == nil {
+		t.Fatalf("expected no claim for dry-run request")
+	}
+
+	ctx := admission.NewContextWithRequest(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Create}})
+	if err := defaulter.Default(ctx, cluster); err != nil {
+		t.Fatalf("Default returned error: %v", err)
+	}
+
+	if cluster.Spec.ControlPlaneEndpoint.Host != "" {
+		t.Fatalf("expected cluster to be admitted unchanged, got host %q", cluster.Spec.ControlPlaneEndpoint.Host)
+	}
+	if err := client.Get(context.Background(), claimKey, claim); err != nil {
+		t.Fatalf("expected claim to be created: %v", err)
+	}
+	if len(claim.GetOwnerReferences()) != 0 {
+		t.Fatalf("expected claim without ownerReferences, got %#v", claim.GetOwnerReferences())
+	}
+	if claim.GetLabels()[allocator.ClusterNameLabel] != "slow" {
+		t.Fatalf("expected %s label on claim, got %#v", allocator.ClusterNameLabel, claim.GetLabels())
+	}
+	if !allocator.Unadopted(claim) {
+		t.Fatalf("expected the claim to be marked as pending adoption, got %#v", claim.GetAnnotations())
+	}
+
+	// The reconciler adopts the claim once the Cluster is persisted
+	cluster.Annotations = map[string]string{allocator.IngressEnabledAnnotation(): "false"}
+	if err := client.Create(context.Background(), cluster); err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	if _, err := reconciler.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "slow", Namespace: "default"}}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if err := client.Get(context.Background(), claimKey, claim); err != nil {
+		t.Fatalf("get claim: %v", err)
+	}
+	if allocator.Unadopted(claim) || claim.GetAnnotations()[allocator.PendingAdoptionAnnotation()] != "" {
+		t.Fatalf("expected the claim to be adopted, got owners %#v and annotations %#v", claim.GetOwnerReferences(), claim.GetAnnotations())
+	}
+}
+
+func TestReconcileDeletesClaimsOfClustersNeverCreated(t *testing.T) {
+	scheme := fixtures.NewScheme(t)
+	rejected := fixtures.NewTopologyCluster("default", "rejected", "prod")
+
+	unadopted := allocator.NewClaim(rejected, allocator.ControlPlaneRole, "pool-cp")
+	unadopted.SetCreationTimestamp(metav1.NewTime(time.Now().Add(-2 * unadoptedClaimGracePeriod)))
+	// A claim left behind by deleting its Cluster with orphan propagation must be kept for vipctl adopt
+	orphaned := allocator.NewClaim(rejected, allocator.IngressRole, "pool-ingress")
+	orphaned.SetCreationTimestamp(unadopted.GetCreationTimestamp())
+	orphaned.SetAnnotations(nil)
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(unadopted, orphaned).Build()
+	reconciler := &ClusterReconciler{Client: c, Scheme: scheme, Logger: testr.New(t), DefaultPort: 6443}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(rejected)}
+	ctx := context.Background()
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(unadopted), unadopted.DeepCopy()); !errors.IsNotFound(err) {
+		t.Fatalf("expected the unadopted claim to be deleted, got %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(orphaned), orphaned.DeepCopy()); err != nil {
+		t.Fatalf("expected the orphaned claim to be kept: %v", err)
+	}
+
+	// Claims younger than the grace period may still belong to a Cluster being admitted
+	young := allocator.NewClaim(rejected, allocator.ControlPlaneRole, "pool-cp")
+	young.SetCreationTimestamp(metav1.NewTime(time.Now()))
+	if err := c.Create(ctx, young); err != nil {
+		t.Fatalf("create claim: %v", err)
+	}
+	result, err := reconciler.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if result.RequeueAfter <= 0 || result.RequeueAfter > unadoptedClaimGracePeriod {
+		t.Fatalf("expected a requeue within the grace period, got %v", result.RequeueAfter)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(young), young.DeepCopy()); err != nil {
+		t.Fatalf("expected the young claim to be kept: %v", err)
+	}
+}
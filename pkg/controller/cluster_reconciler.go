@@ -3,40 +3,33 @@ package controller
 import (
 	"context"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
 	"github.com/gorizond/capi-vip-allocator/pkg/metrics"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 
-	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 const (
-	controlPlaneRole          = "control-plane"
-	ingressRole               = "ingress"
-	clusterClassLabel         = "vip.capi.gorizond.io/cluster-class"
-	clusterClassAnnotation    = "vip.capi.gorizond.io/cluster-class"
-	roleLabel                 = "vip.capi.gorizond.io/role"
-	ingressEnabledAnnotation  = "vip.capi.gorizond.io/ingress-enabled"
-	ingressVipAnnotation      = "vip.capi.gorizond.io/ingress-vip"
-	ipamGroup                 = "ipam.cluster.x-k8s.io"
-	ipamVersion               = "v1beta1"  // for IPAddressClaim and IPAddress
-	globalPoolAPIVersion      = "v1alpha2" // for GlobalInClusterIPPool
-	globalPoolKind            = "GlobalInClusterIPPool"
-	ipAddressClaimKind        = "IPAddressClaim"
-	ipAddressKind             = "IPAddress"
-	defaultRequeueDelay       = 10 * time.Second
-	clusterClassLabelTrueFlag = "true"
+	defaultRequeueDelay = 10 * time.Second
+	// Shadow results are refreshed periodically so they follow pool and policy changes
+	shadowResyncPeriod = 5 * time.Minute
+	// Claims created during admission are kept this long without a Cluster; it must exceed the
+	// time the API server may spend admitting the Cluster after the mutating webhook returned
+	unadoptedClaimGracePeriod = 2 * time.Minute
 )
 
 // ClusterReconciler reconciles Cluster resources to ensure a control-plane VIP is allocated.
@@ -44,7 +37,39 @@ type ClusterReconciler struct {
 	client.Client
 	Scheme      *runtime.Scheme
 	Logger      logr.Logger
+	Recorder    record.EventRecorder
 	DefaultPort int32
+	// Shadow only reports the allocations that would be made, see allocator.ShadowEnabled
+	Shadow bool
+	// RequeueDelay is how long to wait before checking a pending claim again (default 10s)
+	RequeueDelay time.Duration
+	// ShadowResyncPeriod is how often shadow results are refreshed (default 5m)
+	ShadowResyncPeriod time.Duration
+	// APIReader reads uncached for the quota re-check after a claim is created; may be nil
+	APIReader client.Reader
+}
+
+// requeueDelay returns the configured RequeueDelay or the default.
+func (r *ClusterReconciler) requeueDelay() time.Duration {
+	if r.RequeueDelay > 0 {
+		return r.RequeueDelay
+	}
+	return defaultRequeueDelay
+}
+
+// shadowResync returns the configured ShadowResyncPeriod or the default.
+func (r *ClusterReconciler) shadowResync() time.Duration {
+	if r.ShadowResyncPeriod > 0 {
+		return r.ShadowResyncPeriod
+	}
+	return shadowResyncPeriod
+}
+
+// vipAllocator returns the allocator backed by the reconciler's client, logger and recorder.
+func (r *ClusterReconciler) vipAllocator() *allocator.PoolAllocator {
+	vips := allocator.New(r.Client, r.Logger, r.Recorder)
+	vips.APIReader = r.APIReader
+	return vips
 }
 
 // SetupWithManager wires the reconciler into controller-runtime.
@@ -53,11 +78,29 @@ func (r *ClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		r.DefaultPort = 6443
 	}
 
+	// Claims created by the mutating webhook have no owner yet; watching them requeues their
+	// Cluster so the claim is deleted if the Cluster never gets created
+	claim := &unstructured.Unstructured{}
+	claim.SetGroupVersionKind(allocator.ClaimGVK())
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&clusterv1.Cluster{}).
+		Watches(claim,
+			handler.EnqueueRequestsFromMapFunc(claimToCluster),
+			builder.WithPredicates(predicate.NewPredicateFuncs(allocator.Unadopted)),
+		).
 		Complete(r)
 }
 
+// claimToCluster maps a claim to the Cluster named by its cluster-name label.
+func claimToCluster(_ context.Context, obj client.Object) []reconcile.Request {
+	name := obj.GetLabels()[allocator.ClusterNameLabel]
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}}}
+}
+
 // Reconcile ensures the Cluster has a VIP allocated for its control-plane endpoint.
 // This controller works as a FALLBACK for clusters created without BeforeClusterCreate hook
 // or when the hook fails/is disabled.
@@ -68,7 +111,12 @@ func (r *ClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	cluster := &clusterv1.Cluster{}
 	if err := r.Client.Get(ctx, req.NamespacedName, cluster); err != nil {
 		if errors.IsNotFound(err) {
-			return ctrl.Result{}, nil
+			allocator.ForgetShadow(req.Namespace, req.Name)
+			retryAfter, err := r.vipAllocator().DeleteUnadoptedClaims(ctx, req.Namespace, req.Name, unadoptedClaimGracePeriod)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: retryAfter}, nil
 		}
 		return ctrl.Result{}, fmt.Errorf("fetch cluster: %w", err)
 	}
@@ -86,17 +134,34 @@ func (r *ClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		metrics.VipReconcileDurationSeconds.WithLabelValues(clusterClass).Observe(duration)
 	}()
 
+	if allocator.ShadowEnabled(cluster, r.Shadow) {
+		if err := r.reconcileShadow(ctx, cluster, log); err != nil {
+			log.Error(err, "shadow allocation")
+			metrics.VipReconcileTotal.WithLabelValues(clusterClass, "error").Inc()
+			return ctrl.Result{}, err
+		}
+		metrics.VipReconcileTotal.WithLabelValues(clusterClass, "shadow").Inc()
+		return ctrl.Result{RequeueAfter: r.shadowResync()}, nil
+	}
+	allocator.ForgetShadow(cluster.Namespace, cluster.Name)
+
+	ingressEnabled, err := r.ingressEnabled(ctx, cluster)
+	if err != nil {
+		metrics.VipReconcileTotal.WithLabelValues(clusterClass, "error").Inc()
+		return ctrl.Result{}, err
+	}
+
 	// ALWAYS check and allocate Ingress VIP first (independent of Control Plane VIP)
 	// Check if Ingress VIP is explicitly disabled
-	if cluster.Annotations[ingressEnabledAnnotation] != "false" {
+	if ingressEnabled {
 		if err := r.ensureIngressVIP(ctx, cluster, log); err != nil {
 			log.Error(err, "ensure ingress VIP")
-			metrics.VipAllocationErrorsTotal.WithLabelValues(ingressRole, clusterClass, "ingress_vip_allocation_failed").Inc()
+			metrics.VipAllocationErrorsTotal.WithLabelValues(allocator.IngressRole, clusterClass, "ingress_vip_allocation_failed").Inc()
 			metrics.VipReconcileTotal.WithLabelValues(clusterClass, "error").Inc()
 			return ctrl.Result{}, err
 		}
 	} else {
-		log.V(1).Info("ingress VIP explicitly disabled via annotation")
+		log.V(1).Info("ingress VIP explicitly disabled via annotation or VIPAllocationPolicy")
 	}
 
 	// EARLY CHECK: Skip Control Plane VIP allocation if already set
@@ -105,9 +170,7 @@ func (r *ClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 			"host", cluster.Spec.ControlPlaneEndpoint.Host)
 
 		// Still ensure claim is adopted (ownerReference set)
-		claimName := fmt.Sprintf("vip-cp-%s", cluster.Name)
-		_, err := r.ensureClaim(ctx, cluster, claimName)
-		if err != nil {
+		if _, err := r.vipAllocator().EnsureClaim(ctx, cluster, allocator.ControlPlaneRole); err != nil {
 			// Only log error, don't block reconcile
 			log.V(1).Info("could not adopt IPAddressClaim (may not exist)", "error", err.Error())
 		}
@@ -119,42 +182,42 @@ func (r *ClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	log.Info("controlPlaneEndpoint not set, controller will allocate VIP (fallback mode)")
 
 	allocationStart := time.Now()
-	claimName := fmt.Sprintf("vip-cp-%s", cluster.Name)
+	vips := r.vipAllocator()
 
-	// Ensure claim exists and adopt it if needed (may have been created by runtime extension)
-	claim, err := r.ensureClaim(ctx, cluster, claimName)
+	// Ensure claim exists and adopt it if needed (may have been created by runtime extension or webhook)
+	claim, err := vips.EnsureClaim(ctx, cluster, allocator.ControlPlaneRole)
 	if err != nil {
 		log.Error(err, "ensure IPAddressClaim")
-		metrics.VipAllocationErrorsTotal.WithLabelValues(controlPlaneRole, clusterClass, "claim_creation_failed").Inc()
+		metrics.VipAllocationErrorsTotal.WithLabelValues(allocator.ControlPlaneRole, clusterClass, "claim_creation_failed").Inc()
 		metrics.VipReconcileTotal.WithLabelValues(clusterClass, "error").Inc()
 		return ctrl.Result{}, err
 	}
 
 	// Wait for IP allocation
-	ip, ready, err := r.resolveIPAddress(ctx, cluster.Namespace, claim)
+	ip, ready, err := vips.ResolveAddress(ctx, claim)
 	if err != nil {
 		log.Error(err, "resolve IPAddress")
-		metrics.VipAllocationErrorsTotal.WithLabelValues(controlPlaneRole, clusterClass, "ip_resolution_failed").Inc()
+		metrics.VipAllocationErrorsTotal.WithLabelValues(allocator.ControlPlaneRole, clusterClass, "ip_resolution_failed").Inc()
 		metrics.VipReconcileTotal.WithLabelValues(clusterClass, "error").Inc()
 		return ctrl.Result{}, err
 	}
 	if !ready {
 		log.Info("claim not ready, will requeue")
 		metrics.VipReconcileTotal.WithLabelValues(clusterClass, "requeued").Inc()
-		return ctrl.Result{RequeueAfter: defaultRequeueDelay}, nil
+		return ctrl.Result{RequeueAfter: r.requeueDelay()}, nil
 	}
 
 	// Patch cluster endpoint
-	if err := r.patchClusterEndpoint(ctx, cluster, ip, cluster.Namespace); err != nil {
+	if err := r.patchClusterEndpoint(ctx, cluster, ip); err != nil {
 		log.Error(err, "patch cluster endpoint")
-		metrics.VipAllocationErrorsTotal.WithLabelValues(controlPlaneRole, clusterClass, "cluster_patch_failed").Inc()
+		metrics.VipAllocationErrorsTotal.WithLabelValues(allocator.ControlPlaneRole, clusterClass, "cluster_patch_failed").Inc()
 		metrics.VipReconcileTotal.WithLabelValues(clusterClass, "error").Inc()
 		return ctrl.Result{}, err
 	}
 
 	allocationDuration := time.Since(allocationStart).Seconds()
-	metrics.VipAllocationDurationSeconds.WithLabelValues(controlPlaneRole, clusterClass).Observe(allocationDuration)
-	metrics.VipAllocationsTotal.WithLabelValues(controlPlaneRole, clusterClass).Inc()
+	metrics.VipAllocationDurationSeconds.WithLabelValues(allocator.ControlPlaneRole, clusterClass).Observe(allocationDuration)
+	metrics.VipAllocationsTotal.WithLabelValues(allocator.ControlPlaneRole, clusterClass).Inc()
 	metrics.VipReconcileTotal.WithLabelValues(clusterClass, "success").Inc()
 
 	log.Info("control-plane VIP assigned by controller (fallback mode)", "ip", ip, "duration_seconds", allocationDuration)
@@ -162,286 +225,80 @@ func (r *ClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	return ctrl.Result{}, nil
 }
 
-func (r *ClusterReconciler) ensureClaim(ctx context.Context, cluster *clusterv1.Cluster, claimName string) (*unstructured.Unstructured, error) {
-	log := r.Logger.WithValues("cluster", cluster.Name, "claim", claimName)
-	claimGVK := schema.GroupVersionKind{Group: ipamGroup, Version: ipamVersion, Kind: ipAddressClaimKind}
-
-	claim := &unstructured.Unstructured{}
-	claim.SetGroupVersionKind(claimGVK)
-
-	namespacedName := types.NamespacedName{Name: claimName, Namespace: cluster.Namespace}
-	if err := r.Client.Get(ctx, namespacedName, claim); err == nil {
-		// Claim exists - check if it needs ownerReference adoption
-		if len(claim.GetOwnerReferences()) == 0 {
-			// Claim was created by runtime extension hook without ownerRef
-			// Adopt it by adding ownerReference
-			log.Info("Adopting IPAddressClaim created by runtime extension")
-			ownerRef := metav1.NewControllerRef(cluster, clusterv1.GroupVersion.WithKind("Cluster"))
-			claim.SetOwnerReferences([]metav1.OwnerReference{*ownerRef})
-
-			if err := r.Client.Update(ctx, claim); err != nil {
-				return nil, fmt.Errorf("adopt IPAddressClaim: %w", err)
-			}
-			log.Info("IPAddressClaim adopted successfully")
-		}
-		return claim, nil
-	} else if !errors.IsNotFound(err) {
-		return nil, fmt.Errorf("get IPAddressClaim: %w", err)
-	}
-
-	poolName, err := r.findPool(ctx, cluster.Spec.Topology.Class, controlPlaneRole)
-	if err != nil {
-		return nil, err
-	}
-
-	if poolName == "" {
-		return nil, fmt.Errorf("no matching ip pool for class %q", cluster.Spec.Topology.Class)
-	}
+func (r *ClusterReconciler) patchClusterEndpoint(ctx context.Context, cluster *clusterv1.Cluster, ip string) error {
+	patchHelper := client.MergeFrom(cluster.DeepCopy())
 
-	claim.SetName(claimName)
-	claim.SetNamespace(cluster.Namespace)
-	claim.SetLabels(map[string]string{
-		roleLabel: controlPlaneRole,
-	})
-
-	ownerRef := metav1.NewControllerRef(cluster, clusterv1.GroupVersion.WithKind("Cluster"))
-	claim.SetOwnerReferences([]metav1.OwnerReference{*ownerRef})
-
-	if err := unstructured.SetNestedField(claim.Object, map[string]interface{}{
-		"apiGroup": ipamGroup,
-		"kind":     globalPoolKind,
-		"name":     poolName,
-	}, "spec", "poolRef"); err != nil {
-		return nil, fmt.Errorf("set poolRef: %w", err)
+	if err := r.setClusterEndpoint(ctx, cluster, ip); err != nil {
+		return err
 	}
 
-	if err := r.Client.Create(ctx, claim); err != nil {
-		return nil, fmt.Errorf("create IPAddressClaim: %w", err)
+	if err := r.Client.Patch(ctx, cluster, patchHelper); err != nil {
+		return fmt.Errorf("patch cluster endpoint: %w", err)
 	}
 
-	return claim, nil
+	return nil
 }
 
-func (r *ClusterReconciler) findPool(ctx context.Context, className, role string) (string, error) {
-	poolListGVK := schema.GroupVersionKind{Group: ipamGroup, Version: globalPoolAPIVersion, Kind: globalPoolKind + "List"}
-	pools := &unstructured.UnstructuredList{}
-	pools.SetGroupVersionKind(poolListGVK)
-
-	// List all GlobalInClusterIPPool resources without label filtering
-	// We'll filter them manually to support comma-separated values and annotation-based class names
-	if err := r.Client.List(ctx, pools); err != nil {
-		return "", fmt.Errorf("list %s: %w", globalPoolKind, err)
-	}
-
-	// Find a pool that matches both className and role (supporting comma-separated values and annotations)
-	for _, pool := range pools.Items {
-		labels := pool.GetLabels()
-		annotations := pool.GetAnnotations()
-
-		// Check if cluster-class label matches (exact, comma-separated, or annotation-based)
-		classLabel, classExists := labels[clusterClassLabel]
-		if !classExists {
-			continue
-		}
-
-		// NEW LOGIC: If label value is "true", read cluster classes from annotation
-		if classLabel == clusterClassLabelTrueFlag {
-			classAnnotation, annotationExists := annotations[clusterClassAnnotation]
-			if !annotationExists {
-				// Label is "true" but no annotation found - skip this pool
-				continue
-			}
-			// Check if annotation contains our className (comma-separated list)
-			if !labelContainsValue(classAnnotation, className) {
-				continue
-			}
-		} else {
-			// OLD LOGIC: Label contains cluster class name(s) directly
-			if !labelContainsValue(classLabel, className) {
-				continue
-			}
-		}
-
-		// Check if role label matches (exact or comma-separated)
-		roleLabel, roleExists := labels[roleLabel]
-		if !roleExists {
-			continue
-		}
-		if !labelContainsValue(roleLabel, role) {
-			continue
-		}
-
-		// Found a matching pool
-		return pool.GetName(), nil
-	}
-
-	return "", nil
+// setClusterEndpoint sets the control plane endpoint and, if the ClusterClass defines it,
+// the VIP variable on the in-memory Cluster object.
+func (r *ClusterReconciler) setClusterEndpoint(ctx context.Context, cluster *clusterv1.Cluster, ip string) error {
+	return r.vipAllocator().SetControlPlaneEndpoint(ctx, cluster, ip, r.DefaultPort)
 }
 
-// labelContainsValue checks if a label value contains the target value.
-// Supports both exact match and comma-separated lists.
-// Examples:
-//   - labelContainsValue("rke2-proxmox-class", "rke2-proxmox-class") -> true
-//   - labelContainsValue("class1,class2,class3", "class2") -> true
-//   - labelContainsValue("class1, class2, class3", "class2") -> true (with spaces)
-func labelContainsValue(labelValue, targetValue string) bool {
-	// Trim spaces from target value
-	targetValue = strings.TrimSpace(targetValue)
-
-	// Check exact match first (optimization)
-	if strings.TrimSpace(labelValue) == targetValue {
-		return true
-	}
-
-	// Split by comma and check each value
-	values := strings.Split(labelValue, ",")
-	for _, val := range values {
-		if strings.TrimSpace(val) == targetValue {
-			return true
-		}
-	}
-
-	return false
+// ingressEnabled reports whether an ingress VIP should be allocated for the cluster.
+func (r *ClusterReconciler) ingressEnabled(ctx context.Context, cluster *clusterv1.Cluster) (bool, error) {
+	return r.vipAllocator().IngressEnabled(ctx, cluster)
 }
 
-func (r *ClusterReconciler) resolveIPAddress(ctx context.Context, namespace string, claim *unstructured.Unstructured) (string, bool, error) {
-	addressName, found, err := unstructured.NestedString(claim.Object, "status", "addressRef", "name")
+// reconcileShadow reports the pool and address each VIP role of the cluster would get, without
+// creating claims or patching the Cluster.
+func (r *ClusterReconciler) reconcileShadow(ctx context.Context, cluster *clusterv1.Cluster, log logr.Logger) error {
+	roles := []string{allocator.ControlPlaneRole}
+	ingressEnabled, err := r.ingressEnabled(ctx, cluster)
 	if err != nil {
-		return "", false, fmt.Errorf("read claim status: %w", err)
-	}
-	if !found || addressName == "" {
-		return "", false, nil
-	}
-
-	ipGVK := schema.GroupVersionKind{Group: ipamGroup, Version: ipamVersion, Kind: ipAddressKind}
-	ip := &unstructured.Unstructured{}
-	ip.SetGroupVersionKind(ipGVK)
-
-	nn := types.NamespacedName{Name: addressName, Namespace: namespace}
-	if err := r.Client.Get(ctx, nn, ip); err != nil {
-		if errors.IsNotFound(err) {
-			return "", false, nil
-		}
-		return "", false, fmt.Errorf("get IPAddress: %w", err)
+		return err
 	}
-
-	address, found, err := unstructured.NestedString(ip.Object, "spec", "address")
-	if err != nil {
-		return "", false, fmt.Errorf("read IPAddress: %w", err)
-	}
-	if !found || address == "" {
-		return "", false, nil
-	}
-
-	return address, true, nil
-}
-
-func (r *ClusterReconciler) patchClusterEndpoint(ctx context.Context, cluster *clusterv1.Cluster, ip string, clusterNamespace string) error {
-	patchHelper := client.MergeFrom(cluster.DeepCopy())
-
-	// Set the controlPlaneEndpoint directly
-	cluster.Spec.ControlPlaneEndpoint.Host = ip
-	if cluster.Spec.ControlPlaneEndpoint.Port == 0 {
-		cluster.Spec.ControlPlaneEndpoint.Port = r.DefaultPort
+	if ingressEnabled {
+		roles = append(roles, allocator.IngressRole)
+	} else {
+		allocator.ForgetShadow(cluster.Namespace, cluster.Name)
 	}
 
-	// Check if ClusterClass defines clusterVip variable (legacy mode)
-	// Only patch topology.variables if the variable is defined in ClusterClass
-	if cluster.Spec.Topology != nil {
-		clusterClass, err := r.getClusterClass(ctx, cluster.Spec.Topology.Class, clusterNamespace)
+	vips := r.vipAllocator()
+	for _, role := range roles {
+		result, err := vips.Shadow(ctx, cluster, role)
 		if err != nil {
-			return fmt.Errorf("get ClusterClass: %w", err)
-		}
-
-		// Check if ClusterClass defines clusterVip variable
-		if r.hasClusterVipVariable(clusterClass) {
-			// Legacy mode: update or add clusterVip variable
-			found := false
-			for i := range cluster.Spec.Topology.Variables {
-				if cluster.Spec.Topology.Variables[i].Name == "clusterVip" {
-					cluster.Spec.Topology.Variables[i].Value.Raw = []byte(fmt.Sprintf("%q", ip))
-					found = true
-					break
-				}
-			}
-
-			// If not found, append new variable
-			if !found {
-				cluster.Spec.Topology.Variables = append(cluster.Spec.Topology.Variables, clusterv1.ClusterVariable{
-					Name:  "clusterVip",
-					Value: apiextensionsv1.JSON{Raw: []byte(fmt.Sprintf("%q", ip))},
-				})
-			}
+			return fmt.Errorf("shadow %s allocation: %w", role, err)
 		}
-		// If ClusterClass doesn't define clusterVip, we're in direct mode
-		// Only controlPlaneEndpoint.Host is patched (lines 205-208)
+		allocator.ReportShadow(log, r.Recorder, cluster, result)
 	}
-
-	if err := r.Client.Patch(ctx, cluster, patchHelper); err != nil {
-		return fmt.Errorf("patch cluster endpoint: %w", err)
-	}
-
 	return nil
 }
 
-// getClusterClass fetches the ClusterClass for the given class name.
-// First tries to get it as cluster-scoped, then falls back to namespace-scoped.
-func (r *ClusterReconciler) getClusterClass(ctx context.Context, className string, clusterNamespace string) (*clusterv1.ClusterClass, error) {
-	clusterClass := &clusterv1.ClusterClass{}
-
-	// First try cluster-scoped (without namespace)
-	namespacedName := types.NamespacedName{Name: className}
-	err := r.Client.Get(ctx, namespacedName, clusterClass)
-	if err == nil {
-		return clusterClass, nil
-	}
-
-	// If not found, try namespace-scoped (with cluster's namespace)
-	if errors.IsNotFound(err) {
-		namespacedName = types.NamespacedName{Name: className, Namespace: clusterNamespace}
-		if err := r.Client.Get(ctx, namespacedName, clusterClass); err != nil {
-			return nil, fmt.Errorf("get ClusterClass %q (tried both cluster-scoped and namespace %q): %w", className, clusterNamespace, err)
-		}
-		return clusterClass, nil
-	}
-
-	return nil, fmt.Errorf("get ClusterClass %q: %w", className, err)
-}
-
-// hasClusterVipVariable checks if the ClusterClass defines a clusterVip variable.
-func (r *ClusterReconciler) hasClusterVipVariable(clusterClass *clusterv1.ClusterClass) bool {
-	for _, variable := range clusterClass.Spec.Variables {
-		if variable.Name == "clusterVip" {
-			return true
-		}
-	}
-	return false
-}
-
 // ensureIngressVIP allocates and sets Ingress VIP annotation for the cluster.
 func (r *ClusterReconciler) ensureIngressVIP(ctx context.Context, cluster *clusterv1.Cluster, log logr.Logger) error {
 	clusterClass := cluster.Spec.Topology.Class
 
 	// Check if ingress VIP annotation already set
-	if existingVip, ok := cluster.Annotations[ingressVipAnnotation]; ok && existingVip != "" {
+	if existingVip, ok := cluster.Annotations[allocator.IngressVIPAnnotation()]; ok && existingVip != "" {
 		log.V(1).Info("ingress VIP annotation already set, skipping allocation", "vip", existingVip)
 		return nil
 	}
 
 	allocationStart := time.Now()
-	claimName := fmt.Sprintf("vip-ingress-%s", cluster.Name)
+	vips := r.vipAllocator()
 
 	// Ensure claim exists
-	claim, err := r.ensureClaimWithRole(ctx, cluster, claimName, ingressRole)
+	claim, err := vips.EnsureClaim(ctx, cluster, allocator.IngressRole)
 	if err != nil {
-		metrics.VipAllocationErrorsTotal.WithLabelValues(ingressRole, clusterClass, "claim_creation_failed").Inc()
+		metrics.VipAllocationErrorsTotal.WithLabelValues(allocator.IngressRole, clusterClass, "claim_creation_failed").Inc()
 		return fmt.Errorf("ensure ingress IPAddressClaim: %w", err)
 	}
 
 	// Wait for IP allocation
-	ip, ready, err := r.resolveIPAddress(ctx, cluster.Namespace, claim)
+	ip, ready, err := vips.ResolveAddress(ctx, claim)
 	if err != nil {
-		metrics.VipAllocationErrorsTotal.WithLabelValues(ingressRole, clusterClass, "ip_resolution_failed").Inc()
+		metrics.VipAllocationErrorsTotal.WithLabelValues(allocator.IngressRole, clusterClass, "ip_resolution_failed").Inc()
 		return fmt.Errorf("resolve ingress IPAddress: %w", err)
 	}
 	if !ready {
@@ -452,85 +309,17 @@ func (r *ClusterReconciler) ensureIngressVIP(ctx context.Context, cluster *clust
 	// Set ingress VIP in annotation and label
 	patchHelper := client.MergeFrom(cluster.DeepCopy())
 
-	if cluster.Annotations == nil {
-		cluster.Annotations = make(map[string]string)
-	}
-	cluster.Annotations[ingressVipAnnotation] = ip
-
-	if cluster.Labels == nil {
-		cluster.Labels = make(map[string]string)
-	}
-	cluster.Labels[ingressVipAnnotation] = ip
+	allocator.SetIngressVIP(cluster, ip)
 
 	if err := r.Client.Patch(ctx, cluster, patchHelper); err != nil {
-		metrics.VipAllocationErrorsTotal.WithLabelValues(ingressRole, clusterClass, "cluster_patch_failed").Inc()
+		metrics.VipAllocationErrorsTotal.WithLabelValues(allocator.IngressRole, clusterClass, "cluster_patch_failed").Inc()
 		return fmt.Errorf("patch cluster ingress VIP annotation and label: %w", err)
 	}
 
 	allocationDuration := time.Since(allocationStart).Seconds()
-	metrics.VipAllocationDurationSeconds.WithLabelValues(ingressRole, clusterClass).Observe(allocationDuration)
-	metrics.VipAllocationsTotal.WithLabelValues(ingressRole, clusterClass).Inc()
+	metrics.VipAllocationDurationSeconds.WithLabelValues(allocator.IngressRole, clusterClass).Observe(allocationDuration)
+	metrics.VipAllocationsTotal.WithLabelValues(allocator.IngressRole, clusterClass).Inc()
 
-	log.Info("ingress VIP assigned to annotation and label", "ip", ip, "annotation", ingressVipAnnotation, "duration_seconds", allocationDuration)
+	log.Info("ingress VIP assigned to annotation and label", "ip", ip, "annotation", allocator.IngressVIPAnnotation(), "duration_seconds", allocationDuration)
 	return nil
 }
-
-// ensureClaim creates or adopts an IPAddressClaim with the specified role.
-// Overloaded version that accepts role parameter.
-func (r *ClusterReconciler) ensureClaimWithRole(ctx context.Context, cluster *clusterv1.Cluster, claimName string, role string) (*unstructured.Unstructured, error) {
-	log := r.Logger.WithValues("cluster", cluster.Name, "claim", claimName, "role", role)
-	claimGVK := schema.GroupVersionKind{Group: ipamGroup, Version: ipamVersion, Kind: ipAddressClaimKind}
-
-	claim := &unstructured.Unstructured{}
-	claim.SetGroupVersionKind(claimGVK)
-
-	namespacedName := types.NamespacedName{Name: claimName, Namespace: cluster.Namespace}
-	if err := r.Client.Get(ctx, namespacedName, claim); err == nil {
-		// Claim exists - check if it needs ownerReference adoption
-		if len(claim.GetOwnerReferences()) == 0 {
-			log.Info("Adopting IPAddressClaim created by runtime extension")
-			ownerRef := metav1.NewControllerRef(cluster, clusterv1.GroupVersion.WithKind("Cluster"))
-			claim.SetOwnerReferences([]metav1.OwnerReference{*ownerRef})
-
-			if err := r.Client.Update(ctx, claim); err != nil {
-				return nil, fmt.Errorf("adopt IPAddressClaim: %w", err)
-			}
-			log.Info("IPAddressClaim adopted successfully")
-		}
-		return claim, nil
-	} else if !errors.IsNotFound(err) {
-		return nil, fmt.Errorf("get IPAddressClaim: %w", err)
-	}
-
-	poolName, err := r.findPool(ctx, cluster.Spec.Topology.Class, role)
-	if err != nil {
-		return nil, err
-	}
-
-	if poolName == "" {
-		return nil, fmt.Errorf("no matching ip pool for class %q role %q", cluster.Spec.Topology.Class, role)
-	}
-
-	claim.SetName(claimName)
-	claim.SetNamespace(cluster.Namespace)
-	claim.SetLabels(map[string]string{
-		roleLabel: role,
-	})
-
-	ownerRef := metav1.NewControllerRef(cluster, clusterv1.GroupVersion.WithKind("Cluster"))
-	claim.SetOwnerReferences([]metav1.OwnerReference{*ownerRef})
-
-	if err := unstructured.SetNestedField(claim.Object, map[string]interface{}{
-		"apiGroup": ipamGroup,
-		"kind":     globalPoolKind,
-		"name":     poolName,
-	}, "spec", "poolRef"); err != nil {
-		return nil, fmt.Errorf("set poolRef: %w", err)
-	}
-
-	if err := r.Client.Create(ctx, claim); err != nil {
-		return nil, fmt.Errorf("create IPAddressClaim: %w", err)
-	}
-
-	return claim, nil
-}
@@ -6,11 +6,17 @@ import (
 	"testing"
 
 	"github.com/go-logr/logr/testr"
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	"github.com/gorizond/capi-vip-allocator/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -21,7 +27,7 @@ func TestClusterReconciler_Reconcile_SkipsWhenVIPAlreadySet(t *testing.T) {
 	if err := clusterv1.AddToScheme(scheme); err != nil {
 		t.Fatalf("add cluster api scheme: %v", err)
 	}
-	registerIPAMGVKs(scheme)
+	fixtures.RegisterIPAMGVKs(scheme)
 
 	// Cluster with VIP already set (by BeforeClusterCreate hook)
 	cluster := &clusterv1.Cluster{
@@ -29,7 +35,7 @@ func TestClusterReconciler_Reconcile_SkipsWhenVIPAlreadySet(t *testing.T) {
 			Name:      "test-cluster",
 			Namespace: "default",
 			Annotations: map[string]string{
-				ingressEnabledAnnotation: "false", // Disable ingress VIP for this test
+				allocator.IngressEnabledAnnotation(): "false", // Disable ingress VIP for this test
 			},
 		},
 		Spec: clusterv1.ClusterSpec{
@@ -41,9 +47,9 @@ func TestClusterReconciler_Reconcile_SkipsWhenVIPAlreadySet(t *testing.T) {
 		},
 	}
 
-	pool := newGlobalPool("pool-cp", map[string]string{
-		clusterClassLabel: "example",
-		roleLabel:         controlPlaneRole,
+	pool := fixtures.NewGlobalPool("pool-cp", map[string]string{
+		allocator.ClusterClassLabel(): "example",
+		allocator.RoleLabel():         allocator.ControlPlaneRole,
 	})
 
 	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(cluster, pool).Build()
@@ -81,14 +87,17 @@ func TestClusterReconciler_Reconcile_RequeuesWhenClaimPending(t *testing.T) {
 	if err := clusterv1.AddToScheme(scheme); err != nil {
 		t.Fatalf("add cluster api scheme: %v", err)
 	}
-	registerIPAMGVKs(scheme)
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add core scheme: %v", err)
+	}
+	fixtures.RegisterIPAMGVKs(scheme)
 
 	cluster := &clusterv1.Cluster{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "test-cluster",
 			Namespace: "default",
 			Annotations: map[string]string{
-				ingressEnabledAnnotation: "false", // Disable ingress VIP for this test
+				allocator.IngressEnabledAnnotation(): "false", // Disable ingress VIP for this test
 			},
 		},
 		Spec: clusterv1.ClusterSpec{
@@ -96,9 +105,9 @@ func TestClusterReconciler_Reconcile_RequeuesWhenClaimPending(t *testing.T) {
 		},
 	}
 
-	pool := newGlobalPool("pool-cp", map[string]string{
-		clusterClassLabel: "example",
-		roleLabel:         controlPlaneRole,
+	pool := fixtures.NewGlobalPool("pool-cp", map[string]string{
+		allocator.ClusterClassLabel(): "example",
+		allocator.RoleLabel():         allocator.ControlPlaneRole,
 	})
 
 	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(cluster, pool).Build()
@@ -121,13 +130,13 @@ func TestClusterReconciler_Reconcile_RequeuesWhenClaimPending(t *testing.T) {
 	}
 
 	claim := &unstructured.Unstructured{}
-	claim.SetGroupVersionKind(schema.GroupVersionKind{Group: ipamGroup, Version: ipamVersion, Kind: ipAddressClaimKind})
+	claim.SetGroupVersionKind(schema.GroupVersionKind{Group: allocator.IPAMGroup, Version: allocator.IPAMVersion, Kind: allocator.IPAddressClaimKind})
 	if err := client.Get(ctx, types.NamespacedName{Name: "vip-cp-" + cluster.Name, Namespace: cluster.Namespace}, claim); err != nil {
 		t.Fatalf("expected IPAddressClaim to be created: %v", err)
 	}
 
-	if got := claim.GetLabels()[roleLabel]; got != controlPlaneRole {
-		t.Fatalf("expected claim label %q=%q, got %q", roleLabel, controlPlaneRole, got)
+	if got := claim.GetLabels()[allocator.RoleLabel()]; got != allocator.ControlPlaneRole {
+		t.Fatalf("expected claim label %q=%q, got %q", allocator.RoleLabel(), allocator.ControlPlaneRole, got)
 	}
 
 	poolRef, found, err := unstructured.NestedMap(claim.Object, "spec", "poolRef")
@@ -158,19 +167,105 @@ func TestClusterReconciler_Reconcile_RequeuesWhenClaimPending(t *testing.T) {
 	}
 }
 
+func TestClusterReconciler_Reconcile_ShadowModeOnlyReports(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clusterv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add cluster api scheme: %v", err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add core scheme: %v", err)
+	}
+	fixtures.RegisterIPAMGVKs(scheme)
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "shadow-cluster",
+			Namespace: "default",
+			Annotations: map[string]string{
+				allocator.IngressEnabledAnnotation(): "false", // Disable ingress VIP for this test
+			},
+		},
+		Spec: clusterv1.ClusterSpec{
+			Topology: &clusterv1.Topology{Class: "example"},
+		},
+	}
+
+	pool := fixtures.NewGlobalPool("pool-cp", map[string]string{
+		allocator.ClusterClassLabel(): "example",
+		allocator.RoleLabel():         allocator.ControlPlaneRole,
+	})
+	pool.Object["spec"] = map[string]interface{}{"addresses": []interface{}{"10.2.0.30-10.2.0.40"}}
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(cluster, pool).Build()
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &ClusterReconciler{
+		Client:      client,
+		Scheme:      scheme,
+		Logger:      testr.New(t),
+		Recorder:    recorder,
+		DefaultPort: 6443,
+		Shadow:      true,
+	}
+
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace}}
+
+	result, err := reconciler.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if result.RequeueAfter != shadowResyncPeriod {
+		t.Fatalf("expected requeue after %v, got %v", shadowResyncPeriod, result.RequeueAfter)
+	}
+
+	claims := &unstructured.UnstructuredList{}
+	claims.SetGroupVersionKind(schema.GroupVersionKind{Group: allocator.IPAMGroup, Version: allocator.IPAMVersion, Kind: allocator.IPAddressClaimKind + "List"})
+	if err := client.List(ctx, claims); err != nil {
+		t.Fatalf("list claims: %v", err)
+	}
+	if len(claims.Items) != 0 {
+		t.Fatalf("expected no IPAddressClaim in shadow mode, found %d", len(claims.Items))
+	}
+
+	updatedCluster := &clusterv1.Cluster{}
+	if err := client.Get(ctx, req.NamespacedName, updatedCluster); err != nil {
+		t.Fatalf("fetch cluster after reconcile: %v", err)
+	}
+	if updatedCluster.Spec.ControlPlaneEndpoint.Host != "" || updatedCluster.ResourceVersion != "999" {
+		t.Fatalf("expected the cluster to stay untouched, got host %q resourceVersion %s", updatedCluster.Spec.ControlPlaneEndpoint.Host, updatedCluster.ResourceVersion)
+	}
+
+	if event := <-recorder.Events; !strings.Contains(event, "would allocate control-plane VIP 10.2.0.30 from pool pool-cp") {
+		t.Fatalf("unexpected event %q", event)
+	}
+	gauge := metrics.VipShadowAllocation.WithLabelValues(cluster.Namespace, cluster.Name, allocator.ControlPlaneRole, "pool-cp", "10.2.0.30", "", "")
+	if got := testutil.ToFloat64(gauge); got != 1 {
+		t.Fatalf("expected shadow allocation to be reported as a change, got %v", got)
+	}
+
+	// Leaving shadow mode drops the cluster's shadow series
+	reconciler.Shadow = false
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if got := testutil.CollectAndCount(metrics.VipShadowAllocation); got != 0 {
+		t.Fatalf("expected shadow series to be removed, found %d", got)
+	}
+}
+
 func TestClusterReconciler_Reconcile_AssignsIPAddress_DirectMode(t *testing.T) {
 	scheme := runtime.NewScheme()
 	if err := clusterv1.AddToScheme(scheme); err != nil {
 		t.Fatalf("add cluster api scheme: %v", err)
 	}
-	registerIPAMGVKs(scheme)
+	fixtures.RegisterIPAMGVKs(scheme)
 
 	cluster := &clusterv1.Cluster{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "test-cluster",
 			Namespace: "default",
 			Annotations: map[string]string{
-				ingressEnabledAnnotation: "false", // Disable ingress VIP for this test
+				allocator.IngressEnabledAnnotation(): "false", // Disable ingress VIP for this test
 			},
 		},
 		Spec: clusterv1.ClusterSpec{
@@ -190,19 +285,19 @@ func TestClusterReconciler_Reconcile_AssignsIPAddress_DirectMode(t *testing.T) {
 		},
 	}
 
-	pool := newGlobalPool("pool-cp", map[string]string{
-		clusterClassLabel: "example",
-		roleLabel:         controlPlaneRole,
+	pool := fixtures.NewGlobalPool("pool-cp", map[string]string{
+		allocator.ClusterClassLabel(): "example",
+		allocator.RoleLabel():         allocator.ControlPlaneRole,
 	})
 
-	claim := newIPAddressClaim(cluster, "vip-cp-"+cluster.Name)
+	claim := fixtures.NewIPAddressClaim(cluster, "vip-cp-"+cluster.Name, map[string]string{allocator.RoleLabel(): allocator.ControlPlaneRole})
 	if err := unstructured.SetNestedField(claim.Object, map[string]interface{}{
 		"name": "vip-address",
 	}, "status", "addressRef"); err != nil {
 		t.Fatalf("set claim status: %v", err)
 	}
 
-	ip := newIPAddress("vip-address", cluster.Namespace, "10.0.0.15")
+	ip := fixtures.NewIPAddress("vip-address", cluster.Namespace, "10.0.0.15")
 
 	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(cluster, clusterClass, pool, claim, ip).Build()
 	reconciler := &ClusterReconciler{
@@ -247,14 +342,14 @@ func TestClusterReconciler_Reconcile_AssignsIPAddress_LegacyMode(t *testing.T) {
 	if err := clusterv1.AddToScheme(scheme); err != nil {
 		t.Fatalf("add cluster api scheme: %v", err)
 	}
-	registerIPAMGVKs(scheme)
+	fixtures.RegisterIPAMGVKs(scheme)
 
 	cluster := &clusterv1.Cluster{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "test-cluster-legacy",
 			Namespace: "default",
 			Annotations: map[string]string{
-				ingressEnabledAnnotation: "false", // Disable ingress VIP for this test
+				allocator.IngressEnabledAnnotation(): "false", // Disable ingress VIP for this test
 			},
 		},
 		Spec: clusterv1.ClusterSpec{
@@ -275,19 +370,19 @@ func TestClusterReconciler_Reconcile_AssignsIPAddress_LegacyMode(t *testing.T) {
 		},
 	}
 
-	pool := newGlobalPool("pool-cp", map[string]string{
-		clusterClassLabel: "example-legacy",
-		roleLabel:         controlPlaneRole,
+	pool := fixtures.NewGlobalPool("pool-cp", map[string]string{
+		allocator.ClusterClassLabel(): "example-legacy",
+		allocator.RoleLabel():         allocator.ControlPlaneRole,
 	})
 
-	claim := newIPAddressClaim(cluster, "vip-cp-"+cluster.Name)
+	claim := fixtures.NewIPAddressClaim(cluster, "vip-cp-"+cluster.Name, map[string]string{allocator.RoleLabel(): allocator.ControlPlaneRole})
 	if err := unstructured.SetNestedField(claim.Object, map[string]interface{}{
 		"name": "vip-address",
 	}, "status", "addressRef"); err != nil {
 		t.Fatalf("set claim status: %v", err)
 	}
 
-	ip := newIPAddress("vip-address", cluster.Namespace, "10.0.0.20")
+	ip := fixtures.NewIPAddress("vip-address", cluster.Namespace, "10.0.0.20")
 
 	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(cluster, clusterClass, pool, claim, ip).Build()
 	reconciler := &ClusterReconciler{
@@ -334,85 +429,12 @@ func TestClusterReconciler_Reconcile_AssignsIPAddress_LegacyMode(t *testing.T) {
 	}
 }
 
-func TestEnsureClaimErrorsWhenPoolMissing(t *testing.T) {
-	scheme := runtime.NewScheme()
-	if err := clusterv1.AddToScheme(scheme); err != nil {
-		t.Fatalf("add cluster api scheme: %v", err)
-	}
-	registerIPAMGVKs(scheme)
-
-	cluster := &clusterv1.Cluster{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "no-pool",
-			Namespace: "default",
-		},
-		Spec: clusterv1.ClusterSpec{
-			Topology: &clusterv1.Topology{Class: "missing"},
-		},
-	}
-
-	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(cluster).Build()
-	reconciler := &ClusterReconciler{
-		Client: client,
-		Scheme: scheme,
-		Logger: testr.New(t),
-	}
-
-	_, err := reconciler.ensureClaim(context.Background(), cluster, "vip-cp-"+cluster.Name)
-	if err == nil {
-		t.Fatalf("expected error when pool is missing")
-	}
-	if !strings.Contains(err.Error(), "no matching ip pool") {
-		t.Fatalf("unexpected error: %v", err)
-	}
-}
-
-func TestFindPoolMatchesClusterClassAndRole(t *testing.T) {
-	scheme := runtime.NewScheme()
-	if err := clusterv1.AddToScheme(scheme); err != nil {
-		t.Fatalf("add cluster api scheme: %v", err)
-	}
-	registerIPAMGVKs(scheme)
-
-	matching := newGlobalPool("control-plane-pool", map[string]string{
-		clusterClassLabel: "prod",
-		roleLabel:         controlPlaneRole,
-	})
-	wrongClass := newGlobalPool("wrong-class", map[string]string{
-		clusterClassLabel: "dev",
-		roleLabel:         controlPlaneRole,
-	})
-	wrongRole := newGlobalPool("wrong-role", map[string]string{
-		clusterClassLabel: "prod",
-		roleLabel:         "ingress",
-	})
-
-	client := fake.NewClientBuilder().
-		WithScheme(scheme).
-		WithRuntimeObjects(matching, wrongClass, wrongRole).
-		Build()
-
-	reconciler := &ClusterReconciler{
-		Client: client,
-		Scheme: scheme,
-		Logger: testr.New(t),
-	}
-
-	got, err := reconciler.findPool(context.Background(), "prod", controlPlaneRole)
-	if err != nil {
-		t.Fatalf("findPool returned error: %v", err)
-	}
-	if got != matching.GetName() {
-		t.Fatalf("expected pool %q, got %q", matching.GetName(), got)
-	}
-}
-
 func TestPatchClusterEndpointPreservesExistingPort(t *testing.T) {
 	scheme := runtime.NewScheme()
 	if err := clusterv1.AddToScheme(scheme); err != nil {
 		t.Fatalf("add cluster api scheme: %v", err)
 	}
-	registerIPAMGVKs(scheme)
+	fixtures.RegisterIPAMGVKs(scheme)
 
 	cluster := &clusterv1.Cluster{
 		ObjectMeta: metav1.ObjectMeta{
@@ -447,7 +469,7 @@ func TestPatchClusterEndpointPreservesExistingPort(t *testing.T) {
 		DefaultPort: 6443,
 	}
 
-	if err := reconciler.patchClusterEndpoint(context.Background(), cluster, "10.1.1.10", cluster.Namespace); err != nil {
+	if err := reconciler.patchClusterEndpoint(context.Background(), cluster, "10.1.1.10"); err != nil {
 		t.Fatalf("patchClusterEndpoint returned error: %v", err)
 	}
 
@@ -464,185 +486,12 @@ func TestPatchClusterEndpointPreservesExistingPort(t *testing.T) {
 	}
 }
 
-func TestResolveIPAddressPendingWithoutIPAddressResource(t *testing.T) {
-	scheme := runtime.NewScheme()
-	if err := clusterv1.AddToScheme(scheme); err != nil {
-		t.Fatalf("add cluster api scheme: %v", err)
-	}
-	registerIPAMGVKs(scheme)
-
-	cluster := &clusterv1.Cluster{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "wait-for-ip",
-			Namespace: "default",
-		},
-	}
-
-	claim := newIPAddressClaim(cluster, "vip-cp-"+cluster.Name)
-	if err := unstructured.SetNestedField(claim.Object, map[string]interface{}{
-		"name": "pending-ip",
-	}, "status", "addressRef"); err != nil {
-		t.Fatalf("set claim status: %v", err)
-	}
-
-	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(claim).Build()
-	reconciler := &ClusterReconciler{
-		Client: client,
-		Scheme: scheme,
-		Logger: testr.New(t),
-	}
-
-	ip, ready, err := reconciler.resolveIPAddress(context.Background(), cluster.Namespace, claim)
-	if err != nil {
-		t.Fatalf("resolveIPAddress returned error: %v", err)
-	}
-	if ready {
-		t.Fatalf("expected claim to be pending, got ready with ip %q", ip)
-	}
-	if ip != "" {
-		t.Fatalf("expected ip to be empty while pending, got %q", ip)
-	}
-}
-
-func registerIPAMGVKs(scheme *runtime.Scheme) {
-	// Register pool types with v1alpha2
-	gvPool := schema.GroupVersion{Group: ipamGroup, Version: globalPoolAPIVersion}
-	scheme.AddKnownTypeWithName(gvPool.WithKind(globalPoolKind), &unstructured.Unstructured{})
-	scheme.AddKnownTypeWithName(gvPool.WithKind(globalPoolKind+"List"), &unstructured.UnstructuredList{})
-
-	// Register claim/address types with v1beta1
-	gv := schema.GroupVersion{Group: ipamGroup, Version: ipamVersion}
-	scheme.AddKnownTypeWithName(gv.WithKind(ipAddressClaimKind), &unstructured.Unstructured{})
-	scheme.AddKnownTypeWithName(gv.WithKind(ipAddressClaimKind+"List"), &unstructured.UnstructuredList{})
-	scheme.AddKnownTypeWithName(gv.WithKind(ipAddressKind), &unstructured.Unstructured{})
-	scheme.AddKnownTypeWithName(gv.WithKind(ipAddressKind+"List"), &unstructured.UnstructuredList{})
-}
-
-func newGlobalPool(name string, labels map[string]string) *unstructured.Unstructured {
-	pool := &unstructured.Unstructured{}
-	pool.SetGroupVersionKind(schema.GroupVersionKind{Group: ipamGroup, Version: globalPoolAPIVersion, Kind: globalPoolKind})
-	pool.SetName(name)
-	pool.SetLabels(labels)
-	return pool
-}
-
-func newIPAddressClaim(cluster *clusterv1.Cluster, name string) *unstructured.Unstructured {
-	claim := &unstructured.Unstructured{}
-	claim.SetGroupVersionKind(schema.GroupVersionKind{Group: ipamGroup, Version: ipamVersion, Kind: ipAddressClaimKind})
-	claim.SetName(name)
-	claim.SetNamespace(cluster.Namespace)
-	claim.SetLabels(map[string]string{roleLabel: controlPlaneRole})
-	ownerRef := metav1.NewControllerRef(cluster, clusterv1.GroupVersion.WithKind("Cluster"))
-	claim.SetOwnerReferences([]metav1.OwnerReference{*ownerRef})
-	if err := unstructured.SetNestedField(claim.Object, map[string]interface{}{
-		"apiVersion": gvString(),
-		"kind":       globalPoolKind,
-		"name":       "pool-cp",
-	}, "spec", "poolRef"); err != nil {
-		panic(err)
-	}
-	return claim
-}
-
-func newIPAddress(name, namespace, address string) *unstructured.Unstructured {
-	ip := &unstructured.Unstructured{}
-	ip.SetGroupVersionKind(schema.GroupVersionKind{Group: ipamGroup, Version: ipamVersion, Kind: ipAddressKind})
-	ip.SetName(name)
-	ip.SetNamespace(namespace)
-	if err := unstructured.SetNestedField(ip.Object, address, "spec", "address"); err != nil {
-		panic(err)
-	}
-	return ip
-}
-
-func gvString() string {
-	return ipamGroup + "/" + ipamVersion
-}
-
-func TestGetClusterClass_NamespaceScoped(t *testing.T) {
-	scheme := runtime.NewScheme()
-	if err := clusterv1.AddToScheme(scheme); err != nil {
-		t.Fatalf("add cluster api scheme: %v", err)
-	}
-
-	// ClusterClass in namespace
-	clusterClass := &clusterv1.ClusterClass{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "rke2-proxmox-class",
-			Namespace: "clusters-proxmox",
-		},
-		Spec: clusterv1.ClusterClassSpec{
-			Variables: []clusterv1.ClusterClassVariable{
-				{Name: "clusterVip"},
-			},
-		},
-	}
-
-	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(clusterClass).Build()
-	reconciler := &ClusterReconciler{
-		Client: client,
-		Scheme: scheme,
-		Logger: testr.New(t),
-	}
-
-	ctx := context.Background()
-
-	// Test: should find ClusterClass in namespace
-	got, err := reconciler.getClusterClass(ctx, "rke2-proxmox-class", "clusters-proxmox")
-	if err != nil {
-		t.Fatalf("getClusterClass returned error: %v", err)
-	}
-	if got.Name != "rke2-proxmox-class" {
-		t.Fatalf("expected ClusterClass name %q, got %q", "rke2-proxmox-class", got.Name)
-	}
-	if got.Namespace != "clusters-proxmox" {
-		t.Fatalf("expected ClusterClass namespace %q, got %q", "clusters-proxmox", got.Namespace)
-	}
-}
-
-func TestGetClusterClass_ClusterScoped(t *testing.T) {
-	scheme := runtime.NewScheme()
-	if err := clusterv1.AddToScheme(scheme); err != nil {
-		t.Fatalf("add cluster api scheme: %v", err)
-	}
-
-	// ClusterClass without namespace (cluster-scoped)
-	clusterClass := &clusterv1.ClusterClass{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: "global-class",
-		},
-		Spec: clusterv1.ClusterClassSpec{
-			Variables: []clusterv1.ClusterClassVariable{
-				{Name: "someVariable"},
-			},
-		},
-	}
-
-	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(clusterClass).Build()
-	reconciler := &ClusterReconciler{
-		Client: client,
-		Scheme: scheme,
-		Logger: testr.New(t),
-	}
-
-	ctx := context.Background()
-
-	// Test: should find cluster-scoped ClusterClass
-	got, err := reconciler.getClusterClass(ctx, "global-class", "any-namespace")
-	if err != nil {
-		t.Fatalf("getClusterClass returned error: %v", err)
-	}
-	if got.Name != "global-class" {
-		t.Fatalf("expected ClusterClass name %q, got %q", "global-class", got.Name)
-	}
-}
-
 func TestEnsureIngressVIP_SetsAnnotationAndLabel(t *testing.T) {
 	scheme := runtime.NewScheme()
 	if err := clusterv1.AddToScheme(scheme); err != nil {
 		t.Fatalf("add cluster api scheme: %v", err)
 	}
-	registerIPAMGVKs(scheme)
+	fixtures.RegisterIPAMGVKs(scheme)
 
 	cluster := &clusterv1.Cluster{
 		ObjectMeta: metav1.ObjectMeta{
@@ -660,28 +509,28 @@ func TestEnsureIngressVIP_SetsAnnotationAndLabel(t *testing.T) {
 	}
 
 	// Create both control-plane and ingress pools
-	cpPool := newGlobalPool("pool-cp", map[string]string{
-		clusterClassLabel: "example",
-		roleLabel:         controlPlaneRole,
+	cpPool := fixtures.NewGlobalPool("pool-cp", map[string]string{
+		allocator.ClusterClassLabel(): "example",
+		allocator.RoleLabel():         allocator.ControlPlaneRole,
 	})
-	ingressPool := newGlobalPool("pool-ingress", map[string]string{
-		clusterClassLabel: "example",
-		roleLabel:         ingressRole,
+	ingressPool := fixtures.NewGlobalPool("pool-ingress", map[string]string{
+		allocator.ClusterClassLabel(): "example",
+		allocator.RoleLabel():         allocator.IngressRole,
 	})
 
 	// Create ingress claim with IP ready
 	ingressClaim := &unstructured.Unstructured{}
-	ingressClaim.SetGroupVersionKind(schema.GroupVersionKind{Group: ipamGroup, Version: ipamVersion, Kind: ipAddressClaimKind})
+	ingressClaim.SetGroupVersionKind(schema.GroupVersionKind{Group: allocator.IPAMGroup, Version: allocator.IPAMVersion, Kind: allocator.IPAddressClaimKind})
 	ingressClaim.SetName("vip-ingress-" + cluster.Name)
 	ingressClaim.SetNamespace(cluster.Namespace)
-	ingressClaim.SetLabels(map[string]string{roleLabel: ingressRole})
+	ingressClaim.SetLabels(map[string]string{allocator.RoleLabel(): allocator.IngressRole})
 	if err := unstructured.SetNestedField(ingressClaim.Object, map[string]interface{}{
 		"name": "vip-ingress-address",
 	}, "status", "addressRef"); err != nil {
 		t.Fatalf("set ingress claim status: %v", err)
 	}
 
-	ingressIP := newIPAddress("vip-ingress-address", cluster.Namespace, "10.0.0.101")
+	ingressIP := fixtures.NewIPAddress("vip-ingress-address", cluster.Namespace, "10.0.0.101")
 
 	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(cluster, cpPool, ingressPool, ingressClaim, ingressIP).Build()
 	reconciler := &ClusterReconciler{
@@ -710,216 +559,14 @@ func TestEnsureIngressVIP_SetsAnnotationAndLabel(t *testing.T) {
 	}
 
 	// Check annotation
-	gotAnnotation := updatedCluster.Annotations[ingressVipAnnotation]
+	gotAnnotation := updatedCluster.Annotations[allocator.IngressVIPAnnotation()]
 	if gotAnnotation != "10.0.0.101" {
 		t.Fatalf("expected ingress VIP annotation to be 10.0.0.101, got %s", gotAnnotation)
 	}
 
 	// Check label (NEW!)
-	gotLabel := updatedCluster.Labels[ingressVipAnnotation]
+	gotLabel := updatedCluster.Labels[allocator.IngressVIPAnnotation()]
 	if gotLabel != "10.0.0.101" {
 		t.Fatalf("expected ingress VIP label to be 10.0.0.101, got %s", gotLabel)
 	}
 }
-
-func TestLabelContainsValue(t *testing.T) {
-	tests := []struct {
-		name        string
-		labelValue  string
-		targetValue string
-		expected    bool
-	}{
-		{
-			name:        "exact match",
-			labelValue:  "rke2-proxmox-class",
-			targetValue: "rke2-proxmox-class",
-			expected:    true,
-		},
-		{
-			name:        "exact match with spaces",
-			labelValue:  " rke2-proxmox-class ",
-			targetValue: "rke2-proxmox-class",
-			expected:    true,
-		},
-		{
-			name:        "comma-separated first value",
-			labelValue:  "class1,class2,class3",
-			targetValue: "class1",
-			expected:    true,
-		},
-		{
-			name:        "comma-separated middle value",
-			labelValue:  "class1,class2,class3",
-			targetValue: "class2",
-			expected:    true,
-		},
-		{
-			name:        "comma-separated last value",
-			labelValue:  "class1,class2,class3",
-			targetValue: "class3",
-			expected:    true,
-		},
-		{
-			name:        "comma-separated with spaces",
-			labelValue:  "class1, class2, class3",
-			targetValue: "class2",
-			expected:    true,
-		},
-		{
-			name:        "comma-separated with mixed spaces",
-			labelValue:  "class1,class2 ,  class3",
-			targetValue: "class3",
-			expected:    true,
-		},
-		{
-			name:        "no match single value",
-			labelValue:  "rke2-proxmox-class",
-			targetValue: "other-class",
-			expected:    false,
-		},
-		{
-			name:        "no match comma-separated",
-			labelValue:  "class1,class2,class3",
-			targetValue: "class4",
-			expected:    false,
-		},
-		{
-			name:        "partial substring no match",
-			labelValue:  "rke2-proxmox-class",
-			targetValue: "rke2",
-			expected:    false,
-		},
-		{
-			name:        "empty label value",
-			labelValue:  "",
-			targetValue: "class1",
-			expected:    false,
-		},
-		{
-			name:        "empty target value",
-			labelValue:  "class1",
-			targetValue: "",
-			expected:    false,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := labelContainsValue(tt.labelValue, tt.targetValue)
-			if got != tt.expected {
-				t.Errorf("labelContainsValue(%q, %q) = %v, expected %v", tt.labelValue, tt.targetValue, got, tt.expected)
-			}
-		})
-	}
-}
-
-func TestFindPoolWithCommaSeparatedLabels(t *testing.T) {
-	scheme := runtime.NewScheme()
-	if err := clusterv1.AddToScheme(scheme); err != nil {
-		t.Fatalf("add cluster api scheme: %v", err)
-	}
-	registerIPAMGVKs(scheme)
-
-	// Pool with comma-separated cluster-class
-	poolMultiClass := newGlobalPool("multi-class-pool", map[string]string{
-		clusterClassLabel: "class1,class2,class3",
-		roleLabel:         controlPlaneRole,
-	})
-
-	// Pool with comma-separated role
-	poolMultiRole := newGlobalPool("multi-role-pool", map[string]string{
-		clusterClassLabel: "prod",
-		roleLabel:         "control-plane,ingress",
-	})
-
-	// Pool with both comma-separated
-	poolBothMulti := newGlobalPool("both-multi-pool", map[string]string{
-		clusterClassLabel: "dev,staging,prod",
-		roleLabel:         "control-plane,ingress",
-	})
-
-	// Single value pools for comparison
-	poolSingle := newGlobalPool("single-pool", map[string]string{
-		clusterClassLabel: "prod",
-		roleLabel:         controlPlaneRole,
-	})
-
-	client := fake.NewClientBuilder().
-		WithScheme(scheme).
-		WithRuntimeObjects(poolMultiClass, poolMultiRole, poolBothMulti, poolSingle).
-		Build()
-
-	reconciler := &ClusterReconciler{
-		Client: client,
-		Scheme: scheme,
-		Logger: testr.New(t),
-	}
-
-	ctx := context.Background()
-
-	tests := []struct {
-		name          string
-		className     string
-		role          string
-		expectedPools []string // can match multiple pools, we check if result is one of these
-	}{
-		{
-			name:          "match second value in cluster-class",
-			className:     "class2",
-			role:          controlPlaneRole,
-			expectedPools: []string{"multi-class-pool"},
-		},
-		{
-			name:          "match ingress role in multi-role pool",
-			className:     "prod",
-			role:          ingressRole,
-			expectedPools: []string{"multi-role-pool", "both-multi-pool"},
-		},
-		{
-			name:          "match control-plane role in multi-role pool",
-			className:     "prod",
-			role:          controlPlaneRole,
-			expectedPools: []string{"single-pool", "both-multi-pool"},
-		},
-		{
-			name:          "match staging in both-multi pool",
-			className:     "staging",
-			role:          ingressRole,
-			expectedPools: []string{"both-multi-pool"},
-		},
-		{
-			name:          "no match",
-			className:     "nonexistent",
-			role:          controlPlaneRole,
-			expectedPools: []string{},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := reconciler.findPool(ctx, tt.className, tt.role)
-			if err != nil {
-				t.Fatalf("findPool returned error: %v", err)
-			}
-
-			if len(tt.expectedPools) == 0 {
-				if got != "" {
-					t.Fatalf("expected no pool, got %q", got)
-				}
-				return
-			}
-
-			// Check if result is one of expected pools
-			found := false
-			for _, expected := range tt.expectedPools {
-				if got == expected {
-					found = true
-					break
-				}
-			}
-			if !found {
-				t.Fatalf("expected one of %v, got %q", tt.expectedPools, got)
-			}
-		})
-	}
-}
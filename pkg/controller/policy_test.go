@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	vipv1alpha1 "github.com/gorizond/capi-vip-allocator/api/v1alpha1"
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPatchClusterEndpointUsesPolicyPortAndVariable(t *testing.T) {
+	scheme := fixtures.NewScheme(t)
+
+	cluster := fixtures.NewTopologyCluster("default", "policy-cluster", "custom")
+	clusterClass := &clusterv1.ClusterClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "custom"},
+		Spec: clusterv1.ClusterClassSpec{
+			Variables: []clusterv1.ClusterClassVariable{{Name: "apiVip"}},
+		},
+	}
+	policy := &vipv1alpha1.VIPAllocationPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "custom"},
+		Spec: vipv1alpha1.VIPAllocationPolicySpec{
+			ClusterClasses: []string{"custom"},
+			Roles:          []string{allocator.ControlPlaneRole},
+			Pools:          []vipv1alpha1.PoolReference{{Name: "pool"}},
+			Port:           9345,
+			IngressPolicy:  vipv1alpha1.IngressPolicyDisabled,
+			Variables:      vipv1alpha1.VariableNames{ControlPlane: "apiVip"},
+		},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(cluster, clusterClass, policy).Build()
+	reconciler := &ClusterReconciler{Client: client, Scheme: scheme, Logger: testr.New(t), DefaultPort: 6443}
+	ctx := context.Background()
+
+	if err := reconciler.patchClusterEndpoint(ctx, cluster, "10.3.0.5"); err != nil {
+		t.Fatalf("patchClusterEndpoint returned error: %v", err)
+	}
+
+	updated := &clusterv1.Cluster{}
+	if err := client.Get(ctx, types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace}, updated); err != nil {
+		t.Fatalf("fetch cluster after patch: %v", err)
+	}
+	if updated.Spec.ControlPlaneEndpoint.Port != 9345 {
+		t.Fatalf("expected policy port 9345, got %d", updated.Spec.ControlPlaneEndpoint.Port)
+	}
+	if len(updated.Spec.Topology.Variables) != 1 || updated.Spec.Topology.Variables[0].Name != "apiVip" {
+		t.Fatalf("expected apiVip variable to be set, got %#v", updated.Spec.Topology.Variables)
+	}
+
+	enabled, err := reconciler.ingressEnabled(ctx, updated)
+	if err != nil {
+		t.Fatalf("ingressEnabled returned error: %v", err)
+	}
+	if enabled {
+		t.Fatalf("expected ingress to be disabled by policy")
+	}
+}
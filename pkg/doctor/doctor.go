@@ -0,0 +1,343 @@
+// Package doctor explains why a Cluster has no VIP. It walks the reconciler's decision path
+// step by step against a live management cluster and stops at the first failing step.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Severity is the outcome of a diagnostic step.
+type Severity string
+
+const (
+	// SeverityOK means the step passed.
+	SeverityOK Severity = "ok"
+	// SeverityInfo is context that does not block allocation.
+	SeverityInfo Severity = "info"
+	// SeverityWarning is a likely misconfiguration that does not block allocation.
+	SeverityWarning Severity = "warning"
+	// SeverityFail is the step that blocks allocation.
+	SeverityFail Severity = "fail"
+)
+
+// Finding is the result of one diagnostic step.
+type Finding struct {
+	// Role is empty for steps that apply to the whole cluster
+	Role     string   `json:"role,omitempty"`
+	Step     string   `json:"step"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	Hints    []string `json:"hints,omitempty"`
+}
+
+// Report lists the findings for a cluster in the order the steps ran.
+type Report struct {
+	Cluster  string    `json:"cluster"`
+	Findings []Finding `json:"findings"`
+}
+
+// Failures returns the failing findings, at most one per role.
+func (r *Report) Failures() []Finding {
+	var failures []Finding
+	for _, finding := range r.Findings {
+		if finding.Severity == SeverityFail {
+			failures = append(failures, finding)
+		}
+	}
+	return failures
+}
+
+// Options tune the diagnosis to the manager's configuration.
+type Options struct {
+	// Shadow is the manager-wide --shadow-mode setting
+	Shadow bool
+}
+
+// Diagnose walks the VIP decision path for the cluster. Cluster-level failures end the
+// diagnosis; otherwise every VIP role is diagnosed up to its first failing step.
+func Diagnose(ctx context.Context, c client.Client, key types.NamespacedName, opts Options) (*Report, error) {
+	d := &diagnosis{
+		vips:   allocator.New(c, logr.Discard(), nil),
+		report: &Report{Cluster: allocator.ClusterKey(key.Namespace, key.Name)},
+	}
+
+	cluster := &clusterv1.Cluster{}
+	if err := c.Get(ctx, key, cluster); err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, fmt.Errorf("get Cluster: %w", err)
+		}
+		d.add("", "cluster", SeverityFail, fmt.Sprintf("Cluster %s not found", d.report.Cluster),
+			"check the namespace and name: vipctl doctor <namespace>/<cluster>")
+		return d.report, nil
+	}
+	d.cluster = cluster
+
+	ok, err := d.checkCluster(ctx, opts)
+	if err != nil || !ok {
+		return d.report, err
+	}
+
+	roles := []string{allocator.ControlPlaneRole}
+	ingressEnabled, err := d.vips.IngressEnabled(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if ingressEnabled {
+		roles = append(roles, allocator.IngressRole)
+	} else {
+		d.add(allocator.IngressRole, "ingress", SeverityInfo,
+			fmt.Sprintf("ingress VIP disabled by the %s annotation or the VIPAllocationPolicy ingressPolicy", allocator.IngressEnabledAnnotation()))
+	}
+
+	for _, role := range roles {
+		if err := d.checkRole(ctx, role); err != nil {
+			return nil, err
+		}
+	}
+	return d.report, nil
+}
+
+type diagnosis struct {
+	vips    *allocator.PoolAllocator
+	cluster *clusterv1.Cluster
+	report  *Report
+}
+
+func (d *diagnosis) add(role, step string, severity Severity, message string, hints ...string) {
+	d.report.Findings = append(d.report.Findings, Finding{Role: role, Step: step, Severity: severity, Message: message, Hints: hints})
+}
+
+// checkCluster runs the steps shared by all roles and reports whether the diagnosis continues.
+func (d *diagnosis) checkCluster(ctx context.Context, opts Options) (bool, error) {
+	cluster := d.cluster
+	d.add("", "cluster", SeverityOK, fmt.Sprintf("Cluster %s found", d.report.Cluster))
+
+	if cluster.Spec.Topology == nil || cluster.Spec.Topology.Class == "" {
+		d.add("", "topology", SeverityFail, "Cluster has no spec.topology.class; only ClusterClass-based Clusters get a VIP",
+			"create the Cluster from a ClusterClass, or set spec.controlPlaneEndpoint manually")
+		return false, nil
+	}
+	className := cluster.Spec.Topology.Class
+	d.add("", "topology", SeverityOK, fmt.Sprintf("Cluster uses ClusterClass %q", className))
+
+	if _, err := d.vips.GetClusterClass(ctx, className, cluster.Namespace); err != nil {
+		if !errors.IsNotFound(err) {
+			return false, err
+		}
+		d.add("", "clusterclass", SeverityFail, fmt.Sprintf("ClusterClass %q not found in namespace %s", className, cluster.Namespace),
+			"create the ClusterClass or fix spec.topology.class; the reconciler reads it to set the VIP variable")
+		return false, nil
+	}
+	d.add("", "clusterclass", SeverityOK, fmt.Sprintf("ClusterClass %q exists", className))
+
+	if allocator.ShadowEnabled(cluster, opts.Shadow) {
+		hint := fmt.Sprintf("remove the %s annotation or set it to \"false\"", allocator.ShadowAnnotation())
+		if _, annotated := cluster.Annotations[allocator.ShadowAnnotation()]; !annotated {
+			hint = fmt.Sprintf("run the manager without --shadow-mode, or annotate the Cluster with %s: \"false\"", allocator.ShadowAnnotation())
+		}
+		d.add("", "shadow", SeverityFail, "shadow mode is enabled: allocations are only reported, never made",
+			hint, "see the ShadowAllocation events on the Cluster for the allocation it would get")
+		return false, nil
+	}
+
+	if cluster.DeletionTimestamp != nil {
+		d.add("", "deletion", SeverityFail, "Cluster is being deleted", "VIPs are released on deletion; nothing to allocate")
+		return false, nil
+	}
+	return true, nil
+}
+
+// checkRole follows the role's decision path up to its first failing step.
+func (d *diagnosis) checkRole(ctx context.Context, role string) error {
+	cluster := d.cluster
+	endpoint := clusterEndpoint(cluster, role)
+
+	claim := &unstructured.Unstructured{}
+	claim.SetGroupVersionKind(allocator.ClaimGVK())
+	claimName := allocator.ClaimName(cluster.Name, role)
+	err := d.vips.Client.Get(ctx, types.NamespacedName{Name: claimName, Namespace: cluster.Namespace}, claim)
+	switch {
+	case errors.IsNotFound(err):
+		claim = nil
+	case err != nil:
+		return fmt.Errorf("get IPAddressClaim: %w", err)
+	}
+
+	if endpoint != "" {
+		d.add(role, "endpoint", SeverityOK, fmt.Sprintf("%s is set to %s", endpointField(role), endpoint))
+		if claim != nil {
+			if address := claimAddress(ctx, d.vips, claim); address != "" && address != endpoint {
+				d.add(role, "endpoint", SeverityWarning,
+					fmt.Sprintf("IPAddressClaim %s holds %s, but the Cluster uses %s", claimName, address, endpoint),
+					"the Cluster endpoint wins; release the claim if the address was set manually")
+			}
+		}
+		return nil
+	}
+	d.add(role, "endpoint", SeverityInfo, fmt.Sprintf("%s is not set yet", endpointField(role)))
+
+	if claim != nil {
+		return d.checkClaim(ctx, role, claim)
+	}
+	d.add(role, "claim", SeverityInfo, fmt.Sprintf("IPAddressClaim %s does not exist yet", claimName))
+
+	pool, err := d.checkPoolSelection(ctx, role)
+	if err != nil || pool == "" {
+		return err
+	}
+
+	used, limit, limited, err := d.vips.QuotaUsage(ctx, cluster.Namespace)
+	if err != nil {
+		d.add(role, "quota", SeverityFail, err.Error(), fmt.Sprintf("fix the %s annotation on the Namespace", allocator.VIPQuotaAnnotation()))
+		return nil
+	}
+	if limited && used >= limit {
+		d.add(role, "quota", SeverityFail, fmt.Sprintf("namespace %s holds %d of %d allowed VIPs", cluster.Namespace, used, limit),
+			fmt.Sprintf("raise the %s annotation on the Namespace or release unused VIPs (vipctl inventory)", allocator.VIPQuotaAnnotation()))
+		return nil
+	}
+	if limited {
+		d.add(role, "quota", SeverityOK, fmt.Sprintf("namespace %s holds %d of %d allowed VIPs", cluster.Namespace, used, limit))
+	}
+
+	if !d.checkCapacity(ctx, role, pool) {
+		return nil
+	}
+
+	d.add(role, "claim", SeverityFail, fmt.Sprintf("pool %s can serve the %s VIP, but IPAddressClaim %s was not created", pool, role, claimName),
+		"check that the capi-vip-allocator manager runs with --enable-reconciler=true and read its logs for this Cluster",
+		"check the Cluster events for allocation errors: kubectl describe cluster -n "+cluster.Namespace+" "+cluster.Name)
+	return nil
+}
+
+// checkClaim follows an existing claim to its IPAddress.
+func (d *diagnosis) checkClaim(ctx context.Context, role string, claim *unstructured.Unstructured) error {
+	poolName, _, _ := unstructured.NestedString(claim.Object, "spec", "poolRef", "name")
+	d.add(role, "claim", SeverityOK, fmt.Sprintf("IPAddressClaim %s requests an address from pool %s", claim.GetName(), poolName))
+
+	pool := &unstructured.Unstructured{}
+	pool.SetGroupVersionKind(allocator.PoolGVK())
+	if err := d.vips.Client.Get(ctx, types.NamespacedName{Name: poolName}, pool); err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("get %s: %w", allocator.GlobalPoolKind, err)
+		}
+		d.add(role, "pool", SeverityFail, fmt.Sprintf("%s %s referenced by the claim does not exist", allocator.GlobalPoolKind, poolName),
+			"recreate the pool, or delete the claim so a matching pool is selected again")
+		return nil
+	}
+
+	addressName, _, _ := unstructured.NestedString(claim.Object, "status", "addressRef", "name")
+	if addressName == "" {
+		if !d.checkCapacity(ctx, role, poolName) {
+			return nil
+		}
+		d.add(role, "address", SeverityFail, fmt.Sprintf("IPAddressClaim %s has no status.addressRef: the IPAM provider has not allocated an address", claim.GetName()),
+			"check that the in-cluster IPAM provider (capi-ipam-in-cluster) is running and read its logs",
+			"check the claim conditions: kubectl get ipaddressclaim -n "+claim.GetNamespace()+" "+claim.GetName()+" -o yaml")
+		return nil
+	}
+
+	address := &unstructured.Unstructured{}
+	address.SetGroupVersionKind(allocator.AddressGVK())
+	if err := d.vips.Client.Get(ctx, types.NamespacedName{Name: addressName, Namespace: claim.GetNamespace()}, address); err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("get IPAddress: %w", err)
+		}
+		d.add(role, "address", SeverityFail, fmt.Sprintf("IPAddress %s referenced by the claim does not exist", addressName),
+			"delete the IPAddressClaim so the IPAM provider allocates a new address")
+		return nil
+	}
+	value, _, _ := unstructured.NestedString(address.Object, "spec", "address")
+	d.add(role, "address", SeverityOK, fmt.Sprintf("IPAddress %s holds %s", addressName, value))
+
+	d.add(role, "endpoint", SeverityFail, fmt.Sprintf("address %s is allocated but %s is not set", value, endpointField(role)),
+		"check that the capi-vip-allocator manager runs with --enable-reconciler=true and read its logs for this Cluster")
+	return nil
+}
+
+// checkCapacity reports whether the pool still has a free address.
+func (d *diagnosis) checkCapacity(ctx context.Context, role, pool string) bool {
+	usage, err := d.vips.PoolUsage(ctx, pool)
+	if err != nil {
+		d.add(role, "capacity", SeverityWarning, fmt.Sprintf("could not compute the capacity of pool %s: %v", pool, err))
+		return true
+	}
+	if usage.Free() <= 0 {
+		d.add(role, "capacity", SeverityFail, fmt.Sprintf("pool %s is exhausted: %d of %d addresses in use", pool, usage.Used, usage.Total),
+			"add addresses to the pool, add another pool for the class and role, or release unused VIPs (vipctl inventory)")
+		return false
+	}
+	d.add(role, "capacity", SeverityOK, fmt.Sprintf("pool %s has %d of %d addresses free", pool, usage.Free(), usage.Total))
+	return true
+}
+
+// claimAddress returns the address bound to the claim, "" if none or unreadable.
+func claimAddress(ctx context.Context, vips *allocator.PoolAllocator, claim *unstructured.Unstructured) string {
+	if address := claim.GetAnnotations()[allocator.AddressAnnotation()]; address != "" {
+		return address
+	}
+	addressName, _, _ := unstructured.NestedString(claim.Object, "status", "addressRef", "name")
+	if addressName == "" {
+		return ""
+	}
+	address := &unstructured.Unstructured{}
+	address.SetGroupVersionKind(allocator.AddressGVK())
+	if err := vips.Client.Get(ctx, types.NamespacedName{Name: addressName, Namespace: claim.GetNamespace()}, address); err != nil {
+		return ""
+	}
+	value, _, _ := unstructured.NestedString(address.Object, "spec", "address")
+	return value
+}
+
+// clusterEndpoint returns the address the Cluster publishes for the role.
+func clusterEndpoint(cluster *clusterv1.Cluster, role string) string {
+	if role == allocator.IngressRole {
+		return cluster.Annotations[allocator.IngressVIPAnnotation()]
+	}
+	return cluster.Spec.ControlPlaneEndpoint.Host
+}
+
+func endpointField(role string) string {
+	if role == allocator.IngressRole {
+		return "annotation " + allocator.IngressVIPAnnotation()
+	}
+	return "spec.controlPlaneEndpoint.host"
+}
+
+// WriteText prints the findings grouped by role, with hints under failing steps.
+func (r *Report) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "Cluster %s\n", r.Cluster); err != nil {
+		return err
+	}
+	role := ""
+	for _, finding := range r.Findings {
+		if finding.Role != role {
+			role = finding.Role
+			if _, err := fmt.Fprintf(w, "\nRole %s\n", role); err != nil {
+				return err
+			}
+		}
+		tag := "[" + strings.ToUpper(string(finding.Severity)) + "]"
+		if _, err := fmt.Fprintf(w, "  %-9s %-12s %s\n", tag, finding.Step, finding.Message); err != nil {
+			return err
+		}
+		for _, hint := range finding.Hints {
+			if _, err := fmt.Fprintf(w, "  %-9s %-12s hint: %s\n", "", "", hint); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
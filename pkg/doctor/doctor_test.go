@@ -0,0 +1,149 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newCluster(annotations map[string]string) *clusterv1.Cluster {
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[allocator.IngressEnabledAnnotation()] = "false"
+	return &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "alpha", Namespace: "team-a", Annotations: annotations},
+		Spec:       clusterv1.ClusterSpec{Topology: &clusterv1.Topology{Class: "prod", Version: "v1.30.0"}},
+	}
+}
+
+func newClusterClass() *clusterv1.ClusterClass {
+	return &clusterv1.ClusterClass{ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: "team-a"}}
+}
+
+func newPool(name string, labels, annotations map[string]string) *unstructured.Unstructured {
+	pool := &unstructured.Unstructured{}
+	pool.SetGroupVersionKind(allocator.PoolGVK())
+	pool.SetName(name)
+	pool.SetLabels(labels)
+	pool.SetAnnotations(annotations)
+	pool.Object["spec"] = map[string]interface{}{"addresses": []interface{}{"10.0.0.10-10.0.0.11"}}
+	return pool
+}
+
+func diagnose(t *testing.T, shadow bool, objects ...runtime.Object) *Report {
+	t.Helper()
+	c := fake.NewClientBuilder().WithScheme(fixtures.NewScheme(t)).WithRuntimeObjects(objects...).Build()
+	report, err := Diagnose(context.Background(), c, types.NamespacedName{Namespace: "team-a", Name: "alpha"}, Options{Shadow: shadow})
+	if err != nil {
+		t.Fatalf("Diagnose returned error: %v", err)
+	}
+	return report
+}
+
+func onlyFailure(t *testing.T, report *Report) Finding {
+	t.Helper()
+	failures := report.Failures()
+	if len(failures) != 1 {
+		var out bytes.Buffer
+		_ = report.WriteText(&out)
+		t.Fatalf("expected one failure, got %d:\n%s", len(failures), out.String())
+	}
+	return failures[0]
+}
+
+func TestDiagnoseReportsNearMissPools(t *testing.T) {
+	report := diagnose(t, false,
+		newCluster(nil),
+		newClusterClass(),
+		newPool("case", map[string]string{allocator.ClusterClassLabel(): "Prod", allocator.RoleLabel(): "control-plane"}, nil),
+		newPool("role", map[string]string{allocator.ClusterClassLabel(): "dev,prod", allocator.RoleLabel(): "Control-Plane"}, nil),
+		newPool("annotation", map[string]string{allocator.ClusterClassLabel(): "true", allocator.RoleLabel(): "control-plane"},
+			map[string]string{allocator.ClusterClassAnnotation(): "dev, pr od"}),
+		newPool("flag", map[string]string{allocator.ClusterClassLabel(): "true", allocator.RoleLabel(): "control-plane"}, nil),
+		newPool("other", map[string]string{allocator.ClusterClassLabel(): "dev", allocator.RoleLabel(): "control-plane"}, nil),
+	)
+
+	failure := onlyFailure(t, report)
+	if failure.Step != "pool" || failure.Role != allocator.ControlPlaneRole {
+		t.Fatalf("expected the control-plane pool step to fail, got %+v", failure)
+	}
+	hints := strings.Join(failure.Hints, "\n")
+	for _, want := range []string{
+		`pool case: label vip.capi.gorizond.io/cluster-class="Prod" differs from class "prod" only by case or whitespace`,
+		`pool role: label vip.capi.gorizond.io/role="Control-Plane" differs from role "control-plane" only by case or whitespace`,
+		`pool annotation: annotation vip.capi.gorizond.io/cluster-class="dev, pr od" differs from class "prod" only by case or whitespace`,
+		`pool flag: label vip.capi.gorizond.io/cluster-class is "true" but the vip.capi.gorizond.io/cluster-class annotation is missing`,
+	} {
+		if !strings.Contains(hints, want) {
+			t.Errorf("expected hint %q, got:\n%s", want, hints)
+		}
+	}
+	if strings.Contains(hints, "pool other") {
+		t.Errorf("a pool for another class is not a near miss, got:\n%s", hints)
+	}
+}
+
+func TestDiagnosePendingClaim(t *testing.T) {
+	cluster := newCluster(nil)
+	claim := &unstructured.Unstructured{}
+	claim.SetGroupVersionKind(allocator.ClaimGVK())
+	claim.SetName(allocator.ClaimName(cluster.Name, allocator.ControlPlaneRole))
+	claim.SetNamespace(cluster.Namespace)
+	claim.SetLabels(map[string]string{allocator.RoleLabel(): allocator.ControlPlaneRole})
+	claim.Object["spec"] = map[string]interface{}{
+		"poolRef": map[string]interface{}{"apiGroup": allocator.IPAMGroup, "kind": allocator.GlobalPoolKind, "name": "cp"},
+	}
+
+	report := diagnose(t, false, cluster, newClusterClass(), claim,
+		newPool("cp", map[string]string{allocator.ClusterClassLabel(): "prod", allocator.RoleLabel(): "control-plane"}, nil))
+
+	failure := onlyFailure(t, report)
+	if failure.Step != "address" || !strings.Contains(failure.Message, "has no status.addressRef") {
+		t.Fatalf("expected the pending claim to be reported, got %+v", failure)
+	}
+}
+
+func TestDiagnoseStopsAtClusterLevelFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		shadow  bool
+		objects []runtime.Object
+		step    string
+	}{
+		{name: "missing cluster", step: "cluster"},
+		{name: "missing class", objects: []runtime.Object{newCluster(nil)}, step: "clusterclass"},
+		{name: "shadow annotation", objects: []runtime.Object{newCluster(map[string]string{allocator.ShadowAnnotation(): "true"}), newClusterClass()}, step: "shadow"},
+		{name: "shadow mode", shadow: true, objects: []runtime.Object{newCluster(nil), newClusterClass()}, step: "shadow"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := diagnose(t, tt.shadow, tt.objects...)
+			if failure := onlyFailure(t, report); failure.Step != tt.step || failure.Role != "" {
+				t.Fatalf("expected step %q to fail, got %+v", tt.step, failure)
+			}
+		})
+	}
+}
+
+func TestDiagnoseAllocatedCluster(t *testing.T) {
+	cluster := newCluster(nil)
+	cluster.Spec.ControlPlaneEndpoint = clusterv1.APIEndpoint{Host: "10.0.0.10", Port: 6443}
+
+	report := diagnose(t, false, cluster, newClusterClass())
+	if failures := report.Failures(); len(failures) != 0 {
+		t.Fatalf("expected no failures, got %+v", failures)
+	}
+}
@@ -0,0 +1,180 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	vipv1alpha1 "github.com/gorizond/capi-vip-allocator/api/v1alpha1"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// checkPoolSelection repeats FindPool and explains its outcome. It returns the selected pool,
+// or "" after recording the failing step.
+func (d *diagnosis) checkPoolSelection(ctx context.Context, role string) (string, error) {
+	policy, err := d.vips.MatchPolicy(ctx, d.cluster, role)
+	if err != nil {
+		d.add(role, "policy", SeverityFail, err.Error(), "fix the selectors of the VIPAllocationPolicy")
+		return "", nil
+	}
+	if policy != nil {
+		return d.checkPolicyPools(ctx, role, policy)
+	}
+	d.add(role, "policy", SeverityInfo, "no VIPAllocationPolicy applies, pools are matched by labels")
+	return d.checkLabelledPools(ctx, role)
+}
+
+// checkPolicyPools explains why the pools referenced by the policy can or cannot be used.
+func (d *diagnosis) checkPolicyPools(ctx context.Context, role string, policy *vipv1alpha1.VIPAllocationPolicy) (string, error) {
+	d.add(role, "policy", SeverityOK, fmt.Sprintf("VIPAllocationPolicy %s (priority %d) selects the pools", policy.Name, policy.Spec.Priority))
+
+	var skipped []string
+	for _, ref := range policy.Spec.Pools {
+		kind := ref.Kind
+		if kind == "" {
+			kind = vipv1alpha1.DefaultPoolKind
+		}
+		pool := &unstructured.Unstructured{}
+		pool.SetGroupVersionKind(schema.GroupVersionKind{Group: allocator.IPAMGroup, Version: allocator.PoolGVK().Version, Kind: kind})
+		if err := d.vips.Client.Get(ctx, types.NamespacedName{Name: ref.Name}, pool); err != nil {
+			if !errors.IsNotFound(err) {
+				return "", fmt.Errorf("get %s %q: %w", kind, ref.Name, err)
+			}
+			skipped = append(skipped, fmt.Sprintf("pool %s does not exist", ref.Name))
+			continue
+		}
+		allowed, err := d.vips.PoolAllowsNamespace(ctx, pool, d.cluster.Namespace)
+		if err != nil {
+			return "", err
+		}
+		if !allowed {
+			skipped = append(skipped, fmt.Sprintf("pool %s does not allow namespace %s (%s / %s annotations)",
+				ref.Name, d.cluster.Namespace, allocator.AllowedNamespacesAnnotation(), allocator.NamespaceSelectorAnnotation()))
+			continue
+		}
+		d.add(role, "pool", SeverityOK, fmt.Sprintf("pool %s selected by VIPAllocationPolicy %s", ref.Name, policy.Name), skipped...)
+		return ref.Name, nil
+	}
+
+	hints := append(skipped, fmt.Sprintf("create one of the referenced pools or fix spec.pools of VIPAllocationPolicy %s", policy.Name))
+	d.add(role, "pool", SeverityFail, fmt.Sprintf("VIPAllocationPolicy %s references no existing pool usable from namespace %s", policy.Name, d.cluster.Namespace), hints...)
+	return "", nil
+}
+
+// checkLabelledPools explains label-based pool matching, including near-miss pools.
+func (d *diagnosis) checkLabelledPools(ctx context.Context, role string) (string, error) {
+	className := d.cluster.Spec.Topology.Class
+
+	pools := &unstructured.UnstructuredList{}
+	pools.SetGroupVersionKind(allocator.PoolGVK().GroupVersion().WithKind(allocator.GlobalPoolKind + "List"))
+	if err := d.vips.Client.List(ctx, pools); err != nil {
+		return "", fmt.Errorf("list %s: %w", allocator.GlobalPoolKind, err)
+	}
+
+	var hints []string
+	for i := range pools.Items {
+		pool := &pools.Items[i]
+		if allocator.PoolMatches(pool, className, role) {
+			allowed, err := d.vips.PoolAllowsNamespace(ctx, pool, d.cluster.Namespace)
+			if err != nil {
+				return "", err
+			}
+			if !allowed {
+				hints = append(hints, fmt.Sprintf("pool %s matches but does not allow namespace %s (%s / %s annotations)",
+					pool.GetName(), d.cluster.Namespace, allocator.AllowedNamespacesAnnotation(), allocator.NamespaceSelectorAnnotation()))
+				continue
+			}
+			d.add(role, "pool", SeverityOK, fmt.Sprintf("pool %s matches class %q and role %s", pool.GetName(), className, role), hints...)
+			return pool.GetName(), nil
+		}
+		hints = append(hints, nearMisses(pool, className, role)...)
+	}
+
+	if len(pools.Items) == 0 {
+		hints = append(hints, fmt.Sprintf("no %s exists; create one", allocator.GlobalPoolKind))
+	}
+	hints = append(hints, fmt.Sprintf("label a pool with %s=%s (or \"true\" plus the %s annotation) and %s=%s; both accept comma-separated lists",
+		allocator.ClusterClassLabel(), className, allocator.ClusterClassAnnotation(), allocator.RoleLabel(), role))
+	d.add(role, "pool", SeverityFail, fmt.Sprintf("no %s matches class %q and role %s", allocator.GlobalPoolKind, className, role), hints...)
+	return "", nil
+}
+
+// nearMisses explains why a pool that almost selects the class and role does not match.
+// A pool is a near miss when its labels or annotation differ from the wanted values only in
+// case or whitespace, or when it uses the "true" flag without the class annotation.
+func nearMisses(pool *unstructured.Unstructured, className, role string) []string {
+	labels := pool.GetLabels()
+	var misses []string
+
+	for key := range labels {
+		for _, want := range []string{allocator.ClusterClassLabel(), allocator.RoleLabel()} {
+			if key != want && strings.EqualFold(strings.TrimSpace(key), want) {
+				misses = append(misses, fmt.Sprintf("pool %s: label key %q should be %q", pool.GetName(), key, want))
+			}
+		}
+	}
+
+	classLabel, hasClass := labels[allocator.ClusterClassLabel()]
+	roleValue, hasRole := labels[allocator.RoleLabel()]
+	if !hasClass || !hasRole {
+		return misses
+	}
+
+	classSource := fmt.Sprintf("label %s", allocator.ClusterClassLabel())
+	classValue := classLabel
+	switch {
+	case classLabel == allocator.ClusterClassLabelTrueFlag:
+		annotation, ok := pool.GetAnnotations()[allocator.ClusterClassAnnotation()]
+		if !ok {
+			if allocator.LabelContainsValue(roleValue, role) {
+				misses = append(misses, fmt.Sprintf("pool %s: label %s is \"true\" but the %s annotation is missing",
+					pool.GetName(), allocator.ClusterClassLabel(), allocator.ClusterClassAnnotation()))
+			}
+			return misses
+		}
+		classSource = fmt.Sprintf("annotation %s", allocator.ClusterClassAnnotation())
+		classValue = annotation
+	case strings.EqualFold(strings.TrimSpace(classLabel), allocator.ClusterClassLabelTrueFlag):
+		misses = append(misses, fmt.Sprintf("pool %s: label %s=%q must be exactly \"true\" to read the %s annotation",
+			pool.GetName(), allocator.ClusterClassLabel(), classLabel, allocator.ClusterClassAnnotation()))
+		return misses
+	}
+
+	classMatches := allocator.LabelContainsValue(classValue, className)
+	classNear := !classMatches && looselyContains(classValue, className)
+	roleMatches := allocator.LabelContainsValue(roleValue, role)
+	roleNear := !roleMatches && looselyContains(roleValue, role)
+
+	if (classMatches || classNear) && (roleMatches || roleNear) {
+		if classNear {
+			misses = append(misses, fmt.Sprintf("pool %s: %s=%q differs from class %q only by case or whitespace",
+				pool.GetName(), classSource, classValue, className))
+		}
+		if roleNear {
+			misses = append(misses, fmt.Sprintf("pool %s: label %s=%q differs from role %q only by case or whitespace",
+				pool.GetName(), allocator.RoleLabel(), roleValue, role))
+		}
+	}
+	return misses
+}
+
+// looselyContains reports whether a comma-separated value contains target when case and all
+// whitespace are ignored.
+func looselyContains(value, target string) bool {
+	target = normalize(target)
+	for _, item := range strings.Split(value, ",") {
+		if normalize(item) == target {
+			return true
+		}
+	}
+	return false
+}
+
+func normalize(value string) string {
+	return strings.ToLower(strings.Join(strings.Fields(value), ""))
+}
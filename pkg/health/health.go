@@ -0,0 +1,53 @@
+// Package health contains readiness checks registered with the manager.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// cacheSyncTimeout bounds how long a readiness probe waits for the informer cache.
+const cacheSyncTimeout = time.Second
+
+// IPAMResources reports not-ready while the API server does not serve the IPAM kinds the
+// allocator needs, i.e. the IPAM provider is not installed or is a different version.
+func IPAMResources(mapper meta.RESTMapper) healthz.Checker {
+	return func(_ *http.Request) error {
+		var missing []string
+		for _, gvk := range []schema.GroupVersionKind{allocator.ClaimGVK(), allocator.AddressGVK(), allocator.PoolGVK()} {
+			if _, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+				if !meta.IsNoMatchError(err) {
+					return fmt.Errorf("look up %s: %w", gvk, err)
+				}
+				missing = append(missing, fmt.Sprintf("%s/%s %s", gvk.Group, gvk.Version, gvk.Kind))
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("IPAM provider is not installed: %s not served by the API server", strings.Join(missing, ", "))
+		}
+		return nil
+	}
+}
+
+// CacheSynced reports not-ready until the manager's informer cache has synced.
+func CacheSynced(c cache.Cache) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), cacheSyncTimeout)
+		defer cancel()
+		if !c.WaitForCacheSync(ctx) {
+			return errors.New("informer cache is not synced yet")
+		}
+		return nil
+	}
+}
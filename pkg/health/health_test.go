@@ -0,0 +1,59 @@
+package health
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+)
+
+func TestIPAMResources(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(allocator.ClaimGVK(), meta.RESTScopeNamespace)
+
+	err := IPAMResources(mapper)(httptest.NewRequest("GET", "/readyz", nil))
+	if err == nil {
+		t.Fatal("expected not-ready while IPAddress and pool kinds are missing")
+	}
+	for _, kind := range []string{allocator.IPAddressKind, allocator.GlobalPoolKind} {
+		if !strings.Contains(err.Error(), kind) {
+			t.Fatalf("expected %s in %q", kind, err.Error())
+		}
+	}
+	if strings.Contains(err.Error(), allocator.IPAddressClaimKind) {
+		t.Fatalf("did not expect served %s in %q", allocator.IPAddressClaimKind, err.Error())
+	}
+
+	mapper.Add(allocator.AddressGVK(), meta.RESTScopeNamespace)
+	mapper.Add(allocator.PoolGVK(), meta.RESTScopeRoot)
+	if err := IPAMResources(mapper)(httptest.NewRequest("GET", "/readyz", nil)); err != nil {
+		t.Fatalf("expected ready, got %v", err)
+	}
+
+	// A provider serving an older version only is not enough
+	older := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range []schema.GroupVersionKind{allocator.ClaimGVK(), allocator.AddressGVK()} {
+		older.Add(gvk, meta.RESTScopeNamespace)
+	}
+	older.Add(schema.GroupVersionKind{Group: allocator.IPAMGroup, Version: "v1alpha1", Kind: allocator.GlobalPoolKind}, meta.RESTScopeRoot)
+	if err := IPAMResources(older)(httptest.NewRequest("GET", "/readyz", nil)); err == nil {
+		t.Fatal("expected not-ready when the pool kind is only served in another version")
+	}
+}
+
+func TestCacheSynced(t *testing.T) {
+	synced := false
+	informers := &informertest.FakeInformers{Synced: &synced}
+
+	if err := CacheSynced(informers)(httptest.NewRequest("GET", "/readyz", nil)); err == nil {
+		t.Fatal("expected not-ready before the cache synced")
+	}
+	synced = true
+	if err := CacheSynced(informers)(httptest.NewRequest("GET", "/readyz", nil)); err != nil {
+		t.Fatalf("expected ready, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package inventory
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Formats lists the output formats supported by Write.
+var Formats = []string{"table", "json", "yaml", "csv"}
+
+// columns are the table headers and CSV headers of the fields returned by Entry.row, in order.
+// CSV headers match the JSON field names.
+var columns = []struct{ table, csv string }{
+	{"NAMESPACE", "namespace"},
+	{"CLUSTER", "cluster"},
+	{"CLUSTERCLASS", "clusterClass"},
+	{"ROLE", "role"},
+	{"POOL", "pool"},
+	{"ADDRESS", "address"},
+	{"PREFIX", "prefix"},
+	{"GATEWAY", "gateway"},
+	{"CLAIM", "claim"},
+	{"AGE", "age"},
+	{"ENDPOINT MATCHES", "endpointMatches"},
+}
+
+// Write prints the entries in the given format: table, json, yaml or csv.
+func Write(w io.Writer, entries []Entry, format string) error {
+	switch format {
+	case "table":
+		return writeTable(w, entries)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	case "yaml":
+		return writeYAML(w, entries)
+	case "csv":
+		return writeCSV(w, entries)
+	default:
+		return fmt.Errorf("unsupported output format %q, expected one of %v", format, Formats)
+	}
+}
+
+// row returns the table and CSV fields of an entry.
+func (e Entry) row() []string {
+	prefix := ""
+	if e.Prefix != 0 {
+		prefix = strconv.FormatInt(e.Prefix, 10)
+	}
+	matches := strconv.FormatBool(e.EndpointMatches)
+	if !e.ClusterFound {
+		matches = "cluster missing"
+	}
+	return []string{e.Namespace, e.Cluster, e.ClusterClass, e.Role, e.Pool, e.Address, prefix, e.Gateway, e.Claim, e.Age, matches}
+}
+
+func writeTable(w io.Writer, entries []Entry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.table
+	}
+	writeTabRow(tw, header)
+	for _, entry := range entries {
+		fields := entry.row()
+		for i, field := range fields {
+			if field == "" {
+				fields[i] = "-"
+			}
+		}
+		writeTabRow(tw, fields)
+	}
+	return tw.Flush()
+}
+
+func writeTabRow(w io.Writer, fields []string) {
+	for i, field := range fields {
+		if i > 0 {
+			fmt.Fprint(w, "\t")
+		}
+		fmt.Fprint(w, field)
+	}
+	fmt.Fprintln(w)
+}
+
+func writeCSV(w io.Writer, entries []Entry) error {
+	cw := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.csv
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := cw.Write(entry.row()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeYAML prints the entries as a YAML sequence. Entries only hold scalars, so strings are
+// written as JSON-quoted scalars, which YAML parses unchanged.
+func writeYAML(w io.Writer, entries []Entry) error {
+	if len(entries) == 0 {
+		_, err := fmt.Fprintln(w, "[]")
+		return err
+	}
+	for _, e := range entries {
+		fields := []struct {
+			key   string
+			value string
+		}{
+			{"namespace", strconv.Quote(e.Namespace)},
+			{"cluster", strconv.Quote(e.Cluster)},
+			{"clusterClass", strconv.Quote(e.ClusterClass)},
+			{"role", strconv.Quote(e.Role)},
+			{"claim", strconv.Quote(e.Claim)},
+			{"pool", strconv.Quote(e.Pool)},
+			{"address", strconv.Quote(e.Address)},
+			{"prefix", strconv.FormatInt(e.Prefix, 10)},
+			{"gateway", strconv.Quote(e.Gateway)},
+			{"created", strconv.Quote(e.Created.UTC().Format(time.RFC3339))},
+			{"age", strconv.Quote(e.Age)},
+			{"clusterFound", strconv.FormatBool(e.ClusterFound)},
+			{"endpointMatches", strconv.FormatBool(e.EndpointMatches)},
+		}
+		for i, field := range fields {
+			indent := "  "
+			if i == 0 {
+				indent = "- "
+			}
+			if _, err := fmt.Fprintf(w, "%s%s: %s\n", indent, field.key, field.value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
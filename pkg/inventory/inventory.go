@@ -0,0 +1,125 @@
+// Package inventory lists the VIPs held by Clusters: every role-labelled IPAddressClaim with its
+// IPAddress, pool and owning Cluster.
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Entry is one VIP of a cluster role.
+type Entry struct {
+	Namespace    string `json:"namespace"`
+	Cluster      string `json:"cluster"`
+	ClusterClass string `json:"clusterClass,omitempty"`
+	Role         string `json:"role"`
+	Claim        string `json:"claim"`
+	Pool         string `json:"pool,omitempty"`
+	// Address is empty while the IPAM provider has not allocated one
+	Address string `json:"address,omitempty"`
+	Prefix  int64  `json:"prefix,omitempty"`
+	Gateway string `json:"gateway,omitempty"`
+	// Created is the creation time of the claim
+	Created time.Time `json:"created"`
+	Age     string    `json:"age"`
+	// ClusterFound is false when the owning Cluster no longer exists
+	ClusterFound bool `json:"clusterFound"`
+	// EndpointMatches reports whether the Cluster carries the claim's address: the control plane
+	// endpoint host for the control-plane role, the ingress-vip annotation for the ingress role
+	EndpointMatches bool `json:"endpointMatches"`
+}
+
+// Collect reads all role-labelled IPAddressClaims, their IPAddresses and owning Clusters.
+// Entries are sorted by namespace, cluster and role; ages are relative to now.
+func Collect(ctx context.Context, c client.Reader, now time.Time) ([]Entry, error) {
+	claims := &unstructured.UnstructuredList{}
+	claims.SetGroupVersionKind(allocator.ClaimGVK().GroupVersion().WithKind(allocator.IPAddressClaimKind + "List"))
+	if err := c.List(ctx, claims, client.HasLabels{allocator.RoleLabel()}); err != nil {
+		return nil, fmt.Errorf("list IPAddressClaims: %w", err)
+	}
+
+	addresses := &unstructured.UnstructuredList{}
+	addresses.SetGroupVersionKind(allocator.AddressGVK().GroupVersion().WithKind(allocator.IPAddressKind + "List"))
+	if err := c.List(ctx, addresses); err != nil {
+		return nil, fmt.Errorf("list IPAddresses: %w", err)
+	}
+	addressByName := make(map[string]*unstructured.Unstructured, len(addresses.Items))
+	for i := range addresses.Items {
+		address := &addresses.Items[i]
+		addressByName[allocator.ClusterKey(address.GetNamespace(), address.GetName())] = address
+	}
+
+	clusters := &clusterv1.ClusterList{}
+	if err := c.List(ctx, clusters); err != nil {
+		return nil, fmt.Errorf("list Clusters: %w", err)
+	}
+	clusterByName := make(map[string]*clusterv1.Cluster, len(clusters.Items))
+	for i := range clusters.Items {
+		cluster := &clusters.Items[i]
+		clusterByName[allocator.ClusterKey(cluster.Namespace, cluster.Name)] = cluster
+	}
+
+	entries := make([]Entry, 0, len(claims.Items))
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		entry := Entry{
+			Namespace: claim.GetNamespace(),
+			Cluster:   allocator.ClaimClusterName(claim),
+			Role:      claim.GetLabels()[allocator.RoleLabel()],
+			Claim:     claim.GetName(),
+			Created:   claim.GetCreationTimestamp().Time,
+			Age:       duration.HumanDuration(now.Sub(claim.GetCreationTimestamp().Time)),
+		}
+		entry.Pool, _, _ = unstructured.NestedString(claim.Object, "spec", "poolRef", "name")
+
+		addressName, _, _ := unstructured.NestedString(claim.Object, "status", "addressRef", "name")
+		if address := addressByName[allocator.ClusterKey(entry.Namespace, addressName)]; addressName != "" && address != nil {
+			entry.Address, _, _ = unstructured.NestedString(address.Object, "spec", "address")
+			entry.Prefix, _, _ = unstructured.NestedInt64(address.Object, "spec", "prefix")
+			entry.Gateway, _, _ = unstructured.NestedString(address.Object, "spec", "gateway")
+		}
+		if entry.Address == "" {
+			// The claim may have been resolved before its IPAddress was removed
+			entry.Address = claim.GetAnnotations()[allocator.AddressAnnotation()]
+		}
+
+		if cluster, ok := clusterByName[allocator.ClusterKey(entry.Namespace, entry.Cluster)]; ok {
+			entry.ClusterFound = true
+			if cluster.Spec.Topology != nil {
+				entry.ClusterClass = cluster.Spec.Topology.Class
+			}
+			entry.EndpointMatches = entry.Address != "" && entry.Address == endpoint(cluster, entry.Role)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		return a.Role < b.Role
+	})
+	return entries, nil
+}
+
+// endpoint returns the address the Cluster publishes for the role.
+func endpoint(cluster *clusterv1.Cluster, role string) string {
+	if role == allocator.IngressRole {
+		return cluster.Annotations[allocator.IngressVIPAnnotation()]
+	}
+	return cluster.Spec.ControlPlaneEndpoint.Host
+}
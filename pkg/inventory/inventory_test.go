@@ -0,0 +1,117 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var created = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newClaim(namespace, cluster, role, pool, addressName string) *unstructured.Unstructured {
+	claim := &unstructured.Unstructured{}
+	claim.SetGroupVersionKind(allocator.ClaimGVK())
+	claim.SetName(allocator.ClaimName(cluster, role))
+	claim.SetNamespace(namespace)
+	claim.SetLabels(map[string]string{allocator.RoleLabel(): role, allocator.ClusterNameLabel: cluster})
+	claim.SetCreationTimestamp(metav1.NewTime(created))
+	claim.Object["spec"] = map[string]interface{}{
+		"poolRef": map[string]interface{}{"apiGroup": allocator.IPAMGroup, "kind": allocator.GlobalPoolKind, "name": pool},
+	}
+	if addressName != "" {
+		claim.Object["status"] = map[string]interface{}{"addressRef": map[string]interface{}{"name": addressName}}
+	}
+	return claim
+}
+
+func newAddress(namespace, name, address string) *unstructured.Unstructured {
+	ip := &unstructured.Unstructured{}
+	ip.SetGroupVersionKind(allocator.AddressGVK())
+	ip.SetName(name)
+	ip.SetNamespace(namespace)
+	ip.Object["spec"] = map[string]interface{}{"address": address, "prefix": int64(24), "gateway": "10.0.0.1"}
+	return ip
+}
+
+func TestCollect(t *testing.T) {
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "alpha", Namespace: "team-a", Annotations: map[string]string{allocator.IngressVIPAnnotation(): "10.0.1.9"}},
+		Spec: clusterv1.ClusterSpec{
+			ControlPlaneEndpoint: clusterv1.APIEndpoint{Host: "10.0.0.10", Port: 6443},
+			Topology:             &clusterv1.Topology{Class: "prod", Version: "v1.30.0"},
+		},
+	}
+	objects := []runtime.Object{
+		cluster,
+		newClaim("team-a", "alpha", allocator.ControlPlaneRole, "cp-pool", "vip-cp-alpha"),
+		newAddress("team-a", "vip-cp-alpha", "10.0.0.10"),
+		newClaim("team-a", "alpha", allocator.IngressRole, "ingress-pool", "vip-ingress-alpha"),
+		newAddress("team-a", "vip-ingress-alpha", "10.0.1.5"),
+		newClaim("team-b", "gone", allocator.ControlPlaneRole, "cp-pool", ""),
+	}
+	c := fake.NewClientBuilder().WithScheme(fixtures.NewScheme(t)).WithRuntimeObjects(objects...).Build()
+
+	entries, err := Collect(context.Background(), c, created.Add(49*time.Hour))
+	if err != nil {
+		t.Fatalf("Collect returned error: %v", err)
+	}
+
+	want := []Entry{
+		{Namespace: "team-a", Cluster: "alpha", ClusterClass: "prod", Role: allocator.ControlPlaneRole, Claim: "vip-cp-alpha", Pool: "cp-pool",
+			Address: "10.0.0.10", Prefix: 24, Gateway: "10.0.0.1", Created: created, Age: "2d1h", ClusterFound: true, EndpointMatches: true},
+		{Namespace: "team-a", Cluster: "alpha", ClusterClass: "prod", Role: allocator.IngressRole, Claim: "vip-ingress-alpha", Pool: "ingress-pool",
+			Address: "10.0.1.5", Prefix: 24, Gateway: "10.0.0.1", Created: created, Age: "2d1h", ClusterFound: true, EndpointMatches: false},
+		{Namespace: "team-b", Cluster: "gone", Role: allocator.ControlPlaneRole, Claim: "vip-cp-gone", Pool: "cp-pool", Created: created, Age: "2d1h"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), entries)
+	}
+	for i := range want {
+		if !entries[i].Created.Equal(want[i].Created) {
+			t.Errorf("entry %d: expected created %v, got %v", i, want[i].Created, entries[i].Created)
+		}
+		entries[i].Created = want[i].Created
+		if entries[i] != want[i] {
+			t.Errorf("entry %d: expected %+v, got %+v", i, want[i], entries[i])
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	entries := []Entry{{Namespace: "team-a", Cluster: "alpha", ClusterClass: "prod", Role: allocator.ControlPlaneRole, Claim: "vip-cp-alpha",
+		Pool: "cp-pool", Address: "10.0.0.10", Prefix: 24, Created: created, Age: "5d", ClusterFound: true, EndpointMatches: true}}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: "csv", want: "namespace,cluster,clusterClass,role,pool,address,prefix,gateway,claim,age,endpointMatches\nteam-a,alpha,prod,control-plane,cp-pool,10.0.0.10,24,,vip-cp-alpha,5d,true\n"},
+		{format: "yaml", want: "- namespace: \"team-a\"\n  cluster: \"alpha\"\n"},
+		{format: "json", want: `"endpointMatches": true`},
+		{format: "table", want: "team-a     alpha    prod          control-plane  cp-pool  10.0.0.10  24      -        vip-cp-alpha  5d   true"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := Write(&out, entries, tt.format); err != nil {
+			t.Fatalf("%s: Write returned error: %v", tt.format, err)
+		}
+		if !strings.Contains(out.String(), tt.want) {
+			t.Errorf("%s: expected output to contain %q, got:\n%s", tt.format, tt.want, out.String())
+		}
+	}
+
+	if err := Write(&bytes.Buffer{}, entries, "xml"); err == nil {
+		t.Fatalf("expected an error for an unsupported format")
+	}
+}
@@ -97,6 +97,77 @@ var (
 		[]string{"role", "namespace"},
 	)
 
+	// VipNamespaceQuotaLimit describes the VIP quota configured on a namespace; it is reported
+	// at scrape time by the allocator's QuotaCollector
+	VipNamespaceQuotaLimit = prometheus.NewDesc(
+		"capi_vip_allocator_namespace_quota_limit",
+		"Maximum number of VIP claims allowed in the namespace",
+		[]string{"namespace"}, nil,
+	)
+
+	// VipNamespaceQuotaUsed describes the VIP claims counted against a namespace quota; it is
+	// reported at scrape time by the allocator's QuotaCollector
+	VipNamespaceQuotaUsed = prometheus.NewDesc(
+		"capi_vip_allocator_namespace_quota_used",
+		"Number of VIP claims counted against the namespace quota",
+		[]string{"namespace"}, nil,
+	)
+
+	// VipHookCacheRequestsTotal tracks how runtime extension allocations were answered
+	VipHookCacheRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "capi_vip_allocator_hook_cache_requests_total",
+			Help: "Runtime extension VIP lookups by result: hit (cached address), miss (allocation ran) or inflight (joined a running allocation)",
+		},
+		[]string{"result"},
+	)
+
+	// VipHookRequestsTotal tracks runtime extension hook requests
+	VipHookRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "capi_vip_allocator_hook_requests_total",
+			Help: "Total number of runtime extension hook requests by hook, response status and HTTP code",
+		},
+		[]string{"hook", "status", "code"},
+	)
+
+	// VipHookDurationSeconds tracks runtime extension hook latency
+	VipHookDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "capi_vip_allocator_hook_duration_seconds",
+			Help:    "Duration of runtime extension hook requests in seconds",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"hook"},
+	)
+
+	// VipHookInFlight tracks runtime extension hook requests being served
+	VipHookInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "capi_vip_allocator_hook_in_flight",
+			Help: "Number of runtime extension hook requests currently being served",
+		},
+		[]string{"hook"},
+	)
+
+	// VipHookPatchesPerResponse tracks patches emitted per GeneratePatches response
+	VipHookPatchesPerResponse = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "capi_vip_allocator_hook_patches_per_response",
+			Help:    "Number of patches emitted per GeneratePatches response",
+			Buckets: []float64{0, 1, 2, 4, 8, 16, 32, 64},
+		},
+	)
+
+	// VipShadowAllocation reports the allocation shadow mode would make for a cluster role
+	VipShadowAllocation = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "capi_vip_allocator_shadow_allocation",
+			Help: "Pool and address shadow mode would allocate per cluster and role; 1 if it differs from the current allocation, 0 otherwise",
+		},
+		[]string{"namespace", "cluster", "role", "pool", "address", "current_pool", "current_address"},
+	)
+
 	// VipReconcileTotal tracks controller reconcile operations
 	VipReconcileTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -130,6 +201,12 @@ func init() {
 		VipClaimsTotal,
 		VipClaimsReady,
 		VipClaimsPending,
+		VipHookCacheRequestsTotal,
+		VipHookRequestsTotal,
+		VipHookDurationSeconds,
+		VipHookInFlight,
+		VipHookPatchesPerResponse,
+		VipShadowAllocation,
 		VipReconcileTotal,
 		VipReconcileDurationSeconds,
 	)
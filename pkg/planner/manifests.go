@@ -0,0 +1,121 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// manifestExtensions are the file extensions read when walking a directory.
+var manifestExtensions = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+// LoadManifests reads every object from the YAML or JSON files at paths. Directories are walked
+// recursively for *.yaml, *.yml and *.json files; "-" reads standard input. Multi-document files
+// and v1 Lists are supported.
+func LoadManifests(paths []string) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	for _, path := range paths {
+		if path == "-" {
+			decoded, err := decodeManifests(os.Stdin)
+			if err != nil {
+				return nil, fmt.Errorf("read stdin: %w", err)
+			}
+			objects = append(objects, decoded...)
+			continue
+		}
+
+		files, err := manifestFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			decoded, err := readManifestFile(file)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, decoded...)
+		}
+	}
+	return objects, nil
+}
+
+// manifestFiles returns path itself, or the manifest files below it in lexical order.
+func manifestFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && manifestExtensions[strings.ToLower(filepath.Ext(file))] {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk %s: %w", path, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func readManifestFile(file string) ([]*unstructured.Unstructured, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	objects, err := decodeManifests(f)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", file, err)
+	}
+	return objects, nil
+}
+
+// decodeManifests decodes all documents of a YAML or JSON stream, expanding Lists.
+func decodeManifests(r io.Reader) ([]*unstructured.Unstructured, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+
+	var objects []*unstructured.Unstructured
+	for {
+		document := map[string]interface{}{}
+		if err := decoder.Decode(&document); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objects, nil
+			}
+			return nil, err
+		}
+		if len(document) == 0 {
+			continue
+		}
+
+		object := &unstructured.Unstructured{Object: document}
+		if !object.IsList() {
+			objects = append(objects, object)
+			continue
+		}
+		list, err := object.ToList()
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			objects = append(objects, &list.Items[i])
+		}
+	}
+}
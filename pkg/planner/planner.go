@@ -0,0 +1,331 @@
+// Package planner predicts VIP allocations from manifests, without a management cluster.
+// It runs the allocator's pool selection against an in-memory client loaded with the manifests,
+// so GitOps changes to Clusters, ClusterClasses, pools and VIPAllocationPolicies can be checked
+// in CI.
+package planner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/go-logr/logr"
+	vipv1alpha1 "github.com/gorizond/capi-vip-allocator/api/v1alpha1"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// Status describes what would happen to a cluster role's VIP.
+type Status string
+
+const (
+	// StatusAllocated means the role already holds a claim from the selected pool.
+	StatusAllocated Status = "allocated"
+	// StatusDrift means the role holds a claim from another pool; the allocator keeps it.
+	StatusDrift Status = "drift"
+	// StatusManual means the address is set on the Cluster and no claim would be created.
+	StatusManual Status = "manual"
+	// StatusNew means a claim would be created and get the predicted address.
+	StatusNew Status = "new"
+	// StatusExhausted means a pool matches but has no free address left.
+	StatusExhausted Status = "exhausted"
+	// StatusNoPool means no pool matches the cluster class and role.
+	StatusNoPool Status = "no-pool"
+)
+
+// Allocation is the planned VIP of one cluster role.
+type Allocation struct {
+	// Cluster is "namespace/name"
+	Cluster        string `json:"cluster"`
+	Class          string `json:"class"`
+	Role           string `json:"role"`
+	Pool           string `json:"pool,omitempty"`
+	Address        string `json:"address,omitempty"`
+	CurrentPool    string `json:"currentPool,omitempty"`
+	CurrentAddress string `json:"currentAddress,omitempty"`
+	Status         Status `json:"status"`
+}
+
+// PoolCapacity is the projected capacity of a pool once the plan is applied.
+type PoolCapacity struct {
+	Name  string `json:"name"`
+	Total int    `json:"total"`
+	Used  int    `json:"used"`
+	// Planned is the number of new claims the plan assigns to the pool
+	Planned int `json:"planned"`
+	// Shortfall is the number of cluster roles the pool could not serve
+	Shortfall int `json:"shortfall"`
+}
+
+// FreeAfter returns the addresses left after the plan is applied.
+func (p PoolCapacity) FreeAfter() int {
+	return p.Total - p.Used - p.Planned
+}
+
+// Exhausted reports whether the plan uses up the pool.
+func (p PoolCapacity) Exhausted() bool {
+	return p.Shortfall > 0 || p.FreeAfter() <= 0
+}
+
+// Result is the outcome of Plan.
+type Result struct {
+	Allocations []Allocation   `json:"allocations"`
+	Pools       []PoolCapacity `json:"pools"`
+	// Ignored counts manifests of kinds the planner does not use
+	Ignored int `json:"ignored"`
+}
+
+// Problems lists the cluster roles that would not get a VIP.
+func (r *Result) Problems() []string {
+	var problems []string
+	for _, a := range r.Allocations {
+		switch a.Status {
+		case StatusNoPool:
+			problems = append(problems, fmt.Sprintf("%s %s: no pool matches class %q", a.Cluster, a.Role, a.Class))
+		case StatusExhausted:
+			problems = append(problems, fmt.Sprintf("%s %s: pool %s has no free address", a.Cluster, a.Role, a.Pool))
+		}
+	}
+	return problems
+}
+
+// Plan selects a pool and predicts an address for every topology Cluster role in objects.
+// Existing IPAddressClaims and IPAddresses in objects are honoured; new claims are assigned in
+// namespace/name order, each taking the next free address of its pool.
+func Plan(ctx context.Context, objects []*unstructured.Unstructured, logger logr.Logger) (*Result, error) {
+	c, clusters, ignored, err := newClient(objects)
+	if err != nil {
+		return nil, err
+	}
+	vips := allocator.New(c, logger, nil)
+	result := &Result{Ignored: ignored}
+
+	pools := map[string]*PoolCapacity{}
+	poolList := &unstructured.UnstructuredList{}
+	poolList.SetGroupVersionKind(allocator.PoolGVK().GroupVersion().WithKind(allocator.GlobalPoolKind + "List"))
+	if err := c.List(ctx, poolList); err != nil {
+		return nil, fmt.Errorf("list %s: %w", allocator.GlobalPoolKind, err)
+	}
+	for _, pool := range poolList.Items {
+		usage, err := vips.PoolUsage(ctx, pool.GetName())
+		if err != nil {
+			return nil, err
+		}
+		pools[pool.GetName()] = &PoolCapacity{Name: pool.GetName(), Total: usage.Total, Used: usage.Used}
+	}
+
+	for _, cluster := range clusters {
+		roles := []string{allocator.ControlPlaneRole}
+		ingressEnabled, err := vips.IngressEnabled(ctx, cluster)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s/%s: %w", cluster.Namespace, cluster.Name, err)
+		}
+		if ingressEnabled {
+			roles = append(roles, allocator.IngressRole)
+		}
+
+		for _, role := range roles {
+			shadow, err := vips.Shadow(ctx, cluster, role)
+			if err != nil {
+				return nil, fmt.Errorf("cluster %s/%s %s: %w", cluster.Namespace, cluster.Name, role, err)
+			}
+			allocation := Allocation{
+				Cluster:        allocator.ClusterKey(cluster.Namespace, cluster.Name),
+				Class:          cluster.Spec.Topology.Class,
+				Role:           role,
+				Pool:           shadow.Pool,
+				Address:        shadow.Address,
+				CurrentPool:    shadow.CurrentPool,
+				CurrentAddress: shadow.CurrentAddress,
+				Status:         status(shadow),
+			}
+
+			switch allocation.Status {
+			case StatusNew:
+				// Reserve the address so the next cluster gets the following one
+				if err := c.Create(ctx, plannedAddress(cluster, role, shadow)); err != nil {
+					return nil, fmt.Errorf("reserve planned address: %w", err)
+				}
+				if pool := pools[shadow.Pool]; pool != nil {
+					pool.Planned++
+				}
+			case StatusExhausted:
+				if pool := pools[shadow.Pool]; pool != nil {
+					pool.Shortfall++
+				}
+			}
+			result.Allocations = append(result.Allocations, allocation)
+		}
+	}
+
+	for _, pool := range pools {
+		result.Pools = append(result.Pools, *pool)
+	}
+	sort.Slice(result.Pools, func(i, j int) bool { return result.Pools[i].Name < result.Pools[j].Name })
+	return result, nil
+}
+
+// status classifies a shadow allocation the way the reconciler would act on it.
+func status(shadow allocator.ShadowResult) Status {
+	switch {
+	case shadow.CurrentPool != "" && shadow.CurrentPool == shadow.Pool:
+		return StatusAllocated
+	case shadow.CurrentPool != "":
+		return StatusDrift
+	case shadow.CurrentAddress != "":
+		return StatusManual
+	case shadow.Pool == "":
+		return StatusNoPool
+	case shadow.Address == "":
+		return StatusExhausted
+	default:
+		return StatusNew
+	}
+}
+
+// plannedAddress is the IPAddress standing in for a planned claim's allocation.
+func plannedAddress(cluster *clusterv1.Cluster, role string, shadow allocator.ShadowResult) *unstructured.Unstructured {
+	address := &unstructured.Unstructured{}
+	address.SetGroupVersionKind(allocator.AddressGVK())
+	address.SetGenerateName(allocator.ClaimName(cluster.Name, role) + "-planned-")
+	address.SetNamespace(cluster.Namespace)
+	address.Object["spec"] = map[string]interface{}{
+		"address": shadow.Address,
+		"poolRef": map[string]interface{}{
+			"apiGroup": allocator.IPAMGroup,
+			"kind":     allocator.GlobalPoolKind,
+			"name":     shadow.Pool,
+		},
+	}
+	return address
+}
+
+// newClient loads the objects the allocator reads into an in-memory client and returns the
+// topology Clusters in namespace/name order, plus the number of ignored objects.
+func newClient(objects []*unstructured.Unstructured) (client.Client, []*clusterv1.Cluster, int, error) {
+	scheme := newScheme()
+
+	var (
+		clusters        []*clusterv1.Cluster
+		runtimeObjects  []runtime.Object
+		namespaces      = map[string]bool{}
+		knownNamespaces = map[string]bool{}
+		ignored         int
+	)
+	for _, object := range objects {
+		gvk := object.GroupVersionKind()
+		if !scheme.Recognizes(gvk) {
+			ignored++
+			continue
+		}
+
+		typed, err := scheme.New(gvk)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if _, isUnstructured := typed.(*unstructured.Unstructured); isUnstructured {
+			runtimeObjects = append(runtimeObjects, object.DeepCopy())
+			continue
+		}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, typed); err != nil {
+			return nil, nil, 0, fmt.Errorf("decode %s %s: %w", gvk.Kind, object.GetName(), err)
+		}
+		runtimeObjects = append(runtimeObjects, typed)
+
+		switch obj := typed.(type) {
+		case *corev1.Namespace:
+			knownNamespaces[obj.Name] = true
+		case *clusterv1.Cluster:
+			if obj.Namespace == "" {
+				obj.Namespace = metav1.NamespaceDefault
+			}
+			namespaces[obj.Namespace] = true
+			if obj.Spec.Topology != nil && obj.Spec.Topology.Class != "" {
+				clusters = append(clusters, obj)
+			}
+		}
+	}
+
+	// Namespaces missing from the manifests exist without labels
+	for namespace := range namespaces {
+		if !knownNamespaces[namespace] {
+			runtimeObjects = append(runtimeObjects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})
+		}
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		return allocator.ClusterKey(clusters[i].Namespace, clusters[i].Name) < allocator.ClusterKey(clusters[j].Namespace, clusters[j].Name)
+	})
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(runtimeObjects...).Build()
+	return c, clusters, ignored, nil
+}
+
+// newScheme knows the typed objects the allocator reads; IPAM objects stay unstructured.
+func newScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypes(corev1.SchemeGroupVersion, &corev1.Namespace{}, &corev1.NamespaceList{})
+	scheme.AddKnownTypes(clusterv1.GroupVersion, &clusterv1.Cluster{}, &clusterv1.ClusterList{}, &clusterv1.ClusterClass{}, &clusterv1.ClusterClassList{})
+	utilruntime.Must(vipv1alpha1.AddToScheme(scheme))
+	metav1.AddToGroupVersion(scheme, corev1.SchemeGroupVersion)
+	metav1.AddToGroupVersion(scheme, clusterv1.GroupVersion)
+
+	for _, gvk := range []schema.GroupVersionKind{allocator.PoolGVK(), allocator.ClaimGVK(), allocator.AddressGVK()} {
+		scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind(gvk.Kind+"List"), &unstructured.UnstructuredList{})
+	}
+	return scheme
+}
+
+// WriteText prints the allocations and the pool capacities as tables.
+func (r *Result) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLUSTER\tCLASS\tROLE\tPOOL\tADDRESS\tSTATUS\tCURRENT")
+	for _, a := range r.Allocations {
+		current := "-"
+		if a.CurrentPool != "" || a.CurrentAddress != "" {
+			current = fmt.Sprintf("%s (%s)", dash(a.CurrentAddress), dash(a.CurrentPool))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", a.Cluster, a.Class, a.Role, dash(a.Pool), dash(a.Address), a.Status, current)
+	}
+
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "POOL\tTOTAL\tUSED\tPLANNED\tFREE AFTER\tEXHAUSTED")
+	for _, p := range r.Pools {
+		exhausted := "no"
+		if p.Exhausted() {
+			exhausted = "yes"
+			if p.Shortfall > 0 {
+				exhausted = fmt.Sprintf("yes (short by %d)", p.Shortfall)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\n", p.Name, p.Total, p.Used, p.Planned, p.FreeAfter(), exhausted)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON prints the result as indented JSON.
+func (r *Result) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+func dash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,160 @@
+package planner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+)
+
+const planManifests = `
+apiVersion: ipam.cluster.x-k8s.io/v1alpha2
+kind: GlobalInClusterIPPool
+metadata:
+  name: prod-cp
+  labels:
+    vip.capi.gorizond.io/cluster-class: prod
+    vip.capi.gorizond.io/role: control-plane
+spec:
+  addresses: ["10.0.0.10-10.0.0.11"]
+  prefix: 24
+---
+apiVersion: ipam.cluster.x-k8s.io/v1beta1
+kind: IPAddress
+metadata:
+  name: vip-cp-existing
+  namespace: team-a
+spec:
+  address: 10.0.0.10
+  prefix: 24
+  poolRef:
+    apiGroup: ipam.cluster.x-k8s.io
+    kind: GlobalInClusterIPPool
+    name: prod-cp
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+`
+
+const planClusters = `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: cluster.x-k8s.io/v1beta1
+  kind: Cluster
+  metadata:
+    name: alpha
+    namespace: team-a
+    annotations:
+      vip.capi.gorizond.io/ingress-enabled: "false"
+  spec:
+    topology:
+      class: prod
+      version: v1.30.0
+- apiVersion: cluster.x-k8s.io/v1beta1
+  kind: Cluster
+  metadata:
+    name: beta
+    namespace: team-a
+    annotations:
+      vip.capi.gorizond.io/ingress-enabled: "false"
+  spec:
+    topology:
+      class: prod
+      version: v1.30.0
+- apiVersion: cluster.x-k8s.io/v1beta1
+  kind: Cluster
+  metadata:
+    name: gamma
+    namespace: team-b
+  spec:
+    topology:
+      class: dev
+      version: v1.30.0
+`
+
+func writeManifests(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pools.yaml"), []byte(planManifests), 0o600); err != nil {
+		t.Fatalf("write pools: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "clusters"), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "clusters", "clusters.yml"), []byte(planClusters), 0o600); err != nil {
+		t.Fatalf("write clusters: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a manifest"), 0o600); err != nil {
+		t.Fatalf("write readme: %v", err)
+	}
+	return dir
+}
+
+func TestLoadManifestsWalksDirectories(t *testing.T) {
+	objects, err := LoadManifests([]string{writeManifests(t)})
+	if err != nil {
+		t.Fatalf("LoadManifests returned error: %v", err)
+	}
+	if len(objects) != 6 {
+		t.Fatalf("expected 6 objects (3 clusters from the List, pool, address, configmap), got %d", len(objects))
+	}
+	if objects[0].GetKind() != "Cluster" || objects[0].GetName() != "alpha" {
+		t.Fatalf("expected files in lexical order, got %s %s first", objects[0].GetKind(), objects[0].GetName())
+	}
+}
+
+func TestPlanAssignsAddressesAndReportsExhaustion(t *testing.T) {
+	objects, err := LoadManifests([]string{writeManifests(t)})
+	if err != nil {
+		t.Fatalf("LoadManifests returned error: %v", err)
+	}
+
+	result, err := Plan(context.Background(), objects, testr.New(t))
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	want := []Allocation{
+		{Cluster: "team-a/alpha", Class: "prod", Role: "control-plane", Pool: "prod-cp", Address: "10.0.0.11", Status: StatusNew},
+		{Cluster: "team-a/beta", Class: "prod", Role: "control-plane", Pool: "prod-cp", Status: StatusExhausted},
+		{Cluster: "team-b/gamma", Class: "dev", Role: "control-plane", Status: StatusNoPool},
+		{Cluster: "team-b/gamma", Class: "dev", Role: "ingress", Status: StatusNoPool},
+	}
+	if len(result.Allocations) != len(want) {
+		t.Fatalf("expected %d allocations, got %+v", len(want), result.Allocations)
+	}
+	for i := range want {
+		if result.Allocations[i] != want[i] {
+			t.Errorf("allocation %d: expected %+v, got %+v", i, want[i], result.Allocations[i])
+		}
+	}
+
+	if len(result.Pools) != 1 {
+		t.Fatalf("expected one pool, got %+v", result.Pools)
+	}
+	pool := result.Pools[0]
+	if pool.Total != 2 || pool.Used != 1 || pool.Planned != 1 || pool.Shortfall != 1 || pool.FreeAfter() != 0 || !pool.Exhausted() {
+		t.Fatalf("unexpected pool capacity %+v", pool)
+	}
+	if result.Ignored != 1 {
+		t.Fatalf("expected the ConfigMap to be ignored, got %d", result.Ignored)
+	}
+	if problems := result.Problems(); len(problems) != 3 {
+		t.Fatalf("expected 3 problems, got %v", problems)
+	}
+
+	var out bytes.Buffer
+	if err := result.WriteText(&out); err != nil {
+		t.Fatalf("WriteText returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "yes (short by 1)") {
+		t.Fatalf("expected the pool to be reported exhausted, got:\n%s", out.String())
+	}
+}
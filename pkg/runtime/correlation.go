@@ -0,0 +1,155 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	runtimehooksv1 "sigs.k8s.io/cluster-api/exp/runtime/hooks/api/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// Holder field paths CAPI sets on the templates referenced directly by the Cluster
+	infrastructureRefPath = "spec.infrastructureRef"
+	controlPlaneRefPath   = "spec.controlPlaneRef"
+
+	builtinVariable = "builtin"
+)
+
+// itemRole is what a GeneratePatches item is to the Cluster holding it.
+type itemRole int
+
+const (
+	// roleOther is an item we never patch, e.g. a MachineDeployment template
+	roleOther itemRole = iota
+	roleInfrastructureCluster
+	roleControlPlane
+)
+
+// correlatedItem is a non-Cluster GeneratePatches item together with the Cluster it belongs to.
+type correlatedItem struct {
+	item     runtimehooksv1.GeneratePatchesRequestItem
+	typeMeta metav1.TypeMeta
+	object   *unstructured.Unstructured
+	role     itemRole
+	// cluster is the "namespace/name" key of the owning Cluster
+	cluster string
+}
+
+// builtinCluster is the part of the "builtin" variable identifying the Cluster being reconciled.
+type builtinCluster struct {
+	Cluster struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		Topology  struct {
+			Class string `json:"class"`
+		} `json:"topology"`
+	} `json:"cluster"`
+}
+
+// correlateItems resolves the role and owning Cluster of every non-Cluster item. The role comes
+// from the HolderReference field path and the Cluster from the HolderReference, falling back to
+// the builtin variables. Items that cannot be correlated are returned as warnings instead.
+func correlateItems(request *runtimehooksv1.GeneratePatchesRequest) ([]correlatedItem, []string) {
+	requestBuiltin := builtinFromVariables(request.Variables)
+
+	var items []correlatedItem
+	var warnings []string
+	for i, item := range request.Items {
+		var typeMeta metav1.TypeMeta
+		if err := json.Unmarshal(item.Object.Raw, &typeMeta); err != nil {
+			warnings = append(warnings, fmt.Sprintf("item %d (uid %s): cannot decode object: %v", i, item.UID, err))
+			continue
+		}
+		if typeMeta.Kind == "Cluster" {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{}
+		if err := json.Unmarshal(item.Object.Raw, obj); err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s (uid %s): cannot decode object: %v", typeMeta.Kind, item.UID, err))
+			continue
+		}
+
+		holder := item.HolderReference
+		role := roleOther
+		switch {
+		case holder.Kind == "":
+			warnings = append(warnings, fmt.Sprintf("%s %s (uid %s): no holder reference", typeMeta.Kind, obj.GetName(), item.UID))
+			continue
+		case holder.Kind == "Cluster" && holder.FieldPath == infrastructureRefPath:
+			role = roleInfrastructureCluster
+		case holder.Kind == "Cluster" && holder.FieldPath == controlPlaneRefPath:
+			role = roleControlPlane
+		case holder.Kind == "Cluster":
+			// The Cluster only holds its infrastructure and control plane; anything else is ambiguous
+			warnings = append(warnings, fmt.Sprintf("%s %s (uid %s): unknown holder field path %q", typeMeta.Kind, obj.GetName(), item.UID, holder.FieldPath))
+			continue
+		}
+		if role == roleOther {
+			continue
+		}
+
+		cluster := itemCluster(item, obj, requestBuiltin)
+		if cluster == "" {
+			warnings = append(warnings, fmt.Sprintf("%s %s (uid %s): cannot determine the owning Cluster", typeMeta.Kind, obj.GetName(), item.UID))
+			continue
+		}
+
+		items = append(items, correlatedItem{item: item, typeMeta: typeMeta, object: obj, role: role, cluster: cluster})
+	}
+	return items, warnings
+}
+
+// itemCluster returns the "namespace/name" key of the Cluster owning the item, or "" if unknown.
+func itemCluster(item runtimehooksv1.GeneratePatchesRequestItem, obj *unstructured.Unstructured, requestBuiltin builtinCluster) string {
+	builtin := builtinFromVariables(item.Variables)
+	name := firstNonEmpty(builtin.Cluster.Name, requestBuiltin.Cluster.Name)
+	namespace := firstNonEmpty(builtin.Cluster.Namespace, requestBuiltin.Cluster.Namespace)
+
+	holder := item.HolderReference
+	if holder.Kind == "Cluster" && holder.Name != "" {
+		name = holder.Name
+		namespace = firstNonEmpty(holder.Namespace, namespace)
+	}
+	namespace = firstNonEmpty(namespace, obj.GetNamespace())
+
+	if name == "" || namespace == "" {
+		return ""
+	}
+	return allocator.ClusterKey(namespace, name)
+}
+
+// builtinFromVariables decodes the cluster identity from the "builtin" variable, if present.
+func builtinFromVariables(variables []runtimehooksv1.Variable) builtinCluster {
+	var builtin builtinCluster
+	for _, v := range variables {
+		if v.Name != builtinVariable {
+			continue
+		}
+		// Other builtin fields are irrelevant here; a malformed value just leaves the identity empty
+		_ = json.Unmarshal(v.Value.Raw, &builtin)
+	}
+	return builtin
+}
+
+// uncorrelatedMessage summarises the items skipped because their Cluster is unknown.
+func uncorrelatedMessage(warnings []string) string {
+	if len(warnings) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("ignored %d item(s) that could not be correlated to a Cluster: %s", len(warnings), strings.Join(warnings, "; "))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	runtimehooksv1 "sigs.k8s.io/cluster-api/exp/runtime/hooks/api/v1alpha1"
+)
+
+func TestGeneratePatchesCorrelatesInfrastructureByNamespace(t *testing.T) {
+	first := newCluster()
+	first.Namespace = "team-a"
+	first.Spec.ControlPlaneEndpoint.Host = "10.5.0.1"
+	first.Spec.ControlPlaneEndpoint.Port = 6443
+	second := newCluster()
+	second.Namespace = "team-b"
+	second.Spec.ControlPlaneEndpoint.Host = "10.5.0.2"
+	second.Spec.ControlPlaneEndpoint.Port = 6443
+
+	request := newPatchesRequest(t, first)
+	secondRequest := newPatchesRequest(t, second)
+	secondRequest.Items[0].UID = "second-cluster"
+	request.Items = append(request.Items,
+		secondRequest.Items[0],
+		newInfrastructureItem(t, "infra-b", runtimehooksv1.HolderReference{Kind: "Cluster", Name: "hooked", Namespace: "team-b", FieldPath: infrastructureRefPath}),
+		newInfrastructureItem(t, "infra-a", runtimehooksv1.HolderReference{Kind: "Cluster", Name: "hooked", Namespace: "team-a", FieldPath: infrastructureRefPath}),
+	)
+
+	extension := NewVIPExtension(newFakeClient(t), testr.New(t), Options{})
+
+	response := &runtimehooksv1.GeneratePatchesResponse{}
+	extension.GeneratePatches(context.Background(), request, response)
+	if response.GetStatus() != runtimehooksv1.ResponseStatusSuccess || response.GetMessage() != "" {
+		t.Fatalf("expected success without warnings, got %s (%s)", response.GetStatus(), response.GetMessage())
+	}
+
+	for uid, host := range map[string]string{"infra-a": "10.5.0.1", "infra-b": "10.5.0.2"} {
+		want := []map[string]interface{}{{
+			"op":    "replace",
+			"path":  "/spec/template/spec/controlPlaneEndpoint",
+			"value": map[string]interface{}{"host": host, "port": float64(6443)},
+		}}
+		if ops := patchOpsFor(t, response, uid); !reflect.DeepEqual(ops, want) {
+			t.Fatalf("unexpected patch for %s:\n got %v\nwant %v", uid, ops, want)
+		}
+	}
+}
+
+func TestGeneratePatchesCorrelatesByBuiltinVariables(t *testing.T) {
+	cluster := newCluster()
+	cluster.Spec.ControlPlaneEndpoint.Host = "10.5.0.1"
+	cluster.Spec.ControlPlaneEndpoint.Port = 6443
+
+	request := newPatchesRequest(t, cluster)
+	request.Variables = []runtimehooksv1.Variable{{
+		Name:  builtinVariable,
+		Value: apiextensionsv1.JSON{Raw: []byte(`{"cluster":{"name":"hooked","namespace":"default","topology":{"class":"prod"}}}`)},
+	}}
+	request.Items = append(request.Items, newInfrastructureItem(t, "infra", runtimehooksv1.HolderReference{Kind: "Cluster", FieldPath: infrastructureRefPath}))
+
+	extension := NewVIPExtension(newFakeClient(t), testr.New(t), Options{})
+
+	response := &runtimehooksv1.GeneratePatchesResponse{}
+	extension.GeneratePatches(context.Background(), request, response)
+	if response.GetStatus() != runtimehooksv1.ResponseStatusSuccess {
+		t.Fatalf("expected success, got %s (%s)", response.GetStatus(), response.GetMessage())
+	}
+	if ops := patchOpsFor(t, response, "infra"); len(ops) != 1 || ops[0]["path"] != "/spec/template/spec/controlPlaneEndpoint" {
+		t.Fatalf("unexpected patch %v", ops)
+	}
+}
+
+func TestGeneratePatchesWarnsAboutUncorrelatedItems(t *testing.T) {
+	cluster := newCluster()
+	cluster.Spec.ControlPlaneEndpoint.Host = "10.5.0.1"
+	cluster.Spec.ControlPlaneEndpoint.Port = 6443
+
+	request := newPatchesRequest(t, cluster)
+	request.Items = append(request.Items,
+		newInfrastructureItem(t, "orphan", runtimehooksv1.HolderReference{}),
+		newInfrastructureItem(t, "ambiguous", runtimehooksv1.HolderReference{Kind: "Cluster", Name: "hooked", Namespace: "default"}),
+		newInfrastructureItem(t, "worker", runtimehooksv1.HolderReference{Kind: "MachineDeployment", Name: "md-0", Namespace: "default", FieldPath: "spec.template.spec.infrastructureRef"}),
+	)
+
+	extension := NewVIPExtension(newFakeClient(t), testr.New(t), Options{})
+
+	response := &runtimehooksv1.GeneratePatchesResponse{}
+	extension.GeneratePatches(context.Background(), request, response)
+	if response.GetStatus() != runtimehooksv1.ResponseStatusSuccess {
+		t.Fatalf("expected success, got %s (%s)", response.GetStatus(), response.GetMessage())
+	}
+	for _, item := range response.Items {
+		if item.UID != "cluster-item" {
+			t.Fatalf("expected no patches for uncorrelated items, got one for %s", item.UID)
+		}
+	}
+
+	message := response.GetMessage()
+	for _, want := range []string{"ignored 2 item(s)", "uid orphan): no holder reference", `uid ambiguous): unknown holder field path ""`} {
+		if !strings.Contains(message, want) {
+			t.Fatalf("expected message to contain %q, got %q", want, message)
+		}
+	}
+	if strings.Contains(message, "worker") {
+		t.Fatalf("items held by other objects must not be reported, got %q", message)
+	}
+}
+
+func newInfrastructureItem(t *testing.T, uid string, holder runtimehooksv1.HolderReference) runtimehooksv1.GeneratePatchesRequestItem {
+	t.Helper()
+	raw, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "infrastructure.cluster.x-k8s.io/v1beta1",
+		"kind":       "ProxmoxClusterTemplate",
+		"metadata":   map[string]interface{}{"name": "hooked", "namespace": holder.Namespace},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{"controlPlaneEndpoint": map[string]interface{}{"host": "", "port": 0}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("marshal infrastructure cluster: %v", err)
+	}
+	return runtimehooksv1.GeneratePatchesRequestItem{
+		UID:             types.UID(uid),
+		HolderReference: holder,
+		Object:          runtime.RawExtension{Raw: raw},
+	}
+}
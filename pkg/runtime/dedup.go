@@ -0,0 +1,141 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorizond/capi-vip-allocator/pkg/metrics"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+const (
+	// Resolved addresses are served from memory for this long before the claim is read again
+	defaultAddressCacheTTL = 30 * time.Second
+	// A shared allocation may outlive the hook call that started it, but no longer than this
+	defaultAllocationTimeout = time.Minute
+
+	cacheResultHit      = "hit"
+	cacheResultMiss     = "miss"
+	cacheResultInFlight = "inflight"
+)
+
+// allocation is the outcome of one VIP allocation attempt for a cluster role.
+type allocation struct {
+	poolName    string
+	claimName   string
+	requestedAt string
+	ip          string
+	ready       bool
+}
+
+// allocationCall is an allocation in progress; waiters block on done or their own context.
+type allocationCall struct {
+	done   chan struct{}
+	result allocation
+	err    error
+	// panic is the value fn panicked with; it is raised again in every caller
+	panic any
+}
+
+type cachedAllocation struct {
+	result  allocation
+	expires time.Time
+}
+
+// allocationGroup deduplicates concurrent allocations for the same key and keeps
+// ready results for ttl. Pending results and errors are never cached, so the next
+// call after them checks the claim again.
+type allocationGroup struct {
+	ttl time.Duration
+	// timeout bounds a shared allocation, which runs detached from the callers' contexts
+	timeout time.Duration
+	now     func() time.Time
+
+	mu       sync.Mutex
+	inFlight map[string]*allocationCall
+	cache    map[string]cachedAllocation
+}
+
+func newAllocationGroup(ttl time.Duration) *allocationGroup {
+	return &allocationGroup{
+		ttl:      ttl,
+		timeout:  defaultAllocationTimeout,
+		now:      time.Now,
+		inFlight: make(map[string]*allocationCall),
+		cache:    make(map[string]cachedAllocation),
+	}
+}
+
+// allocationKey identifies a cluster role as "namespace/cluster/uid/role". The UID keeps a
+// Cluster recreated under the same name from getting the cached address of the deleted one.
+func allocationKey(cluster *clusterv1.Cluster, role string) string {
+	return cluster.Namespace + "/" + cluster.Name + "/" + string(cluster.UID) + "/" + role
+}
+
+// do returns the cached allocation for key or runs fn, sharing a single execution
+// of fn between all callers that arrive while it is running. fn runs on a context
+// detached from the caller that started it, bounded by the group timeout, so one
+// caller giving up does not fail the others; each caller stops waiting when its
+// own ctx is done.
+func (g *allocationGroup) do(ctx context.Context, key string, fn func(context.Context) (allocation, error)) (allocation, error) {
+	g.mu.Lock()
+	if cached, ok := g.cache[key]; ok {
+		if g.now().Before(cached.expires) {
+			g.mu.Unlock()
+			metrics.VipHookCacheRequestsTotal.WithLabelValues(cacheResultHit).Inc()
+			return cached.result, nil
+		}
+		delete(g.cache, key)
+	}
+	call, ok := g.inFlight[key]
+	if ok {
+		g.mu.Unlock()
+		metrics.VipHookCacheRequestsTotal.WithLabelValues(cacheResultInFlight).Inc()
+	} else {
+		call = &allocationCall{done: make(chan struct{})}
+		g.inFlight[key] = call
+		g.mu.Unlock()
+		metrics.VipHookCacheRequestsTotal.WithLabelValues(cacheResultMiss).Inc()
+		go g.run(context.WithoutCancel(ctx), key, call, fn)
+	}
+
+	select {
+	case <-call.done:
+		if call.panic != nil {
+			panic(call.panic)
+		}
+		return call.result, call.err
+	case <-ctx.Done():
+		return allocation{}, fmt.Errorf("wait for allocation for %s: %w", key, ctx.Err())
+	}
+}
+
+// run executes fn for call and publishes its result to the waiters.
+func (g *allocationGroup) run(ctx context.Context, key string, call *allocationCall, fn func(context.Context) (allocation, error)) {
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			call.result, call.err, call.panic = allocation{}, fmt.Errorf("allocation for %s did not complete", key), r
+		}
+		g.mu.Lock()
+		delete(g.inFlight, key)
+		if call.err == nil && call.result.ready && g.ttl > 0 {
+			g.cache[key] = cachedAllocation{result: call.result, expires: g.now().Add(g.ttl)}
+		}
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.result, call.err = fn(ctx)
+}
+
+// forget drops the cached allocation for key, e.g. when the cluster is deleted.
+func (g *allocationGroup) forget(key string) {
+	g.mu.Lock()
+	delete(g.cache, key)
+	g.mu.Unlock()
+}
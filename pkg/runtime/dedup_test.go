@@ -0,0 +1,156 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAllocationGroupSharesConcurrentCalls(t *testing.T) {
+	group := newAllocationGroup(time.Minute)
+	release := make(chan struct{})
+	var calls atomic.Int32
+
+	const callers = 5
+	var wg sync.WaitGroup
+	results := make([]allocation, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := group.do(context.Background(), "default/shared/control-plane", func(context.Context) (allocation, error) {
+				calls.Add(1)
+				<-release
+				return allocation{poolName: "pool", ip: "10.0.0.10", ready: true}, nil
+			})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			results[i] = result
+		}(i)
+	}
+
+	// Give every caller time to join the in-flight allocation before it completes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected a single allocation, got %d", got)
+	}
+	for i, result := range results {
+		if result.ip != "10.0.0.10" {
+			t.Fatalf("caller %d got %q", i, result.ip)
+		}
+	}
+
+	if _, err := group.do(context.Background(), "default/shared/control-plane", func(context.Context) (allocation, error) {
+		t.Fatal("expected the cached address to be used")
+		return allocation{}, nil
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestAllocationGroupCachesOnlyReadyAddresses(t *testing.T) {
+	group := newAllocationGroup(time.Minute)
+	now := time.Now()
+	group.now = func() time.Time { return now }
+	key := "default/cached/control-plane"
+	ctx := context.Background()
+
+	var calls int
+	pending := func(context.Context) (allocation, error) {
+		calls++
+		return allocation{poolName: "pool", ready: false}, nil
+	}
+	failing := func(context.Context) (allocation, error) {
+		calls++
+		return allocation{}, errors.New("boom")
+	}
+	ready := func(context.Context) (allocation, error) {
+		calls++
+		return allocation{poolName: "pool", ip: "10.0.0.11", ready: true}, nil
+	}
+
+	_, _ = group.do(ctx, key, pending)
+	_, _ = group.do(ctx, key, failing)
+	_, _ = group.do(ctx, key, ready)
+	_, _ = group.do(ctx, key, ready)
+	if calls != 3 {
+		t.Fatalf("expected pending and failed results not to be cached, got %d calls", calls)
+	}
+
+	now = now.Add(2 * time.Minute)
+	_, _ = group.do(ctx, key, ready)
+	if calls != 4 {
+		t.Fatalf("expected cache entry to expire, got %d calls", calls)
+	}
+
+	group.forget(key)
+	_, _ = group.do(ctx, key, ready)
+	if calls != 5 {
+		t.Fatalf("expected forget to drop the cache entry, got %d calls", calls)
+	}
+}
+
+func TestAllocationGroupOutlivesCanceledCallers(t *testing.T) {
+	group := newAllocationGroup(time.Minute)
+	key := "default/canceled/control-plane"
+	started, release := make(chan struct{}), make(chan struct{})
+	workErr := make(chan error, 1)
+	allocate := func(ctx context.Context) (allocation, error) {
+		close(started)
+		<-release
+		workErr <- ctx.Err()
+		return allocation{poolName: "pool", ip: "10.0.0.12", ready: true}, nil
+	}
+
+	// The caller that started the allocation gives up
+	first, cancelFirst := context.WithCancel(context.Background())
+	firstDone := make(chan error, 1)
+	go func() {
+		_, err := group.do(first, key, allocate)
+		firstDone <- err
+	}()
+	<-started
+	cancelFirst()
+	if err := <-firstDone; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the canceled caller to stop waiting, got %v", err)
+	}
+
+	// A waiter whose deadline passes returns without waiting for the allocation
+	waiter, cancelWaiter := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelWaiter()
+	if _, err := group.do(waiter, key, allocate); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the waiter to time out, got %v", err)
+	}
+
+	close(release)
+	if err := <-workErr; err != nil {
+		t.Fatalf("expected the shared allocation to keep running, its context ended with %v", err)
+	}
+	result, err := group.do(context.Background(), key, func(context.Context) (allocation, error) {
+		t.Fatal("expected the allocation of the canceled caller to be cached")
+		return allocation{}, nil
+	})
+	if err != nil || result.ip != "10.0.0.12" {
+		t.Fatalf("unexpected cached allocation %+v, %v", result, err)
+	}
+}
+
+func TestAllocationGroupBoundsSharedAllocation(t *testing.T) {
+	group := newAllocationGroup(time.Minute)
+	group.timeout = 10 * time.Millisecond
+
+	_, err := group.do(context.Background(), "default/slow/control-plane", func(ctx context.Context) (allocation, error) {
+		<-ctx.Done()
+		return allocation{}, ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the shared allocation to time out, got %v", err)
+	}
+}
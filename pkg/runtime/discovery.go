@@ -0,0 +1,175 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	runtimehooksv1 "sigs.k8s.io/cluster-api/exp/runtime/hooks/api/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Hook names a runtime hook served by the extension.
+type Hook string
+
+const (
+	HookGeneratePatches     Hook = "GeneratePatches"
+	HookValidateTopology    Hook = "ValidateTopology"
+	HookBeforeClusterDelete Hook = "BeforeClusterDelete"
+	HookAfterClusterUpgrade Hook = "AfterClusterUpgrade"
+
+	// CAPI rejects handler timeouts above 30 seconds
+	maxHookTimeoutSeconds = 30
+)
+
+// hookOrder is the order in which hooks are advertised by discovery.
+var hookOrder = []Hook{HookGeneratePatches, HookValidateTopology, HookBeforeClusterDelete, HookAfterClusterUpgrade}
+
+// HookSettings is what discovery advertises for a hook.
+type HookSettings struct {
+	TimeoutSeconds int32
+	FailurePolicy  runtimehooksv1.FailurePolicy
+}
+
+// DefaultHookSettings returns the settings used when no hooks are configured: every hook is
+// advertised, allocation fails closed, and validation and the lifecycle hooks fail open.
+func DefaultHookSettings() map[Hook]HookSettings {
+	return map[Hook]HookSettings{
+		// Increased to 30s for VIP allocation + patching
+		HookGeneratePatches: {TimeoutSeconds: maxHookTimeoutSeconds, FailurePolicy: runtimehooksv1.FailurePolicyFail},
+		// Failing closed would block every topology reconcile whenever the extension is unreachable
+		HookValidateTopology:    {TimeoutSeconds: 10, FailurePolicy: runtimehooksv1.FailurePolicyIgnore},
+		HookBeforeClusterDelete: {TimeoutSeconds: 10, FailurePolicy: runtimehooksv1.FailurePolicyIgnore},
+		HookAfterClusterUpgrade: {TimeoutSeconds: 10, FailurePolicy: runtimehooksv1.FailurePolicyIgnore},
+	}
+}
+
+// ParseHookSettings builds the advertised hook set from the --runtime-extension-hooks,
+// --runtime-extension-hook-timeouts and --runtime-extension-hook-failure-policies flags.
+// An empty hook list advertises every hook; timeouts and failure policies are "Hook=value" pairs
+// overriding the defaults of advertised hooks.
+func ParseHookSettings(hooks, timeouts, failurePolicies []string) (map[Hook]HookSettings, error) {
+	defaults := DefaultHookSettings()
+
+	settings := make(map[Hook]HookSettings)
+	for _, value := range hooks {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		hook, err := parseHook(value)
+		if err != nil {
+			return nil, err
+		}
+		settings[hook] = defaults[hook]
+	}
+	if len(settings) == 0 {
+		settings = defaults
+	}
+
+	if err := forEachHookValue(timeouts, settings, func(hook Hook, value string) error {
+		seconds, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || seconds < 1 || seconds > maxHookTimeoutSeconds {
+			return fmt.Errorf("invalid timeout %q for hook %s: must be 1-%d seconds", value, hook, maxHookTimeoutSeconds)
+		}
+		hookSettings := settings[hook]
+		hookSettings.TimeoutSeconds = int32(seconds)
+		settings[hook] = hookSettings
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := forEachHookValue(failurePolicies, settings, func(hook Hook, value string) error {
+		policy := runtimehooksv1.FailurePolicy(value)
+		if policy != runtimehooksv1.FailurePolicyFail && policy != runtimehooksv1.FailurePolicyIgnore {
+			return fmt.Errorf("invalid failure policy %q for hook %s: must be %q or %q", value, hook, runtimehooksv1.FailurePolicyFail, runtimehooksv1.FailurePolicyIgnore)
+		}
+		hookSettings := settings[hook]
+		hookSettings.FailurePolicy = policy
+		settings[hook] = hookSettings
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func parseHook(value string) (Hook, error) {
+	for _, hook := range hookOrder {
+		if strings.EqualFold(value, string(hook)) {
+			return hook, nil
+		}
+	}
+	return "", fmt.Errorf("unknown hook %q: must be one of %s, %s, %s, %s", value, HookGeneratePatches, HookValidateTopology, HookBeforeClusterDelete, HookAfterClusterUpgrade)
+}
+
+// forEachHookValue calls fn for every "Hook=value" pair; hooks must be advertised.
+func forEachHookValue(pairs []string, settings map[Hook]HookSettings, fn func(Hook, string) error) error {
+	for _, pair := range pairs {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, found := strings.Cut(pair, "=")
+		if !found {
+			return fmt.Errorf("invalid hook setting %q: expected Hook=value", pair)
+		}
+		hook, err := parseHook(strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		if _, ok := settings[hook]; !ok {
+			return fmt.Errorf("hook setting %q refers to hook %s which is not advertised", pair, hook)
+		}
+		if err := fn(hook, strings.TrimSpace(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// advertisedHooks returns the configured hooks in discovery order.
+func (s *Server) advertisedHooks() []Hook {
+	var hooks []Hook
+	for _, hook := range hookOrder {
+		if _, ok := s.hooks[hook]; ok {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
+
+// handlerName returns the handler name CAPI uses for a hook, e.g. "vip-allocator-generate-patches".
+func (s *Server) handlerName(hook Hook) string {
+	suffix := map[Hook]string{
+		HookGeneratePatches:     "generate-patches",
+		HookValidateTopology:    "validate-topology",
+		HookBeforeClusterDelete: "before-delete",
+		HookAfterClusterUpgrade: "after-upgrade",
+	}[hook]
+	return s.extension.Name() + "-" + suffix
+}
+
+// handlerPath returns the path CAPI calls for a hook's handler.
+func (s *Server) handlerPath(hook Hook) string {
+	return fmt.Sprintf("/hooks.runtime.cluster.x-k8s.io/v1alpha1/%s/%s", strings.ToLower(string(hook)), s.handlerName(hook))
+}
+
+// namespaceSelected reports whether clusters in the namespace are served, mirroring the
+// ExtensionConfig namespaceSelector so requests CAPI should not have sent are ignored.
+func (e *VIPExtension) namespaceSelected(ctx context.Context, namespace string) (bool, error) {
+	if e.NamespaceSelector == nil || e.NamespaceSelector.Empty() {
+		return true, nil
+	}
+	ns := &corev1.Namespace{}
+	if err := e.Client.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return false, fmt.Errorf("get namespace %s: %w", namespace, err)
+	}
+	return e.NamespaceSelector.Matches(labels.Set(ns.Labels)), nil
+}
@@ -0,0 +1,110 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	runtimehooksv1 "sigs.k8s.io/cluster-api/exp/runtime/hooks/api/v1alpha1"
+)
+
+func TestParseHookSettings(t *testing.T) {
+	settings, err := ParseHookSettings(nil, []string{"GeneratePatches=20"}, []string{"generatepatches=Ignore"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(settings) != len(hookOrder) {
+		t.Fatalf("expected every hook to be advertised by default, got %v", settings)
+	}
+	if got := settings[HookGeneratePatches]; got.TimeoutSeconds != 20 || got.FailurePolicy != runtimehooksv1.FailurePolicyIgnore {
+		t.Fatalf("unexpected GeneratePatches settings %+v", got)
+	}
+	if got := settings[HookBeforeClusterDelete]; got != DefaultHookSettings()[HookBeforeClusterDelete] {
+		t.Fatalf("expected defaults for BeforeClusterDelete, got %+v", got)
+	}
+	if got := settings[HookValidateTopology]; got.TimeoutSeconds != 10 || got.FailurePolicy != runtimehooksv1.FailurePolicyIgnore {
+		t.Fatalf("expected ValidateTopology to fail open by default, got %+v", got)
+	}
+
+	for _, tt := range []struct {
+		name                             string
+		hooks, timeouts, failurePolicies []string
+	}{
+		{name: "unknown hook", hooks: []string{"BeforeClusterCreate"}},
+		{name: "timeout too long", timeouts: []string{"GeneratePatches=31"}},
+		{name: "timeout without value", timeouts: []string{"GeneratePatches"}},
+		{name: "unknown failure policy", failurePolicies: []string{"GeneratePatches=Retry"}},
+		{name: "setting for hook not advertised", hooks: []string{"GeneratePatches"}, failurePolicies: []string{"ValidateTopology=Ignore"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseHookSettings(tt.hooks, tt.timeouts, tt.failurePolicies); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestDiscoveryAdvertisesConfiguredHooks(t *testing.T) {
+	hooks, err := ParseHookSettings([]string{"GeneratePatches", "BeforeClusterDelete"}, nil, []string{"GeneratePatches=Ignore"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server := NewServer(newFakeClient(t), testr.New(t), 9443, "", Options{Hooks: hooks})
+
+	recorder := httptest.NewRecorder()
+	server.handleDiscovery(recorder, httptest.NewRequest(http.MethodPost, "/hooks.runtime.cluster.x-k8s.io/v1alpha1/discovery", nil))
+
+	response := &runtimehooksv1.DiscoveryResponse{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+		t.Fatalf("unmarshal discovery response: %v", err)
+	}
+	if len(response.Handlers) != 2 {
+		t.Fatalf("expected 2 handlers, got %d", len(response.Handlers))
+	}
+	patches := response.Handlers[0]
+	if patches.Name != "vip-allocator-generate-patches" || patches.RequestHook.Hook != "GeneratePatches" {
+		t.Fatalf("unexpected first handler %+v", patches)
+	}
+	if *patches.FailurePolicy != runtimehooksv1.FailurePolicyIgnore || *patches.TimeoutSeconds != 30 {
+		t.Fatalf("unexpected GeneratePatches settings: failurePolicy=%s timeout=%d", *patches.FailurePolicy, *patches.TimeoutSeconds)
+	}
+	if response.Handlers[1].Name != "vip-allocator-before-delete" {
+		t.Fatalf("unexpected second handler %+v", response.Handlers[1])
+	}
+	if got := server.handlerPath(HookValidateTopology); got != "/hooks.runtime.cluster.x-k8s.io/v1alpha1/validatetopology/vip-allocator-validate-topology" {
+		t.Fatalf("unexpected handler path %s", got)
+	}
+}
+
+func TestGeneratePatchesSkipsNamespacesOutsideSelector(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: map[string]string{"team": "other"}}}
+	selector, err := labels.Parse("team=platform")
+	if err != nil {
+		t.Fatalf("parse selector: %v", err)
+	}
+	c := newFakeClient(t, newPool(), namespace)
+	extension := NewVIPExtension(c, testr.New(t), Options{NamespaceSelector: selector})
+
+	response := &runtimehooksv1.GeneratePatchesResponse{}
+	extension.GeneratePatches(context.Background(), newPatchesRequest(t, newCluster()), response)
+	if response.GetStatus() != runtimehooksv1.ResponseStatusSuccess || len(response.Items) != 0 {
+		t.Fatalf("expected success without patches, got status %s with %d items (%s)", response.GetStatus(), len(response.Items), response.GetMessage())
+	}
+
+	claims := &unstructured.UnstructuredList{}
+	claims.SetGroupVersionKind(allocator.ClaimGVK().GroupVersion().WithKind(allocator.IPAddressClaimKind + "List"))
+	if err := c.List(context.Background(), claims); err != nil {
+		t.Fatalf("list claims: %v", err)
+	}
+	if len(claims.Items) != 0 {
+		t.Fatalf("expected no claim for a namespace outside the selector, got %d", len(claims.Items))
+	}
+}
@@ -4,61 +4,161 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"time"
+	"strings"
 
 	"github.com/go-logr/logr"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	runtimehooksv1 "sigs.k8s.io/cluster-api/exp/runtime/hooks/api/v1alpha1"
 
-	"k8s.io/apimachinery/pkg/api/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
-	ipamGroup            = "ipam.cluster.x-k8s.io"
-	ipamVersion          = "v1beta1"
-	globalPoolAPIVersion = "v1alpha2"
-	globalPoolKind       = "GlobalInClusterIPPool"
-	ipAddressClaimKind   = "IPAddressClaim"
-	ipAddressKind        = "IPAddress"
-	clusterClassLabel    = "vip.capi.gorizond.io/cluster-class"
-	roleLabel            = "vip.capi.gorizond.io/role"
-	controlPlaneRole     = "control-plane"
-	defaultPort          = int32(6443)
-
-	// IP allocation retry settings for GeneratePatches hook
-	ipAllocationTimeout  = 25 * time.Second // Must be less than hook timeout (30s)
-	ipAllocationInterval = 500 * time.Millisecond
-
-	// BeforeClusterCreate hook timeout settings
-	beforeCreateIPTimeout  = 25 * time.Second // Must be less than hook timeout (30s max allowed by CAPI)
-	beforeCreateIPInterval = 1 * time.Second  // Slightly longer interval for this hook
+	defaultPort = int32(6443)
 )
 
+// PendingPolicy controls how GeneratePatches answers while a cluster's VIP claim is pending.
+type PendingPolicy string
+
+const (
+	// PendingPolicyRetry fails the hook call so the topology controller retries it with backoff.
+	PendingPolicyRetry PendingPolicy = "retry"
+	// PendingPolicySkip succeeds without VIP patches for the cluster; a later call or the reconciler sets them.
+	PendingPolicySkip PendingPolicy = "skip"
+)
+
+// ParsePendingPolicy validates a --runtime-extension-pending-policy value.
+func ParsePendingPolicy(value string) (PendingPolicy, error) {
+	switch policy := PendingPolicy(value); policy {
+	case PendingPolicyRetry, PendingPolicySkip:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid pending policy %q: must be %q or %q", value, PendingPolicyRetry, PendingPolicySkip)
+	}
+}
+
+// PortResolver returns the control-plane port for a Cluster without one, or 0 to use the default port.
+type PortResolver func(ctx context.Context, cluster *clusterv1.Cluster) (int32, error)
+
+// Options configures a VIPExtension and the Server hosting it.
+type Options struct {
+	// ExtensionName is the handler name prefix registered with CAPI (must not contain dots)
+	ExtensionName string
+	// PendingPolicy decides how GeneratePatches answers while a VIP is pending
+	PendingPolicy PendingPolicy
+	// PatchProfiles enables built-in ControlPlane patches, e.g. TLS SANs for RKE2 or kubeadm
+	PatchProfiles []PatchProfile
+	// DefaultPort is the control-plane port used when neither the Cluster nor PortResolver sets one
+	DefaultPort int32
+	// PortResolver resolves per-class ports; defaults to the port of the matching VIPAllocationPolicy
+	PortResolver PortResolver
+	// Hooks are the advertised hooks and their discovery settings; defaults to DefaultHookSettings
+	Hooks map[Hook]HookSettings
+	// NamespaceSelector limits the served Clusters like the ExtensionConfig namespaceSelector
+	NamespaceSelector labels.Selector
+	// ClientCAFile enables mTLS on the Server: callers must present a certificate signed by this CA bundle
+	ClientCAFile string
+	// Shadow only reports the allocations that would be made, see allocator.ShadowEnabled
+	Shadow bool
+	// Recorder receives shadow allocation and pool events; may be nil
+	Recorder record.EventRecorder
+	// APIReader reads uncached for the quota re-check after a claim is created; may be nil
+	APIReader client.Reader
+}
+
 // VIPExtension implements CAPI Runtime Extension for VIP allocation.
 type VIPExtension struct {
 	Client        client.Client
 	Logger        logr.Logger
 	ExtensionName string
+	Allocator     allocator.Allocator
+	PendingPolicy PendingPolicy
+	// PatchProfiles enables built-in ControlPlane patches, e.g. TLS SANs for RKE2 or kubeadm
+	PatchProfiles []PatchProfile
+	DefaultPort   int32
+	PortResolver  PortResolver
+	// NamespaceSelector limits the served Clusters like the ExtensionConfig namespaceSelector
+	NamespaceSelector labels.Selector
+	Shadow            bool
+	Recorder          record.EventRecorder
+
+	allocations *allocationGroup
 }
 
 // NewVIPExtension creates a new VIP runtime extension.
-func NewVIPExtension(client client.Client, logger logr.Logger, extensionName string) *VIPExtension {
-	if extensionName == "" {
-		extensionName = "vip-allocator" // Default name without dots
+func NewVIPExtension(client client.Client, logger logr.Logger, opts Options) *VIPExtension {
+	if opts.ExtensionName == "" {
+		opts.ExtensionName = "vip-allocator" // Default name without dots
+	}
+	if opts.PendingPolicy == "" {
+		opts.PendingPolicy = PendingPolicyRetry
+	}
+	if opts.DefaultPort == 0 {
+		opts.DefaultPort = defaultPort
+	}
+	vips := allocator.New(client, logger, opts.Recorder)
+	vips.APIReader = opts.APIReader
+	if opts.PortResolver == nil {
+		opts.PortResolver = policyPortResolver(vips)
 	}
 	return &VIPExtension{
-		Client:        client,
-		Logger:        logger,
-		ExtensionName: extensionName,
+		Client:            client,
+		Logger:            logger,
+		ExtensionName:     opts.ExtensionName,
+		Allocator:         vips,
+		PendingPolicy:     opts.PendingPolicy,
+		PatchProfiles:     opts.PatchProfiles,
+		DefaultPort:       opts.DefaultPort,
+		PortResolver:      opts.PortResolver,
+		NamespaceSelector: opts.NamespaceSelector,
+		Shadow:            opts.Shadow,
+		Recorder:          opts.Recorder,
+		allocations:       newAllocationGroup(defaultAddressCacheTTL),
 	}
 }
 
+// policyPortResolver resolves the port from the VIPAllocationPolicy matching the cluster's class,
+// falling back to the ClusterClass default port, mirroring the reconciler.
+func policyPortResolver(vips *allocator.PoolAllocator) PortResolver {
+	return func(ctx context.Context, cluster *clusterv1.Cluster) (int32, error) {
+		policy, err := vips.MatchPolicy(ctx, cluster, allocator.ControlPlaneRole)
+		if err != nil {
+			return 0, err
+		}
+		if policy != nil && policy.Spec.Port != 0 {
+			return policy.Spec.Port, nil
+		}
+		return allocator.ClassPort(cluster), nil
+	}
+}
+
+// controlPlanePort returns the Cluster's own port if set, otherwise the resolved or default port.
+func (e *VIPExtension) controlPlanePort(ctx context.Context, cluster *clusterv1.Cluster) (int32, error) {
+	if cluster.Spec.ControlPlaneEndpoint.Port != 0 {
+		return cluster.Spec.ControlPlaneEndpoint.Port, nil
+	}
+	if e.PortResolver != nil {
+		port, err := e.PortResolver(ctx, cluster)
+		if err != nil {
+			return 0, fmt.Errorf("resolve control plane port: %w", err)
+		}
+		if port != 0 {
+			return port, nil
+		}
+	}
+	if e.DefaultPort != 0 {
+		return e.DefaultPort, nil
+	}
+	return defaultPort, nil
+}
+
 // Name returns the name of the extension.
 func (e *VIPExtension) Name() string {
 	return e.ExtensionName
@@ -66,151 +166,162 @@ func (e *VIPExtension) Name() string {
 
 // GeneratePatches is called during Cluster topology reconciliation to generate patches.
 // v0.4.0: This is the ONLY hook for VIP allocation and patching (BeforeClusterCreate removed).
-// It allocates VIPs AND patches both Cluster and InfrastructureCluster objects.
+// It allocates VIPs for the Clusters owning the items and patches the InfrastructureCluster and
+// ControlPlane templates, and the Cluster itself when it is one of the items.
 func (e *VIPExtension) GeneratePatches(ctx context.Context, request *runtimehooksv1.GeneratePatchesRequest, response *runtimehooksv1.GeneratePatchesResponse) {
 	log := e.Logger.WithName("GeneratePatches")
 
 	log.Info("GeneratePatches hook called", "itemsCount", len(request.Items))
 
-	// Map to store allocated IPs: clusterName -> IP
+	// Items other than Clusters are matched to their Cluster up front; the maps below are keyed by
+	// "namespace/name" so equally named clusters in different namespaces do not collide
+	items, warnings := correlateItems(request)
+
+	// Map to store allocated IPs: cluster key -> IP
 	allocatedIPs := make(map[string]string)
 
-	// Map to store cluster namespace: clusterName -> namespace
-	clusterNamespaces := make(map[string]string)
+	// Map to store control plane ports: cluster key -> port
+	allocatedPorts := make(map[string]int32)
 
-	// First pass: Process Cluster objects and allocate VIPs
-	for i, item := range request.Items {
-		// Check object type
-		var typeMeta metav1.TypeMeta
-		if err := json.Unmarshal(item.Object.Raw, &typeMeta); err != nil {
-			log.Error(err, "failed to unmarshal TypeMeta", "itemIndex", i)
-			continue
-		}
+	// Map to store ingress VIPs already allocated by the reconciler: cluster key -> IP
+	ingressVIPs := make(map[string]string)
 
-		log.V(1).Info("processing item", "itemIndex", i, "kind", typeMeta.Kind, "apiVersion", typeMeta.APIVersion, "uid", item.UID)
+	clusters, err := e.patchClusters(ctx, request, items)
+	if err != nil {
+		log.Error(err, "failed to get Clusters")
+		response.SetStatus(runtimehooksv1.ResponseStatusFailure)
+		response.SetMessage(err.Error())
+		return
+	}
 
-		// We only care about Cluster objects
-		if typeMeta.Kind != "Cluster" {
+	// First pass: allocate VIPs for the Clusters of the request
+	for _, target := range clusters {
+		cluster := target.cluster
+		key := allocator.ClusterKey(cluster.Namespace, cluster.Name)
+
+		log.Info("processing cluster", "name", cluster.Name, "namespace", cluster.Namespace, "uid", cluster.UID)
+
+		// Skip if no topology
+		if cluster.Spec.Topology == nil || cluster.Spec.Topology.Class == "" {
+			log.Info("no topology, skipping", "cluster", cluster.Name)
 			continue
 		}
 
-		// Convert to Cluster
-		cluster := &clusterv1.Cluster{}
-		if err := json.Unmarshal(item.Object.Raw, cluster); err != nil {
-			log.Error(err, "failed to unmarshal Cluster")
+		selected, err := e.namespaceSelected(ctx, cluster.Namespace)
+		if err != nil {
+			log.Error(err, "failed to check namespace selector", "cluster", cluster.Name)
 			response.SetStatus(runtimehooksv1.ResponseStatusFailure)
-			response.SetMessage(fmt.Sprintf("failed to unmarshal Cluster: %v", err))
+			response.SetMessage(fmt.Sprintf("failed to check namespace selector for cluster %s: %v", cluster.Name, err))
 			return
 		}
+		if !selected {
+			log.Info("namespace not selected, skipping", "cluster", cluster.Name, "namespace", cluster.Namespace)
+			continue
+		}
 
-		log.Info("processing cluster", "name", cluster.Name, "namespace", cluster.Namespace, "uid", item.UID)
+		if ingressIP := cluster.Annotations[allocator.IngressVIPAnnotation()]; ingressIP != "" {
+			ingressVIPs[key] = ingressIP
+		}
 
-		// Skip if no topology
-		if cluster.Spec.Topology == nil || cluster.Spec.Topology.Class == "" {
-			log.Info("no topology, skipping", "cluster", cluster.Name)
-			continue
+		port, err := e.controlPlanePort(ctx, cluster)
+		if err != nil {
+			log.Error(err, "failed to resolve control plane port", "cluster", cluster.Name)
+			response.SetStatus(runtimehooksv1.ResponseStatusFailure)
+			response.SetMessage(fmt.Sprintf("failed to resolve control plane port for cluster %s: %v", cluster.Name, err))
+			return
 		}
+		allocatedPorts[key] = port
 
-		// Store cluster namespace for later lookup
-		clusterNamespaces[cluster.Name] = cluster.Namespace
+		if allocator.ShadowEnabled(cluster, e.Shadow) {
+			// Report the would-be allocation; only an endpoint the Cluster already has is patched
+			e.reportShadow(ctx, log, cluster)
+			if host := cluster.Spec.ControlPlaneEndpoint.Host; host != "" {
+				allocatedIPs[key] = host
+			}
+			continue
+		}
 
 		// Skip if endpoint already set (manual configuration)
 		if cluster.Spec.ControlPlaneEndpoint.Host != "" {
 			log.Info("controlPlaneEndpoint already set, skipping allocation", "cluster", cluster.Name, "host", cluster.Spec.ControlPlaneEndpoint.Host)
-			allocatedIPs[cluster.Name] = cluster.Spec.ControlPlaneEndpoint.Host
+			allocatedIPs[key] = cluster.Spec.ControlPlaneEndpoint.Host
 			continue
 		}
 
-		// Allocate IP for this cluster
-		poolName, err := e.findPool(ctx, cluster.Spec.Topology.Class, controlPlaneRole)
+		// Concurrent calls for the same cluster share one allocation; ready addresses are cached
+		result, err := e.allocations.do(ctx, allocationKey(cluster, allocator.ControlPlaneRole), func(ctx context.Context) (allocation, error) {
+			return e.allocate(ctx, cluster, allocator.ControlPlaneRole)
+		})
 		if err != nil {
-			log.Error(err, "failed to find IP pool", "cluster", cluster.Name)
+			log.Error(err, "failed to allocate IP", "cluster", cluster.Name)
 			response.SetStatus(runtimehooksv1.ResponseStatusFailure)
-			response.SetMessage(fmt.Sprintf("failed to find IP pool for cluster %s: %v", cluster.Name, err))
+			response.SetMessage(fmt.Sprintf("failed to allocate IP for cluster %s: %v", cluster.Name, err))
 			return
 		}
 
-		if poolName == "" {
+		if result.poolName == "" {
 			// No pool found - fail cluster creation (strict validation)
-			log.Error(fmt.Errorf("no IP pool found"), "IP pool not found for cluster class", "clusterClass", cluster.Spec.Topology.Class, "role", controlPlaneRole)
+			log.Error(fmt.Errorf("no IP pool found"), "IP pool not found for cluster class", "clusterClass", cluster.Spec.Topology.Class, "role", allocator.ControlPlaneRole)
 			response.SetStatus(runtimehooksv1.ResponseStatusFailure)
-			response.SetMessage(fmt.Sprintf("no IP pool found for cluster class %q with labels vip.capi.gorizond.io/cluster-class=%s and vip.capi.gorizond.io/role=%s", cluster.Spec.Topology.Class, cluster.Spec.Topology.Class, controlPlaneRole))
+			response.SetMessage(fmt.Sprintf("no IP pool found for cluster class %q with labels %s=%s and %s=%s", cluster.Spec.Topology.Class, allocator.ClusterClassLabel(), cluster.Spec.Topology.Class, allocator.RoleLabel(), allocator.ControlPlaneRole))
 			return
 		}
 
-		// Pre-allocate IPAddressClaim
-		claimName := fmt.Sprintf("vip-cp-%s", cluster.Name)
-		ip, err := e.preallocateIP(ctx, cluster, claimName, poolName)
-		if err != nil {
-			log.Error(err, "failed to preallocate IP", "cluster", cluster.Name)
+		if !result.ready {
+			message := fmt.Sprintf("VIP for cluster %s/%s is pending: IPAddressClaim %s requested at %s has no address yet",
+				cluster.Namespace, cluster.Name, result.claimName, result.requestedAt)
+			if e.PendingPolicy == PendingPolicySkip {
+				log.Info("VIP pending, skipping patches for cluster", "cluster", cluster.Name, "claim", result.claimName)
+				continue
+			}
+			log.Info("VIP pending, asking topology controller to retry", "cluster", cluster.Name, "claim", result.claimName)
 			response.SetStatus(runtimehooksv1.ResponseStatusFailure)
-			response.SetMessage(fmt.Sprintf("failed to allocate IP for cluster %s: %v", cluster.Name, err))
+			response.SetMessage(message + ", retrying")
 			return
 		}
 
+		ip := result.ip
+		poolName := result.poolName
 		log.Info("VIP allocated", "cluster", cluster.Name, "ip", ip, "pool", poolName)
 
 		// Store allocated IP
-		allocatedIPs[cluster.Name] = ip
+		allocatedIPs[key] = ip
 
-		// Add patch to set controlPlaneEndpoint in Cluster
-		e.addClusterPatch(response, item.UID, "/spec/controlPlaneEndpoint", map[string]interface{}{
-			"host": ip,
-			"port": defaultPort,
-		})
+		// Add patch to set controlPlaneEndpoint in Cluster, when the Cluster is an item
+		if target.itemUID != "" {
+			e.addClusterPatch(response, target.itemUID, "/spec/controlPlaneEndpoint", map[string]interface{}{
+				"host": ip,
+				"port": port,
+			})
+		}
 	}
 
 	// Second pass: Patch InfrastructureCluster objects with allocated VIPs
-	for i, item := range request.Items {
-		var typeMeta metav1.TypeMeta
-		if err := json.Unmarshal(item.Object.Raw, &typeMeta); err != nil {
-			log.V(1).Info("failed to unmarshal TypeMeta in second pass", "itemIndex", i, "error", err)
-			continue
-		}
-
-		// Check if this is an InfrastructureCluster (any kind ending with "Cluster" in infrastructure group)
-		if typeMeta.Kind == "Cluster" || !isInfrastructureCluster(typeMeta) {
-			log.V(1).Info("skipping non-InfrastructureCluster", "itemIndex", i, "kind", typeMeta.Kind)
+	for _, target := range items {
+		if target.role != roleInfrastructureCluster {
 			continue
 		}
+		obj := target.object
 
-		// Parse object to get metadata
-		obj := &unstructured.Unstructured{}
-		if err := json.Unmarshal(item.Object.Raw, obj); err != nil {
-			log.Error(err, "failed to unmarshal InfrastructureCluster", "kind", typeMeta.Kind, "itemIndex", i)
-			continue
-		}
-
-		log.Info("found InfrastructureCluster", "kind", typeMeta.Kind, "name", obj.GetName(), "namespace", obj.GetNamespace(), "uid", item.UID)
-
-		// Get cluster name from HolderReference (this is the Cluster that owns this object)
-		// HolderReference points to the Cluster object in topology reconciliation
-		var clusterName string
-		if item.HolderReference.Name != "" {
-			clusterName = item.HolderReference.Name
-			log.Info("using HolderReference for cluster name", "infraCluster", obj.GetName(), "clusterName", clusterName)
-		} else {
-			// Fallback: try to extract from object name (usually matches cluster name)
-			clusterName = extractClusterName(obj.GetName())
-			log.Info("using extracted cluster name from object name", "infraCluster", obj.GetName(), "clusterName", clusterName)
-		}
-
-		if clusterName == "" {
-			log.Info("could not determine cluster name, skipping", "infraCluster", obj.GetName())
-			continue
-		}
+		log.Info("found InfrastructureCluster", "kind", target.typeMeta.Kind, "name", obj.GetName(), "cluster", target.cluster, "uid", target.item.UID)
 
 		// Check if we have allocated IP for this cluster
-		ip, exists := allocatedIPs[clusterName]
+		ip, exists := allocatedIPs[target.cluster]
 		if !exists {
-			log.Info("no VIP allocated for this cluster yet, skipping patch", "infraCluster", obj.GetName(), "clusterName", clusterName)
+			log.Info("no VIP allocated for this cluster yet, skipping patch", "infraCluster", obj.GetName(), "cluster", target.cluster)
 			continue
 		}
 
-		log.Info("patching InfrastructureCluster with VIP", "kind", typeMeta.Kind, "name", obj.GetName(), "clusterName", clusterName, "ip", ip)
+		log.Info("patching InfrastructureCluster with VIP", "kind", target.typeMeta.Kind, "name", obj.GetName(), "cluster", target.cluster, "ip", ip)
+
+		// Templates carry the InfrastructureCluster spec under spec.template.spec
+		specPath := []string{"spec"}
+		if strings.HasSuffix(target.typeMeta.Kind, "Template") {
+			specPath = []string{"spec", "template", "spec"}
+		}
 
 		// Check if controlPlaneEndpoint exists in spec
-		spec, found, _ := unstructured.NestedMap(obj.Object, "spec")
+		spec, found, _ := unstructured.NestedMap(obj.Object, specPath...)
 		if !found {
 			log.Info("spec not found in InfrastructureCluster, skipping", "infraCluster", obj.GetName())
 			continue
@@ -218,24 +329,130 @@ func (e *VIPExtension) GeneratePatches(ctx context.Context, request *runtimehook
 
 		// Check if controlPlaneEndpoint field exists
 		if _, exists := spec["controlPlaneEndpoint"]; exists {
+			path := "/" + strings.Join(append(specPath, "controlPlaneEndpoint"), "/")
 			// Add patch to set controlPlaneEndpoint
-			e.addGenericPatch(response, item.UID, "/spec/controlPlaneEndpoint", map[string]interface{}{
+			e.addGenericPatch(response, target.item.UID, path, map[string]interface{}{
 				"host": ip,
-				"port": defaultPort,
+				"port": allocatedPorts[target.cluster],
 			})
-			log.Info("added patch for InfrastructureCluster", "infraCluster", obj.GetName(), "path", "/spec/controlPlaneEndpoint", "ip", ip)
+			log.Info("added patch for InfrastructureCluster", "infraCluster", obj.GetName(), "path", path, "ip", ip)
 		} else {
 			log.Info("controlPlaneEndpoint field not found in spec, skipping", "infraCluster", obj.GetName())
 		}
 	}
 
+	// Third pass: Patch ControlPlane objects according to the enabled patch profiles
+	e.addControlPlanePatches(log, items, response, allocatedIPs, ingressVIPs)
+
 	response.SetStatus(runtimehooksv1.ResponseStatusSuccess)
+	if message := uncorrelatedMessage(warnings); message != "" {
+		log.Info("some items were not patched", "warnings", warnings)
+		response.SetMessage(message)
+	}
+}
+
+// patchCluster is a Cluster whose VIP GeneratePatches allocates.
+type patchCluster struct {
+	cluster *clusterv1.Cluster
+	// itemUID is the UID of the request item holding the Cluster, empty when it is read
+	// through the client
+	itemUID types.UID
+}
+
+// patchClusters returns the Clusters of a GeneratePatches request. CAPI only sends the templates
+// of a topology, so the Clusters are the owners correlateItems resolved from holder references and
+// the builtin variables, read through the client; Cluster items are used as they are. A Cluster
+// that is not found is skipped, its items are then left unpatched.
+func (e *VIPExtension) patchClusters(ctx context.Context, request *runtimehooksv1.GeneratePatchesRequest, items []correlatedItem) ([]patchCluster, error) {
+	requestBuiltin := builtinFromVariables(request.Variables)
+
+	var clusters []patchCluster
+	seen := map[string]bool{}
+	for _, item := range request.Items {
+		var typeMeta metav1.TypeMeta
+		if err := json.Unmarshal(item.Object.Raw, &typeMeta); err != nil || typeMeta.Kind != "Cluster" {
+			continue // undecodable items are reported by correlateItems
+		}
+		cluster := &clusterv1.Cluster{}
+		if err := json.Unmarshal(item.Object.Raw, cluster); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal Cluster: %w", err)
+		}
+		if cluster.Namespace == "" {
+			cluster.Namespace = firstNonEmpty(item.HolderReference.Namespace, builtinFromVariables(item.Variables).Cluster.Namespace, requestBuiltin.Cluster.Namespace)
+		}
+		key := allocator.ClusterKey(cluster.Namespace, cluster.Name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		clusters = append(clusters, patchCluster{cluster: cluster, itemUID: item.UID})
+	}
+
+	for _, item := range items {
+		if seen[item.cluster] {
+			continue
+		}
+		seen[item.cluster] = true
+
+		namespace, name, _ := strings.Cut(item.cluster, "/")
+		cluster := &clusterv1.Cluster{}
+		if err := e.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, cluster); err != nil {
+			if apierrors.IsNotFound(err) {
+				e.Logger.Info("Cluster of GeneratePatches items not found, skipping", "cluster", item.cluster)
+				continue
+			}
+			return nil, fmt.Errorf("failed to get cluster %s: %w", item.cluster, err)
+		}
+		clusters = append(clusters, patchCluster{cluster: cluster})
+	}
+	return clusters, nil
+}
+
+// reportShadow reports the control-plane allocation the cluster would get in shadow mode.
+// Failures are only logged: shadow mode must never block topology reconciliation.
+func (e *VIPExtension) reportShadow(ctx context.Context, log logr.Logger, cluster *clusterv1.Cluster) {
+	result, err := e.Allocator.Shadow(ctx, cluster, allocator.ControlPlaneRole)
+	if err != nil {
+		log.Error(err, "shadow allocation failed", "cluster", cluster.Name, "namespace", cluster.Namespace)
+		return
+	}
+	allocator.ReportShadow(log, e.Recorder, cluster, result)
 }
 
 // BeforeClusterCreate - REMOVED in v0.4.0
 // BeforeClusterCreate hook cannot modify Cluster object - CAPI ignores changes to request.Cluster.
 // All VIP allocation is done in GeneratePatches hook via patch response.
 
+// allocate finds the pool for the cluster role, ensures the IPAddressClaim exists and checks it
+// once, without waiting for IPAM. An empty poolName in the result means no pool matched.
+func (e *VIPExtension) allocate(ctx context.Context, cluster *clusterv1.Cluster, role string) (allocation, error) {
+	poolName, err := e.Allocator.FindPool(ctx, cluster, role)
+	if err != nil {
+		return allocation{}, fmt.Errorf("find IP pool: %w", err)
+	}
+	if poolName == "" {
+		return allocation{}, nil
+	}
+
+	claim, err := e.Allocator.EnsureClaim(ctx, cluster, role)
+	if err != nil {
+		return allocation{}, err
+	}
+
+	ip, ready, err := e.Allocator.ResolveAddress(ctx, claim)
+	if err != nil {
+		return allocation{}, fmt.Errorf("resolve IP address: %w", err)
+	}
+
+	return allocation{
+		poolName:    poolName,
+		claimName:   claim.GetName(),
+		requestedAt: claim.GetAnnotations()[allocator.RequestedAtAnnotation()],
+		ip:          ip,
+		ready:       ready,
+	}, nil
+}
+
 // AfterClusterUpgrade is called after a Cluster is upgraded (no-op for us).
 func (e *VIPExtension) AfterClusterUpgrade(ctx context.Context, request *runtimehooksv1.AfterClusterUpgradeRequest, response *runtimehooksv1.AfterClusterUpgradeResponse) {
 	response.SetStatus(runtimehooksv1.ResponseStatusSuccess)
@@ -249,6 +466,8 @@ func (e *VIPExtension) BeforeClusterDelete(ctx context.Context, request *runtime
 	})
 
 	log.Info("BeforeClusterDelete hook called - IPAddressClaim will be cleaned up via ownerReferences")
+	e.allocations.forget(allocationKey(&request.Cluster, allocator.ControlPlaneRole))
+	allocator.ForgetShadow(request.Cluster.Namespace, request.Cluster.Name)
 	response.SetStatus(runtimehooksv1.ResponseStatusSuccess)
 }
 
@@ -282,154 +501,6 @@ func (e *VIPExtension) getVariableValue(cluster *clusterv1.Cluster, varName stri
 	return ""
 }
 
-func (e *VIPExtension) findPool(ctx context.Context, className, role string) (string, error) {
-	poolListGVK := schema.GroupVersionKind{Group: ipamGroup, Version: globalPoolAPIVersion, Kind: globalPoolKind + "List"}
-	pools := &unstructured.UnstructuredList{}
-	pools.SetGroupVersionKind(poolListGVK)
-
-	selector := client.MatchingLabels(map[string]string{
-		clusterClassLabel: className,
-		roleLabel:         role,
-	})
-
-	if err := e.Client.List(ctx, pools, selector); err != nil {
-		return "", fmt.Errorf("list %s: %w", globalPoolKind, err)
-	}
-
-	if len(pools.Items) == 0 {
-		return "", nil
-	}
-
-	return pools.Items[0].GetName(), nil
-}
-
-func (e *VIPExtension) preallocateIP(ctx context.Context, cluster *clusterv1.Cluster, claimName, poolName string) (string, error) {
-	log := e.Logger.WithValues("cluster", cluster.Name, "namespace", cluster.Namespace, "claim", claimName, "pool", poolName)
-
-	// Check if claim already exists
-	claimGVK := schema.GroupVersionKind{Group: ipamGroup, Version: ipamVersion, Kind: ipAddressClaimKind}
-	claim := &unstructured.Unstructured{}
-	claim.SetGroupVersionKind(claimGVK)
-
-	namespacedName := types.NamespacedName{Name: claimName, Namespace: cluster.Namespace}
-
-	// Try to get existing claim
-	err := e.Client.Get(ctx, namespacedName, claim)
-	if err == nil {
-		// Claim exists, check if IP is ready
-		log.Info("IPAddressClaim already exists, checking for allocated IP")
-		return e.waitForIPAllocation(ctx, cluster.Namespace, namespacedName, claim)
-	}
-
-	if !errors.IsNotFound(err) {
-		// Unexpected error
-		log.Error(err, "failed to get IPAddressClaim")
-		return "", fmt.Errorf("get IPAddressClaim: %w", err)
-	}
-
-	// Create new claim (without ownerReference - Cluster doesn't exist in etcd yet!)
-	log.Info("IPAddressClaim not found, creating new one")
-	claim.SetName(claimName)
-	claim.SetNamespace(cluster.Namespace)
-	claim.SetLabels(map[string]string{
-		roleLabel: controlPlaneRole,
-		// Add cluster name for later adoption by reconciler
-		"cluster.x-k8s.io/cluster-name": cluster.Name,
-	})
-
-	if err := unstructured.SetNestedField(claim.Object, map[string]interface{}{
-		"apiGroup": ipamGroup,
-		"kind":     globalPoolKind,
-		"name":     poolName,
-	}, "spec", "poolRef"); err != nil {
-		return "", fmt.Errorf("set poolRef: %w", err)
-	}
-
-	if err := e.Client.Create(ctx, claim); err != nil {
-		if errors.IsAlreadyExists(err) {
-			// Race condition: another reconciler created it
-			log.Info("IPAddressClaim was created by another process, fetching it")
-			return e.waitForIPAllocation(ctx, cluster.Namespace, namespacedName, nil)
-		}
-		log.Error(err, "failed to create IPAddressClaim")
-		return "", fmt.Errorf("create IPAddressClaim: %w", err)
-	}
-
-	log.Info("IPAddressClaim created successfully, waiting for IP allocation")
-	// Wait for IP to be allocated with retry
-	return e.waitForIPAllocation(ctx, cluster.Namespace, namespacedName, nil)
-}
-
-// waitForIPAllocation waits for IP to be allocated to the claim with retry logic.
-func (e *VIPExtension) waitForIPAllocation(ctx context.Context, namespace string, namespacedName types.NamespacedName, existingClaim *unstructured.Unstructured) (string, error) {
-	log := e.Logger.WithValues("claim", namespacedName.Name, "namespace", namespace)
-
-	claimGVK := schema.GroupVersionKind{Group: ipamGroup, Version: ipamVersion, Kind: ipAddressClaimKind}
-
-	var allocatedIP string
-	err := wait.PollUntilContextTimeout(ctx, ipAllocationInterval, ipAllocationTimeout, true, func(ctx context.Context) (bool, error) {
-		claim := existingClaim
-		if claim == nil {
-			claim = &unstructured.Unstructured{}
-			claim.SetGroupVersionKind(claimGVK)
-			if err := e.Client.Get(ctx, namespacedName, claim); err != nil {
-				if errors.IsNotFound(err) {
-					log.V(1).Info("IPAddressClaim not found yet, retrying")
-					return false, nil // Retry
-				}
-				return false, err // Permanent error
-			}
-		}
-
-		// Try to get IP from claim
-		ip, err := e.getIPFromClaim(ctx, namespace, claim)
-		if err != nil {
-			log.V(1).Info("IP not ready yet, retrying", "error", err.Error())
-			// Reset claim for next iteration to force refresh
-			existingClaim = nil
-			return false, nil // Retry
-		}
-
-		allocatedIP = ip
-		log.Info("IP successfully allocated", "ip", allocatedIP)
-		return true, nil // Success
-	})
-
-	if err != nil {
-		if wait.Interrupted(err) {
-			return "", fmt.Errorf("timeout waiting for IP allocation after %v", ipAllocationTimeout)
-		}
-		return "", fmt.Errorf("error waiting for IP allocation: %w", err)
-	}
-
-	return allocatedIP, nil
-}
-
-func (e *VIPExtension) getIPFromClaim(ctx context.Context, namespace string, claim *unstructured.Unstructured) (string, error) {
-	addressName, found, err := unstructured.NestedString(claim.Object, "status", "addressRef", "name")
-	if err != nil {
-		return "", fmt.Errorf("read claim status: %w", err)
-	}
-	if !found || addressName == "" {
-		return "", fmt.Errorf("IP not allocated yet (claim is pending)")
-	}
-
-	ipGVK := schema.GroupVersionKind{Group: ipamGroup, Version: ipamVersion, Kind: ipAddressKind}
-	ipAddr := &unstructured.Unstructured{}
-	ipAddr.SetGroupVersionKind(ipGVK)
-
-	if err := e.Client.Get(ctx, types.NamespacedName{Name: addressName, Namespace: namespace}, ipAddr); err != nil {
-		return "", fmt.Errorf("get IPAddress: %w", err)
-	}
-
-	address, found, err := unstructured.NestedString(ipAddr.Object, "spec", "address")
-	if err != nil || !found || address == "" {
-		return "", fmt.Errorf("IP address not found in IPAddress resource")
-	}
-
-	return address, nil
-}
-
 func (e *VIPExtension) addClusterPatch(response *runtimehooksv1.GeneratePatchesResponse, itemUID types.UID, path string, value interface{}) {
 	patch := runtimehooksv1.GeneratePatchesResponseItem{
 		UID:       itemUID,
@@ -515,139 +586,3 @@ func (e *VIPExtension) addGenericPatch(response *runtimehooksv1.GeneratePatchesR
 	}
 	response.Items = append(response.Items, patch)
 }
-
-// isInfrastructureCluster checks if the TypeMeta represents an InfrastructureCluster.
-// Infrastructure clusters are typically in groups like "infrastructure.cluster.x-k8s.io"
-// and have kind names ending with "Cluster" (e.g., ProxmoxCluster, AWSCluster).
-func isInfrastructureCluster(typeMeta metav1.TypeMeta) bool {
-	// Check if APIVersion contains "infrastructure" and Kind ends with "Cluster"
-	if len(typeMeta.APIVersion) == 0 || len(typeMeta.Kind) < 7 {
-		return false
-	}
-
-	// Parse APIVersion to get group
-	gv, err := schema.ParseGroupVersion(typeMeta.APIVersion)
-	if err != nil {
-		return false
-	}
-
-	// Check if group contains "infrastructure" and kind ends with "Cluster"
-	return (gv.Group == "infrastructure.cluster.x-k8s.io" ||
-		len(gv.Group) > 14 && gv.Group[:14] == "infrastructure") &&
-		len(typeMeta.Kind) >= 7 && typeMeta.Kind[len(typeMeta.Kind)-7:] == "Cluster"
-}
-
-// extractClusterName extracts the cluster name from an InfrastructureCluster name.
-// By convention, InfrastructureCluster names match the Cluster name or follow
-// predictable patterns like "<clustername>-<suffix>".
-func extractClusterName(infraClusterName string) string {
-	// In most cases, the InfrastructureCluster name equals the Cluster name
-	// or is a prefix. CAPI topology controller ensures this naming convention.
-	// For now, we simply return the name as-is, assuming it matches.
-	// More sophisticated matching could be added if needed.
-	return infraClusterName
-}
-
-// ensureIPAddressClaimForBeforeCreate creates or retrieves an existing IPAddressClaim for BeforeClusterCreate hook.
-// NOTE: Cannot set ownerReference because Cluster doesn't exist in etcd yet.
-// The controller will adopt this claim later by setting ownerReference.
-func (e *VIPExtension) ensureIPAddressClaimForBeforeCreate(ctx context.Context, cluster *clusterv1.Cluster, claimName, poolName string) (*unstructured.Unstructured, error) {
-	log := e.Logger.WithValues("cluster", cluster.Name, "namespace", cluster.Namespace, "claim", claimName, "pool", poolName)
-
-	claimGVK := schema.GroupVersionKind{Group: ipamGroup, Version: ipamVersion, Kind: ipAddressClaimKind}
-	claim := &unstructured.Unstructured{}
-	claim.SetGroupVersionKind(claimGVK)
-
-	namespacedName := types.NamespacedName{Name: claimName, Namespace: cluster.Namespace}
-
-	// Try to get existing claim
-	err := e.Client.Get(ctx, namespacedName, claim)
-	if err == nil {
-		// Claim already exists
-		log.Info("IPAddressClaim already exists, will use it")
-		return claim, nil
-	}
-
-	if !errors.IsNotFound(err) {
-		// Unexpected error
-		log.Error(err, "failed to get IPAddressClaim")
-		return nil, fmt.Errorf("get IPAddressClaim: %w", err)
-	}
-
-	// Create new claim
-	log.Info("IPAddressClaim not found, creating new one")
-	claim.SetName(claimName)
-	claim.SetNamespace(cluster.Namespace)
-	claim.SetLabels(map[string]string{
-		roleLabel: controlPlaneRole,
-		// Add cluster name label for later adoption by controller
-		"cluster.x-k8s.io/cluster-name": cluster.Name,
-	})
-
-	// Set poolRef
-	if err := unstructured.SetNestedField(claim.Object, map[string]interface{}{
-		"apiGroup": ipamGroup,
-		"kind":     globalPoolKind,
-		"name":     poolName,
-	}, "spec", "poolRef"); err != nil {
-		return nil, fmt.Errorf("set poolRef: %w", err)
-	}
-
-	if err := e.Client.Create(ctx, claim); err != nil {
-		if errors.IsAlreadyExists(err) {
-			// Race condition: another process created it
-			log.Info("IPAddressClaim was created by another process, fetching it")
-			if err := e.Client.Get(ctx, namespacedName, claim); err != nil {
-				return nil, fmt.Errorf("fetch existing IPAddressClaim: %w", err)
-			}
-			return claim, nil
-		}
-		log.Error(err, "failed to create IPAddressClaim")
-		return nil, fmt.Errorf("create IPAddressClaim: %w", err)
-	}
-
-	log.Info("IPAddressClaim created successfully")
-	return claim, nil
-}
-
-// waitForVIPInBeforeCreate waits for VIP allocation with longer timeout for BeforeClusterCreate hook.
-func (e *VIPExtension) waitForVIPInBeforeCreate(ctx context.Context, namespace string, claim *unstructured.Unstructured) (string, error) {
-	log := e.Logger.WithValues("claim", claim.GetName(), "namespace", namespace)
-
-	claimGVK := schema.GroupVersionKind{Group: ipamGroup, Version: ipamVersion, Kind: ipAddressClaimKind}
-	namespacedName := types.NamespacedName{Name: claim.GetName(), Namespace: namespace}
-
-	var allocatedIP string
-	err := wait.PollUntilContextTimeout(ctx, beforeCreateIPInterval, beforeCreateIPTimeout, true, func(ctx context.Context) (bool, error) {
-		// Refresh claim
-		freshClaim := &unstructured.Unstructured{}
-		freshClaim.SetGroupVersionKind(claimGVK)
-		if err := e.Client.Get(ctx, namespacedName, freshClaim); err != nil {
-			if errors.IsNotFound(err) {
-				log.V(1).Info("IPAddressClaim not found yet, retrying")
-				return false, nil // Retry
-			}
-			return false, err // Permanent error
-		}
-
-		// Try to get IP from claim
-		ip, err := e.getIPFromClaim(ctx, namespace, freshClaim)
-		if err != nil {
-			log.V(1).Info("IP not ready yet, retrying", "error", err.Error())
-			return false, nil // Retry
-		}
-
-		allocatedIP = ip
-		log.Info("IP successfully allocated", "ip", allocatedIP)
-		return true, nil // Success
-	})
-
-	if err != nil {
-		if wait.Interrupted(err) {
-			return "", fmt.Errorf("timeout waiting for IP allocation after %v: %w", beforeCreateIPTimeout, err)
-		}
-		return "", fmt.Errorf("error waiting for IP allocation: %w", err)
-	}
-
-	return allocatedIP, nil
-}
@@ -0,0 +1,295 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	runtimehooksv1 "sigs.k8s.io/cluster-api/exp/runtime/hooks/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGeneratePatchesDoesNotWaitForPendingClaim(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     PendingPolicy
+		wantStatus runtimehooksv1.ResponseStatus
+	}{
+		{name: "retry", policy: PendingPolicyRetry, wantStatus: runtimehooksv1.ResponseStatusFailure},
+		{name: "skip", policy: PendingPolicySkip, wantStatus: runtimehooksv1.ResponseStatusSuccess},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClient(t, newPool())
+			extension := NewVIPExtension(c, testr.New(t), Options{PendingPolicy: tt.policy})
+
+			response := &runtimehooksv1.GeneratePatchesResponse{}
+			extension.GeneratePatches(context.Background(), newPatchesRequest(t, newCluster()), response)
+
+			if response.GetStatus() != tt.wantStatus {
+				t.Fatalf("expected status %s, got %s (%s)", tt.wantStatus, response.GetStatus(), response.GetMessage())
+			}
+			if len(response.Items) != 0 {
+				t.Fatalf("expected no patches while pending, got %d", len(response.Items))
+			}
+			if tt.policy == PendingPolicyRetry && !strings.Contains(response.GetMessage(), "pending") {
+				t.Fatalf("expected pending message, got %q", response.GetMessage())
+			}
+
+			claim := &unstructured.Unstructured{}
+			claim.SetGroupVersionKind(allocator.ClaimGVK())
+			if err := c.Get(context.Background(), types.NamespacedName{Name: "vip-cp-hooked", Namespace: "default"}, claim); err != nil {
+				t.Fatalf("expected claim to be created: %v", err)
+			}
+			if claim.GetAnnotations()[allocator.RequestedAtAnnotation()] == "" {
+				t.Fatalf("expected %s annotation on claim", allocator.RequestedAtAnnotation())
+			}
+		})
+	}
+}
+
+func TestGeneratePatchesUsesAddressRecordedOnClaim(t *testing.T) {
+	claim, address := newReadyClaim(t, "10.5.0.9")
+
+	c := newFakeClient(t, newPool(), claim, address)
+	extension := NewVIPExtension(c, testr.New(t), Options{PendingPolicy: PendingPolicyRetry})
+	ctx := context.Background()
+
+	response := &runtimehooksv1.GeneratePatchesResponse{}
+	extension.GeneratePatches(ctx, newPatchesRequest(t, newCluster()), response)
+	if response.GetStatus() != runtimehooksv1.ResponseStatusSuccess || len(response.Items) != 1 {
+		t.Fatalf("expected one patch, got status %s with %d items (%s)", response.GetStatus(), len(response.Items), response.GetMessage())
+	}
+	if !strings.Contains(string(response.Items[0].Patch), "10.5.0.9") {
+		t.Fatalf("expected patch with VIP, got %s", response.Items[0].Patch)
+	}
+
+	// Without the in-memory cache, later calls answer from the claim annotation without reading the IPAddress
+	extension.allocations.forget(allocationKey(newCluster(), allocator.ControlPlaneRole))
+	if err := c.Delete(ctx, address); err != nil {
+		t.Fatalf("delete address: %v", err)
+	}
+	response = &runtimehooksv1.GeneratePatchesResponse{}
+	extension.GeneratePatches(ctx, newPatchesRequest(t, newCluster()), response)
+	if response.GetStatus() != runtimehooksv1.ResponseStatusSuccess || len(response.Items) != 1 {
+		t.Fatalf("expected patch from claim annotation, got status %s with %d items (%s)", response.GetStatus(), len(response.Items), response.GetMessage())
+	}
+}
+
+func TestGeneratePatchesAllocatesForTemplatesWithoutClusterItem(t *testing.T) {
+	claim, address := newReadyClaim(t, "10.5.0.9")
+	cluster := newCluster()
+	c := newFakeClient(t, newPool(), cluster, claim, address)
+	extension := NewVIPExtension(c, testr.New(t), Options{PatchProfiles: []PatchProfile{PatchProfileRKE2}})
+
+	// CAPI sends the templates the Cluster references, identified by holder field paths and the builtin variable
+	request := &runtimehooksv1.GeneratePatchesRequest{
+		Variables: []runtimehooksv1.Variable{{
+			Name:  builtinVariable,
+			Value: apiextensionsv1.JSON{Raw: []byte(`{"cluster":{"name":"hooked","namespace":"default","topology":{"class":"prod"}}}`)},
+		}},
+		Items: []runtimehooksv1.GeneratePatchesRequestItem{
+			newInfrastructureItem(t, "infra", runtimehooksv1.HolderReference{APIVersion: clusterv1.GroupVersion.String(), Kind: "Cluster", FieldPath: infrastructureRefPath}),
+			newControlPlaneItem(t, "cp-template", map[string]interface{}{
+				"apiVersion": "controlplane.cluster.x-k8s.io/v1beta1",
+				"kind":       "RKE2ControlPlaneTemplate",
+				"metadata":   map[string]interface{}{"name": "hooked"},
+				"spec":       map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{}}},
+			}),
+		},
+	}
+
+	response := &runtimehooksv1.GeneratePatchesResponse{}
+	extension.GeneratePatches(context.Background(), request, response)
+	if response.GetStatus() != runtimehooksv1.ResponseStatusSuccess {
+		t.Fatalf("expected success, got %s (%s)", response.GetStatus(), response.GetMessage())
+	}
+	if ops := patchOpsFor(t, response, "infra"); len(ops) != 1 || ops[0]["path"] != "/spec/template/spec/controlPlaneEndpoint" || !strings.Contains(string(mustMarshalJSON(ops)), `"host":"10.5.0.9"`) {
+		t.Fatalf("expected the VIP patched into the infrastructure template, got %v", ops)
+	}
+	if ops := patchOpsFor(t, response, "cp-template"); !strings.Contains(string(mustMarshalJSON(ops)), "10.5.0.9") {
+		t.Fatalf("expected the VIP patched into the control plane template, got %v", ops)
+	}
+	if len(response.Items) != 2 {
+		t.Fatalf("expected patches for the two templates only, got %d", len(response.Items))
+	}
+}
+
+func TestGeneratePatchesDoesNotServeCachedAddressToRecreatedCluster(t *testing.T) {
+	claim, address := newReadyClaim(t, "10.5.0.9")
+	cluster := newCluster()
+	cluster.UID = "first"
+	c := newFakeClient(t, newPool(), cluster, claim, address)
+	// BeforeClusterDelete is not advertised, so nothing evicts the cached address
+	extension := NewVIPExtension(c, testr.New(t), Options{PendingPolicy: PendingPolicyRetry})
+	ctx := context.Background()
+	request := &runtimehooksv1.GeneratePatchesRequest{Items: []runtimehooksv1.GeneratePatchesRequestItem{
+		newInfrastructureItem(t, "infra", runtimehooksv1.HolderReference{Kind: "Cluster", Name: "hooked", Namespace: "default", FieldPath: infrastructureRefPath}),
+	}}
+
+	response := &runtimehooksv1.GeneratePatchesResponse{}
+	extension.GeneratePatches(ctx, request, response)
+	if response.GetStatus() != runtimehooksv1.ResponseStatusSuccess || len(response.Items) != 1 {
+		t.Fatalf("expected the VIP of the first Cluster, got status %s with %d items (%s)", response.GetStatus(), len(response.Items), response.GetMessage())
+	}
+
+	// The Cluster is deleted with its claim and recreated under the same name within the cache TTL
+	for _, obj := range []client.Object{cluster, claim, address} {
+		if err := c.Delete(ctx, obj); err != nil {
+			t.Fatalf("delete %s: %v", obj.GetName(), err)
+		}
+	}
+	recreated := newCluster()
+	recreated.UID = "second"
+	if err := c.Create(ctx, recreated); err != nil {
+		t.Fatalf("recreate cluster: %v", err)
+	}
+
+	response = &runtimehooksv1.GeneratePatchesResponse{}
+	extension.GeneratePatches(ctx, request, response)
+	if response.GetStatus() != runtimehooksv1.ResponseStatusFailure || !strings.Contains(response.GetMessage(), "pending") || len(response.Items) != 0 {
+		t.Fatalf("expected the recreated Cluster to wait for a new claim, got status %s with %d items (%s)", response.GetStatus(), len(response.Items), response.GetMessage())
+	}
+}
+
+func TestGeneratePatchesControlPlanePort(t *testing.T) {
+	tests := []struct {
+		name        string
+		clusterPort int32
+		resolved    int32
+		wantPort    string
+	}{
+		{name: "existing cluster port is kept", clusterPort: 8443, resolved: 9345, wantPort: `"port":8443`},
+		{name: "resolver port", resolved: 9345, wantPort: `"port":9345`},
+		{name: "default port", wantPort: `"port":7443`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claim, address := newReadyClaim(t, "10.5.0.9")
+			extension := NewVIPExtension(newFakeClient(t, newPool(), claim, address), testr.New(t), Options{
+				DefaultPort: 7443,
+				PortResolver: func(context.Context, *clusterv1.Cluster) (int32, error) {
+					return tt.resolved, nil
+				},
+			})
+
+			cluster := newCluster()
+			cluster.Spec.ControlPlaneEndpoint.Port = tt.clusterPort
+
+			response := &runtimehooksv1.GeneratePatchesResponse{}
+			extension.GeneratePatches(context.Background(), newPatchesRequest(t, cluster), response)
+			if response.GetStatus() != runtimehooksv1.ResponseStatusSuccess || len(response.Items) != 1 {
+				t.Fatalf("expected one patch, got status %s with %d items (%s)", response.GetStatus(), len(response.Items), response.GetMessage())
+			}
+			if !strings.Contains(string(response.Items[0].Patch), tt.wantPort) {
+				t.Fatalf("expected %s in patch, got %s", tt.wantPort, response.Items[0].Patch)
+			}
+		})
+	}
+}
+
+func TestGeneratePatchesShadowMode(t *testing.T) {
+	c := newFakeClient(t, newPool())
+	extension := NewVIPExtension(c, testr.New(t), Options{Shadow: true})
+
+	response := &runtimehooksv1.GeneratePatchesResponse{}
+	extension.GeneratePatches(context.Background(), newPatchesRequest(t, newCluster()), response)
+	if response.GetStatus() != runtimehooksv1.ResponseStatusSuccess {
+		t.Fatalf("expected success, got %s (%s)", response.GetStatus(), response.GetMessage())
+	}
+	if len(response.Items) != 0 {
+		t.Fatalf("expected no patches in shadow mode, got %d", len(response.Items))
+	}
+	claim := &unstructured.Unstructured{}
+	claim.SetGroupVersionKind(allocator.ClaimGVK())
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "vip-cp-hooked", Namespace: "default"}, claim); err == nil {
+		t.Fatalf("expected no IPAddressClaim in shadow mode")
+	}
+
+	// A Cluster opted in by annotation keeps the endpoint it already has on its infrastructure
+	cluster := newCluster()
+	cluster.Annotations = map[string]string{allocator.ShadowAnnotation(): "true"}
+	cluster.Spec.ControlPlaneEndpoint = clusterv1.APIEndpoint{Host: "10.5.0.1", Port: 6443}
+	request := newPatchesRequest(t, cluster)
+	request.Items = append(request.Items, newInfrastructureItem(t, "infra", runtimehooksv1.HolderReference{Kind: "Cluster", Name: "hooked", Namespace: "default", FieldPath: infrastructureRefPath}))
+
+	response = &runtimehooksv1.GeneratePatchesResponse{}
+	NewVIPExtension(c, testr.New(t), Options{}).GeneratePatches(context.Background(), request, response)
+	if len(response.Items) != 1 || response.Items[0].UID != "infra" {
+		t.Fatalf("expected only the existing endpoint to be patched into the infrastructure, got %+v", response.Items)
+	}
+}
+
+// newReadyClaim returns the control-plane claim of the "hooked" cluster and the IPAddress it resolves to.
+func newReadyClaim(t *testing.T, ip string) (*unstructured.Unstructured, *unstructured.Unstructured) {
+	t.Helper()
+	claim := &unstructured.Unstructured{}
+	claim.SetGroupVersionKind(allocator.ClaimGVK())
+	claim.SetName("vip-cp-hooked")
+	claim.SetNamespace("default")
+	claim.SetLabels(map[string]string{allocator.RoleLabel(): allocator.ControlPlaneRole})
+	if err := unstructured.SetNestedField(claim.Object, "hooked-ip", "status", "addressRef", "name"); err != nil {
+		t.Fatalf("set addressRef: %v", err)
+	}
+	address := &unstructured.Unstructured{}
+	address.SetGroupVersionKind(allocator.AddressGVK())
+	address.SetName("hooked-ip")
+	address.SetNamespace("default")
+	if err := unstructured.SetNestedField(address.Object, ip, "spec", "address"); err != nil {
+		t.Fatalf("set address: %v", err)
+	}
+	return claim, address
+}
+
+func newFakeClient(t *testing.T, objects ...runtime.Object) client.Client {
+	t.Helper()
+	return fake.NewClientBuilder().WithScheme(fixtures.NewScheme(t)).WithRuntimeObjects(objects...).Build()
+}
+
+func newPool() *unstructured.Unstructured {
+	pool := &unstructured.Unstructured{}
+	pool.SetGroupVersionKind(allocator.PoolGVK())
+	pool.SetName("pool-cp")
+	pool.SetLabels(map[string]string{
+		allocator.ClusterClassLabel(): "prod",
+		allocator.RoleLabel():         allocator.ControlPlaneRole,
+	})
+	return pool
+}
+
+func newCluster() *clusterv1.Cluster {
+	return &clusterv1.Cluster{
+		TypeMeta:   metav1.TypeMeta{APIVersion: clusterv1.GroupVersion.String(), Kind: "Cluster"},
+		ObjectMeta: metav1.ObjectMeta{Name: "hooked", Namespace: "default"},
+		Spec: clusterv1.ClusterSpec{
+			Topology: &clusterv1.Topology{Class: "prod"},
+		},
+	}
+}
+
+func newPatchesRequest(t *testing.T, cluster *clusterv1.Cluster) *runtimehooksv1.GeneratePatchesRequest {
+	t.Helper()
+	raw, err := json.Marshal(cluster)
+	if err != nil {
+		t.Fatalf("marshal cluster: %v", err)
+	}
+	return &runtimehooksv1.GeneratePatchesRequest{
+		Items: []runtimehooksv1.GeneratePatchesRequestItem{{
+			UID:    types.UID("cluster-item"),
+			Object: runtime.RawExtension{Raw: raw},
+		}},
+	}
+}
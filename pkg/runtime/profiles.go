@@ -0,0 +1,205 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	runtimehooksv1 "sigs.k8s.io/cluster-api/exp/runtime/hooks/api/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// PatchProfile names a built-in set of ControlPlane patches applied by GeneratePatches.
+type PatchProfile string
+
+const (
+	// PatchProfileRKE2 adds the VIPs to RKE2ControlPlane serverConfig.tlsSAN and sets registrationAddress.
+	PatchProfileRKE2 PatchProfile = "rke2"
+	// PatchProfileKubeadm adds the control-plane VIP to KubeadmControlPlane apiServer.certSANs.
+	PatchProfileKubeadm PatchProfile = "kubeadm"
+
+	controlPlaneGroup = "controlplane.cluster.x-k8s.io"
+)
+
+// controlPlanePatchProfile describes where a control-plane provider expects the VIP.
+// Paths are relative to the ControlPlane spec (or spec.template.spec for templates).
+type controlPlanePatchProfile struct {
+	kind             string
+	sansPath         []string
+	registrationPath []string
+	// includeIngressVIP also adds the Cluster's ingress VIP to the SANs
+	includeIngressVIP bool
+}
+
+var controlPlanePatchProfiles = map[PatchProfile]controlPlanePatchProfile{
+	PatchProfileRKE2: {
+		kind:              "RKE2ControlPlane",
+		sansPath:          []string{"serverConfig", "tlsSAN"},
+		registrationPath:  []string{"registrationAddress"},
+		includeIngressVIP: true,
+	},
+	PatchProfileKubeadm: {
+		kind:     "KubeadmControlPlane",
+		sansPath: []string{"kubeadmConfigSpec", "clusterConfiguration", "apiServer", "certSANs"},
+	},
+}
+
+// ParsePatchProfiles validates the values of the --runtime-extension-patch-profiles flag.
+func ParsePatchProfiles(values []string) ([]PatchProfile, error) {
+	var profiles []PatchProfile
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		profile := PatchProfile(value)
+		if _, ok := controlPlanePatchProfiles[profile]; !ok {
+			return nil, fmt.Errorf("invalid patch profile %q: must be %q or %q", value, PatchProfileRKE2, PatchProfileKubeadm)
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+// controlPlaneProfile returns the enabled profile matching a ControlPlane or ControlPlaneTemplate kind.
+func (e *VIPExtension) controlPlaneProfile(typeMeta metav1.TypeMeta) (controlPlanePatchProfile, bool) {
+	gv, err := schema.ParseGroupVersion(typeMeta.APIVersion)
+	if err != nil || gv.Group != controlPlaneGroup {
+		return controlPlanePatchProfile{}, false
+	}
+	for _, name := range e.PatchProfiles {
+		profile := controlPlanePatchProfiles[name]
+		if typeMeta.Kind == profile.kind || typeMeta.Kind == profile.kind+"Template" {
+			return profile, true
+		}
+	}
+	return controlPlanePatchProfile{}, false
+}
+
+// addControlPlanePatches patches ControlPlane items of clusters with an allocated VIP according
+// to the enabled patch profiles. Existing SANs are kept and an explicit registration address wins.
+func (e *VIPExtension) addControlPlanePatches(log logr.Logger, items []correlatedItem, response *runtimehooksv1.GeneratePatchesResponse, allocatedIPs, ingressVIPs map[string]string) {
+	if len(e.PatchProfiles) == 0 {
+		return
+	}
+
+	for _, target := range items {
+		if target.role != roleControlPlane {
+			continue
+		}
+		typeMeta, obj := target.typeMeta, target.object
+		profile, ok := e.controlPlaneProfile(typeMeta)
+		if !ok {
+			continue
+		}
+
+		ip, exists := allocatedIPs[target.cluster]
+		if !exists {
+			log.Info("no VIP allocated for this cluster yet, skipping ControlPlane patch", "controlPlane", obj.GetName(), "cluster", target.cluster)
+			continue
+		}
+
+		specPath := []string{"spec"}
+		if strings.HasSuffix(typeMeta.Kind, "Template") {
+			specPath = []string{"spec", "template", "spec"}
+		}
+
+		sans := []string{ip}
+		if ingressIP := ingressVIPs[target.cluster]; profile.includeIngressVIP && ingressIP != "" && ingressIP != ip {
+			sans = append(sans, ingressIP)
+		}
+
+		var ops []map[string]interface{}
+		sansPath := append(append([]string{}, specPath...), profile.sansPath...)
+		existing, _, err := unstructured.NestedStringSlice(obj.Object, sansPath...)
+		if err != nil {
+			log.Info("SAN field is not a string list, skipping ControlPlane patch", "controlPlane", obj.GetName(), "path", strings.Join(sansPath, "."))
+			continue
+		}
+		if merged, changed := mergeSANs(existing, sans); changed {
+			ops = append(ops, setFieldOps(obj.Object, sansPath, toInterfaceSlice(merged))...)
+		}
+
+		if profile.registrationPath != nil {
+			registrationPath := append(append([]string{}, specPath...), profile.registrationPath...)
+			if current, _, _ := unstructured.NestedString(obj.Object, registrationPath...); current == "" {
+				ops = append(ops, setFieldOps(obj.Object, registrationPath, ip)...)
+			}
+		}
+
+		if len(ops) == 0 {
+			continue
+		}
+
+		response.Items = append(response.Items, runtimehooksv1.GeneratePatchesResponseItem{
+			UID:       target.item.UID,
+			PatchType: runtimehooksv1.JSONPatchType,
+			Patch:     mustMarshalJSON(ops),
+		})
+		log.Info("added patch for ControlPlane", "kind", typeMeta.Kind, "controlPlane", obj.GetName(), "cluster", target.cluster, "sans", sans)
+	}
+}
+
+// mergeSANs appends the missing addresses to existing, reporting whether anything was added.
+func mergeSANs(existing, addresses []string) ([]string, bool) {
+	merged := append([]string{}, existing...)
+	changed := false
+	for _, address := range addresses {
+		found := false
+		for _, san := range merged {
+			if san == address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, address)
+			changed = true
+		}
+	}
+	return merged, changed
+}
+
+// setFieldOps returns the JSON patch that sets path to value, creating missing parent objects.
+// The value is also set on obj so later operations on the same object see it.
+func setFieldOps(obj map[string]interface{}, path []string, value interface{}) []map[string]interface{} {
+	// Find the first segment that does not exist yet and add everything below it in one operation
+	current := obj
+	for i, segment := range path[:len(path)-1] {
+		next, ok := current[segment]
+		if !ok {
+			nested := value
+			for j := len(path) - 1; j > i; j-- {
+				nested = map[string]interface{}{path[j]: nested}
+			}
+			current[segment] = nested
+			return []map[string]interface{}{{"op": "add", "path": jsonPointer(path[:i+1]), "value": nested}}
+		}
+		nextMap, ok := next.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = nextMap
+	}
+	current[path[len(path)-1]] = value
+	return []map[string]interface{}{{"op": "add", "path": jsonPointer(path), "value": value}}
+}
+
+func jsonPointer(path []string) string {
+	escaped := make([]string, 0, len(path))
+	for _, segment := range path {
+		escaped = append(escaped, strings.ReplaceAll(strings.ReplaceAll(segment, "~", "~0"), "/", "~1"))
+	}
+	return "/" + strings.Join(escaped, "/")
+}
+
+func toInterfaceSlice(values []string) []interface{} {
+	result := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		result = append(result, value)
+	}
+	return result
+}
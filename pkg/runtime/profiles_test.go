@@ -0,0 +1,149 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	runtimehooksv1 "sigs.k8s.io/cluster-api/exp/runtime/hooks/api/v1alpha1"
+)
+
+func TestGeneratePatchesAppliesRKE2Profile(t *testing.T) {
+	cluster := newCluster()
+	cluster.Spec.ControlPlaneEndpoint.Host = "10.5.0.1"
+	cluster.Annotations = map[string]string{allocator.IngressVIPAnnotation(): "10.5.0.2"}
+
+	request := newPatchesRequest(t, cluster)
+	request.Items = append(request.Items, newControlPlaneItem(t, "cp-template", map[string]interface{}{
+		"apiVersion": "controlplane.cluster.x-k8s.io/v1beta1",
+		"kind":       "RKE2ControlPlaneTemplate",
+		"metadata":   map[string]interface{}{"name": "hooked"},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"serverConfig": map[string]interface{}{"tlsSAN": []interface{}{"api.example.com", "10.5.0.1"}},
+				},
+			},
+		},
+	}))
+
+	extension := NewVIPExtension(newFakeClient(t), testr.New(t), Options{PendingPolicy: PendingPolicyRetry, PatchProfiles: []PatchProfile{PatchProfileRKE2}})
+
+	response := &runtimehooksv1.GeneratePatchesResponse{}
+	extension.GeneratePatches(context.Background(), request, response)
+	if response.GetStatus() != runtimehooksv1.ResponseStatusSuccess {
+		t.Fatalf("expected success, got %s (%s)", response.GetStatus(), response.GetMessage())
+	}
+
+	ops := patchOpsFor(t, response, "cp-template")
+	want := []map[string]interface{}{
+		{"op": "add", "path": "/spec/template/spec/serverConfig/tlsSAN", "value": []interface{}{"api.example.com", "10.5.0.1", "10.5.0.2"}},
+		{"op": "add", "path": "/spec/template/spec/registrationAddress", "value": "10.5.0.1"},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Fatalf("unexpected patch:\n got %v\nwant %v", ops, want)
+	}
+}
+
+func TestGeneratePatchesAppliesKubeadmProfileToMissingFields(t *testing.T) {
+	cluster := newCluster()
+	cluster.Spec.ControlPlaneEndpoint.Host = "10.5.0.1"
+	cluster.Annotations = map[string]string{allocator.IngressVIPAnnotation(): "10.5.0.2"}
+
+	request := newPatchesRequest(t, cluster)
+	request.Items = append(request.Items, newControlPlaneItem(t, "kcp", map[string]interface{}{
+		"apiVersion": "controlplane.cluster.x-k8s.io/v1beta1",
+		"kind":       "KubeadmControlPlane",
+		"metadata":   map[string]interface{}{"name": "hooked"},
+		"spec": map[string]interface{}{
+			"kubeadmConfigSpec": map[string]interface{}{},
+		},
+	}))
+
+	extension := NewVIPExtension(newFakeClient(t), testr.New(t), Options{PendingPolicy: PendingPolicyRetry, PatchProfiles: []PatchProfile{PatchProfileKubeadm}})
+
+	response := &runtimehooksv1.GeneratePatchesResponse{}
+	extension.GeneratePatches(context.Background(), request, response)
+
+	ops := patchOpsFor(t, response, "kcp")
+	want := []map[string]interface{}{{
+		"op":   "add",
+		"path": "/spec/kubeadmConfigSpec/clusterConfiguration",
+		"value": map[string]interface{}{
+			"apiServer": map[string]interface{}{"certSANs": []interface{}{"10.5.0.1"}},
+		},
+	}}
+	if !reflect.DeepEqual(ops, want) {
+		t.Fatalf("unexpected patch:\n got %v\nwant %v", ops, want)
+	}
+}
+
+func TestGeneratePatchesSkipsControlPlaneWithoutProfile(t *testing.T) {
+	cluster := newCluster()
+	cluster.Spec.ControlPlaneEndpoint.Host = "10.5.0.1"
+
+	request := newPatchesRequest(t, cluster)
+	request.Items = append(request.Items, newControlPlaneItem(t, "kcp", map[string]interface{}{
+		"apiVersion": "controlplane.cluster.x-k8s.io/v1beta1",
+		"kind":       "KubeadmControlPlane",
+		"metadata":   map[string]interface{}{"name": "hooked"},
+		"spec":       map[string]interface{}{},
+	}))
+
+	extension := NewVIPExtension(newFakeClient(t), testr.New(t), Options{PendingPolicy: PendingPolicyRetry, PatchProfiles: []PatchProfile{PatchProfileRKE2}})
+
+	response := &runtimehooksv1.GeneratePatchesResponse{}
+	extension.GeneratePatches(context.Background(), request, response)
+	for _, item := range response.Items {
+		if item.UID == "kcp" {
+			t.Fatalf("expected no patch for KubeadmControlPlane with only the rke2 profile, got %s", item.Patch)
+		}
+	}
+}
+
+func TestParsePatchProfiles(t *testing.T) {
+	profiles, err := ParsePatchProfiles([]string{"rke2", " kubeadm", ""})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(profiles, []PatchProfile{PatchProfileRKE2, PatchProfileKubeadm}) {
+		t.Fatalf("unexpected profiles %v", profiles)
+	}
+	if _, err := ParsePatchProfiles([]string{"k3s"}); err == nil {
+		t.Fatal("expected error for unknown profile")
+	}
+}
+
+func newControlPlaneItem(t *testing.T, uid string, object map[string]interface{}) runtimehooksv1.GeneratePatchesRequestItem {
+	t.Helper()
+	raw, err := json.Marshal(object)
+	if err != nil {
+		t.Fatalf("marshal control plane: %v", err)
+	}
+	return runtimehooksv1.GeneratePatchesRequestItem{
+		UID:             types.UID(uid),
+		HolderReference: runtimehooksv1.HolderReference{Kind: "Cluster", Name: "hooked", Namespace: "default", FieldPath: controlPlaneRefPath},
+		Object:          runtime.RawExtension{Raw: raw},
+	}
+}
+
+func patchOpsFor(t *testing.T, response *runtimehooksv1.GeneratePatchesResponse, uid string) []map[string]interface{} {
+	t.Helper()
+	for _, item := range response.Items {
+		if item.UID != types.UID(uid) {
+			continue
+		}
+		var ops []map[string]interface{}
+		if err := json.Unmarshal(item.Patch, &ops); err != nil {
+			t.Fatalf("unmarshal patch: %v", err)
+		}
+		return ops
+	}
+	t.Fatalf("no patch for item %s", uid)
+	return nil
+}
@@ -2,64 +2,86 @@ package runtime
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/gorizond/capi-vip-allocator/pkg/metrics"
 	runtimehooksv1 "sigs.k8s.io/cluster-api/exp/runtime/hooks/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// maxRequestBodyBytes bounds hook request bodies; GeneratePatches requests carry every template
+// of a topology and stay well below this.
+const maxRequestBodyBytes = 10 << 20
+
 // Server wraps the Runtime Extension HTTP server.
 type Server struct {
 	extension *VIPExtension
 	logger    logr.Logger
 	port      int
 	certDir   string
+	hooks     map[Hook]HookSettings
+	// clientCAFile, when set, requires callers to present a certificate signed by this CA bundle
+	clientCAFile string
+
+	// mu guards the listener state reported by ReadyzCheck
+	mu         sync.RWMutex
+	listenAddr string
+	watcher    *certwatcher.CertWatcher
 }
 
 // NewServer creates a new Runtime Extension server.
-func NewServer(client client.Client, logger logr.Logger, port int, certDir string, extensionName string) *Server {
+func NewServer(client client.Client, logger logr.Logger, port int, certDir string, opts Options) *Server {
+	hooks := opts.Hooks
+	if len(hooks) == 0 {
+		hooks = DefaultHookSettings()
+	}
 	return &Server{
-		extension: NewVIPExtension(client, logger, extensionName),
-		logger:    logger,
-		port:      port,
-		certDir:   certDir,
+		extension:    NewVIPExtension(client, logger, opts),
+		logger:       logger,
+		port:         port,
+		certDir:      certDir,
+		hooks:        hooks,
+		clientCAFile: opts.ClientCAFile,
 	}
 }
 
 // Start starts the runtime extension HTTP server.
 // Implements manager.Runnable interface.
 func (s *Server) Start(ctx context.Context) error {
-	mux := http.NewServeMux()
-
-	// Register handlers for each hook with full paths including handler names
-	// CAPI Runtime SDK appends handler name to the hook path
-	// v0.4.0: GeneratePatches is the ONLY hook (allocates VIP + patches Cluster + patches InfraCluster)
-	//         BeforeClusterCreate removed (cannot modify Cluster - CAPI ignores request.Cluster changes)
-	handlerName := s.extension.Name()
-	mux.HandleFunc(fmt.Sprintf("/hooks.runtime.cluster.x-k8s.io/v1alpha1/generatepatches/%s-generate-patches", handlerName), s.handleGeneratePatches)
-	mux.HandleFunc(fmt.Sprintf("/hooks.runtime.cluster.x-k8s.io/v1alpha1/beforeclusterdelete/%s-before-delete", handlerName), s.handleBeforeClusterDelete)
-	mux.HandleFunc(fmt.Sprintf("/hooks.runtime.cluster.x-k8s.io/v1alpha1/afterclusterupgrade/%s-after-upgrade", handlerName), s.handleAfterClusterUpgrade)
-	mux.HandleFunc("/hooks.runtime.cluster.x-k8s.io/v1alpha1/discovery", s.handleDiscovery)
-
-	// Add root handler for health checks
-	mux.HandleFunc("/", s.handleRoot)
+	tlsConfig, watcher, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
 
-	s.logger.Info("registered runtime extension handlers (v0.4.0 - GeneratePatches only)",
-		"generatePatches", fmt.Sprintf("/hooks.runtime.cluster.x-k8s.io/v1alpha1/generatepatches/%s-generate-patches", handlerName),
-		"beforeDelete", fmt.Sprintf("/hooks.runtime.cluster.x-k8s.io/v1alpha1/beforeclusterdelete/%s-before-delete", handlerName),
-		"afterUpgrade", fmt.Sprintf("/hooks.runtime.cluster.x-k8s.io/v1alpha1/afterclusterupgrade/%s-after-upgrade", handlerName))
+	// Reload the serving certificate when cert-manager rotates it
+	go func() {
+		if err := watcher.Start(ctx); err != nil {
+			s.logger.Error(err, "runtime extension certificate watcher failed")
+		}
+	}()
 
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.port),
-		Handler: s.loggingMiddleware(mux),
+		Addr:      fmt.Sprintf(":%d", s.port),
+		Handler:   s.handler(),
+		TLSConfig: tlsConfig,
 	}
 
-	s.logger.Info("starting runtime extension server", "port", s.port, "certDir", s.certDir)
+	s.logger.Info("starting runtime extension server", "port", s.port, "certDir", s.certDir, "clientCAFile", s.clientCAFile)
 
 	// Shutdown server when context is done
 	go func() {
@@ -72,150 +94,249 @@ func (s *Server) Start(ctx context.Context) error {
 		}
 	}()
 
-	// Start server with TLS (blocking)
-	certFile := s.certDir + "/tls.crt"
-	keyFile := s.certDir + "/tls.key"
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("runtime extension server listen: %w", err)
+	}
+	s.setListening(listener.Addr().String(), watcher)
+	defer s.setListening("", nil)
 
-	if err := server.ListenAndServeTLS(certFile, keyFile); err != nil && err != http.ErrServerClosed {
+	// Start server with TLS (blocking); certificates come from the watcher via TLSConfig
+	if err := server.ServeTLS(listener, "", ""); err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("runtime extension server error: %w", err)
 	}
 
 	return nil
 }
 
-// NeedLeaderElection returns false as the runtime extension server doesn't need leader election.
-func (s *Server) NeedLeaderElection() bool {
-	return false
+func (s *Server) setListening(addr string, watcher *certwatcher.CertWatcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listenAddr = addr
+	s.watcher = watcher
 }
 
-func (s *Server) handleGeneratePatches(w http.ResponseWriter, r *http.Request) {
-	s.logger.Info("GeneratePatches hook called")
+// ReadyzCheck reports whether the TLS listener is running, has a serving certificate and
+// accepts connections. Register it with the manager's readyz endpoint.
+func (s *Server) ReadyzCheck(_ *http.Request) error {
+	s.mu.RLock()
+	addr, watcher := s.listenAddr, s.watcher
+	s.mu.RUnlock()
 
-	body, err := io.ReadAll(r.Body)
+	if addr == "" {
+		return errors.New("runtime extension listener is not running")
+	}
+	if cert, _ := watcher.GetCertificate(nil); cert == nil {
+		return fmt.Errorf("runtime extension has no serving certificate loaded from %s", s.certDir)
+	}
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
 	if err != nil {
-		s.handleError(w, "failed to read request body", err)
-		return
+		return fmt.Errorf("runtime extension listener %s is not accepting connections: %w", addr, err)
 	}
-	defer r.Body.Close()
+	return conn.Close()
+}
 
-	request := &runtimehooksv1.GeneratePatchesRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		s.handleError(w, "failed to unmarshal request", err)
-		return
+// handler returns the hook handlers wrapped in the logging and metrics middleware.
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	// Register handlers for each advertised hook with full paths including handler names
+	// CAPI Runtime SDK appends handler name to the hook path
+	// GeneratePatches allocates the VIP and patches Cluster, InfraCluster and ControlPlane objects
+	handlers := map[Hook]http.HandlerFunc{
+		HookGeneratePatches:     s.handleGeneratePatches,
+		HookValidateTopology:    s.handleValidateTopology,
+		HookBeforeClusterDelete: s.handleBeforeClusterDelete,
+		HookAfterClusterUpgrade: s.handleAfterClusterUpgrade,
+	}
+	paths := make([]interface{}, 0, 2*len(s.hooks))
+	for _, hook := range s.advertisedHooks() {
+		mux.HandleFunc(s.handlerPath(hook), postOnly(handlers[hook]))
+		paths = append(paths, string(hook), s.handlerPath(hook))
 	}
+	mux.HandleFunc("/hooks.runtime.cluster.x-k8s.io/v1alpha1/discovery", postOnly(s.handleDiscovery))
 
-	s.logger.Info("GeneratePatches request decoded", "itemsCount", len(request.Items))
+	// Add root handler for health checks
+	mux.HandleFunc("/", s.handleRoot)
 
-	response := &runtimehooksv1.GeneratePatchesResponse{}
-	s.extension.GeneratePatches(r.Context(), request, response)
+	s.logger.Info("registered runtime extension handlers", paths...)
 
-	s.logger.Info("GeneratePatches response prepared", "status", response.GetStatus(), "patchesCount", len(response.Items))
-	s.writeResponse(w, response)
+	return s.loggingMiddleware(mux)
 }
 
-// handleBeforeClusterCreate - REMOVED in v0.4.0
-// BeforeClusterCreate hook cannot modify Cluster object, removed completely
-
-func (s *Server) handleBeforeClusterDelete(w http.ResponseWriter, r *http.Request) {
-	s.logger.Info("BeforeClusterDelete hook called")
-
-	body, err := io.ReadAll(r.Body)
+// tlsConfig loads the serving certificate from certDir through a watcher that reloads it on change
+// and, if clientCAFile is set, requires client certificates signed by that CA bundle.
+func (s *Server) tlsConfig() (*tls.Config, *certwatcher.CertWatcher, error) {
+	watcher, err := certwatcher.New(filepath.Join(s.certDir, "tls.crt"), filepath.Join(s.certDir, "tls.key"))
 	if err != nil {
-		s.handleError(w, "failed to read request body", err)
-		return
+		return nil, nil, fmt.Errorf("load runtime extension certificate: %w", err)
 	}
-	defer r.Body.Close()
 
-	request := &runtimehooksv1.BeforeClusterDeleteRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		s.handleError(w, "failed to unmarshal request", err)
-		return
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: watcher.GetCertificate,
 	}
 
-	clusterKey := fmt.Sprintf("%s/%s", request.Cluster.Namespace, request.Cluster.Name)
-	s.logger.Info("BeforeClusterDelete request decoded", "cluster", clusterKey)
+	if s.clientCAFile != "" {
+		caBundle, err := os.ReadFile(s.clientCAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read client CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBundle) {
+			return nil, nil, fmt.Errorf("client CA bundle %s contains no PEM certificates", s.clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
 
-	response := &runtimehooksv1.BeforeClusterDeleteResponse{}
-	s.extension.BeforeClusterDelete(r.Context(), request, response)
+	return config, watcher, nil
+}
 
-	s.logger.Info("BeforeClusterDelete response prepared", "cluster", clusterKey, "status", response.GetStatus())
-	s.writeResponse(w, response)
+// NeedLeaderElection returns false as the runtime extension server doesn't need leader election.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+func (s *Server) handleGeneratePatches(w http.ResponseWriter, r *http.Request) {
+	request := &runtimehooksv1.GeneratePatchesRequest{}
+	s.serveHook(w, r, HookGeneratePatches, request, func() runtimehooksv1.ResponseObject {
+		return &runtimehooksv1.GeneratePatchesResponse{}
+	}, func(ctx context.Context, obj runtimehooksv1.ResponseObject) {
+		response := obj.(*runtimehooksv1.GeneratePatchesResponse)
+		s.logger.Info("GeneratePatches request decoded", "itemsCount", len(request.Items))
+		s.extension.GeneratePatches(ctx, request, response)
+		metrics.VipHookPatchesPerResponse.Observe(float64(len(response.Items)))
+		s.logger.Info("GeneratePatches response prepared", "status", response.GetStatus(), "patchesCount", len(response.Items))
+	})
+}
+
+func (s *Server) handleValidateTopology(w http.ResponseWriter, r *http.Request) {
+	request := &runtimehooksv1.ValidateTopologyRequest{}
+	s.serveHook(w, r, HookValidateTopology, request, func() runtimehooksv1.ResponseObject {
+		return &runtimehooksv1.ValidateTopologyResponse{}
+	}, func(ctx context.Context, obj runtimehooksv1.ResponseObject) {
+		response := obj.(*runtimehooksv1.ValidateTopologyResponse)
+		s.logger.Info("ValidateTopology request decoded", "itemsCount", len(request.Items))
+		s.extension.ValidateTopology(ctx, request, response)
+		s.logger.Info("ValidateTopology response prepared", "status", response.GetStatus())
+	})
+}
+
+// handleBeforeClusterCreate - REMOVED in v0.4.0
+// BeforeClusterCreate hook cannot modify Cluster object, removed completely
+
+func (s *Server) handleBeforeClusterDelete(w http.ResponseWriter, r *http.Request) {
+	request := &runtimehooksv1.BeforeClusterDeleteRequest{}
+	s.serveHook(w, r, HookBeforeClusterDelete, request, func() runtimehooksv1.ResponseObject {
+		return &runtimehooksv1.BeforeClusterDeleteResponse{}
+	}, func(ctx context.Context, obj runtimehooksv1.ResponseObject) {
+		response := obj.(*runtimehooksv1.BeforeClusterDeleteResponse)
+		clusterKey := fmt.Sprintf("%s/%s", request.Cluster.Namespace, request.Cluster.Name)
+		s.logger.Info("BeforeClusterDelete request decoded", "cluster", clusterKey)
+		s.extension.BeforeClusterDelete(ctx, request, response)
+		s.logger.Info("BeforeClusterDelete response prepared", "cluster", clusterKey, "status", response.GetStatus())
+	})
 }
 
 func (s *Server) handleAfterClusterUpgrade(w http.ResponseWriter, r *http.Request) {
-	s.logger.Info("AfterClusterUpgrade hook called")
+	request := &runtimehooksv1.AfterClusterUpgradeRequest{}
+	s.serveHook(w, r, HookAfterClusterUpgrade, request, func() runtimehooksv1.ResponseObject {
+		return &runtimehooksv1.AfterClusterUpgradeResponse{}
+	}, func(ctx context.Context, obj runtimehooksv1.ResponseObject) {
+		response := obj.(*runtimehooksv1.AfterClusterUpgradeResponse)
+		clusterKey := fmt.Sprintf("%s/%s", request.Cluster.Namespace, request.Cluster.Name)
+		s.logger.Info("AfterClusterUpgrade request decoded", "cluster", clusterKey)
+		s.extension.AfterClusterUpgrade(ctx, request, response)
+		s.logger.Info("AfterClusterUpgrade response prepared", "cluster", clusterKey, "status", response.GetStatus())
+	})
+}
 
-	body, err := io.ReadAll(r.Body)
+// serveHook decodes a bounded request body into request, runs handle on a fresh response and
+// writes it. Oversized or undecodable requests and panics in handle are answered with a Failure
+// response of the hook's type, so the CAPI controller reports the message instead of an HTTP error.
+func (s *Server) serveHook(w http.ResponseWriter, r *http.Request, hook Hook, request interface{}, newResponse func() runtimehooksv1.ResponseObject, handle func(context.Context, runtimehooksv1.ResponseObject)) {
+	s.logger.Info(string(hook) + " hook called")
+
+	fail := func(message string) {
+		response := newResponse()
+		response.SetStatus(runtimehooksv1.ResponseStatusFailure)
+		response.SetMessage(message)
+		s.writeResponse(w, response)
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			s.logger.Error(fmt.Errorf("%v", recovered), "hook handler panicked", "hook", hook, "stack", string(debug.Stack()))
+			fail(fmt.Sprintf("%s hook failed unexpectedly: %v", hook, recovered))
+		}
+	}()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	defer r.Body.Close()
 	if err != nil {
-		s.handleError(w, "failed to read request body", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.logger.Info("rejecting oversized hook request", "hook", hook, "limitBytes", tooLarge.Limit)
+			fail(fmt.Sprintf("%s request body exceeds %d bytes", hook, tooLarge.Limit))
+			return
+		}
+		s.logger.Error(err, "failed to read request body", "hook", hook)
+		fail(fmt.Sprintf("failed to read %s request body: %v", hook, err))
 		return
 	}
-	defer r.Body.Close()
 
-	request := &runtimehooksv1.AfterClusterUpgradeRequest{}
 	if err := json.Unmarshal(body, request); err != nil {
-		s.handleError(w, "failed to unmarshal request", err)
+		s.logger.Error(err, "failed to unmarshal request", "hook", hook)
+		fail(fmt.Sprintf("failed to decode %s request: %v", hook, err))
 		return
 	}
 
-	clusterKey := fmt.Sprintf("%s/%s", request.Cluster.Namespace, request.Cluster.Name)
-	s.logger.Info("AfterClusterUpgrade request decoded", "cluster", clusterKey)
-
-	response := &runtimehooksv1.AfterClusterUpgradeResponse{}
-	s.extension.AfterClusterUpgrade(r.Context(), request, response)
-
-	s.logger.Info("AfterClusterUpgrade response prepared", "cluster", clusterKey, "status", response.GetStatus())
+	response := newResponse()
+	handle(r.Context(), response)
 	s.writeResponse(w, response)
 }
 
+// postOnly rejects every method but POST, the only one the Runtime SDK uses.
+func postOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+			return
+		}
+		next(w, r)
+	}
+}
+
 func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
 	s.logger.Info("Discovery hook called")
 
-	failPolicyFail := runtimehooksv1.FailurePolicyFail
-	failPolicyIgnore := runtimehooksv1.FailurePolicyIgnore
-
 	response := &runtimehooksv1.DiscoveryResponse{}
 	response.SetStatus(runtimehooksv1.ResponseStatusSuccess)
-	// v0.4.0: GeneratePatches is the ONLY hook for VIP allocation (BeforeClusterCreate removed)
-	response.Handlers = []runtimehooksv1.ExtensionHandler{
-		{
-			Name: s.extension.Name() + "-generate-patches",
+	for _, hook := range s.advertisedHooks() {
+		settings := s.hooks[hook]
+		failurePolicy := settings.FailurePolicy
+		response.Handlers = append(response.Handlers, runtimehooksv1.ExtensionHandler{
+			Name: s.handlerName(hook),
 			RequestHook: runtimehooksv1.GroupVersionHook{
 				APIVersion: runtimehooksv1.GroupVersion.String(),
-				Hook:       "GeneratePatches",
+				Hook:       string(hook),
 			},
-			TimeoutSeconds: ptrInt32(30), // Increased to 30s for VIP allocation + patching
-			FailurePolicy:  &failPolicyFail,
-		},
-		{
-			Name: s.extension.Name() + "-before-delete",
-			RequestHook: runtimehooksv1.GroupVersionHook{
-				APIVersion: runtimehooksv1.GroupVersion.String(),
-				Hook:       "BeforeClusterDelete",
-			},
-			TimeoutSeconds: ptrInt32(10),
-			FailurePolicy:  &failPolicyIgnore,
-		},
-		{
-			Name: s.extension.Name() + "-after-upgrade",
-			RequestHook: runtimehooksv1.GroupVersionHook{
-				APIVersion: runtimehooksv1.GroupVersion.String(),
-				Hook:       "AfterClusterUpgrade",
-			},
-			TimeoutSeconds: ptrInt32(10),
-			FailurePolicy:  &failPolicyIgnore,
-		},
+			TimeoutSeconds: ptrInt32(settings.TimeoutSeconds),
+			FailurePolicy:  &failurePolicy,
+		})
 	}
 
 	s.writeResponse(w, response)
 }
 
-func (s *Server) handleError(w http.ResponseWriter, message string, err error) {
-	s.logger.Error(err, message)
-	http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusBadRequest)
-}
-
 func (s *Server) writeResponse(w http.ResponseWriter, response interface{}) {
+	if wrapped, ok := w.(*responseWriterWrapper); ok {
+		if hookResponse, ok := response.(runtimehooksv1.ResponseObject); ok {
+			wrapped.hookStatus = string(hookResponse.GetStatus())
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		s.logger.Error(err, "failed to encode response")
@@ -227,10 +348,13 @@ func ptrInt32(i int32) *int32 {
 	return &i
 }
 
-// loggingMiddleware logs all incoming HTTP requests.
+// loggingMiddleware logs all incoming HTTP requests and records per-hook metrics.
 func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		hook := s.hookLabel(r.URL.Path)
+		metrics.VipHookInFlight.WithLabelValues(hook).Inc()
+		defer metrics.VipHookInFlight.WithLabelValues(hook).Dec()
 
 		s.logger.Info("runtime-extension: incoming HTTP request",
 			"method", r.Method,
@@ -244,6 +368,14 @@ func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(wrapped, r)
 
 		duration := time.Since(start)
+		hookStatus := wrapped.hookStatus
+		if hookStatus == "" {
+			// No hook response was written, e.g. the request could not be decoded
+			hookStatus = "none"
+		}
+		metrics.VipHookRequestsTotal.WithLabelValues(hook, hookStatus, strconv.Itoa(wrapped.statusCode)).Inc()
+		metrics.VipHookDurationSeconds.WithLabelValues(hook).Observe(duration.Seconds())
+
 		s.logger.Info("runtime-extension: HTTP request completed",
 			"method", r.Method,
 			"path", r.URL.Path,
@@ -252,10 +384,24 @@ func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// responseWriterWrapper wraps http.ResponseWriter to capture status code.
+// hookLabel returns the hook served at path for metric labels: a hook name, "Discovery" or "other".
+func (s *Server) hookLabel(path string) string {
+	if path == "/hooks.runtime.cluster.x-k8s.io/v1alpha1/discovery" {
+		return "Discovery"
+	}
+	for _, hook := range s.advertisedHooks() {
+		if path == s.handlerPath(hook) {
+			return string(hook)
+		}
+	}
+	return "other"
+}
+
+// responseWriterWrapper wraps http.ResponseWriter to capture status code and the hook response status.
 type responseWriterWrapper struct {
 	http.ResponseWriter
 	statusCode int
+	hookStatus string
 }
 
 func (w *responseWriterWrapper) WriteHeader(statusCode int) {
@@ -263,7 +409,7 @@ func (w *responseWriterWrapper) WriteHeader(statusCode int) {
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
-// handleRoot handles requests to the root path (for health checks).
+// handleRoot handles requests to the root path (for health checks) and reports the listener readiness.
 func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
 		s.logger.Info("runtime-extension: 404 not found", "path", r.URL.Path)
@@ -271,7 +417,17 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	status := map[string]string{"status": "ok", "service": "capi-vip-allocator-runtime-extension"}
+	code := http.StatusOK
+	if err := s.ReadyzCheck(r); err != nil {
+		status["status"] = "not ready"
+		status["reason"] = err.Error()
+		code = http.StatusServiceUnavailable
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status":"ok","service":"capi-vip-allocator-runtime-extension"}`)
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		s.logger.Error(err, "failed to encode status")
+	}
 }
@@ -0,0 +1,361 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	"github.com/gorizond/capi-vip-allocator/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	runtimehooksv1 "sigs.k8s.io/cluster-api/exp/runtime/hooks/api/v1alpha1"
+)
+
+func TestServerReloadsRotatedCertificate(t *testing.T) {
+	certDir := t.TempDir()
+	ca := newTestCA(t)
+	writeKeyPair(t, certDir, ca.issue(t, "first", 1))
+
+	server := NewServer(newFakeClient(t), testr.New(t), 9443, certDir, Options{})
+	config, watcher, err := server.tlsConfig()
+	if err != nil {
+		t.Fatalf("tls config: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = watcher.Start(ctx) }()
+
+	if serial := servingSerial(t, config); serial != 1 {
+		t.Fatalf("expected initial certificate, got serial %d", serial)
+	}
+
+	// The watch is registered asynchronously, so keep rotating until the change is observed
+	rotated := ca.issue(t, "second", 2)
+	deadline := time.Now().Add(10 * time.Second)
+	for servingSerial(t, config) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("rotated certificate was not picked up")
+		}
+		writeKeyPair(t, certDir, rotated)
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestServerRequiresClientCertificateSignedByCA(t *testing.T) {
+	certDir := t.TempDir()
+	ca := newTestCA(t)
+	writeKeyPair(t, certDir, ca.issue(t, "server", 1))
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, ca.certPEM, 0o600); err != nil {
+		t.Fatalf("write CA: %v", err)
+	}
+
+	server := NewServer(newFakeClient(t), testr.New(t), 9443, certDir, Options{ClientCAFile: caFile})
+	config, _, err := server.tlsConfig()
+	if err != nil {
+		t.Fatalf("tls config: %v", err)
+	}
+
+	httpServer := httptest.NewUnstartedServer(http.HandlerFunc(server.handleRoot))
+	httpServer.TLS = config
+	httpServer.StartTLS()
+	defer httpServer.Close()
+
+	get := func(certificates ...tls.Certificate) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec // only the client side of the handshake is under test
+			Certificates:       certificates,
+		}}}
+		response, err := client.Get(httpServer.URL + "/")
+		if err != nil {
+			return err
+		}
+		return response.Body.Close()
+	}
+
+	if err := get(); err == nil {
+		t.Fatal("expected request without client certificate to be rejected")
+	}
+	if err := get(newTestCA(t).issue(t, "stranger", 3).tlsCertificate(t)); err == nil {
+		t.Fatal("expected client certificate from another CA to be rejected")
+	}
+	if err := get(ca.issue(t, "capi-controller-manager", 4).tlsCertificate(t)); err != nil {
+		t.Fatalf("expected client certificate signed by the CA to be accepted: %v", err)
+	}
+}
+
+func TestServerReadyzCheckFollowsListener(t *testing.T) {
+	certDir := t.TempDir()
+	writeKeyPair(t, certDir, newTestCA(t).issue(t, "server", 1))
+
+	// Port 0 picks a free port; ReadyzCheck dials the address actually bound
+	server := NewServer(newFakeClient(t), testr.New(t), 0, certDir, Options{})
+	if err := server.ReadyzCheck(nil); err == nil {
+		t.Fatal("expected not-ready before the server started")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- server.Start(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.ReadyzCheck(nil) != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not become ready: %v", server.ReadyzCheck(nil))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("server stopped with error: %v", err)
+	}
+	if err := server.ReadyzCheck(nil); err == nil {
+		t.Fatal("expected not-ready after the server stopped")
+	}
+}
+
+func TestServerStartFailsWithoutCertificate(t *testing.T) {
+	server := NewServer(newFakeClient(t), testr.New(t), 0, t.TempDir(), Options{})
+	if err := server.Start(context.Background()); err == nil {
+		t.Fatal("expected start to fail without tls.crt and tls.key")
+	}
+	if err := server.ReadyzCheck(nil); err == nil {
+		t.Fatal("expected not-ready when the server failed to start")
+	}
+}
+
+func TestServerRecordsHookMetrics(t *testing.T) {
+	claim, address := newReadyClaim(t, "10.5.0.9")
+	server := NewServer(newFakeClient(t, newPool(), claim, address), testr.New(t), 0, "", Options{})
+	handler := server.handler()
+	path := server.handlerPath(HookGeneratePatches)
+
+	success := testutil.ToFloat64(metrics.VipHookRequestsTotal.WithLabelValues("GeneratePatches", "Success", "200"))
+	failures := testutil.ToFloat64(metrics.VipHookRequestsTotal.WithLabelValues("GeneratePatches", "Failure", "200"))
+	patchesBefore := histogramSum(t, metrics.VipHookPatchesPerResponse)
+
+	body, err := json.Marshal(newPatchesRequest(t, newCluster()))
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, strings.NewReader("{")))
+
+	if got := testutil.ToFloat64(metrics.VipHookRequestsTotal.WithLabelValues("GeneratePatches", "Success", "200")); got != success+1 {
+		t.Fatalf("expected one successful GeneratePatches request, got %v", got-success)
+	}
+	if got := testutil.ToFloat64(metrics.VipHookRequestsTotal.WithLabelValues("GeneratePatches", "Failure", "200")); got != failures+1 {
+		t.Fatalf("expected one failed GeneratePatches request, got %v", got-failures)
+	}
+	if got := histogramSum(t, metrics.VipHookPatchesPerResponse) - patchesBefore; got != 1 {
+		t.Fatalf("expected one patch recorded, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.VipHookInFlight.WithLabelValues("GeneratePatches")); got != 0 {
+		t.Fatalf("expected no requests in flight, got %v", got)
+	}
+}
+
+func histogramSum(t *testing.T, histogram prometheus.Histogram) float64 {
+	t.Helper()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(histogram)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gather histogram: %v", err)
+	}
+	return families[0].GetMetric()[0].GetHistogram().GetSampleSum()
+}
+
+func TestServerHardening(t *testing.T) {
+	server := NewServer(newFakeClient(t, newPool()), testr.New(t), 0, "", Options{})
+	server.extension.Allocator = panickingAllocator{}
+	handler := server.handler()
+	path := server.handlerPath(HookGeneratePatches)
+
+	validBody, err := json.Marshal(newPatchesRequest(t, newCluster()))
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		body        string
+		wantCode    int
+		wantMessage string
+	}{
+		{name: "GET is not allowed", method: http.MethodGet, wantCode: http.StatusMethodNotAllowed},
+		{name: "undecodable body", method: http.MethodPost, body: "{", wantCode: http.StatusOK, wantMessage: "failed to decode GeneratePatches request"},
+		{name: "oversized body", method: http.MethodPost, body: `{"items":"` + strings.Repeat("x", maxRequestBodyBytes) + `"}`, wantCode: http.StatusOK, wantMessage: "request body exceeds"},
+		{name: "panic in handler", method: http.MethodPost, body: string(validBody), wantCode: http.StatusOK, wantMessage: "GeneratePatches hook failed unexpectedly: allocator exploded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(tt.method, path, strings.NewReader(tt.body)))
+			if recorder.Code != tt.wantCode {
+				t.Fatalf("expected HTTP %d, got %d: %s", tt.wantCode, recorder.Code, recorder.Body.String())
+			}
+			if tt.wantMessage == "" {
+				return
+			}
+
+			response := &runtimehooksv1.GeneratePatchesResponse{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+				t.Fatalf("expected a Runtime SDK response, got %q: %v", recorder.Body.String(), err)
+			}
+			if response.GetStatus() != runtimehooksv1.ResponseStatusFailure || !strings.Contains(response.GetMessage(), tt.wantMessage) {
+				t.Fatalf("expected Failure containing %q, got %s %q", tt.wantMessage, response.GetStatus(), response.GetMessage())
+			}
+		})
+	}
+}
+
+// panickingAllocator simulates a bug deep inside allocation.
+type panickingAllocator struct{}
+
+func (panickingAllocator) FindPool(context.Context, *clusterv1.Cluster, string) (string, error) {
+	panic("allocator exploded")
+}
+
+func (panickingAllocator) EnsureClaim(context.Context, *clusterv1.Cluster, string) (*unstructured.Unstructured, error) {
+	panic("allocator exploded")
+}
+
+func (panickingAllocator) ResolveAddress(context.Context, *unstructured.Unstructured) (string, bool, error) {
+	panic("allocator exploded")
+}
+
+func (panickingAllocator) Release(context.Context, *clusterv1.Cluster, string) error {
+	panic("allocator exploded")
+}
+
+func (panickingAllocator) Shadow(context.Context, *clusterv1.Cluster, string) (allocator.ShadowResult, error) {
+	panic("allocator exploded")
+}
+
+type testCA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+}
+
+type testKeyPair struct {
+	certPEM, keyPEM []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(100),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse CA: %v", err)
+	}
+	return &testCA{cert: cert, key: key, certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca *testCA) issue(t *testing.T, commonName string, serial int64) testKeyPair {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return testKeyPair{
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (p testKeyPair) tlsCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	cert, err := tls.X509KeyPair(p.certPEM, p.keyPEM)
+	if err != nil {
+		t.Fatalf("load key pair: %v", err)
+	}
+	return cert
+}
+
+func writeKeyPair(t *testing.T, dir string, pair testKeyPair) {
+	t.Helper()
+	// Write the key first so the watcher never pairs a new certificate with an old key
+	if err := os.WriteFile(filepath.Join(dir, "tls.key"), pair.keyPEM, 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tls.crt"), pair.certPEM, 0o600); err != nil {
+		t.Fatalf("write certificate: %v", err)
+	}
+}
+
+func servingSerial(t *testing.T, config *tls.Config) int64 {
+	t.Helper()
+	cert, err := config.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("get certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return leaf.SerialNumber.Int64()
+}
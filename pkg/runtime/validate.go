@@ -0,0 +1,171 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	runtimehooksv1 "sigs.k8s.io/cluster-api/exp/runtime/hooks/api/v1alpha1"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ValidateTopology rejects Clusters whose VIP can never be allocated before any patches are
+// generated: topology Clusters without an endpoint whose ClusterClass has no matching pool, and
+// Clusters whose manual endpoint is already allocated to another Cluster.
+//
+// CAPI only sends the templates of a topology as items, never the Cluster itself, so the Cluster
+// is identified by the builtin variables and holder references and read through the client.
+func (e *VIPExtension) ValidateTopology(ctx context.Context, request *runtimehooksv1.ValidateTopologyRequest, response *runtimehooksv1.ValidateTopologyResponse) {
+	log := e.Logger.WithName("ValidateTopology")
+
+	var violations []string
+	var owners map[string]string
+
+	for _, ref := range topologyClusters(request) {
+		key := allocator.ClusterKey(ref.namespace, ref.name)
+
+		cluster, err := e.topologyCluster(ctx, ref)
+		if err != nil {
+			log.Error(err, "failed to get Cluster", "cluster", key)
+			response.SetStatus(runtimehooksv1.ResponseStatusFailure)
+			response.SetMessage(fmt.Sprintf("failed to get cluster %s: %v", key, err))
+			return
+		}
+		if cluster.Spec.Topology == nil || cluster.Spec.Topology.Class == "" {
+			continue
+		}
+
+		selected, err := e.namespaceSelected(ctx, cluster.Namespace)
+		if err != nil {
+			log.Error(err, "failed to check namespace selector", "cluster", key)
+			response.SetStatus(runtimehooksv1.ResponseStatusFailure)
+			response.SetMessage(fmt.Sprintf("failed to check namespace selector for cluster %s: %v", key, err))
+			return
+		}
+		if !selected {
+			continue
+		}
+
+		host := cluster.Spec.ControlPlaneEndpoint.Host
+		if host == "" {
+			poolName, err := e.Allocator.FindPool(ctx, cluster, allocator.ControlPlaneRole)
+			if err != nil {
+				log.Error(err, "failed to find IP pool", "cluster", key)
+				response.SetStatus(runtimehooksv1.ResponseStatusFailure)
+				response.SetMessage(fmt.Sprintf("failed to find IP pool for cluster %s: %v", key, err))
+				return
+			}
+			if poolName == "" {
+				violations = append(violations, fmt.Sprintf("cluster %s: no IP pool for cluster class %q and role %s; label a GlobalInClusterIPPool with %s=%s and %s=%s or add a VIPAllocationPolicy",
+					key, cluster.Spec.Topology.Class, allocator.ControlPlaneRole,
+					allocator.ClusterClassLabel(), cluster.Spec.Topology.Class, allocator.RoleLabel(), allocator.ControlPlaneRole))
+			}
+			continue
+		}
+
+		if owners == nil {
+			var err error
+			if owners, err = allocator.AllocatedAddresses(ctx, e.Client); err != nil {
+				log.Error(err, "failed to list allocated VIPs")
+				response.SetStatus(runtimehooksv1.ResponseStatusFailure)
+				response.SetMessage(fmt.Sprintf("failed to list allocated VIPs: %v", err))
+				return
+			}
+		}
+		if owner, allocated := owners[host]; allocated && owner != key {
+			violations = append(violations, fmt.Sprintf("cluster %s: controlPlaneEndpoint.host %s is already allocated to cluster %s", key, host, owner))
+		}
+	}
+
+	if len(violations) > 0 {
+		log.Info("rejecting topology", "violations", violations)
+		response.SetStatus(runtimehooksv1.ResponseStatusFailure)
+		response.SetMessage(strings.Join(violations, "; "))
+		return
+	}
+
+	response.SetStatus(runtimehooksv1.ResponseStatusSuccess)
+}
+
+// topologyRef identifies a Cluster under validation and the ClusterClass from its builtin variable.
+type topologyRef struct {
+	name      string
+	namespace string
+	class     string
+}
+
+// topologyClusters returns the Clusters a ValidateTopology request is about, sorted by key.
+// They come from the request and item builtin variables and from Cluster holder references.
+func topologyClusters(request *runtimehooksv1.ValidateTopologyRequest) []topologyRef {
+	refs := map[string]topologyRef{}
+	add := func(name, namespace, class string) {
+		if name == "" || namespace == "" {
+			return
+		}
+		key := allocator.ClusterKey(namespace, name)
+		ref := refs[key]
+		refs[key] = topologyRef{name: name, namespace: namespace, class: firstNonEmpty(ref.class, class)}
+	}
+
+	requestBuiltin := builtinFromVariables(request.Variables)
+	add(requestBuiltin.Cluster.Name, requestBuiltin.Cluster.Namespace, requestBuiltin.Cluster.Topology.Class)
+
+	for _, item := range request.Items {
+		if item == nil {
+			continue
+		}
+		builtin := builtinFromVariables(item.Variables)
+		name := firstNonEmpty(builtin.Cluster.Name, requestBuiltin.Cluster.Name)
+		namespace := firstNonEmpty(builtin.Cluster.Namespace, requestBuiltin.Cluster.Namespace)
+		class := firstNonEmpty(builtin.Cluster.Topology.Class, requestBuiltin.Cluster.Topology.Class)
+
+		holder := item.HolderReference
+		if holder.Kind == "Cluster" && holder.Name != "" {
+			if holder.Name != name {
+				class = ""
+			}
+			name = holder.Name
+			namespace = firstNonEmpty(holder.Namespace, namespace)
+		}
+		add(name, namespace, class)
+	}
+
+	keys := make([]string, 0, len(refs))
+	for key := range refs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]topologyRef, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, refs[key])
+	}
+	return result
+}
+
+// topologyCluster reads the Cluster under validation. The ClusterClass in the builtin variable
+// wins over the stored one, since it is the topology being validated. A Cluster that does not
+// exist yet is being created and has no endpoint, so it is built from the builtin variable.
+func (e *VIPExtension) topologyCluster(ctx context.Context, ref topologyRef) (*clusterv1.Cluster, error) {
+	cluster := &clusterv1.Cluster{}
+	err := e.Client.Get(ctx, types.NamespacedName{Namespace: ref.namespace, Name: ref.name}, cluster)
+	switch {
+	case apierrors.IsNotFound(err):
+		cluster = &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: ref.name, Namespace: ref.namespace}}
+	case err != nil:
+		return nil, err
+	}
+
+	if ref.class != "" {
+		if cluster.Spec.Topology == nil {
+			cluster.Spec.Topology = &clusterv1.Topology{}
+		}
+		cluster.Spec.Topology.Class = ref.class
+	}
+	return cluster, nil
+}
@@ -0,0 +1,156 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	runtimehooksv1 "sigs.k8s.io/cluster-api/exp/runtime/hooks/api/v1alpha1"
+)
+
+func TestValidateTopology(t *testing.T) {
+	otherClaim := &unstructured.Unstructured{}
+	otherClaim.SetGroupVersionKind(allocator.ClaimGVK())
+	otherClaim.SetName("vip-cp-other")
+	otherClaim.SetNamespace("default")
+	otherClaim.SetLabels(map[string]string{allocator.RoleLabel(): allocator.ControlPlaneRole})
+	if err := unstructured.SetNestedField(otherClaim.Object, "other-ip", "status", "addressRef", "name"); err != nil {
+		t.Fatalf("set addressRef: %v", err)
+	}
+	otherAddress := &unstructured.Unstructured{}
+	otherAddress.SetGroupVersionKind(allocator.AddressGVK())
+	otherAddress.SetName("other-ip")
+	otherAddress.SetNamespace("default")
+	if err := unstructured.SetNestedField(otherAddress.Object, "10.5.0.20", "spec", "address"); err != nil {
+		t.Fatalf("set address: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		// class is the ClusterClass in the builtin variable
+		class string
+		// mutate changes the stored Cluster; nil means the Cluster is being created
+		mutate      func(*clusterv1.Cluster)
+		wantStatus  runtimehooksv1.ResponseStatus
+		wantMessage string
+	}{
+		{
+			name:       "pool matches class",
+			class:      "prod",
+			mutate:     func(*clusterv1.Cluster) {},
+			wantStatus: runtimehooksv1.ResponseStatusSuccess,
+		},
+		{
+			name:       "new cluster with pool for class",
+			class:      "prod",
+			wantStatus: runtimehooksv1.ResponseStatusSuccess,
+		},
+		{
+			name:        "new cluster without pool for class",
+			class:       "staging",
+			wantStatus:  runtimehooksv1.ResponseStatusFailure,
+			wantMessage: `cluster default/hooked: no IP pool for cluster class "staging"`,
+		},
+		{
+			name:        "class rebase without pool",
+			class:       "staging",
+			mutate:      func(*clusterv1.Cluster) {},
+			wantStatus:  runtimehooksv1.ResponseStatusFailure,
+			wantMessage: `no IP pool for cluster class "staging"`,
+		},
+		{
+			name:        "manual VIP allocated to another cluster",
+			class:       "prod",
+			mutate:      func(c *clusterv1.Cluster) { c.Spec.ControlPlaneEndpoint.Host = "10.5.0.20" },
+			wantStatus:  runtimehooksv1.ResponseStatusFailure,
+			wantMessage: "already allocated to cluster default/other",
+		},
+		{
+			name:       "manual VIP not allocated",
+			class:      "prod",
+			mutate:     func(c *clusterv1.Cluster) { c.Spec.ControlPlaneEndpoint.Host = "10.5.0.21" },
+			wantStatus: runtimehooksv1.ResponseStatusSuccess,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := []runtime.Object{newPool(), otherClaim.DeepCopy(), otherAddress.DeepCopy()}
+			if tt.mutate != nil {
+				cluster := newCluster()
+				tt.mutate(cluster)
+				objects = append(objects, cluster)
+			}
+			extension := NewVIPExtension(newFakeClient(t, objects...), testr.New(t), Options{})
+
+			request := &runtimehooksv1.ValidateTopologyRequest{
+				Variables: []runtimehooksv1.Variable{{
+					Name:  builtinVariable,
+					Value: apiextensionsv1.JSON{Raw: []byte(fmt.Sprintf(`{"cluster":{"name":"hooked","namespace":"default","topology":{"class":%q,"version":"v1.29.0"}}}`, tt.class))},
+				}},
+				Items: []*runtimehooksv1.ValidateTopologyRequestItem{
+					newValidateItem(t, "infrastructure.cluster.x-k8s.io/v1beta1", "ProxmoxClusterTemplate", infrastructureRefPath),
+					newValidateItem(t, "controlplane.cluster.x-k8s.io/v1beta1", "KubeadmControlPlaneTemplate", controlPlaneRefPath),
+				},
+			}
+
+			response := &runtimehooksv1.ValidateTopologyResponse{}
+			extension.ValidateTopology(context.Background(), request, response)
+
+			if response.GetStatus() != tt.wantStatus {
+				t.Fatalf("expected status %s, got %s (%s)", tt.wantStatus, response.GetStatus(), response.GetMessage())
+			}
+			if !strings.Contains(response.GetMessage(), tt.wantMessage) {
+				t.Fatalf("expected message to contain %q, got %q", tt.wantMessage, response.GetMessage())
+			}
+		})
+	}
+}
+
+func TestValidateTopologyIgnoresItemsWithoutCluster(t *testing.T) {
+	extension := NewVIPExtension(newFakeClient(t), testr.New(t), Options{})
+
+	request := &runtimehooksv1.ValidateTopologyRequest{
+		Items: []*runtimehooksv1.ValidateTopologyRequestItem{
+			newValidateItem(t, "infrastructure.cluster.x-k8s.io/v1beta1", "ProxmoxClusterTemplate", infrastructureRefPath),
+		},
+	}
+	request.Items[0].HolderReference.Name = ""
+
+	response := &runtimehooksv1.ValidateTopologyResponse{}
+	extension.ValidateTopology(context.Background(), request, response)
+	if response.GetStatus() != runtimehooksv1.ResponseStatusSuccess {
+		t.Fatalf("expected success, got %s (%s)", response.GetStatus(), response.GetMessage())
+	}
+}
+
+func newValidateItem(t *testing.T, apiVersion, kind, fieldPath string) *runtimehooksv1.ValidateTopologyRequestItem {
+	t.Helper()
+	raw, err := json.Marshal(map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"name": "hooked-" + strings.ToLower(kind), "namespace": "default"},
+		"spec":       map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{}}},
+	})
+	if err != nil {
+		t.Fatalf("marshal %s: %v", kind, err)
+	}
+	return &runtimehooksv1.ValidateTopologyRequestItem{
+		HolderReference: runtimehooksv1.HolderReference{
+			APIVersion: clusterv1.GroupVersion.String(),
+			Kind:       "Cluster",
+			Name:       "hooked",
+			Namespace:  "default",
+			FieldPath:  fieldPath,
+		},
+		Object: runtime.RawExtension{Raw: raw},
+	}
+}
@@ -0,0 +1,145 @@
+// Package webhook contains admission webhooks served by the manager.
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// ClusterValidator validates manually set control-plane endpoints on Cluster create and update.
+// It rejects hosts that are already allocated to another cluster, hosts outside AllowedCIDRs
+// (when configured) and changes of an existing VIP without the override annotation.
+type ClusterValidator struct {
+	Client       client.Client
+	Logger       logr.Logger
+	AllowedCIDRs []*net.IPNet
+}
+
+var _ admission.CustomValidator = &ClusterValidator{}
+
+// SetupWithManager registers the validating webhook for Clusters.
+func (v *ClusterValidator) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&clusterv1.Cluster{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ParseCIDRs parses a list of CIDRs as accepted by the --manual-vip-allowed-cidrs flag.
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	var cidrs []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("parse CIDR %q: %w", value, err)
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, nil
+}
+
+// ValidateCreate validates the control-plane endpoint of a new Cluster.
+func (v *ClusterValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	cluster, ok := obj.(*clusterv1.Cluster)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a Cluster but got a %T", obj))
+	}
+
+	return nil, v.validateHost(ctx, cluster)
+}
+
+// ValidateUpdate validates changes to the control-plane endpoint of an existing Cluster.
+func (v *ClusterValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldCluster, ok := oldObj.(*clusterv1.Cluster)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a Cluster but got a %T", oldObj))
+	}
+	newCluster, ok := newObj.(*clusterv1.Cluster)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a Cluster but got a %T", newObj))
+	}
+
+	oldHost := oldCluster.Spec.ControlPlaneEndpoint.Host
+	newHost := newCluster.Spec.ControlPlaneEndpoint.Host
+	if oldHost == newHost {
+		return nil, nil
+	}
+
+	if oldHost != "" && newCluster.Annotations[allocator.AllowVIPChangeAnnotation()] != "true" {
+		return nil, v.invalid(newCluster, newHost, fmt.Sprintf("changing the control plane VIP from %s requires the %s=\"true\" annotation", oldHost, allocator.AllowVIPChangeAnnotation()))
+	}
+
+	return nil, v.validateHost(ctx, newCluster)
+}
+
+// ValidateDelete allows every delete.
+func (v *ClusterValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateHost checks the cluster's control-plane host against allocated addresses and the allow-list.
+func (v *ClusterValidator) validateHost(ctx context.Context, cluster *clusterv1.Cluster) error {
+	host := cluster.Spec.ControlPlaneEndpoint.Host
+	if host == "" {
+		return nil
+	}
+
+	owners, err := allocator.AllocatedAddresses(ctx, v.Client)
+	if err != nil {
+		v.Logger.Error(err, "list allocated VIPs")
+		return apierrors.NewInternalError(fmt.Errorf("list allocated VIPs: %w", err))
+	}
+
+	if owner, allocated := owners[host]; allocated {
+		if owner == allocator.ClusterKey(cluster.Namespace, cluster.Name) {
+			// Address was allocated to this cluster by the allocator itself
+			return nil
+		}
+		return v.invalid(cluster, host, fmt.Sprintf("address is already allocated to cluster %s", owner))
+	}
+
+	if len(v.AllowedCIDRs) == 0 {
+		return nil
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return v.invalid(cluster, host, "manual control plane hosts must be IP addresses within the allowed CIDRs")
+	}
+	for _, cidr := range v.AllowedCIDRs {
+		if cidr.Contains(ip) {
+			return nil
+		}
+	}
+
+	allowed := make([]string, 0, len(v.AllowedCIDRs))
+	for _, cidr := range v.AllowedCIDRs {
+		allowed = append(allowed, cidr.String())
+	}
+	return v.invalid(cluster, host, fmt.Sprintf("address is outside the allowed CIDRs %s", strings.Join(allowed, ", ")))
+}
+
+func (v *ClusterValidator) invalid(cluster *clusterv1.Cluster, host, message string) error {
+	return apierrors.NewInvalid(
+		clusterv1.GroupVersion.WithKind("Cluster").GroupKind(),
+		cluster.Name,
+		field.ErrorList{field.Invalid(field.NewPath("spec", "controlPlaneEndpoint", "host"), host, message)},
+	)
+}
@@ -0,0 +1,131 @@
+package webhook
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestClusterValidator(t *testing.T) {
+	scheme := fixtures.NewScheme(t)
+
+	owner := newCluster("team-a", "owner", "")
+	claim := newClaim(owner, "vip-cp-owner", "owner-address")
+	address := fixtures.NewIPAddress("owner-address", "team-a", "10.0.0.15")
+
+	cidrs, err := ParseCIDRs([]string{"10.10.0.0/16", " 192.168.1.0/24 "})
+	if err != nil {
+		t.Fatalf("parse CIDRs: %v", err)
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(claim, address).Build()
+	validator := &ClusterValidator{Client: client, Logger: testr.New(t), AllowedCIDRs: cidrs}
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		old     *clusterv1.Cluster
+		new     *clusterv1.Cluster
+		wantErr string
+	}{
+		{
+			name: "no host",
+			new:  newCluster("team-b", "c1", ""),
+		},
+		{
+			name: "host within allowed CIDR",
+			new:  newCluster("team-b", "c1", "10.10.1.1"),
+		},
+		{
+			name:    "host allocated to another cluster",
+			new:     newCluster("team-b", "c1", "10.0.0.15"),
+			wantErr: "already allocated to cluster team-a/owner",
+		},
+		{
+			name: "host allocated to the same cluster skips allow-list",
+			new:  newCluster("team-a", "owner", "10.0.0.15"),
+		},
+		{
+			name:    "host outside allowed CIDRs",
+			new:     newCluster("team-b", "c1", "172.16.0.1"),
+			wantErr: "outside the allowed CIDRs",
+		},
+		{
+			name:    "hostname with allow-list",
+			new:     newCluster("team-b", "c1", "api.example.com"),
+			wantErr: "must be IP addresses",
+		},
+		{
+			name: "allocator sets VIP on update",
+			old:  newCluster("team-a", "owner", ""),
+			new:  newCluster("team-a", "owner", "10.0.0.15"),
+		},
+		{
+			name:    "changing VIP without override",
+			old:     newCluster("team-b", "c1", "10.10.1.1"),
+			new:     newCluster("team-b", "c1", "10.10.1.2"),
+			wantErr: allocator.AllowVIPChangeAnnotation(),
+		},
+		{
+			name: "changing VIP with override",
+			old:  newCluster("team-b", "c1", "10.10.1.1"),
+			new: func() *clusterv1.Cluster {
+				c := newCluster("team-b", "c1", "10.10.1.2")
+				c.Annotations = map[string]string{allocator.AllowVIPChangeAnnotation(): "true"}
+				return c
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.old == nil {
+				_, err = validator.ValidateCreate(ctx, tt.new)
+			} else {
+				_, err = validator.ValidateUpdate(ctx, tt.old, tt.new)
+			}
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func newCluster(namespace, name, host string) *clusterv1.Cluster {
+	return &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: clusterv1.ClusterSpec{
+			Topology:             &clusterv1.Topology{Class: "example"},
+			ControlPlaneEndpoint: clusterv1.APIEndpoint{Host: host},
+		},
+	}
+}
+
+func newClaim(cluster *clusterv1.Cluster, name, addressName string) *unstructured.Unstructured {
+	claim := &unstructured.Unstructured{}
+	claim.SetGroupVersionKind(allocator.ClaimGVK())
+	claim.SetName(name)
+	claim.SetNamespace(cluster.Namespace)
+	claim.SetLabels(map[string]string{allocator.RoleLabel(): "control-plane"})
+	claim.SetOwnerReferences([]metav1.OwnerReference{*metav1.NewControllerRef(cluster, clusterv1.GroupVersion.WithKind("Cluster"))})
+	if err := unstructured.SetNestedField(claim.Object, addressName, "status", "addressRef", "name"); err != nil {
+		panic(err)
+	}
+	return claim
+}
@@ -0,0 +1,229 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// PoolWebhookPath is the path the pool validating webhook is served on.
+	PoolWebhookPath = "/validate-ipam-cluster-x-k8s-io-v1alpha2-globalinclusterippool"
+)
+
+// validRoles are the roles FindPool allocates for.
+var validRoles = []string{allocator.ControlPlaneRole, allocator.IngressRole}
+
+// PoolValidator validates VIP labels, annotations and address ranges on GlobalInClusterIPPools.
+// Pools without VIP labels are ignored. With WarnOnly set, problems are returned as admission
+// warnings instead of rejecting the request.
+type PoolValidator struct {
+	Client   client.Client
+	Logger   logr.Logger
+	WarnOnly bool
+}
+
+var _ admission.Handler = &PoolValidator{}
+
+// SetupWithManager registers the pool validating webhook on the manager's webhook server.
+func (v *PoolValidator) SetupWithManager(mgr ctrl.Manager) {
+	mgr.GetWebhookServer().Register(PoolWebhookPath, &webhook.Admission{Handler: v})
+}
+
+// Handle validates a GlobalInClusterIPPool create or update.
+func (v *PoolValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+
+	pool := &unstructured.Unstructured{}
+	if err := json.Unmarshal(req.Object.Raw, &pool.Object); err != nil {
+		return admission.Errored(http.StatusBadRequest, fmt.Errorf("decode %s: %w", allocator.GlobalPoolKind, err))
+	}
+
+	if !isVIPPool(pool) {
+		return admission.Allowed("")
+	}
+
+	problems := validatePoolMetadata(pool)
+
+	overlaps, err := v.findOverlaps(ctx, pool)
+	if err != nil {
+		v.Logger.Error(err, "check pool overlaps", "pool", pool.GetName())
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	problems = append(problems, overlaps...)
+
+	warnings, err := v.missingClusterClasses(ctx, pool)
+	if err != nil {
+		// Missing-class detection is advisory only
+		v.Logger.Error(err, "check referenced ClusterClasses", "pool", pool.GetName())
+	}
+
+	if len(problems) == 0 {
+		return admission.Allowed("").WithWarnings(warnings...)
+	}
+
+	if v.WarnOnly {
+		v.Logger.Info("pool has VIP configuration problems (warn-only mode)", "pool", pool.GetName(), "problems", problems)
+		return admission.Allowed("").WithWarnings(append(problems, warnings...)...)
+	}
+
+	return admission.Denied(strings.Join(problems, "; ")).WithWarnings(warnings...)
+}
+
+// isVIPPool reports whether the pool carries any of the labels FindPool matches on.
+func isVIPPool(pool *unstructured.Unstructured) bool {
+	poolLabels := pool.GetLabels()
+	_, hasClass := poolLabels[allocator.ClusterClassLabel()]
+	_, hasRole := poolLabels[allocator.RoleLabel()]
+	return hasClass || hasRole
+}
+
+// validatePoolMetadata checks the label and annotation grammar expected by allocator.PoolMatches.
+func validatePoolMetadata(pool *unstructured.Unstructured) []string {
+	var problems []string
+	poolLabels := pool.GetLabels()
+	annotations := pool.GetAnnotations()
+
+	classLabel, hasClass := poolLabels[allocator.ClusterClassLabel()]
+	roleValue, hasRole := poolLabels[allocator.RoleLabel()]
+
+	switch {
+	case !hasClass:
+		problems = append(problems, fmt.Sprintf("label %s is required when %s is set", allocator.ClusterClassLabel(), allocator.RoleLabel()))
+	case classLabel == allocator.ClusterClassLabelTrueFlag:
+		classAnnotation, ok := annotations[allocator.ClusterClassAnnotation()]
+		if !ok || strings.TrimSpace(classAnnotation) == "" {
+			problems = append(problems, fmt.Sprintf("label %s=\"true\" requires a non-empty %s annotation listing ClusterClass names", allocator.ClusterClassLabel(), allocator.ClusterClassAnnotation()))
+		} else {
+			problems = append(problems, validateList("annotation "+allocator.ClusterClassAnnotation(), classAnnotation, validation.IsDNS1123Subdomain)...)
+		}
+	default:
+		problems = append(problems, validateList("label "+allocator.ClusterClassLabel(), classLabel, validation.IsDNS1123Subdomain)...)
+	}
+
+	if !hasRole {
+		problems = append(problems, fmt.Sprintf("label %s is required when %s is set", allocator.RoleLabel(), allocator.ClusterClassLabel()))
+	} else {
+		problems = append(problems, validateList("label "+allocator.RoleLabel(), roleValue, func(value string) []string {
+			for _, role := range validRoles {
+				if value == role {
+					return nil
+				}
+			}
+			return []string{fmt.Sprintf("must be one of %s", strings.Join(validRoles, ", "))}
+		})...)
+	}
+
+	if allowed, ok := annotations[allocator.AllowedNamespacesAnnotation()]; ok {
+		problems = append(problems, validateList("annotation "+allocator.AllowedNamespacesAnnotation(), allowed, validation.IsDNS1123Label)...)
+	}
+	if selector, ok := annotations[allocator.NamespaceSelectorAnnotation()]; ok {
+		if _, err := labels.Parse(selector); err != nil {
+			problems = append(problems, fmt.Sprintf("annotation %s: invalid label selector: %v", allocator.NamespaceSelectorAnnotation(), err))
+		}
+	}
+
+	return problems
+}
+
+// validateList validates each entry of a comma-separated list, rejecting empty entries.
+func validateList(field, value string, validate func(string) []string) []string {
+	var problems []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			problems = append(problems, fmt.Sprintf("%s: empty entry in %q", field, value))
+			continue
+		}
+		for _, msg := range validate(entry) {
+			problems = append(problems, fmt.Sprintf("%s: %q %s", field, entry, msg))
+		}
+	}
+	return problems
+}
+
+// findOverlaps reports address ranges of the pool that overlap other VIP pools.
+func (v *PoolValidator) findOverlaps(ctx context.Context, pool *unstructured.Unstructured) ([]string, error) {
+	addresses, _, _ := unstructured.NestedStringSlice(pool.Object, "spec", "addresses")
+	ranges, err := allocator.ParseAddressRanges(addresses)
+	if err != nil {
+		return []string{fmt.Sprintf("spec.addresses: %v", err)}, nil
+	}
+
+	pools := &unstructured.UnstructuredList{}
+	pools.SetGroupVersionKind(allocator.PoolGVK().GroupVersion().WithKind(allocator.GlobalPoolKind + "List"))
+	if err := v.Client.List(ctx, pools); err != nil {
+		return nil, fmt.Errorf("list %s: %w", allocator.GlobalPoolKind, err)
+	}
+
+	var problems []string
+	for i := range pools.Items {
+		other := &pools.Items[i]
+		if other.GetName() == pool.GetName() || !isVIPPool(other) {
+			continue
+		}
+
+		otherAddresses, _, _ := unstructured.NestedStringSlice(other.Object, "spec", "addresses")
+		otherRanges, err := allocator.ParseAddressRanges(otherAddresses)
+		if err != nil {
+			continue
+		}
+
+		for _, r := range ranges {
+			for _, o := range otherRanges {
+				if r.Overlaps(o) {
+					problems = append(problems, fmt.Sprintf("spec.addresses: %s overlaps %s of VIP pool %s", r.Source, o.Source, other.GetName()))
+				}
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// missingClusterClasses returns a warning for each referenced ClusterClass that exists in no namespace.
+func (v *PoolValidator) missingClusterClasses(ctx context.Context, pool *unstructured.Unstructured) ([]string, error) {
+	classValue := pool.GetLabels()[allocator.ClusterClassLabel()]
+	if classValue == allocator.ClusterClassLabelTrueFlag {
+		classValue = pool.GetAnnotations()[allocator.ClusterClassAnnotation()]
+	}
+	if strings.TrimSpace(classValue) == "" {
+		return nil, nil
+	}
+
+	classes := &clusterv1.ClusterClassList{}
+	if err := v.Client.List(ctx, classes); err != nil {
+		return nil, fmt.Errorf("list ClusterClasses: %w", err)
+	}
+
+	existing := make(map[string]bool, len(classes.Items))
+	for _, class := range classes.Items {
+		existing[class.Name] = true
+	}
+
+	var warnings []string
+	for _, name := range strings.Split(classValue, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !existing[name] {
+			warnings = append(warnings, fmt.Sprintf("ClusterClass %q referenced by %s does not exist", name, allocator.ClusterClassLabel()))
+		}
+	}
+	return warnings, nil
+}
@@ -0,0 +1,131 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/gorizond/capi-vip-allocator/internal/fixtures"
+	"github.com/gorizond/capi-vip-allocator/pkg/allocator"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestPoolValidator(t *testing.T) {
+	scheme := fixtures.NewScheme(t)
+
+	existing := newPool("existing", map[string]string{allocator.ClusterClassLabel(): "prod", allocator.RoleLabel(): "control-plane"}, nil, "10.0.0.0/28")
+	class := &clusterv1.ClusterClass{ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: "default"}}
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(existing, class).Build()
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		pool        *unstructured.Unstructured
+		warnOnly    bool
+		allowed     bool
+		wantMessage string
+		wantWarning string
+	}{
+		{
+			name:    "non VIP pool is ignored",
+			pool:    newPool("plain", nil, nil, "10.0.0.1"),
+			allowed: true,
+		},
+		{
+			name:    "valid pool",
+			pool:    newPool("valid", map[string]string{allocator.ClusterClassLabel(): "prod", allocator.RoleLabel(): "ingress"}, nil, "10.0.1.1-10.0.1.9"),
+			allowed: true,
+		},
+		{
+			name:        "unknown ClusterClass warns",
+			pool:        newPool("unknown-class", map[string]string{allocator.ClusterClassLabel(): "staging", allocator.RoleLabel(): "ingress"}, nil, "10.0.2.1"),
+			allowed:     true,
+			wantWarning: `ClusterClass "staging"`,
+		},
+		{
+			name:        "true label without annotation",
+			pool:        newPool("no-annotation", map[string]string{allocator.ClusterClassLabel(): "true", allocator.RoleLabel(): "control-plane"}, nil, "10.0.3.1"),
+			wantMessage: "requires a non-empty " + allocator.ClusterClassAnnotation(),
+		},
+		{
+			name: "annotation with empty entry",
+			pool: newPool("empty-entry", map[string]string{allocator.ClusterClassLabel(): "true", allocator.RoleLabel(): "control-plane"},
+				map[string]string{allocator.ClusterClassAnnotation(): "prod,,Prod_Class"}, "10.0.3.1"),
+			wantMessage: "empty entry",
+		},
+		{
+			name:        "typo in role",
+			pool:        newPool("bad-role", map[string]string{allocator.ClusterClassLabel(): "prod", allocator.RoleLabel(): "controlplane"}, nil, "10.0.4.1"),
+			wantMessage: `"controlplane" must be one of`,
+		},
+		{
+			name:        "role without class",
+			pool:        newPool("no-class", map[string]string{allocator.RoleLabel(): "ingress"}, nil, "10.0.4.2"),
+			wantMessage: "label " + allocator.ClusterClassLabel() + " is required",
+		},
+		{
+			name:        "overlapping range",
+			pool:        newPool("overlap", map[string]string{allocator.ClusterClassLabel(): "prod", allocator.RoleLabel(): "ingress"}, nil, "10.0.0.10-10.0.0.20"),
+			wantMessage: "overlaps 10.0.0.0/28 of VIP pool existing",
+		},
+		{
+			name:        "warn-only mode allows overlapping range",
+			pool:        newPool("overlap", map[string]string{allocator.ClusterClassLabel(): "prod", allocator.RoleLabel(): "ingress"}, nil, "10.0.0.15"),
+			warnOnly:    true,
+			allowed:     true,
+			wantWarning: "overlaps",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := &PoolValidator{Client: client, Logger: testr.New(t), WarnOnly: tt.warnOnly}
+			response := validator.Handle(ctx, newPoolRequest(t, tt.pool))
+
+			if response.Allowed != tt.allowed {
+				t.Fatalf("expected allowed=%v, got %v (%v)", tt.allowed, response.Allowed, response.Result)
+			}
+			if tt.wantMessage != "" && !strings.Contains(response.Result.Message, tt.wantMessage) {
+				t.Fatalf("expected message containing %q, got %q", tt.wantMessage, response.Result.Message)
+			}
+			if tt.wantWarning != "" && !strings.Contains(strings.Join(response.Warnings, "\n"), tt.wantWarning) {
+				t.Fatalf("expected warning containing %q, got %v", tt.wantWarning, response.Warnings)
+			}
+		})
+	}
+}
+
+func newPool(name string, poolLabels, annotations map[string]string, addresses ...string) *unstructured.Unstructured {
+	pool := &unstructured.Unstructured{}
+	pool.SetGroupVersionKind(schema.GroupVersionKind{Group: allocator.IPAMGroup, Version: allocator.GlobalPoolAPIVersion, Kind: allocator.GlobalPoolKind})
+	pool.SetName(name)
+	pool.SetLabels(poolLabels)
+	pool.SetAnnotations(annotations)
+	if err := unstructured.SetNestedStringSlice(pool.Object, addresses, "spec", "addresses"); err != nil {
+		panic(err)
+	}
+	return pool
+}
+
+func newPoolRequest(t *testing.T, pool *unstructured.Unstructured) admission.Request {
+	t.Helper()
+	raw, err := json.Marshal(pool.Object)
+	if err != nil {
+		t.Fatalf("marshal pool: %v", err)
+	}
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		Name:      pool.GetName(),
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+}